@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"crypto-exchange-go/internal/addresses"
 	"crypto-exchange-go/internal/config"
 	"crypto-exchange-go/internal/database"
 	"crypto-exchange-go/internal/handlers"
@@ -11,8 +12,11 @@ import (
 	"crypto-exchange-go/internal/handlers/finance"
 	"crypto-exchange-go/internal/handlers/system"
 	"crypto-exchange-go/internal/handlers/user"
+	"crypto-exchange-go/internal/mail"
 	"crypto-exchange-go/internal/middleware"
+	"crypto-exchange-go/internal/payments"
 	"crypto-exchange-go/internal/services"
+	"crypto-exchange-go/internal/signer"
 	"crypto-exchange-go/internal/utils"
 	"crypto-exchange-go/pkg/logger"
 	"fmt"
@@ -57,26 +61,39 @@ func main() {
 		log.Fatalf("Failed to initialize matching engine: %v", err)
 	}
 
+	walletService := services.NewWalletService(mysql, redis, log)
+
 	icoService := services.NewIcoService(mysql, log)
 	futuresService := services.NewFuturesService(mysql, log)
 	ecosystemService := services.NewEcosystemService(mysql, log)
 	ecommerceService := services.NewEcommerceService(mysql, log)
 	affiliateService := services.NewAffiliateService(mysql, log)
-	p2pService := services.NewP2pService(mysql, log)
-	stakingService := services.NewStakingService(mysql, log)
+	p2pService := services.NewP2pService(mysql, walletService, log)
+	stakingService := services.NewStakingService(mysql, walletService, log)
 	mailwizardService := services.NewMailwizardService(mysql, log)
 	aiService := services.NewAiService(mysql, log)
 	forexService := services.NewForexService(mysql, log)
 	
-	walletService := services.NewWalletService(mysql, log)
 	orderService := services.NewOrderService(mysql, scyllaDB, redis, matchingEngine, log)
 	transactionService := services.NewTransactionService(mysql, log)
 	userService := services.NewUserService(mysql, log)
 	kycService := services.NewKYCService(mysql, log)
 	notificationService := services.NewNotificationService(mysql, log)
 	supportService := services.NewSupportService(mysql, log)
-	depositService := services.NewDepositService(mysql, walletService, log)
-	withdrawalService := services.NewWithdrawalService(mysql, walletService, log)
+	providers, err := paymentProviders(cfg.Payments)
+	if err != nil {
+		log.Fatalf("Failed to configure payment providers: %v", err)
+	}
+	depositService := services.NewDepositService(mysql, walletService, providers, log)
+	destinationValidator := services.NewDestinationValidator(mysql, addresses.Default())
+	addressBookService := services.NewAddressBookService(mysql, destinationValidator, mailSender(cfg.Mail, log), notificationService, cfg.Withdrawal, cfg.Mail.SiteURL, log)
+	valuationService := services.NewValuationService(mysql, matchingEngine, cfg.Valuation, log)
+	withdrawalService := services.NewWithdrawalService(mysql, walletService, kycService, valuationService, destinationValidator, addressBookService,
+		services.NewStaticFeeEstimator(cfg.Withdrawal.NetworkFees), cfg.Withdrawal, log)
+	withdrawalBatchService := services.NewWithdrawalBatchService(mysql, signer.NewClient(cfg.Signer.URL, cfg.Signer.Token), withdrawalService, log)
+	reservesService := services.NewReservesService(mysql, log)
+	exportService := services.NewExportService(mysql, log)
+	transferService := services.NewTransferService(mysql, walletService, userService, notificationService, cfg.Transfer, log)
 	marketService := services.NewMarketService(mysql, scyllaDB, redis, log)
 	blogService := services.NewBlogService(mysql, log)
 	databaseService := services.NewDatabaseService(mysql, log)
@@ -91,10 +108,13 @@ func main() {
 	router.Use(middleware.Logger(log))
 	router.Use(middleware.RateLimit(cfg.RateLimit))
 
-	hub := handlers.NewWebSocketHub(log)
-	go hub.Run()
+	idempotent := middleware.Idempotency(middleware.NewIdempotencyStore(redis, mysql))
+	permissions := middleware.NewPermissionStore(mysql)
 
-	orderHandler := handlers.GetOrderHandler(orderService, walletService, hub, log)
+	wsBroker := handlers.NewWebSocketBroker(redis, log)
+
+	orderHandler := handlers.GetOrderHandler(orderService, walletService, wsBroker, log)
+	go handlers.NewOrderRequestWorker(orderService, redis, log).Run(context.Background())
 
 	cronManager := utils.NewCronManager(icoService, stakingService, aiService, forexService, affiliateService, log)
 	go cronManager.StartCronJobs(context.Background())
@@ -110,11 +130,19 @@ func main() {
 	mailwizardHandler := admin.NewMailwizardHandler(mailwizardService, log)
 	aiHandler := admin.NewAiHandler(aiService, log)
 	forexHandler := admin.NewForexHandler(forexService, log)
+	reservesHandler := admin.NewReservesHandler(reservesService, log)
+	withdrawalHandler := admin.NewWithdrawalHandler(withdrawalService, log)
+	withdrawalBatchHandler := admin.NewWithdrawalBatchHandler(withdrawalBatchService, log)
 
 	financeWalletHandler := finance.NewWalletHandler(walletService, log)
 	financeTransactionHandler := finance.NewTransactionHandler(transactionService, log)
 	financeDepositHandler := finance.NewDepositHandler(depositService, log)
 	financeWithdrawalHandler := finance.NewWithdrawalHandler(withdrawalService, log)
+	financeAddressBookHandler := finance.NewAddressBookHandler(addressBookService, log)
+	financeTransferHandler := finance.NewTransferHandler(transferService, log)
+	financePortfolioHandler := finance.NewPortfolioHandler(valuationService, log)
+	financeReservesHandler := finance.NewReservesHandler(reservesService, log)
+	financeExportHandler := finance.NewExportHandler(exportService, log)
 	
 	userProfileHandler := user.NewProfileHandler(userService, log)
 	userKYCHandler := user.NewKYCHandler(kycService, log)
@@ -134,7 +162,7 @@ func main() {
 		{
 			exchangeRoutes := auth.Group("/exchange")
 			{
-				exchangeRoutes.POST("/order", adminHandlers.CreateOrder)
+				exchangeRoutes.POST("/order", idempotent, adminHandlers.CreateOrder)
 				exchangeRoutes.GET("/order", adminHandlers.GetOrders)
 				exchangeRoutes.GET("/order/:id", adminHandlers.GetOrder)
 				exchangeRoutes.DELETE("/order/:id", adminHandlers.CancelOrder)
@@ -146,7 +174,7 @@ func main() {
 				exchangeRoutes.GET("/orderbook/:symbol", exchangeMarketHandler.GetOrderBook)
 				exchangeRoutes.GET("/trades/:symbol", exchangeMarketHandler.GetTrades)
 				exchangeRoutes.GET("/chart/:symbol", exchangeMarketHandler.GetChartData)
-				exchangeRoutes.POST("/order", exchangeOrderHandler.CreateOrder)
+				exchangeRoutes.POST("/order", idempotent, exchangeOrderHandler.CreateOrder)
 				exchangeRoutes.GET("/order", exchangeOrderHandler.GetOrders)
 				exchangeRoutes.GET("/order/:id", exchangeOrderHandler.GetOrder)
 				exchangeRoutes.DELETE("/order/:id", exchangeOrderHandler.CancelOrder)
@@ -155,19 +183,34 @@ func main() {
 			finance := auth.Group("/finance")
 			{
 				finance.GET("/wallet", financeWalletHandler.GetWallets)
+				finance.GET("/portfolio", financePortfolioHandler.GetPortfolio)
+				finance.GET("/proof-of-reserves", financeReservesHandler.GetProof)
+				finance.GET("/wallet/balance-changes", financeWalletHandler.GetBalanceChanges)
 				finance.GET("/wallet/:type/:currency", financeWalletHandler.GetWallet)
+				finance.GET("/wallet/:type/:currency/ledger", financeWalletHandler.GetWalletLedger)
 				finance.GET("/transaction", financeTransactionHandler.GetTransactions)
 				finance.GET("/transaction/:id", financeTransactionHandler.GetTransaction)
 				finance.POST("/transaction/analysis", financeTransactionHandler.AnalyzeTransactions)
-				finance.POST("/deposit/fiat", financeDepositHandler.CreateFiatDeposit)
-				finance.POST("/deposit/spot", financeDepositHandler.CreateSpotDeposit)
-				finance.POST("/deposit/fiat/stripe/verify", financeDepositHandler.VerifyStripeDeposit)
-				finance.POST("/deposit/fiat/paypal/verify", financeDepositHandler.VerifyPayPalDeposit)
+				finance.GET("/export/:dataset", financeExportHandler.Export)
+				finance.POST("/deposit/fiat", idempotent, financeDepositHandler.CreateFiatDeposit)
+				finance.POST("/deposit/spot", idempotent, financeDepositHandler.CreateSpotDeposit)
+				finance.POST("/deposit/fiat/stripe/verify", idempotent, financeDepositHandler.VerifyStripeDeposit)
+				finance.POST("/deposit/fiat/paypal/verify", idempotent, financeDepositHandler.VerifyPayPalDeposit)
 				finance.GET("/deposit/address/:currency", financeDepositHandler.GetDepositAddress)
-				finance.POST("/withdraw/fiat", financeWithdrawalHandler.CreateFiatWithdrawal)
-				finance.POST("/withdraw/spot", financeWithdrawalHandler.CreateSpotWithdrawal)
+				finance.POST("/withdraw/fiat", idempotent, financeWithdrawalHandler.CreateFiatWithdrawal)
+				finance.POST("/withdraw/spot", idempotent, financeWithdrawalHandler.CreateSpotWithdrawal)
 				finance.GET("/withdraw", financeWithdrawalHandler.GetWithdrawals)
-				finance.DELETE("/withdraw/:id", financeWithdrawalHandler.CancelWithdrawal)
+				finance.GET("/withdraw/limits", financeWithdrawalHandler.GetLimits)
+				finance.DELETE("/withdraw/:id", idempotent, financeWithdrawalHandler.CancelWithdrawal)
+				finance.GET("/withdraw/address", financeAddressBookHandler.GetAddresses)
+				finance.POST("/withdraw/address", financeAddressBookHandler.AddAddress)
+				finance.PUT("/withdraw/address/:id", financeAddressBookHandler.UpdateAddress)
+				finance.DELETE("/withdraw/address/:id", financeAddressBookHandler.DeleteAddress)
+				finance.GET("/withdraw/whitelist", financeAddressBookHandler.GetWhitelist)
+				finance.PUT("/withdraw/whitelist", financeAddressBookHandler.UpdateWhitelist)
+				finance.POST("/transfer", idempotent, financeTransferHandler.CreateTransfer)
+				finance.POST("/transfer/user/preview", financeTransferHandler.PreviewUserTransfer)
+				finance.POST("/transfer/user", idempotent, financeTransferHandler.CreateUserTransfer)
 			}
 
 			userRoutes := auth.Group("/user")
@@ -199,6 +242,10 @@ func main() {
 			public.GET("/exchange/market", adminHandlers.GetMarkets)
 			public.GET("/exchange/ticker", adminHandlers.GetTickers)
 			public.GET("/exchange/ticker/:symbol", adminHandlers.GetTicker)
+			public.GET("/finance/proof-of-reserves/root", financeReservesHandler.GetRoot)
+			public.POST("/finance/deposit/webhook/:provider", financeDepositHandler.PaymentWebhook)
+			public.POST("/finance/withdraw/address/confirm", financeAddressBookHandler.ConfirmAddress)
+			public.POST("/finance/withdraw/whitelist/confirm", financeAddressBookHandler.ConfirmWhitelistDisable)
 		}
 		
 		admin := auth.Group("/admin/ext")
@@ -269,8 +316,8 @@ func main() {
 				affiliate.GET("/referral", affiliateHandler.GetReferrals)
 				affiliate.PUT("/referral/:id/status", affiliateHandler.UpdateReferralStatus)
 				affiliate.GET("/reward", affiliateHandler.GetRewards)
-				affiliate.POST("/reward", affiliateHandler.CreateReward)
-				affiliate.PUT("/reward/:id/status", affiliateHandler.UpdateRewardStatus)
+				affiliate.POST("/reward", idempotent, affiliateHandler.CreateReward)
+				affiliate.PUT("/reward/:id/status", idempotent, affiliateHandler.UpdateRewardStatus)
 			}
 			
 			p2p := admin.Group("/p2p")
@@ -296,7 +343,7 @@ func main() {
 				staking.POST("/duration", stakingHandler.CreateDuration)
 				staking.GET("/stake", stakingHandler.GetStakes)
 				staking.GET("/stake/:id", stakingHandler.GetStake)
-				staking.PUT("/stake/:id/release", stakingHandler.ReleaseStake)
+				staking.PUT("/stake/:id/release", idempotent, stakingHandler.ReleaseStake)
 			}
 			
 			mailwizard := admin.Group("/mailwizard")
@@ -347,6 +394,33 @@ func main() {
 				forex.GET("/signal", forexHandler.GetSignals)
 				forex.POST("/signal", forexHandler.CreateSignal)
 			}
+
+			reserves := admin.Group("/reserves")
+			{
+				reserves.GET("/snapshot", financeReservesHandler.GetRoot)
+				reserves.POST("/snapshot", middleware.RequirePermission(permissions, "Access Wallet Management"), reservesHandler.CreateSnapshot)
+			}
+
+			withdrawal := admin.Group("/withdrawal", middleware.RequirePermission(permissions, "Access Transaction Management"))
+			{
+				withdrawal.GET("", withdrawalHandler.GetQueue)
+				withdrawal.GET("/:id", withdrawalHandler.GetWithdrawal)
+				withdrawal.POST("/:id/approve", withdrawalHandler.Approve)
+				withdrawal.POST("/:id/reject", withdrawalHandler.Reject)
+				withdrawal.POST("/:id/broadcast", withdrawalHandler.MarkBroadcast)
+				withdrawal.POST("/:id/confirm", withdrawalHandler.Confirm)
+				withdrawal.POST("/:id/fail", withdrawalHandler.Fail)
+			}
+
+			withdrawalBatch := admin.Group("/withdrawal-batch", middleware.RequirePermission(permissions, "Access Transaction Management"))
+			{
+				withdrawalBatch.GET("", withdrawalBatchHandler.GetBatches)
+				withdrawalBatch.POST("/:id/sign", withdrawalBatchHandler.Sign)
+				withdrawalBatch.POST("/:id/abandon", withdrawalBatchHandler.Abandon)
+				withdrawalBatch.POST("/:id/broadcast", withdrawalBatchHandler.MarkBroadcast)
+				withdrawalBatch.POST("/:id/confirm", withdrawalBatchHandler.Confirm)
+				withdrawalBatch.POST("/:id/fail", withdrawalBatchHandler.Fail)
+			}
 		}
 
 		contentRoutes := api.Group("/content")
@@ -369,12 +443,10 @@ func main() {
 		}
 	}
 
-	router.GET("/api/exchange/order", adminHandlers.HandleOrderWebSocket(hub))
-	router.GET("/api/exchange/market", adminHandlers.HandleMarketWebSocket(hub))
-
 	srv := &http.Server{
-		Addr:    fmt.Sprintf(":%d", cfg.Port),
-		Handler: router,
+		Addr:         fmt.Sprintf(":%d", cfg.Port),
+		Handler:      router,
+		WriteTimeout: middleware.ServerWriteTimeout,
 	}
 
 	go func() {
@@ -399,3 +471,44 @@ func main() {
 
 	log.Info("Server exited")
 }
+
+// paymentProviders enables the fiat deposit providers that have credentials.
+// A provider with credentials but no way to authenticate its webhooks is an
+// error rather than silently enabled.
+func paymentProviders(cfg config.Payments) (payments.Registry, error) {
+	var providers []payments.PaymentProvider
+	if cfg.Stripe.SecretKey != "" {
+		stripe, err := payments.NewStripe(payments.StripeOptions{
+			SecretKey:     cfg.Stripe.SecretKey,
+			WebhookSecret: cfg.Stripe.WebhookSecret,
+		})
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, stripe)
+	}
+	if cfg.PayPal.ClientID != "" {
+		providers = append(providers, payments.NewPayPal(payments.PayPalOptions{
+			ClientID:     cfg.PayPal.ClientID,
+			ClientSecret: cfg.PayPal.ClientSecret,
+			WebhookID:    cfg.PayPal.WebhookID,
+			Sandbox:      cfg.PayPal.Sandbox,
+		}))
+	}
+	return payments.NewRegistry(providers...), nil
+}
+
+// mailSender sends through SMTP when a host is configured and logs emails
+// otherwise.
+func mailSender(cfg config.Mail, log *logrus.Logger) mail.Sender {
+	if cfg.Host == "" {
+		return mail.NewLogSender(log)
+	}
+	return mail.NewSMTPSender(mail.SMTPOptions{
+		Host:     cfg.Host,
+		Port:     cfg.Port,
+		Username: cfg.Username,
+		Password: cfg.Password,
+		From:     cfg.From,
+	})
+}
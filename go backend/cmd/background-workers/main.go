@@ -2,11 +2,17 @@ package main
 
 import (
 	"context"
+	"crypto-exchange-go/internal/chainwatch"
 	"crypto-exchange-go/internal/config"
 	"crypto-exchange-go/internal/database"
+	"crypto-exchange-go/internal/services"
+	"crypto-exchange-go/internal/utxo"
 	"crypto-exchange-go/pkg/logger"
+	"errors"
+	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -42,9 +48,28 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	notificationService := services.NewNotificationService(mysql, log)
+	reconciliationService := services.NewReconciliationService(mysql, notificationService, cfg.Reconciliation, log)
+	walletService := services.NewWalletService(mysql, redisClient, log)
+	chainDepositService := services.NewChainDepositService(mysql, walletService, cfg.ChainWatch, log)
+	valuationService := services.NewValuationService(mysql, services.NewMarketService(mysql, scyllaDB, redisClient, log), cfg.Valuation, log)
+
+	scanners, err := chainScanners(cfg.ChainWatch, chainDepositService, log)
+	if err != nil {
+		log.Fatalf("Failed to configure chain watcher: %v", err)
+	}
+
+	batchers, err := withdrawalBatchers(cfg.Batching, services.NewWithdrawalBatchService(mysql, nil, nil, log), log)
+	if err != nil {
+		log.Fatalf("Failed to configure withdrawal batching: %v", err)
+	}
+
 	go startPriceUpdateWorker(ctx, log, mysql, scyllaDB, redisClient)
-	go startWalletMonitorWorker(ctx, log, mysql)
+	go startWalletMonitorWorker(ctx, log, reconciliationService, cfg.Reconciliation)
+	go startBalanceSnapshotWorker(ctx, log, valuationService)
 	go startDatabaseCleanupWorker(ctx, log, mysql, scyllaDB)
+	go startChainWatchWorker(ctx, log, scanners, cfg.ChainWatch)
+	go startWithdrawalBatchWorker(ctx, log, batchers, cfg.Batching)
 
 	log.Info("Background workers started successfully")
 
@@ -70,16 +95,48 @@ func startPriceUpdateWorker(ctx context.Context, log *logrus.Logger, mysql *data
 	}
 }
 
-func startWalletMonitorWorker(ctx context.Context, log *logrus.Logger, mysql *database.MySQL) {
-	ticker := time.NewTicker(5 * time.Minute)
-	defer ticker.Stop()
+func startWalletMonitorWorker(ctx context.Context, log *logrus.Logger, reconciliationService *services.ReconciliationService, cfg config.Reconciliation) {
+	for {
+		timer := time.NewTimer(time.Until(services.NextDailyRun(time.Now(), cfg.RunHour)))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			log.Info("Running wallet reconciliation")
+
+			report, err := reconciliationService.Run(ctx)
+			if err != nil {
+				log.WithError(err).Error("Wallet reconciliation failed")
+				continue
+			}
+
+			log.WithFields(logrus.Fields{
+				"reportId":      report.ID,
+				"wallets":       report.WalletsChecked,
+				"discrepancies": len(report.Discrepancies),
+				"frozenWallets": len(report.FrozenWallets),
+			}).Info("Wallet reconciliation finished")
+		}
+	}
+}
 
+func startBalanceSnapshotWorker(ctx context.Context, log *logrus.Logger, valuationService *services.ValuationService) {
 	for {
+		timer := time.NewTimer(time.Until(services.NextDailyRun(time.Now(), 0)))
+
 		select {
 		case <-ctx.Done():
+			timer.Stop()
 			return
-		case <-ticker.C:
-			log.Debug("Running wallet monitor worker")
+		case <-timer.C:
+			count, err := valuationService.Snapshot(ctx, time.Now())
+			if err != nil {
+				log.WithError(err).Error("Failed to snapshot wallet balances")
+				continue
+			}
+			log.WithField("wallets", count).Info("Snapshotted wallet balances")
 		}
 	}
 }
@@ -97,3 +154,116 @@ func startDatabaseCleanupWorker(ctx context.Context, log *logrus.Logger, mysql *
 		}
 	}
 }
+
+func chainScanners(cfg config.ChainWatch, sink chainwatch.Sink, log *logrus.Logger) ([]*chainwatch.Scanner, error) {
+	var scanners []*chainwatch.Scanner
+	for name, chain := range cfg.Chains {
+		// Viper lowercases map keys; networks are stored in upper case.
+		name = strings.ToUpper(name)
+		currency := strings.ToUpper(chain.Currency)
+		if currency == "" {
+			currency = name
+		}
+
+		var watcher chainwatch.ChainWatcher
+		switch strings.ToLower(chain.Type) {
+		case "evm":
+			tokens := make([]chainwatch.Token, 0, len(chain.Tokens))
+			for _, token := range chain.Tokens {
+				tokens = append(tokens, chainwatch.Token{
+					Currency: strings.ToUpper(token.Currency),
+					Contract: token.Contract,
+					Decimals: token.Decimals,
+				})
+			}
+			watcher = chainwatch.NewEVMWatcher(chainwatch.EVMOptions{
+				Chain:    name,
+				RPCURL:   chain.RPCURL,
+				Currency: currency,
+				Tokens:   tokens,
+			})
+		case "utxo":
+			watcher = chainwatch.NewUTXOWatcher(chainwatch.UTXOOptions{
+				Chain:    name,
+				RPCURL:   chain.RPCURL,
+				Currency: currency,
+			})
+		default:
+			return nil, fmt.Errorf("chain %s: unknown type %q", name, chain.Type)
+		}
+
+		scanners = append(scanners, chainwatch.NewScanner(watcher, sink, chainwatch.ScannerOptions{
+			StartBlock:    chain.StartBlock,
+			MaxReorgDepth: uint64(cfg.MaxReorgDepth),
+		}, log))
+	}
+	return scanners, nil
+}
+
+func startChainWatchWorker(ctx context.Context, log *logrus.Logger, scanners []*chainwatch.Scanner, cfg config.ChainWatch) {
+	if len(scanners) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(cfg.PollSeconds) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, scanner := range scanners {
+				if err := scanner.Scan(ctx); err != nil {
+					log.WithError(err).WithField("chain", scanner.Chain()).Error("Chain scan failed")
+				}
+			}
+		}
+	}
+}
+
+func withdrawalBatchers(cfg config.Batching, ledger utxo.Ledger, log *logrus.Logger) ([]*utxo.Batcher, error) {
+	var batchers []*utxo.Batcher
+	for name, batched := range cfg.Chains {
+		chain, ok := utxo.ChainByName(name)
+		if !ok {
+			return nil, fmt.Errorf("chain %s: not a supported UTXO chain", strings.ToUpper(name))
+		}
+		if batched.FeeRate <= 0 {
+			return nil, fmt.Errorf("chain %s: fee_rate must be positive", chain.Name)
+		}
+
+		batchers = append(batchers, utxo.NewBatcher(chain, ledger, utxo.BatcherOptions{
+			FeeRate:    batched.FeeRate,
+			MaxOutputs: batched.MaxOutputs,
+		}, log))
+	}
+	return batchers, nil
+}
+
+func startWithdrawalBatchWorker(ctx context.Context, log *logrus.Logger, batchers []*utxo.Batcher, cfg config.Batching) {
+	if len(batchers) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(cfg.IntervalSeconds) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, batcher := range batchers {
+				_, err := batcher.Run(ctx)
+				if errors.Is(err, utxo.ErrInsufficientFunds) {
+					log.WithField("chain", batcher.Chain()).Warn("Not enough unspent coins to batch withdrawals")
+					continue
+				}
+				if err != nil {
+					log.WithError(err).WithField("chain", batcher.Chain()).Error("Withdrawal batching failed")
+				}
+			}
+		}
+	}
+}
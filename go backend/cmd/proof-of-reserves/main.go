@@ -0,0 +1,43 @@
+// Command proof-of-reserves snapshots current liabilities into a new
+// proof-of-reserves tree and prints the root and totals to publish.
+package main
+
+import (
+	"context"
+	"crypto-exchange-go/internal/config"
+	"crypto-exchange-go/internal/database"
+	"crypto-exchange-go/internal/services"
+	"crypto-exchange-go/pkg/logger"
+	"encoding/json"
+	"os"
+
+	"github.com/sirupsen/logrus"
+)
+
+func main() {
+	cfg, err := config.Load()
+	if err != nil {
+		logrus.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	log := logger.New(cfg.LogLevel)
+
+	mysql, err := database.NewMySQL(cfg.MySQL)
+	if err != nil {
+		log.Fatalf("Failed to connect to MySQL: %v", err)
+	}
+	defer mysql.Close()
+
+	reservesService := services.NewReservesService(mysql, log)
+
+	snapshot, err := reservesService.CreateSnapshot(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to create reserve snapshot: %v", err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(snapshot); err != nil {
+		log.Fatalf("Failed to write reserve snapshot: %v", err)
+	}
+}
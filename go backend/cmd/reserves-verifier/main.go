@@ -0,0 +1,66 @@
+// Command reserves-verifier checks a proof downloaded from
+// GET /finance/proof-of-reserves without talking to the exchange. Compare the
+// printed root with the one the exchange published before trusting the
+// result.
+//
+//	reserves-verifier -proof proof.json [-root <published root hash>]
+package main
+
+import (
+	"crypto-exchange-go/internal/reserves"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+type proofFile struct {
+	Snapshot struct {
+		RootHash string            `json:"rootHash"`
+		Totals   reserves.Balances `json:"totals"`
+	} `json:"snapshot"`
+	Proof *reserves.Proof `json:"proof"`
+}
+
+func main() {
+	proofPath := flag.String("proof", "proof.json", "proof downloaded from the exchange")
+	root := flag.String("root", "", "published root hash; defaults to the one in the proof file")
+	flag.Parse()
+
+	data, err := os.ReadFile(*proofPath)
+	if err != nil {
+		fail("failed to read proof: %v", err)
+	}
+
+	// Accept the API response as-is or just its data field.
+	var wrapped struct {
+		Data *proofFile `json:"data"`
+	}
+	file := &proofFile{}
+	if err := json.Unmarshal(data, &wrapped); err == nil && wrapped.Data != nil {
+		file = wrapped.Data
+	} else if err := json.Unmarshal(data, file); err != nil {
+		fail("failed to parse proof: %v", err)
+	}
+	if file.Proof == nil {
+		fail("proof file has no proof")
+	}
+
+	rootHash := file.Snapshot.RootHash
+	if *root != "" {
+		rootHash = *root
+	}
+
+	if err := reserves.Verify(file.Proof, rootHash, file.Snapshot.Totals); err != nil {
+		fail("verification failed: %v", err)
+	}
+
+	fmt.Printf("OK: your balances are included in root %s\n", rootHash)
+	fmt.Printf("Your balances: %s\n", file.Proof.Balances.Encode())
+	fmt.Printf("Total liabilities: %s\n", file.Snapshot.Totals.Encode())
+}
+
+func fail(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
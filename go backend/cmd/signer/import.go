@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto-exchange-go/internal/config"
+	"crypto-exchange-go/internal/database"
+	"crypto-exchange-go/internal/hdwallet"
+	"crypto-exchange-go/internal/signer"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Deposit addresses handed out after the import need keys too. This many
+// beyond a master wallet's lastIndex are imported; past that, add keys with
+// signer import.
+const depositLookahead = 100
+
+type custodialWalletKey struct {
+	ID         string `db:"id"`
+	Chain      string `db:"chain"`
+	Address    string `db:"address"`
+	PrivateKey string `db:"privateKey"`
+}
+
+type masterWalletKey struct {
+	ID        string         `db:"id"`
+	Chain     string         `db:"chain"`
+	Address   string         `db:"address"`
+	PublicKey sql.NullString `db:"publicKey"`
+	LastIndex uint32         `db:"lastIndex"`
+	Mnemonic  string         `db:"mnemonic"`
+}
+
+// importEcosystem moves the keys the ecosystem wallet tables still hold in
+// plaintext into the keystore, then clears them from MySQL. Each key is
+// checked against the address stored with it first; wallets that don't
+// match are reported and left alone. It is safe to run again.
+func importEcosystem(cfg *config.Config, keystore *signer.Keystore) {
+	mysql, err := database.NewMySQL(cfg.MySQL)
+	if err != nil {
+		fail("failed to connect to MySQL: %v", err)
+	}
+	defer mysql.Close()
+	ctx := context.Background()
+
+	var custodial []custodialWalletKey
+	err = mysql.SelectContext(ctx, &custodial, `SELECT id, chain, address, privateKey FROM ecosystem_custodial_wallet
+			WHERE privateKey IS NOT NULL AND privateKey <> ''`)
+	if err != nil {
+		fail("failed to read custodial wallets: %v", err)
+	}
+
+	var masters []masterWalletKey
+	err = mysql.SelectContext(ctx, &masters, `SELECT id, chain, address, publicKey, lastIndex, mnemonic FROM ecosystem_master_wallet
+			WHERE mnemonic IS NOT NULL AND mnemonic <> ''`)
+	if err != nil {
+		fail("failed to read master wallets: %v", err)
+	}
+
+	failed := 0
+	for _, wallet := range custodial {
+		if err := importCustodialWallet(ctx, mysql, keystore, &wallet); err != nil {
+			fmt.Fprintf(os.Stderr, "custodial wallet %s: %v\n", wallet.ID, err)
+			failed++
+			continue
+		}
+		fmt.Printf("custodial wallet %s imported\n", wallet.ID)
+	}
+	for _, wallet := range masters {
+		if err := importMasterWallet(ctx, mysql, keystore, &wallet); err != nil {
+			fmt.Fprintf(os.Stderr, "master wallet %s: %v\n", wallet.ID, err)
+			failed++
+			continue
+		}
+		fmt.Printf("master wallet %s imported\n", wallet.ID)
+	}
+
+	if failed > 0 {
+		fail("%d wallets were not imported", failed)
+	}
+}
+
+func importCustodialWallet(ctx context.Context, mysql *database.MySQL, keystore *signer.Keystore, wallet *custodialWalletKey) error {
+	chain, ok := hdwallet.ChainFor(wallet.Chain)
+	if !ok {
+		return fmt.Errorf("unsupported chain %s", wallet.Chain)
+	}
+
+	key, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(wallet.PrivateKey), "0x"))
+	if err != nil {
+		return errors.New("private key must be hex encoded")
+	}
+	if err := checkAddress(chain, key, wallet.Address); err != nil {
+		return err
+	}
+
+	if err := addKey(keystore, "custodial-"+wallet.ID, key); err != nil {
+		return err
+	}
+
+	_, err = mysql.ExecContext(ctx, `UPDATE ecosystem_custodial_wallet SET privateKey = NULL, updatedAt = ? WHERE id = ?`,
+		time.Now(), wallet.ID)
+	if err != nil {
+		return fmt.Errorf("failed to clear private key: %w", err)
+	}
+	return nil
+}
+
+func importMasterWallet(ctx context.Context, mysql *database.MySQL, keystore *signer.Keystore, wallet *masterWalletKey) error {
+	chain, ok := hdwallet.ChainFor(wallet.Chain)
+	if !ok {
+		return fmt.Errorf("unsupported chain %s", wallet.Chain)
+	}
+
+	// Deposit addresses are derived from the xpub, so the mnemonic has to
+	// produce the same account.
+	var xpub *hdwallet.ExtendedKey
+	account := uint32(0)
+	if wallet.PublicKey.String != "" {
+		var err error
+		if xpub, err = hdwallet.ParseExtendedKey(wallet.PublicKey.String); err != nil {
+			return fmt.Errorf("invalid xpub: %w", err)
+		}
+		account = xpub.ChildNumber - hdwallet.HardenedOffset
+	}
+
+	accountKey, err := signer.MnemonicAccount(wallet.Mnemonic, chain.CoinType(), account)
+	if err != nil {
+		return err
+	}
+	if xpub != nil {
+		public, err := accountKey.PublicKey()
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(public.Compressed(), xpub.PublicKey.Compressed()) {
+			return errors.New("mnemonic doesn't match the wallet's xpub")
+		}
+	}
+
+	// Index 0 is the master wallet's own address.
+	for index := uint32(0); index <= wallet.LastIndex+depositLookahead; index++ {
+		key, err := accountKey.Key(index)
+		if errors.Is(err, hdwallet.ErrInvalidChild) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if index == 0 {
+			if err := checkAddress(chain, key, wallet.Address); err != nil {
+				return err
+			}
+		}
+		if err := addKey(keystore, fmt.Sprintf("master-%s-%d", wallet.ID, index), key); err != nil {
+			return err
+		}
+	}
+
+	_, err = mysql.ExecContext(ctx, `UPDATE ecosystem_master_wallet SET mnemonic = NULL, updatedAt = ? WHERE id = ?`,
+		time.Now(), wallet.ID)
+	if err != nil {
+		return fmt.Errorf("failed to clear mnemonic: %w", err)
+	}
+	return nil
+}
+
+func checkAddress(chain hdwallet.Chain, key []byte, address string) error {
+	public, err := hdwallet.PublicKeyFromPrivate(key)
+	if err != nil {
+		return err
+	}
+	derived, err := chain.Address(public)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(derived, address) {
+		return fmt.Errorf("key is for %s, not %s", derived, address)
+	}
+	return nil
+}
+
+// addKey adds key under id. An id that already holds the same key is fine,
+// so an interrupted import can be run again.
+func addKey(keystore *signer.Keystore, id string, key []byte) error {
+	_, err := keystore.Add(id, key)
+	if errors.Is(err, signer.ErrKeyExists) {
+		public, perr := hdwallet.PublicKeyFromPrivate(key)
+		if perr == nil && keystore.PublicKeys()[id] == hex.EncodeToString(public.Compressed()) {
+			return nil
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to add key %s: %w", id, err)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+// Command signer holds the custodial keys and signs withdrawal transactions
+// for the API, which never sees a private key. Run it on a separate host
+// where only the API can reach it. The keystore passphrase comes from
+// SIGNER_PASSPHRASE.
+//
+//	signer serve
+//	signer generate <key id>
+//	signer import <key id>    (reads a hex private key from stdin)
+//	signer keys
+//	signer import-ecosystem   (moves keys still in MySQL into the keystore)
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto-exchange-go/internal/config"
+	"crypto-exchange-go/internal/signer"
+	"crypto-exchange-go/pkg/logger"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		fail("usage: signer serve | generate <key id> | import <key id> | keys | import-ecosystem")
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		fail("failed to load configuration: %v", err)
+	}
+
+	keystore, err := signer.OpenKeystore(cfg.Signer.Keystore, os.Getenv("SIGNER_PASSPHRASE"))
+	if err != nil {
+		fail("failed to open keystore: %v", err)
+	}
+
+	switch os.Args[1] {
+	case "serve":
+		serve(cfg, keystore)
+	case "generate":
+		publicKey, err := keystore.Generate(keyID())
+		if err != nil {
+			fail("failed to generate key: %v", err)
+		}
+		fmt.Println(publicKey)
+	case "import":
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			fail("failed to read key: %v", err)
+		}
+		key, err := hex.DecodeString(strings.TrimSpace(line))
+		if err != nil {
+			fail("key must be hex encoded")
+		}
+		publicKey, err := keystore.Add(keyID(), key)
+		if err != nil {
+			fail("failed to import key: %v", err)
+		}
+		fmt.Println(publicKey)
+	case "import-ecosystem":
+		importEcosystem(cfg, keystore)
+	case "keys":
+		for id, publicKey := range keystore.PublicKeys() {
+			fmt.Printf("%s\t%s\n", id, publicKey)
+		}
+	default:
+		fail("unknown command %q", os.Args[1])
+	}
+}
+
+func keyID() string {
+	if len(os.Args) < 3 || os.Args[2] == "" {
+		fail("a key id is required")
+	}
+	return os.Args[2]
+}
+
+func serve(cfg *config.Config, keystore *signer.Keystore) {
+	log := logger.New(cfg.LogLevel)
+	if cfg.Signer.Token == "" {
+		log.Fatal("SIGNER_TOKEN must be set")
+	}
+
+	software, err := signer.NewSoftwareSigner(keystore, signer.NewPolicy(cfg.Signer.Policies), log)
+	if err != nil {
+		log.Fatalf("Failed to load keys: %v", err)
+	}
+
+	gin.SetMode(gin.ReleaseMode)
+	server := &http.Server{
+		Addr:    cfg.Signer.Listen,
+		Handler: signer.NewHandler(software, cfg.Signer.Token, log),
+	}
+
+	go func() {
+		log.Infof("Signer listening on %s with %d keys", cfg.Signer.Listen, len(keystore.PublicKeys()))
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Signer failed: %v", err)
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.WithError(err).Error("Signer shutdown failed")
+	}
+}
+
+func fail(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"crypto-exchange-go/internal/config"
+	"crypto-exchange-go/internal/database"
+	"crypto-exchange-go/internal/handlers"
+	"crypto-exchange-go/internal/middleware"
+	"crypto-exchange-go/internal/services"
+	"crypto-exchange-go/pkg/logger"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+func main() {
+	cfg, err := config.Load()
+	if err != nil {
+		logrus.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	log := logger.New(cfg.LogLevel)
+
+	redis, err := database.NewRedis(cfg.Redis)
+	if err != nil {
+		log.Fatalf("Failed to connect to Redis: %v", err)
+	}
+	defer redis.Close()
+
+	// MySQL is only used to check admin permissions.
+	mysql, err := database.NewMySQL(cfg.MySQL)
+	if err != nil {
+		log.Fatalf("Failed to connect to MySQL: %v", err)
+	}
+	defer mysql.Close()
+	permissions := middleware.NewPermissionStore(mysql)
+
+	presenceService := services.NewPresenceService(redis, log)
+
+	// The gateway only serves WebSockets. Order requests go through Redis to
+	// the API process, which owns the matching engine.
+	h := handlers.New(nil, nil, nil, nil, log)
+
+	hub := handlers.NewWebSocketHub(cfg.WebSocket, log)
+	gateway := handlers.NewWebSocketGateway(gatewayID(), hub, redis, presenceService, log)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go gateway.Run(ctx)
+
+	router := gin.New()
+	router.Use(gin.Recovery())
+	router.Use(middleware.CORS())
+	router.Use(middleware.Logger(log))
+
+	router.GET("/health", func(c *gin.Context) {
+		if !hub.Accepting() {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"status": "draining"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+
+	router.GET("/api/exchange/order", middleware.Auth(cfg.JWT), h.HandleOrderWebSocket(hub, gateway))
+	router.GET("/api/exchange/market", h.HandleMarketWebSocket(hub))
+	router.GET("/api/system/websocket/stats", middleware.Auth(cfg.JWT), middleware.RequirePermission(permissions, "Access Admin Dashboard"),
+		h.GetWebSocketStats(hub))
+
+	srv := &http.Server{
+		Addr:    fmt.Sprintf(":%d", cfg.WebSocket.Port),
+		Handler: router,
+	}
+
+	go func() {
+		log.Infof("WebSocket gateway starting on port %d", cfg.WebSocket.Port)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Failed to start WebSocket gateway: %v", err)
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+
+	log.Info("WebSocket gateway draining connections...")
+
+	drainCtx, drainCancel := context.WithTimeout(context.Background(), time.Duration(cfg.WebSocket.DrainSeconds)*time.Second)
+	defer drainCancel()
+
+	gateway.Shutdown(drainCtx)
+	cancel()
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer shutdownCancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Errorf("WebSocket gateway forced to shutdown: %v", err)
+	}
+
+	log.Info("WebSocket gateway exited")
+}
+
+func gatewayID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "ws-gateway"
+	}
+	return fmt.Sprintf("%s-%s", hostname, uuid.New().String()[:8])
+}
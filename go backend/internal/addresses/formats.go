@@ -0,0 +1,178 @@
+package addresses
+
+import (
+	"crypto-exchange-go/internal/hdwallet"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type formatFunc func(address string) error
+
+func (f formatFunc) Validate(address string) error {
+	return f(address)
+}
+
+// AnyOf accepts an address that any of formats accepts, for chains with
+// several address types.
+func AnyOf(formats ...Format) Format {
+	return formatFunc(func(address string) error {
+		var err error
+		for _, format := range formats {
+			if err = format.Validate(address); err == nil {
+				return nil
+			}
+		}
+		return err
+	})
+}
+
+// EVM accepts 0x-prefixed 20 byte hex addresses. Mixed case addresses must
+// carry a valid EIP-55 checksum; all lower or upper case ones have none to
+// check.
+func EVM() Format {
+	return formatFunc(func(address string) error {
+		if len(address) != 42 || !strings.HasPrefix(address, "0x") {
+			return errors.New("expected 0x followed by 40 hex digits")
+		}
+		raw, err := hex.DecodeString(address[2:])
+		if err != nil {
+			return errors.New("expected 0x followed by 40 hex digits")
+		}
+		if strings.Trim(address[2:], "0") == "" {
+			return errors.New("the zero address burns funds")
+		}
+
+		digits := address[2:]
+		if digits != strings.ToLower(digits) && digits != strings.ToUpper(digits) &&
+			hdwallet.ChecksumAddress(raw) != address {
+			return errors.New("EIP-55 checksum mismatch")
+		}
+		return nil
+	})
+}
+
+// Base58Check accepts base58check encoded 20 byte hashes behind one of the
+// given version bytes, as P2PKH and P2SH addresses and TRON addresses are.
+func Base58Check(versions ...byte) Format {
+	return formatFunc(func(address string) error {
+		payload, err := hdwallet.DecodeBase58Check(address)
+		if err != nil {
+			return err
+		}
+		return checkVersioned(payload, versions)
+	})
+}
+
+// Segwit accepts native segwit addresses with the given human readable part.
+func Segwit(hrp string) Format {
+	return formatFunc(func(address string) error {
+		_, _, err := hdwallet.DecodeSegwit(hrp, address)
+		return err
+	})
+}
+
+const (
+	bitcoinAlphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+	rippleAlphabet  = "rpshnaf39wBUDNEGHJKLM4PQRST7VWXYZ2bcdeCg65jkm8oFqi1tuvAxyz"
+)
+
+// Ripple accepts classic XRP Ledger addresses: base58check with Ripple's own
+// alphabet, so they are mapped onto Bitcoin's before decoding.
+func Ripple() Format {
+	return formatFunc(func(address string) error {
+		if !strings.HasPrefix(address, "r") {
+			return errors.New("expected an r address")
+		}
+		mapped := strings.Map(func(r rune) rune {
+			i := strings.IndexRune(rippleAlphabet, r)
+			if i < 0 {
+				return '0' // not in either alphabet, so decoding fails
+			}
+			return rune(bitcoinAlphabet[i])
+		}, address)
+
+		payload, err := hdwallet.DecodeBase58Check(mapped)
+		if err != nil {
+			return err
+		}
+		return checkVersioned(payload, []byte{0x00})
+	})
+}
+
+// Stellar accepts G account addresses (StrKey): base32 of a version byte, a
+// 32 byte key and a little endian CRC16-XModem checksum.
+func Stellar() Format {
+	const accountVersion = 6 << 3
+
+	return formatFunc(func(address string) error {
+		raw, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(address)
+		if err != nil || len(raw) != 35 {
+			return errors.New("expected a 56 character G address")
+		}
+		if raw[0] != accountVersion {
+			return errors.New("expected a G address")
+		}
+		if crc16XModem(raw[:33]) != binary.LittleEndian.Uint16(raw[33:]) {
+			return errors.New("checksum mismatch")
+		}
+		return nil
+	})
+}
+
+func checkVersioned(payload, versions []byte) error {
+	if len(payload) != 21 {
+		return fmt.Errorf("expected a 20 byte hash, got %d bytes", len(payload)-1)
+	}
+	for _, version := range versions {
+		if payload[0] == version {
+			return nil
+		}
+	}
+	return fmt.Errorf("unexpected version byte 0x%02x", payload[0])
+}
+
+func crc16XModem(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+type memoFunc func(memo string) error
+
+func (f memoFunc) Validate(memo string) error {
+	return f(memo)
+}
+
+// DestinationTag accepts XRP destination tags, unsigned 32-bit integers.
+func DestinationTag() MemoRule {
+	return memoFunc(func(memo string) error {
+		if _, err := strconv.ParseUint(memo, 10, 32); err != nil {
+			return errors.New("destination tag must be a number up to 4294967295")
+		}
+		return nil
+	})
+}
+
+// TextMemo accepts text memos of up to max bytes.
+func TextMemo(max int) MemoRule {
+	return memoFunc(func(memo string) error {
+		if len(memo) > max {
+			return fmt.Errorf("memo is longer than %d bytes", max)
+		}
+		return nil
+	})
+}
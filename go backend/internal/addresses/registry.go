@@ -0,0 +1,104 @@
+// Package addresses checks withdrawal destinations against the address
+// format of the network they are sent on, so typos are caught before funds
+// leave.
+package addresses
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrUnsupportedNetwork = errors.New("unsupported network")
+	ErrInvalidAddress     = errors.New("invalid address")
+	ErrMemoRequired       = errors.New("a memo or destination tag is required on this network")
+	ErrInvalidMemo        = errors.New("invalid memo")
+)
+
+// Format validates an address string.
+type Format interface {
+	Validate(address string) error
+}
+
+// MemoRule validates the memo or tag that networks with shared deposit
+// addresses use to tell recipients apart.
+type MemoRule interface {
+	Validate(memo string) error
+}
+
+// Network is one blockchain withdrawals can be sent on. Native is its own
+// coin, which can always be withdrawn on it. Memo is nil for networks
+// without memos.
+type Network struct {
+	Name   string
+	Native string
+	Format Format
+	Memo   MemoRule
+}
+
+// Validate checks address, and memo where the network uses one. Memos are
+// required there: exchanges share one address across users, and a transfer
+// without the memo can't be credited.
+func (n Network) Validate(address, memo string) error {
+	if err := n.Format.Validate(address); err != nil {
+		return fmt.Errorf("%w for %s: %v", ErrInvalidAddress, n.Name, err)
+	}
+
+	if n.Memo == nil {
+		if memo != "" {
+			return fmt.Errorf("%w: %s doesn't take a memo", ErrInvalidMemo, n.Name)
+		}
+		return nil
+	}
+	if memo == "" {
+		return ErrMemoRequired
+	}
+	if err := n.Memo.Validate(memo); err != nil {
+		return fmt.Errorf("%w for %s: %v", ErrInvalidMemo, n.Name, err)
+	}
+	return nil
+}
+
+// Registry looks networks up by name.
+type Registry map[string]Network
+
+func NewRegistry(networks ...Network) Registry {
+	registry := Registry{}
+	for _, network := range networks {
+		registry[strings.ToUpper(network.Name)] = network
+	}
+	return registry
+}
+
+func (r Registry) Get(name string) (Network, bool) {
+	network, ok := r[strings.ToUpper(name)]
+	return network, ok
+}
+
+// Default covers the networks the exchange sends on, named as ecosystem
+// tokens name their chain.
+func Default() Registry {
+	bitcoin := AnyOf(Base58Check(0x00, 0x05), Segwit("bc"))
+	litecoin := AnyOf(Base58Check(0x30, 0x32, 0x05), Segwit("ltc"))
+
+	return NewRegistry(
+		Network{Name: "BTC", Native: "BTC", Format: bitcoin},
+		Network{Name: "LTC", Native: "LTC", Format: litecoin},
+		Network{Name: "DOGE", Native: "DOGE", Format: Base58Check(0x1e, 0x16)},
+		Network{Name: "DASH", Native: "DASH", Format: Base58Check(0x4c, 0x10)},
+		Network{Name: "ETH", Native: "ETH", Format: EVM()},
+		Network{Name: "BSC", Native: "BNB", Format: EVM()},
+		Network{Name: "POLYGON", Native: "MATIC", Format: EVM()},
+		Network{Name: "MATIC", Native: "MATIC", Format: EVM()},
+		Network{Name: "ARBITRUM", Native: "ETH", Format: EVM()},
+		Network{Name: "OPTIMISM", Native: "ETH", Format: EVM()},
+		Network{Name: "BASE", Native: "ETH", Format: EVM()},
+		Network{Name: "AVAX", Native: "AVAX", Format: EVM()},
+		Network{Name: "FTM", Native: "FTM", Format: EVM()},
+		Network{Name: "TRON", Native: "TRX", Format: Base58Check(0x41)},
+		Network{Name: "TRX", Native: "TRX", Format: Base58Check(0x41)},
+		Network{Name: "XRP", Native: "XRP", Format: Ripple(), Memo: DestinationTag()},
+		Network{Name: "XLM", Native: "XLM", Format: Stellar(), Memo: TextMemo(28)},
+	)
+}
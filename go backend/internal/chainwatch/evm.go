@@ -0,0 +1,198 @@
+package chainwatch
+
+import (
+	"context"
+	"crypto-exchange-go/internal/hdwallet"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// transferTopic is keccak256("Transfer(address,address,uint256)"), the
+// first topic of every ERC-20 Transfer log.
+const transferTopic = "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+
+const evmNativeDecimals = 18
+
+// Token is an ERC-20 contract whose transfers are watched.
+type Token struct {
+	Currency string
+	Contract string
+	Decimals int32
+}
+
+type EVMOptions struct {
+	Chain  string
+	RPCURL string
+	// Currency is the chain's native coin.
+	Currency   string
+	Tokens     []Token
+	HTTPClient *http.Client
+}
+
+// EVMWatcher reads an Ethereum-compatible chain: native transfers from the
+// block's transactions and token transfers from its Transfer logs.
+// Addresses are returned with their EIP-55 checksum, as they were derived.
+type EVMWatcher struct {
+	chain    string
+	currency string
+	tokens   map[string]Token
+	rpc      *rpcClient
+}
+
+func NewEVMWatcher(opts EVMOptions) *EVMWatcher {
+	tokens := make(map[string]Token, len(opts.Tokens))
+	for _, token := range opts.Tokens {
+		tokens[strings.ToLower(token.Contract)] = token
+	}
+
+	return &EVMWatcher{
+		chain:    opts.Chain,
+		currency: opts.Currency,
+		tokens:   tokens,
+		rpc:      newRPCClient(opts.RPCURL, opts.HTTPClient),
+	}
+}
+
+func (w *EVMWatcher) Chain() string {
+	return w.chain
+}
+
+func (w *EVMWatcher) LatestBlock(ctx context.Context) (uint64, error) {
+	var number string
+	if err := w.rpc.call(ctx, "eth_blockNumber", &number); err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimPrefix(number, "0x"), 16, 64)
+}
+
+type evmBlock struct {
+	Hash         string `json:"hash"`
+	ParentHash   string `json:"parentHash"`
+	Transactions []struct {
+		Hash  string  `json:"hash"`
+		To    *string `json:"to"`
+		Value string  `json:"value"`
+	} `json:"transactions"`
+}
+
+type evmLog struct {
+	Address         string   `json:"address"`
+	Topics          []string `json:"topics"`
+	Data            string   `json:"data"`
+	TransactionHash string   `json:"transactionHash"`
+	LogIndex        string   `json:"logIndex"`
+	Removed         bool     `json:"removed"`
+}
+
+func (w *EVMWatcher) BlockByNumber(ctx context.Context, number uint64) (*Block, error) {
+	var raw *evmBlock
+	if err := w.rpc.call(ctx, "eth_getBlockByNumber", &raw, fmt.Sprintf("0x%x", number), true); err != nil {
+		return nil, err
+	}
+	if raw == nil {
+		return nil, fmt.Errorf("block %d not found", number)
+	}
+
+	block := &Block{
+		Number:     number,
+		Hash:       raw.Hash,
+		ParentHash: raw.ParentHash,
+	}
+
+	for _, tx := range raw.Transactions {
+		if tx.To == nil {
+			continue
+		}
+		value, ok := parseQuantity(tx.Value)
+		if !ok || value.Sign() == 0 {
+			continue
+		}
+		to, err := evmAddress(*tx.To)
+		if err != nil {
+			continue
+		}
+		block.Transfers = append(block.Transfers, Transfer{
+			TxHash:   tx.Hash,
+			Index:    -1,
+			To:       to,
+			Currency: w.currency,
+			Amount:   decimal.NewFromBigInt(value, -evmNativeDecimals),
+		})
+	}
+
+	if len(w.tokens) == 0 {
+		return block, nil
+	}
+
+	contracts := make([]string, 0, len(w.tokens))
+	for contract := range w.tokens {
+		contracts = append(contracts, contract)
+	}
+
+	// Asking by hash keeps the logs from the same block as the
+	// transactions, even if the chain moved in between.
+	var logs []evmLog
+	err := w.rpc.call(ctx, "eth_getLogs", &logs, map[string]interface{}{
+		"blockHash": raw.Hash,
+		"address":   contracts,
+		"topics":    []string{transferTopic},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, log := range logs {
+		token, ok := w.tokens[strings.ToLower(log.Address)]
+		if !ok || log.Removed || len(log.Topics) != 3 {
+			continue
+		}
+		value, ok := parseQuantity(log.Data)
+		if !ok || value.Sign() == 0 {
+			continue
+		}
+		index, err := strconv.ParseInt(strings.TrimPrefix(log.LogIndex, "0x"), 16, 32)
+		if err != nil {
+			continue
+		}
+		// The recipient is the last 20 bytes of the third topic.
+		topic := strings.TrimPrefix(log.Topics[2], "0x")
+		if len(topic) != 64 {
+			continue
+		}
+		to, err := evmAddress(topic[24:])
+		if err != nil {
+			continue
+		}
+		block.Transfers = append(block.Transfers, Transfer{
+			TxHash:   log.TransactionHash,
+			Index:    int(index),
+			To:       to,
+			Currency: token.Currency,
+			Amount:   decimal.NewFromBigInt(value, -token.Decimals),
+		})
+	}
+
+	return block, nil
+}
+
+func parseQuantity(s string) (*big.Int, bool) {
+	s = strings.TrimPrefix(s, "0x")
+	if s == "" {
+		return new(big.Int), true
+	}
+	return new(big.Int).SetString(s, 16)
+}
+
+func evmAddress(s string) (string, error) {
+	raw, err := hex.DecodeString(strings.TrimPrefix(strings.ToLower(s), "0x"))
+	if err != nil || len(raw) != 20 {
+		return "", fmt.Errorf("invalid address %q", s)
+	}
+	return hdwallet.ChecksumAddress(raw), nil
+}
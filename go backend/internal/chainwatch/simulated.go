@@ -0,0 +1,84 @@
+package chainwatch
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+)
+
+// SimulatedChain is an in-memory chain for tests. Blocks are mined on
+// demand and Reorg replaces the newest ones, so a scanner can be driven
+// through forks deterministically.
+type SimulatedChain struct {
+	mu     sync.Mutex
+	chain  string
+	blocks []*Block
+	mined  int
+}
+
+// NewSimulatedChain starts a chain with only its genesis block.
+func NewSimulatedChain(chain string) *SimulatedChain {
+	c := &SimulatedChain{chain: chain}
+	c.blocks = append(c.blocks, c.newBlock(0, "", nil))
+	return c
+}
+
+func (c *SimulatedChain) newBlock(number uint64, parent string, transfers []Transfer) *Block {
+	// Every mined block gets a new hash, so a block replaced at the same
+	// height never matches the old one.
+	c.mined++
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s:%d:%s:%d", c.chain, number, parent, c.mined)))
+	return &Block{
+		Number:     number,
+		Hash:       "0x" + hex.EncodeToString(sum[:]),
+		ParentHash: parent,
+		Transfers:  transfers,
+	}
+}
+
+// Mine appends a block holding transfers.
+func (c *SimulatedChain) Mine(transfers ...Transfer) *Block {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	tip := c.blocks[len(c.blocks)-1]
+	block := c.newBlock(tip.Number+1, tip.Hash, transfers)
+	c.blocks = append(c.blocks, block)
+	return block
+}
+
+// Reorg drops the newest depth blocks; the blocks mined after it form the
+// new branch.
+func (c *SimulatedChain) Reorg(depth int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if depth >= len(c.blocks) {
+		depth = len(c.blocks) - 1
+	}
+	c.blocks = c.blocks[:len(c.blocks)-depth]
+}
+
+func (c *SimulatedChain) Chain() string {
+	return c.chain
+}
+
+func (c *SimulatedChain) LatestBlock(ctx context.Context) (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.blocks[len(c.blocks)-1].Number, nil
+}
+
+func (c *SimulatedChain) BlockByNumber(ctx context.Context, number uint64) (*Block, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if number >= uint64(len(c.blocks)) {
+		return nil, fmt.Errorf("block %d not found", number)
+	}
+	block := *c.blocks[number]
+	block.Transfers = append([]Transfer(nil), block.Transfers...)
+	return &block, nil
+}
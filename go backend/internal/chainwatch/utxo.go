@@ -0,0 +1,98 @@
+package chainwatch
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/shopspring/decimal"
+)
+
+type UTXOOptions struct {
+	Chain      string
+	RPCURL     string
+	Currency   string
+	HTTPClient *http.Client
+}
+
+// UTXOWatcher reads a bitcoind-compatible node (Bitcoin, Litecoin, Dogecoin,
+// Dash). Each transaction output paying an address is a transfer.
+type UTXOWatcher struct {
+	chain    string
+	currency string
+	rpc      *rpcClient
+}
+
+func NewUTXOWatcher(opts UTXOOptions) *UTXOWatcher {
+	return &UTXOWatcher{
+		chain:    opts.Chain,
+		currency: opts.Currency,
+		rpc:      newRPCClient(opts.RPCURL, opts.HTTPClient),
+	}
+}
+
+func (w *UTXOWatcher) Chain() string {
+	return w.chain
+}
+
+func (w *UTXOWatcher) LatestBlock(ctx context.Context) (uint64, error) {
+	var count uint64
+	err := w.rpc.call(ctx, "getblockcount", &count)
+	return count, err
+}
+
+type utxoBlock struct {
+	Hash              string `json:"hash"`
+	PreviousBlockHash string `json:"previousblockhash"`
+	Tx                []struct {
+		TxID string `json:"txid"`
+		Vout []struct {
+			// Coin amounts, not satoshis; decimal keeps them exact.
+			Value        decimal.Decimal `json:"value"`
+			N            int             `json:"n"`
+			ScriptPubKey struct {
+				Address   string   `json:"address"`
+				Addresses []string `json:"addresses"`
+			} `json:"scriptPubKey"`
+		} `json:"vout"`
+	} `json:"tx"`
+}
+
+func (w *UTXOWatcher) BlockByNumber(ctx context.Context, number uint64) (*Block, error) {
+	var hash string
+	if err := w.rpc.call(ctx, "getblockhash", &hash, number); err != nil {
+		return nil, err
+	}
+
+	var raw utxoBlock
+	if err := w.rpc.call(ctx, "getblock", &raw, hash, 2); err != nil {
+		return nil, err
+	}
+
+	block := &Block{
+		Number:     number,
+		Hash:       raw.Hash,
+		ParentHash: raw.PreviousBlockHash,
+	}
+
+	for _, tx := range raw.Tx {
+		for _, out := range tx.Vout {
+			// Older nodes list the address in an array.
+			address := out.ScriptPubKey.Address
+			if address == "" && len(out.ScriptPubKey.Addresses) == 1 {
+				address = out.ScriptPubKey.Addresses[0]
+			}
+			if address == "" || !out.Value.IsPositive() {
+				continue
+			}
+			block.Transfers = append(block.Transfers, Transfer{
+				TxHash:   tx.TxID,
+				Index:    out.N,
+				To:       address,
+				Currency: w.currency,
+				Amount:   out.Value,
+			})
+		}
+	}
+
+	return block, nil
+}
@@ -0,0 +1,199 @@
+// Package chainwatch follows blockchains for transfers to deposit addresses.
+// A ChainWatcher reads one chain; the Scanner walks its blocks in order,
+// remembers the hash of each one through a Sink, and when the chain replaces
+// blocks it has already seen, rolls the Sink back to the fork before
+// scanning the new branch.
+package chainwatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+var ErrReorgTooDeep = errors.New("reorg deeper than the configured limit")
+
+// Transfer is a payment of Amount in Currency to the address To. TxHash and
+// Index identify it on the chain: the log index for tokens, the output index
+// for UTXO chains and -1 for a native EVM transfer.
+type Transfer struct {
+	TxHash   string
+	Index    int
+	To       string
+	Currency string
+	Amount   decimal.Decimal
+}
+
+type Block struct {
+	Number     uint64
+	Hash       string
+	ParentHash string
+	Transfers  []Transfer
+}
+
+type ChainWatcher interface {
+	Chain() string
+	LatestBlock(ctx context.Context) (uint64, error)
+	BlockByNumber(ctx context.Context, number uint64) (*Block, error)
+}
+
+// Sink keeps what the scanner finds. Apply stores a block's hash together with
+// whatever it makes of the block's transfers, so the two never disagree.
+type Sink interface {
+	LastScanned(ctx context.Context, chain string) (uint64, bool, error)
+	ScannedHash(ctx context.Context, chain string, number uint64) (string, bool, error)
+	Apply(ctx context.Context, chain string, block *Block) error
+	// Rollback forgets every block above number and undoes what they
+	// caused, as far as it can still be undone.
+	Rollback(ctx context.Context, chain string, number uint64) error
+	// Confirm runs after each scan with the chain's latest height.
+	Confirm(ctx context.Context, chain string, latest uint64) error
+}
+
+type ScannerOptions struct {
+	// StartBlock is where a chain that was never scanned starts; zero means
+	// its current tip.
+	StartBlock uint64
+	// MaxReorgDepth bounds how far back a fork is looked for.
+	MaxReorgDepth uint64
+	// BatchSize caps the blocks scanned per call, so a node that is far
+	// behind catches up over several polls.
+	BatchSize uint64
+}
+
+type Scanner struct {
+	watcher ChainWatcher
+	sink    Sink
+	opts    ScannerOptions
+	logger  *logrus.Logger
+}
+
+func NewScanner(watcher ChainWatcher, sink Sink, opts ScannerOptions, logger *logrus.Logger) *Scanner {
+	if opts.MaxReorgDepth == 0 {
+		opts.MaxReorgDepth = 128
+	}
+	if opts.BatchSize == 0 {
+		opts.BatchSize = 100
+	}
+	return &Scanner{
+		watcher: watcher,
+		sink:    sink,
+		opts:    opts,
+		logger:  logger,
+	}
+}
+
+func (s *Scanner) Chain() string {
+	return s.watcher.Chain()
+}
+
+// Scan catches up with the chain's tip, up to BatchSize blocks, then lets the
+// sink update confirmations.
+func (s *Scanner) Scan(ctx context.Context) error {
+	chain := s.watcher.Chain()
+
+	latest, err := s.watcher.LatestBlock(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get latest %s block: %w", chain, err)
+	}
+
+	last, scanned, err := s.sink.LastScanned(ctx, chain)
+	if err != nil {
+		return err
+	}
+
+	next := s.opts.StartBlock
+	if !scanned && next == 0 {
+		next = latest
+	}
+	if scanned {
+		// The tip we stopped at may itself have been replaced.
+		if next, err = s.rewind(ctx, last); err != nil {
+			return err
+		}
+	}
+
+	end := latest
+	if end >= next+s.opts.BatchSize {
+		end = next + s.opts.BatchSize - 1
+	}
+
+	for number := next; number <= end; number++ {
+		block, err := s.watcher.BlockByNumber(ctx, number)
+		if err != nil {
+			return fmt.Errorf("failed to get %s block %d: %w", chain, number, err)
+		}
+
+		if number > 0 {
+			parent, ok, err := s.sink.ScannedHash(ctx, chain, number-1)
+			if err != nil {
+				return err
+			}
+			if ok && parent != block.ParentHash {
+				// The chain reorganised under us mid-scan.
+				resume, err := s.rewind(ctx, number-1)
+				if err != nil {
+					return err
+				}
+				number = resume - 1
+				continue
+			}
+		}
+
+		if err := s.sink.Apply(ctx, chain, block); err != nil {
+			return fmt.Errorf("failed to apply %s block %d: %w", chain, number, err)
+		}
+	}
+
+	return s.sink.Confirm(ctx, chain, latest)
+}
+
+// rewind finds the newest scanned block at or below from that is still on
+// the chain, rolls the sink back to it, and returns the block to scan next.
+func (s *Scanner) rewind(ctx context.Context, from uint64) (uint64, error) {
+	chain := s.watcher.Chain()
+
+	for number := from; ; number-- {
+		stored, ok, err := s.sink.ScannedHash(ctx, chain, number)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			// Nothing this old is kept; it's taken as final.
+			return s.rollback(ctx, from, number)
+		}
+
+		block, err := s.watcher.BlockByNumber(ctx, number)
+		if err != nil {
+			return 0, fmt.Errorf("failed to get %s block %d: %w", chain, number, err)
+		}
+		if block.Hash == stored {
+			return s.rollback(ctx, from, number)
+		}
+
+		if from-number+1 >= s.opts.MaxReorgDepth {
+			return 0, fmt.Errorf("%w: %s below block %d", ErrReorgTooDeep, chain, number)
+		}
+		if number == 0 {
+			return 0, fmt.Errorf("%s genesis block changed", chain)
+		}
+	}
+}
+
+func (s *Scanner) rollback(ctx context.Context, from, fork uint64) (uint64, error) {
+	if fork < from {
+		s.logger.WithFields(logrus.Fields{
+			"chain": s.watcher.Chain(),
+			"fork":  fork,
+			"depth": from - fork,
+		}).Warn("Chain reorganisation, rolling back")
+
+		if err := s.sink.Rollback(ctx, s.watcher.Chain(), fork); err != nil {
+			return 0, fmt.Errorf("failed to roll back to block %d: %w", fork, err)
+		}
+	}
+	return fork + 1, nil
+}
@@ -17,6 +17,17 @@ type Config struct {
 	Redis     Redis     `mapstructure:"redis"`
 	JWT       JWT       `mapstructure:"jwt"`
 	RateLimit RateLimit `mapstructure:"rate_limit"`
+	WebSocket WebSocket `mapstructure:"websocket"`
+	Transfer  Transfer  `mapstructure:"transfer"`
+
+	Reconciliation Reconciliation `mapstructure:"reconciliation"`
+	Valuation      Valuation      `mapstructure:"valuation"`
+	Payments       Payments       `mapstructure:"payments"`
+	ChainWatch     ChainWatch     `mapstructure:"chain_watch"`
+	Withdrawal     Withdrawal     `mapstructure:"withdrawal"`
+	Batching       Batching       `mapstructure:"batching"`
+	Signer         Signer         `mapstructure:"signer"`
+	Mail           Mail           `mapstructure:"mail"`
 }
 
 type MySQL struct {
@@ -53,6 +64,174 @@ type RateLimit struct {
 	WindowSeconds     int `mapstructure:"window_seconds"`
 }
 
+type WebSocket struct {
+	Port             int  `mapstructure:"port"`
+	SendQueueSize    int  `mapstructure:"send_queue_size"`
+	MaxLagSeconds    int  `mapstructure:"max_lag_seconds"`
+	DrainSeconds     int  `mapstructure:"drain_seconds"`
+	Compression      bool `mapstructure:"compression"`
+	CompressionLevel int  `mapstructure:"compression_level"`
+}
+
+type Transfer struct {
+	FiatCurrencies    []string `mapstructure:"fiat_currencies"`
+	FuturesCurrencies []string `mapstructure:"futures_currencies"`
+	// Per-currency limits for user-to-user transfers. Currencies without a
+	// daily limit can't be sent to other users; amounts at or above the OTP
+	// threshold need a 2FA code.
+	UserDailyLimits   map[string]float64 `mapstructure:"user_daily_limits"`
+	UserOTPThresholds map[string]float64 `mapstructure:"user_otp_thresholds"`
+}
+
+type Reconciliation struct {
+	// RunHour is the UTC hour the nightly run starts.
+	RunHour       int      `mapstructure:"run_hour"`
+	FreezeWallets bool     `mapstructure:"freeze_wallets"`
+	AlertUserIDs  []string `mapstructure:"alert_user_ids"`
+}
+
+type Valuation struct {
+	ReferenceCurrency string `mapstructure:"reference_currency"`
+	// PeggedCurrencies are valued one-to-one with the reference currency.
+	PeggedCurrencies []string `mapstructure:"pegged_currencies"`
+}
+
+// Payments configures the fiat deposit providers. A provider without a
+// secret key is disabled.
+type Payments struct {
+	Stripe Stripe `mapstructure:"stripe"`
+	PayPal PayPal `mapstructure:"paypal"`
+}
+
+type Stripe struct {
+	SecretKey     string `mapstructure:"secret_key"`
+	WebhookSecret string `mapstructure:"webhook_secret"`
+}
+
+type PayPal struct {
+	ClientID     string `mapstructure:"client_id"`
+	ClientSecret string `mapstructure:"client_secret"`
+	WebhookID    string `mapstructure:"webhook_id"`
+	Sandbox      bool   `mapstructure:"sandbox"`
+}
+
+// ChainWatch configures the on-chain deposit watcher. Chains are keyed by the
+// network name deposit addresses are stored under.
+type ChainWatch struct {
+	PollSeconds   int                     `mapstructure:"poll_seconds"`
+	MaxReorgDepth int                     `mapstructure:"max_reorg_depth"`
+	Chains        map[string]WatchedChain `mapstructure:"chains"`
+}
+
+type WatchedChain struct {
+	// Type is "evm" or "utxo".
+	Type   string `mapstructure:"type"`
+	RPCURL string `mapstructure:"rpc_url"`
+	// Currency is the chain's native coin.
+	Currency string `mapstructure:"currency"`
+	// Confirmations a deposit needs before it's credited.
+	Confirmations int `mapstructure:"confirmations"`
+	// StartBlock is where scanning starts the first time; zero is the tip.
+	StartBlock uint64         `mapstructure:"start_block"`
+	Tokens     []WatchedToken `mapstructure:"tokens"`
+}
+
+type WatchedToken struct {
+	Currency string `mapstructure:"currency"`
+	Contract string `mapstructure:"contract"`
+	Decimals int32  `mapstructure:"decimals"`
+}
+
+// Withdrawal configures withdrawal review. A withdrawal is approved without
+// an admin only if it is under the currency's auto-approve limit, goes to a
+// whitelisted address, the user has the KYC level and its risk score is at
+// most AutoApproveMaxRisk.
+type Withdrawal struct {
+	AutoApproveLimits   map[string]float64 `mapstructure:"auto_approve_limits"`
+	AutoApproveKYCLevel int                `mapstructure:"auto_approve_kyc_level"`
+	AutoApproveMaxRisk  int                `mapstructure:"auto_approve_max_risk"`
+	// A device first seen, or a password changed, within these windows
+	// counts against the withdrawal.
+	NewDeviceHours      int `mapstructure:"new_device_hours"`
+	PasswordChangeHours int `mapstructure:"password_change_hours"`
+	// WhitelistCooldownHours is how long a new address book entry, or
+	// turning whitelist-only mode off, waits before it takes effect.
+	WhitelistCooldownHours int `mapstructure:"whitelist_cooldown_hours"`
+	// Fees are keyed by currency, or by "currency:network" where a network
+	// costs differently. A "default" entry covers currencies without their
+	// own; without one, those currencies can't be withdrawn. NetworkFees are
+	// the static network fee estimates used by fees with Dynamic set.
+	Fees        map[string]WithdrawalFee `mapstructure:"fees"`
+	NetworkFees map[string]float64       `mapstructure:"network_fees"`
+	// LimitTiers cap what a user withdraws per UTC day and month, valued in
+	// the valuation reference currency. A user gets the highest tier their
+	// KYC level reaches; without tiers withdrawals are unlimited.
+	LimitTiers []WithdrawalLimitTier `mapstructure:"limit_tiers"`
+}
+
+// WithdrawalFee is flat plus a percentage of the amount, plus the estimated
+// network fee when Dynamic is set. Smaller amounts than MinAmount are
+// refused.
+type WithdrawalFee struct {
+	Flat      float64 `mapstructure:"flat"`
+	Percent   float64 `mapstructure:"percent"`
+	MinAmount float64 `mapstructure:"min_amount"`
+	Dynamic   bool    `mapstructure:"dynamic"`
+}
+
+type WithdrawalLimitTier struct {
+	KYCLevel int     `mapstructure:"kyc_level"`
+	Daily    float64 `mapstructure:"daily"`
+	Monthly  float64 `mapstructure:"monthly"`
+}
+
+// Batching configures how approved withdrawals on UTXO chains are gathered
+// into transactions. Chains are keyed by network name; chains without an
+// entry aren't batched.
+type Batching struct {
+	IntervalSeconds int                     `mapstructure:"interval_seconds"`
+	Chains          map[string]BatchedChain `mapstructure:"chains"`
+}
+
+type BatchedChain struct {
+	// FeeRate is in satoshis per virtual byte.
+	FeeRate int64 `mapstructure:"fee_rate"`
+	// MaxOutputs caps the withdrawals in one transaction; zero means no cap.
+	MaxOutputs int `mapstructure:"max_outputs"`
+}
+
+// Signer configures the signing process that holds custodial keys. The API
+// reaches it at URL; the signer listens on Listen and keeps its keys in
+// Keystore, encrypted with the passphrase in SIGNER_PASSPHRASE. Both sides
+// share Token.
+type Signer struct {
+	URL      string `mapstructure:"url"`
+	Token    string `mapstructure:"token"`
+	Listen   string `mapstructure:"listen"`
+	Keystore string `mapstructure:"keystore"`
+	// Policies limit what is signed per chain, in coin units. Chains
+	// without one are refused.
+	Policies map[string]SignerPolicy `mapstructure:"policies"`
+}
+
+type SignerPolicy struct {
+	MaxAmount   float64 `mapstructure:"max_amount"`
+	DailyAmount float64 `mapstructure:"daily_amount"`
+	MaxFee      float64 `mapstructure:"max_fee"`
+}
+
+// Mail configures outgoing email. Without a host, emails are logged instead
+// of sent.
+type Mail struct {
+	Host     string `mapstructure:"host"`
+	Port     int    `mapstructure:"port"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+	From     string `mapstructure:"from"`
+	// SiteURL is the frontend's base URL, for links in emails.
+	SiteURL string `mapstructure:"site_url"`
+}
+
 func Load() (*Config, error) {
 	viper.SetConfigName("config")
 	viper.SetConfigType("yaml")
@@ -99,6 +278,44 @@ func setDefaults() {
 	
 	viper.SetDefault("rate_limit.requests_per_minute", 100)
 	viper.SetDefault("rate_limit.window_seconds", 60)
+
+	viper.SetDefault("websocket.port", 4001)
+	viper.SetDefault("websocket.send_queue_size", 256)
+	viper.SetDefault("websocket.max_lag_seconds", 10)
+	viper.SetDefault("websocket.drain_seconds", 30)
+	viper.SetDefault("websocket.compression", true)
+	viper.SetDefault("websocket.compression_level", 1)
+
+	viper.SetDefault("transfer.fiat_currencies", []string{"USD", "EUR", "GBP"})
+	viper.SetDefault("transfer.futures_currencies", []string{"USDT"})
+	viper.SetDefault("transfer.user_daily_limits", map[string]float64{"usdt": 10000, "btc": 0.5, "eth": 5})
+	viper.SetDefault("transfer.user_otp_thresholds", map[string]float64{"usdt": 1000, "btc": 0.02, "eth": 0.3})
+
+	viper.SetDefault("reconciliation.run_hour", 2)
+	viper.SetDefault("reconciliation.freeze_wallets", false)
+
+	viper.SetDefault("valuation.reference_currency", "USDT")
+	viper.SetDefault("valuation.pegged_currencies", []string{"USD"})
+
+	viper.SetDefault("payments.paypal.sandbox", true)
+
+	viper.SetDefault("chain_watch.poll_seconds", 15)
+	viper.SetDefault("chain_watch.max_reorg_depth", 128)
+
+	viper.SetDefault("withdrawal.auto_approve_kyc_level", 2)
+	viper.SetDefault("withdrawal.auto_approve_max_risk", 20)
+	viper.SetDefault("withdrawal.new_device_hours", 24)
+	viper.SetDefault("withdrawal.password_change_hours", 72)
+	viper.SetDefault("withdrawal.whitelist_cooldown_hours", 24)
+
+	viper.SetDefault("batching.interval_seconds", 600)
+
+	viper.SetDefault("signer.url", "http://127.0.0.1:4100")
+	viper.SetDefault("signer.listen", "127.0.0.1:4100")
+	viper.SetDefault("signer.keystore", "./keystore.json")
+
+	viper.SetDefault("mail.port", 587)
+	viper.SetDefault("mail.site_url", "http://localhost:3000")
 }
 
 func loadFromEnv() {
@@ -166,4 +383,69 @@ func loadFromEnv() {
 			viper.Set("rate_limit.window_seconds", r)
 		}
 	}
+
+	if wsPort := os.Getenv("WS_PORT"); wsPort != "" {
+		if p, err := strconv.Atoi(wsPort); err == nil {
+			viper.Set("websocket.port", p)
+		}
+	}
+	if queueSize := os.Getenv("WS_SEND_QUEUE_SIZE"); queueSize != "" {
+		if q, err := strconv.Atoi(queueSize); err == nil {
+			viper.Set("websocket.send_queue_size", q)
+		}
+	}
+	if maxLag := os.Getenv("WS_MAX_LAG_SECONDS"); maxLag != "" {
+		if l, err := strconv.Atoi(maxLag); err == nil {
+			viper.Set("websocket.max_lag_seconds", l)
+		}
+	}
+	if drain := os.Getenv("WS_DRAIN_SECONDS"); drain != "" {
+		if d, err := strconv.Atoi(drain); err == nil {
+			viper.Set("websocket.drain_seconds", d)
+		}
+	}
+
+	if stripeSecret := os.Getenv("STRIPE_SECRET_KEY"); stripeSecret != "" {
+		viper.Set("payments.stripe.secret_key", stripeSecret)
+	}
+	if stripeWebhookSecret := os.Getenv("STRIPE_WEBHOOK_SECRET"); stripeWebhookSecret != "" {
+		viper.Set("payments.stripe.webhook_secret", stripeWebhookSecret)
+	}
+	if paypalClientID := os.Getenv("PAYPAL_CLIENT_ID"); paypalClientID != "" {
+		viper.Set("payments.paypal.client_id", paypalClientID)
+	}
+	if paypalClientSecret := os.Getenv("PAYPAL_CLIENT_SECRET"); paypalClientSecret != "" {
+		viper.Set("payments.paypal.client_secret", paypalClientSecret)
+	}
+	if paypalWebhookID := os.Getenv("PAYPAL_WEBHOOK_ID"); paypalWebhookID != "" {
+		viper.Set("payments.paypal.webhook_id", paypalWebhookID)
+	}
+	if paypalMode := os.Getenv("PAYPAL_MODE"); paypalMode != "" {
+		viper.Set("payments.paypal.sandbox", paypalMode != "live")
+	}
+
+	if signerToken := os.Getenv("SIGNER_TOKEN"); signerToken != "" {
+		viper.Set("signer.token", signerToken)
+	}
+
+	if smtpHost := os.Getenv("APP_NODEMAILER_SMTP_HOST"); smtpHost != "" {
+		viper.Set("mail.host", smtpHost)
+	}
+	if smtpPort := os.Getenv("APP_NODEMAILER_SMTP_PORT"); smtpPort != "" {
+		if p, err := strconv.Atoi(smtpPort); err == nil {
+			viper.Set("mail.port", p)
+		}
+	}
+	if smtpSender := os.Getenv("APP_NODEMAILER_SMTP_SENDER"); smtpSender != "" {
+		viper.Set("mail.username", smtpSender)
+	}
+	if smtpPassword := os.Getenv("APP_NODEMAILER_SMTP_PASSWORD"); smtpPassword != "" {
+		viper.Set("mail.password", smtpPassword)
+	}
+	if appEmail := os.Getenv("NEXT_PUBLIC_APP_EMAIL"); appEmail != "" {
+		viper.Set("mail.from", appEmail)
+	}
+	if siteURL := os.Getenv("NEXT_PUBLIC_SITE_URL"); siteURL != "" {
+		viper.Set("mail.site_url", siteURL)
+	}
 }
@@ -62,3 +62,7 @@ func (r *Redis) Publish(ctx context.Context, channel string, message interface{}
 func (r *Redis) Subscribe(ctx context.Context, channels ...string) *redis.PubSub {
 	return r.client.Subscribe(ctx, channels...)
 }
+
+func (r *Redis) PSubscribe(ctx context.Context, patterns ...string) *redis.PubSub {
+	return r.client.PSubscribe(ctx, patterns...)
+}
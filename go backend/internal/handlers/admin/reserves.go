@@ -0,0 +1,32 @@
+package admin
+
+import (
+	"crypto-exchange-go/internal/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type ReservesHandler struct {
+	reservesService *services.ReservesService
+	logger          *logrus.Logger
+}
+
+func NewReservesHandler(reservesService *services.ReservesService, logger *logrus.Logger) *ReservesHandler {
+	return &ReservesHandler{
+		reservesService: reservesService,
+		logger:          logger,
+	}
+}
+
+func (h *ReservesHandler) CreateSnapshot(c *gin.Context) {
+	snapshot, err := h.reservesService.CreateSnapshot(c.Request.Context())
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to create reserve snapshot")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create reserve snapshot"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": snapshot})
+}
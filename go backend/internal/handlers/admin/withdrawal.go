@@ -0,0 +1,201 @@
+package admin
+
+import (
+	"crypto-exchange-go/internal/middleware"
+	"crypto-exchange-go/internal/models"
+	"crypto-exchange-go/internal/services"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+type WithdrawalHandler struct {
+	withdrawalService *services.WithdrawalService
+	logger            *logrus.Logger
+}
+
+func NewWithdrawalHandler(withdrawalService *services.WithdrawalService, logger *logrus.Logger) *WithdrawalHandler {
+	return &WithdrawalHandler{
+		withdrawalService: withdrawalService,
+		logger:            logger,
+	}
+}
+
+// GetQueue lists withdrawals by status, PENDING by default.
+func (h *WithdrawalHandler) GetQueue(c *gin.Context) {
+	status := strings.ToUpper(c.DefaultQuery("status", models.WithdrawalStatusPending))
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	withdrawals, err := h.withdrawalService.GetReviewQueue(c.Request.Context(), status, limit, offset)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to get withdrawal queue")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get withdrawals"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": withdrawals})
+}
+
+func (h *WithdrawalHandler) GetWithdrawal(c *gin.Context) {
+	withdrawalID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid withdrawal ID"})
+		return
+	}
+
+	review, err := h.withdrawalService.GetWithdrawalReview(c.Request.Context(), withdrawalID)
+	if err != nil {
+		h.reviewError(c, err, "Failed to get withdrawal")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": review})
+}
+
+func (h *WithdrawalHandler) Approve(c *gin.Context) {
+	adminID, withdrawalID, ok := reviewTarget(c)
+	if !ok {
+		return
+	}
+
+	var request models.ReviewWithdrawalRequest
+	if err := c.ShouldBindJSON(&request); err != nil && c.Request.ContentLength != 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.withdrawalService.ApproveWithdrawal(c.Request.Context(), adminID, withdrawalID, request.Reason); err != nil {
+		h.reviewError(c, err, "Failed to approve withdrawal")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Withdrawal approved"})
+}
+
+func (h *WithdrawalHandler) Reject(c *gin.Context) {
+	adminID, withdrawalID, ok := reviewTarget(c)
+	if !ok {
+		return
+	}
+
+	var request models.ReviewWithdrawalRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if strings.TrimSpace(request.Reason) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A reason is required to reject a withdrawal"})
+		return
+	}
+
+	if err := h.withdrawalService.RejectWithdrawal(c.Request.Context(), adminID, withdrawalID, request.Reason); err != nil {
+		h.reviewError(c, err, "Failed to reject withdrawal")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Withdrawal rejected"})
+}
+
+func (h *WithdrawalHandler) MarkBroadcast(c *gin.Context) {
+	adminID, withdrawalID, ok := reviewTarget(c)
+	if !ok {
+		return
+	}
+
+	var request models.MarkWithdrawalBroadcastRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.withdrawalService.MarkWithdrawalBroadcast(c.Request.Context(), adminID, withdrawalID, request.TransactionID); err != nil {
+		h.reviewError(c, err, "Failed to mark withdrawal broadcast")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Withdrawal marked as broadcast"})
+}
+
+func (h *WithdrawalHandler) Confirm(c *gin.Context) {
+	adminID, withdrawalID, ok := reviewTarget(c)
+	if !ok {
+		return
+	}
+
+	if err := h.withdrawalService.ConfirmWithdrawal(c.Request.Context(), adminID, withdrawalID); err != nil {
+		h.reviewError(c, err, "Failed to confirm withdrawal")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Withdrawal confirmed"})
+}
+
+// Fail records that a broadcast transaction didn't make it and refunds the
+// user.
+func (h *WithdrawalHandler) Fail(c *gin.Context) {
+	adminID, withdrawalID, ok := reviewTarget(c)
+	if !ok {
+		return
+	}
+
+	var request models.ReviewWithdrawalRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if strings.TrimSpace(request.Reason) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A reason is required to fail a withdrawal"})
+		return
+	}
+
+	if err := h.withdrawalService.FailWithdrawal(c.Request.Context(), adminID, withdrawalID, request.Reason); err != nil {
+		h.reviewError(c, err, "Failed to mark withdrawal failed")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Withdrawal failed and refunded"})
+}
+
+// reviewTarget only accepts callers a permission guard has admitted, so a
+// route registered without one can't be used to move money.
+func reviewTarget(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	admin, ok := middleware.GetAdminFromContext(c)
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Admin permission required"})
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	withdrawalID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid withdrawal ID"})
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	return admin.ID, withdrawalID, true
+}
+
+func (h *WithdrawalHandler) reviewError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Withdrawal not found"})
+	case errors.Is(err, services.ErrWithdrawalStateConflict), errors.Is(err, services.ErrWithdrawalBatched):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		h.logger.WithError(err).Error(message)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
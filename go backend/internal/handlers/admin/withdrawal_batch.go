@@ -0,0 +1,186 @@
+package admin
+
+import (
+	"crypto-exchange-go/internal/middleware"
+	"crypto-exchange-go/internal/models"
+	"crypto-exchange-go/internal/services"
+	"crypto-exchange-go/internal/signer"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+type WithdrawalBatchHandler struct {
+	batchService *services.WithdrawalBatchService
+	logger       *logrus.Logger
+}
+
+func NewWithdrawalBatchHandler(batchService *services.WithdrawalBatchService, logger *logrus.Logger) *WithdrawalBatchHandler {
+	return &WithdrawalBatchHandler{
+		batchService: batchService,
+		logger:       logger,
+	}
+}
+
+// GetBatches lists withdrawal batches by status, UNSIGNED by default.
+func (h *WithdrawalBatchHandler) GetBatches(c *gin.Context) {
+	status := strings.ToUpper(c.DefaultQuery("status", models.WithdrawalBatchStatusUnsigned))
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	batches, err := h.batchService.GetBatches(c.Request.Context(), status, limit, offset)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to get withdrawal batches")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get withdrawal batches"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": batches})
+}
+
+// Sign sends a batch to the signer. Like the review actions it only accepts
+// callers a permission guard has admitted.
+func (h *WithdrawalBatchHandler) Sign(c *gin.Context) {
+	if _, ok := middleware.GetAdminFromContext(c); !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Admin permission required"})
+		return
+	}
+
+	batchID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid batch ID"})
+		return
+	}
+
+	batch, err := h.batchService.SignBatch(c.Request.Context(), batchID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Withdrawal batch not found"})
+	case errors.Is(err, services.ErrWithdrawalBatchSigned):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, signer.ErrPolicy), errors.Is(err, signer.ErrUnknownKey):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	case err != nil:
+		h.logger.WithError(err).WithField("batchId", batchID).Error("Failed to sign withdrawal batch")
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to sign withdrawal batch"})
+	default:
+		c.JSON(http.StatusOK, gin.H{"data": batch})
+	}
+}
+
+// Abandon drops a batch that was never signed, giving its withdrawals and
+// coins back to the next run.
+func (h *WithdrawalBatchHandler) Abandon(c *gin.Context) {
+	_, batchID, ok := batchTarget(c)
+	if !ok {
+		return
+	}
+
+	if err := h.batchService.AbandonBatch(c.Request.Context(), batchID); err != nil {
+		h.batchError(c, err, "Failed to abandon withdrawal batch")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Withdrawal batch abandoned"})
+}
+
+func (h *WithdrawalBatchHandler) MarkBroadcast(c *gin.Context) {
+	adminID, batchID, ok := batchTarget(c)
+	if !ok {
+		return
+	}
+
+	var request models.MarkWithdrawalBroadcastRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.batchService.MarkBatchBroadcast(c.Request.Context(), adminID, batchID, request.TransactionID); err != nil {
+		h.batchError(c, err, "Failed to mark withdrawal batch broadcast")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Withdrawal batch marked as broadcast"})
+}
+
+func (h *WithdrawalBatchHandler) Confirm(c *gin.Context) {
+	adminID, batchID, ok := batchTarget(c)
+	if !ok {
+		return
+	}
+
+	if err := h.batchService.ConfirmBatch(c.Request.Context(), adminID, batchID); err != nil {
+		h.batchError(c, err, "Failed to confirm withdrawal batch")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Withdrawal batch confirmed"})
+}
+
+func (h *WithdrawalBatchHandler) Fail(c *gin.Context) {
+	adminID, batchID, ok := batchTarget(c)
+	if !ok {
+		return
+	}
+
+	var request models.ReviewWithdrawalRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if strings.TrimSpace(request.Reason) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A reason is required to fail a withdrawal batch"})
+		return
+	}
+
+	if err := h.batchService.FailBatch(c.Request.Context(), adminID, batchID, request.Reason); err != nil {
+		h.batchError(c, err, "Failed to mark withdrawal batch failed")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Withdrawal batch failed and refunded"})
+}
+
+// batchTarget, like reviewTarget, only accepts callers a permission guard
+// has admitted.
+func batchTarget(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	admin, ok := middleware.GetAdminFromContext(c)
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Admin permission required"})
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	batchID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid batch ID"})
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	return admin.ID, batchID, true
+}
+
+func (h *WithdrawalBatchHandler) batchError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Withdrawal batch not found"})
+	case errors.Is(err, services.ErrWithdrawalBatchState), errors.Is(err, services.ErrWithdrawalStateConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		h.logger.WithError(err).Error(message)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
@@ -0,0 +1,215 @@
+package finance
+
+import (
+	"crypto-exchange-go/internal/models"
+	"crypto-exchange-go/internal/services"
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+type AddressBookHandler struct {
+	addressBookService *services.AddressBookService
+	logger             *logrus.Logger
+}
+
+func NewAddressBookHandler(addressBookService *services.AddressBookService, logger *logrus.Logger) *AddressBookHandler {
+	return &AddressBookHandler{
+		addressBookService: addressBookService,
+		logger:             logger,
+	}
+}
+
+func (h *AddressBookHandler) GetAddresses(c *gin.Context) {
+	uid, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	addresses, err := h.addressBookService.GetAddresses(c.Request.Context(), uid, c.Query("currency"), c.Query("network"))
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to get withdrawal addresses")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get withdrawal addresses"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": addresses})
+}
+
+func (h *AddressBookHandler) AddAddress(c *gin.Context) {
+	uid, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	var request models.CreateWithdrawalAddressRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	address, err := h.addressBookService.AddAddress(c.Request.Context(), uid, &request)
+	if errors.Is(err, services.ErrAddressAlreadySaved) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrInvalidDestination) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to add withdrawal address")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add withdrawal address"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": address})
+}
+
+func (h *AddressBookHandler) UpdateAddress(c *gin.Context) {
+	uid, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	addressID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid address ID"})
+		return
+	}
+
+	var request models.UpdateWithdrawalAddressRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.addressBookService.UpdateLabel(c.Request.Context(), uid, addressID, request.Label); err != nil {
+		h.addressError(c, err, "Failed to update withdrawal address")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Withdrawal address updated"})
+}
+
+func (h *AddressBookHandler) DeleteAddress(c *gin.Context) {
+	uid, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	addressID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid address ID"})
+		return
+	}
+
+	if err := h.addressBookService.DeleteAddress(c.Request.Context(), uid, addressID); err != nil {
+		h.addressError(c, err, "Failed to delete withdrawal address")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Withdrawal address deleted"})
+}
+
+func (h *AddressBookHandler) GetWhitelist(c *gin.Context) {
+	uid, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	whitelist, err := h.addressBookService.GetWhitelist(c.Request.Context(), uid)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to get withdrawal whitelist")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get withdrawal whitelist"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": whitelist})
+}
+
+// UpdateWhitelist turns whitelist-only mode on immediately. Turning it off
+// only starts the email confirmation.
+func (h *AddressBookHandler) UpdateWhitelist(c *gin.Context) {
+	uid, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	var request models.UpdateWithdrawalWhitelistRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	whitelist, err := h.addressBookService.SetWhitelist(c.Request.Context(), uid, request.Enabled)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to update withdrawal whitelist")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update withdrawal whitelist"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": whitelist})
+}
+
+func (h *AddressBookHandler) ConfirmAddress(c *gin.Context) {
+	var request models.ConfirmationRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.addressBookService.ConfirmAddress(c.Request.Context(), request.Token); err != nil {
+		h.addressError(c, err, "Failed to confirm withdrawal address")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Withdrawal address confirmed"})
+}
+
+func (h *AddressBookHandler) ConfirmWhitelistDisable(c *gin.Context) {
+	var request models.ConfirmationRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.addressBookService.ConfirmWhitelistDisable(c.Request.Context(), request.Token); err != nil {
+		h.addressError(c, err, "Failed to confirm whitelist change")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Withdrawal whitelist will be turned off after the cooling period"})
+}
+
+func (h *AddressBookHandler) addressError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Withdrawal address not found"})
+	case errors.Is(err, services.ErrInvalidConfirmationToken):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		h.logger.WithError(err).Error(message)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
+
+func currentUser(c *gin.Context) (uuid.UUID, bool) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return uuid.Nil, false
+	}
+
+	uid, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return uuid.Nil, false
+	}
+
+	return uid, true
+}
@@ -2,7 +2,11 @@ package finance
 
 import (
 	"crypto-exchange-go/internal/models"
+	"crypto-exchange-go/internal/payments"
 	"crypto-exchange-go/internal/services"
+	"database/sql"
+	"errors"
+	"io"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -10,6 +14,8 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+const maxWebhookBody = 1 << 20
+
 type DepositHandler struct {
 	depositService *services.DepositService
 	logger         *logrus.Logger
@@ -104,8 +110,7 @@ func (h *DepositHandler) VerifyStripeDeposit(c *gin.Context) {
 
 	result, err := h.depositService.VerifyStripeDeposit(c.Request.Context(), uid, request.PaymentIntentID)
 	if err != nil {
-		h.logger.WithError(err).Error("Failed to verify Stripe deposit")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify deposit"})
+		h.verifyError(c, err, "Stripe")
 		return
 	}
 
@@ -136,14 +141,54 @@ func (h *DepositHandler) VerifyPayPalDeposit(c *gin.Context) {
 
 	result, err := h.depositService.VerifyPayPalDeposit(c.Request.Context(), uid, request.OrderID)
 	if err != nil {
-		h.logger.WithError(err).Error("Failed to verify PayPal deposit")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify deposit"})
+		h.verifyError(c, err, "PayPal")
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"data": result})
 }
 
+func (h *DepositHandler) verifyError(c *gin.Context, err error, provider string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Deposit not found"})
+	case errors.Is(err, services.ErrUnknownPaymentProvider):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": provider + " deposits are not available"})
+	case errors.Is(err, services.ErrPaymentMismatch):
+		c.JSON(http.StatusConflict, gin.H{"error": "Payment does not match deposit"})
+	default:
+		h.logger.WithError(err).Errorf("Failed to verify %s deposit", provider)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify deposit"})
+	}
+}
+
+// PaymentWebhook receives a provider's signed notifications. It's public:
+// the signature, not a session, authenticates the request. Anything but a
+// 2xx makes the provider deliver the event again later.
+func (h *DepositHandler) PaymentWebhook(c *gin.Context) {
+	provider := c.Param("provider")
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookBody))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read body"})
+		return
+	}
+
+	err = h.depositService.HandlePaymentWebhook(c.Request.Context(), provider, c.Request.Header, body)
+	switch {
+	case err == nil, errors.Is(err, services.ErrPaymentMismatch):
+		c.JSON(http.StatusOK, gin.H{"received": true})
+	case errors.Is(err, services.ErrUnknownPaymentProvider):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown provider"})
+	case errors.Is(err, payments.ErrInvalidSignature):
+		h.logger.WithError(err).WithField("provider", provider).Warn("Rejected payment webhook")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid signature"})
+	default:
+		h.logger.WithError(err).WithField("provider", provider).Error("Failed to handle payment webhook")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to handle webhook"})
+	}
+}
+
 func (h *DepositHandler) GetDepositAddress(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
@@ -161,6 +206,10 @@ func (h *DepositHandler) GetDepositAddress(c *gin.Context) {
 	network := c.Query("network")
 
 	address, err := h.depositService.GetDepositAddress(c.Request.Context(), uid, currency, network)
+	if errors.Is(err, services.ErrUnsupportedNetwork) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		h.logger.WithError(err).Error("Failed to get deposit address")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get deposit address"})
@@ -0,0 +1,110 @@
+package finance
+
+import (
+	"crypto-exchange-go/internal/export"
+	"crypto-exchange-go/internal/models"
+	"crypto-exchange-go/internal/services"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+type ExportHandler struct {
+	exportService *services.ExportService
+	logger        *logrus.Logger
+}
+
+func NewExportHandler(exportService *services.ExportService, logger *logrus.Logger) *ExportHandler {
+	return &ExportHandler{
+		exportService: exportService,
+		logger:        logger,
+	}
+}
+
+// Export streams the user's transactions, orders or trades as CSV or XLSX.
+// Transactions take the same filters as the history; orders and trades take
+// symbol, status and from/to.
+func (h *ExportHandler) Export(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	uid, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	dataset := c.Param("dataset")
+	format := export.Format(strings.ToLower(c.DefaultQuery("format", string(export.FormatCSV))))
+	if format != export.FormatCSV && format != export.FormatXLSX {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format"})
+		return
+	}
+
+	var run func(w export.Writer) error
+	switch dataset {
+	case "transactions":
+		filter, err := transactionFilterFromQuery(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		run = func(w export.Writer) error {
+			return h.exportService.ExportTransactions(c.Request.Context(), uid, filter, w)
+		}
+	case "orders", "trades":
+		filter := models.OrderFilter{
+			Symbol: strings.ToUpper(c.Query("symbol")),
+			Status: strings.ToUpper(c.Query("status")),
+		}
+		var err error
+		if filter.From, err = timeQuery(c, "from", false); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if filter.To, err = timeQuery(c, "to", true); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		run = func(w export.Writer) error {
+			if dataset == "orders" {
+				return h.exportService.ExportOrders(c.Request.Context(), uid, filter, w)
+			}
+			return h.exportService.ExportTrades(c.Request.Context(), uid, filter, w)
+		}
+	default:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown export"})
+		return
+	}
+
+	filename := fmt.Sprintf("%s-%s.%s", dataset, time.Now().UTC().Format("20060102"), format)
+	c.Header("Content-Type", format.ContentType())
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+	w, err := export.NewWriter(format, c.Writer, dataset)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := run(w); err != nil {
+		h.logger.WithError(err).WithField("dataset", dataset).Error("Failed to export")
+		// Both writers buffer, so a query that fails up front leaves nothing
+		// on the wire. Once rows are sent the status can't change and the
+		// client sees a truncated file instead.
+		if !c.Writer.Written() {
+			c.Header("Content-Type", "")
+			c.Header("Content-Disposition", "")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export"})
+		}
+		return
+	}
+}
@@ -0,0 +1,55 @@
+package finance
+
+import (
+	"crypto-exchange-go/internal/services"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+type PortfolioHandler struct {
+	valuationService *services.ValuationService
+	logger           *logrus.Logger
+}
+
+func NewPortfolioHandler(valuationService *services.ValuationService, logger *logrus.Logger) *PortfolioHandler {
+	return &PortfolioHandler{
+		valuationService: valuationService,
+		logger:           logger,
+	}
+}
+
+func (h *PortfolioHandler) GetPortfolio(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	uid, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+	if err != nil || days <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid days"})
+		return
+	}
+	if days > 365 {
+		days = 365
+	}
+
+	portfolio, err := h.valuationService.Portfolio(c.Request.Context(), uid, days)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to get portfolio")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get portfolio"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": portfolio})
+}
@@ -0,0 +1,66 @@
+package finance
+
+import (
+	"crypto-exchange-go/internal/services"
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+type ReservesHandler struct {
+	reservesService *services.ReservesService
+	logger          *logrus.Logger
+}
+
+func NewReservesHandler(reservesService *services.ReservesService, logger *logrus.Logger) *ReservesHandler {
+	return &ReservesHandler{
+		reservesService: reservesService,
+		logger:          logger,
+	}
+}
+
+func (h *ReservesHandler) GetProof(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	uid, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	proof, err := h.reservesService.GetProof(c.Request.Context(), uid)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No proof of reserves available for this account yet"})
+		return
+	}
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to get proof of reserves")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get proof of reserves"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": proof})
+}
+
+func (h *ReservesHandler) GetRoot(c *gin.Context) {
+	snapshot, err := h.reservesService.LatestSnapshot(c.Request.Context())
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No proof of reserves published yet"})
+		return
+	}
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to get reserve snapshot")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get reserve snapshot"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": snapshot})
+}
@@ -3,14 +3,19 @@ package finance
 import (
 	"crypto-exchange-go/internal/models"
 	"crypto-exchange-go/internal/services"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 )
 
+const maxTransactionPageSize = 500
+
 type TransactionHandler struct {
 	transactionService *services.TransactionService
 	logger             *logrus.Logger
@@ -36,30 +41,79 @@ func (h *TransactionHandler) GetTransactions(c *gin.Context) {
 		return
 	}
 
-	limitStr := c.DefaultQuery("limit", "50")
-	offsetStr := c.DefaultQuery("offset", "0")
-
-	limit, err := strconv.Atoi(limitStr)
+	filter, err := transactionFilterFromQuery(c)
 	if err != nil {
-		limit = 50
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	offset, err := strconv.Atoi(offsetStr)
-	if err != nil {
-		offset = 0
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 {
+		limit = 50
+	}
+	if limit > maxTransactionPageSize {
+		limit = maxTransactionPageSize
+	}
+	filter.Limit = limit
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		filter.Cursor, err = models.ParseTransactionCursor(cursor)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 	}
 
-	transactionType := c.Query("type")
-	status := c.Query("status")
-
-	transactions, err := h.transactionService.GetTransactions(c.Request.Context(), uid, transactionType, status, limit, offset)
+	page, err := h.transactionService.GetTransactions(c.Request.Context(), uid, filter)
 	if err != nil {
 		h.logger.WithError(err).Error("Failed to get transactions")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get transactions"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"data": transactions})
+	c.JSON(http.StatusOK, gin.H{"data": page.Items, "nextCursor": page.NextCursor})
+}
+
+// timeQuery reads a date or RFC 3339 timestamp from the query string. A bare
+// date used as an upper bound covers that whole day.
+func timeQuery(c *gin.Context, key string, upper bool) (*time.Time, error) {
+	value := c.Query(key)
+	if value == "" {
+		return nil, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: expected YYYY-MM-DD or RFC 3339", key)
+	}
+	if upper {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
+
+func transactionFilterFromQuery(c *gin.Context) (models.TransactionFilter, error) {
+	filter := models.TransactionFilter{
+		Type:        c.Query("type"),
+		Status:      c.Query("status"),
+		Currency:    strings.ToUpper(c.Query("currency")),
+		WalletType:  strings.ToUpper(c.Query("walletType")),
+		ReferenceID: c.Query("referenceId"),
+	}
+
+	var err error
+	if filter.From, err = timeQuery(c, "from", false); err != nil {
+		return filter, err
+	}
+	if filter.To, err = timeQuery(c, "to", true); err != nil {
+		return filter, err
+	}
+
+	return filter, nil
 }
 
 func (h *TransactionHandler) GetTransaction(c *gin.Context) {
@@ -106,9 +160,13 @@ func (h *TransactionHandler) AnalyzeTransactions(c *gin.Context) {
 	}
 
 	var request struct {
-		StartDate string `json:"startDate"`
-		EndDate   string `json:"endDate"`
-		Type      string `json:"type"`
+		StartDate   string `json:"startDate"`
+		EndDate     string `json:"endDate"`
+		Type        string `json:"type"`
+		Status      string `json:"status"`
+		Currency    string `json:"currency"`
+		WalletType  string `json:"walletType"`
+		ReferenceID string `json:"referenceId"`
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
@@ -116,7 +174,13 @@ func (h *TransactionHandler) AnalyzeTransactions(c *gin.Context) {
 		return
 	}
 
-	analysis, err := h.transactionService.AnalyzeTransactions(c.Request.Context(), uid, request.StartDate, request.EndDate, request.Type)
+	analysis, err := h.transactionService.AnalyzeTransactions(c.Request.Context(), uid, request.StartDate, request.EndDate, models.TransactionFilter{
+		Type:        request.Type,
+		Status:      request.Status,
+		Currency:    request.Currency,
+		WalletType:  request.WalletType,
+		ReferenceID: request.ReferenceID,
+	})
 	if err != nil {
 		h.logger.WithError(err).Error("Failed to analyze transactions")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to analyze transactions"})
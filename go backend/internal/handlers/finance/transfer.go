@@ -0,0 +1,139 @@
+package finance
+
+import (
+	"crypto-exchange-go/internal/middleware"
+	"crypto-exchange-go/internal/models"
+	"crypto-exchange-go/internal/services"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+type TransferHandler struct {
+	transferService *services.TransferService
+	logger          *logrus.Logger
+}
+
+func NewTransferHandler(transferService *services.TransferService, logger *logrus.Logger) *TransferHandler {
+	return &TransferHandler{
+		transferService: transferService,
+		logger:          logger,
+	}
+}
+
+func (h *TransferHandler) CreateTransfer(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	uid, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var request models.CreateTransferRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	transfer, err := h.transferService.Transfer(c.Request.Context(), uid, &request, c.GetHeader("Idempotency-Key"))
+	if errors.Is(err, services.ErrWalletFrozen) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrTransferNotAllowed) || errors.Is(err, services.ErrInsufficientBalance) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to transfer funds")
+		// The move runs in one transaction, so a failure left nothing behind.
+		middleware.MarkUncommitted(c)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to transfer funds"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": transfer})
+}
+
+func (h *TransferHandler) PreviewUserTransfer(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	uid, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var request models.UserTransferRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	preview, err := h.transferService.PreviewUserTransfer(c.Request.Context(), uid, &request)
+	if errors.Is(err, services.ErrTransferNotAllowed) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to preview transfer")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to preview transfer"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": preview})
+}
+
+func (h *TransferHandler) CreateUserTransfer(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	uid, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var request models.UserTransferRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	transfer, err := h.transferService.SendToUser(c.Request.Context(), uid, &request, c.GetHeader("Idempotency-Key"))
+	switch {
+	case errors.Is(err, services.ErrOTPRequired), errors.Is(err, services.ErrInvalidOTP), errors.Is(err, services.ErrWalletFrozen):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrTransferNotAllowed), errors.Is(err, services.ErrInsufficientBalance),
+		errors.Is(err, services.ErrDailyLimitExceeded):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrTransferKeyReused):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		h.logger.WithError(err).Error("Failed to send transfer")
+		// The move runs in one transaction, so a failure left nothing behind.
+		middleware.MarkUncommitted(c)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send transfer"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": transfer})
+}
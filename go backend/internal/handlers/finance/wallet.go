@@ -57,6 +57,88 @@ func (h *WalletHandler) GetWallets(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"items": wallets})
 }
 
+func (h *WalletHandler) GetBalanceChanges(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	uid, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	since, err := strconv.ParseInt(c.DefaultQuery("since", "0"), 10, 64)
+	if err != nil || since < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sequence"})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return
+	}
+	if limit > 500 {
+		limit = 500
+	}
+
+	events, err := h.walletService.GetBalanceChanges(c.Request.Context(), uid, since, limit)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to get balance changes")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get balance changes"})
+		return
+	}
+
+	lastSequence := since
+	if len(events) > 0 {
+		lastSequence = events[len(events)-1].Sequence
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items":        events,
+		"lastSequence": lastSequence,
+		"hasMore":      len(events) == limit,
+	})
+}
+
+func (h *WalletHandler) GetWalletLedger(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	uid, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	walletType := models.WalletType(c.Param("type"))
+	currency := c.Param("currency")
+
+	postings, err := h.walletService.GetLedgerHistory(c.Request.Context(), uid, currency, walletType, limit, offset)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to get wallet ledger")
+		c.JSON(http.StatusNotFound, gin.H{"error": "Wallet not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"items": postings})
+}
+
 func (h *WalletHandler) GetWallet(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
@@ -3,6 +3,8 @@ package finance
 import (
 	"crypto-exchange-go/internal/models"
 	"crypto-exchange-go/internal/services"
+	"database/sql"
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -40,11 +42,11 @@ func (h *WithdrawalHandler) CreateFiatWithdrawal(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	request.Device = requestDevice(c)
 
 	withdrawal, err := h.withdrawalService.CreateFiatWithdrawal(c.Request.Context(), uid, &request)
 	if err != nil {
-		h.logger.WithError(err).Error("Failed to create fiat withdrawal")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		h.createError(c, err, "Failed to create fiat withdrawal")
 		return
 	}
 
@@ -69,11 +71,11 @@ func (h *WithdrawalHandler) CreateSpotWithdrawal(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	request.Device = requestDevice(c)
 
 	withdrawal, err := h.withdrawalService.CreateSpotWithdrawal(c.Request.Context(), uid, &request)
 	if err != nil {
-		h.logger.WithError(err).Error("Failed to create spot withdrawal")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		h.createError(c, err, "Failed to create spot withdrawal")
 		return
 	}
 
@@ -124,11 +126,67 @@ func (h *WithdrawalHandler) CancelWithdrawal(c *gin.Context) {
 	}
 
 	err = h.withdrawalService.CancelWithdrawal(c.Request.Context(), uid, withdrawalID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Withdrawal not found"})
+		return
+	}
+	if errors.Is(err, services.ErrWithdrawalStateConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only pending withdrawals can be canceled"})
+		return
+	}
 	if err != nil {
 		h.logger.WithError(err).Error("Failed to cancel withdrawal")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel withdrawal"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Withdrawal canceled successfully"})
 }
+
+// GetLimits shows the user's withdrawal limits and what is left of them.
+func (h *WithdrawalHandler) GetLimits(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	uid, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	limits, err := h.withdrawalService.GetLimits(c.Request.Context(), uid)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to get withdrawal limits")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get withdrawal limits"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": limits})
+}
+
+func (h *WithdrawalHandler) createError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrAddressNotWhitelisted):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidDestination), errors.Is(err, services.ErrInsufficientBalance),
+		errors.Is(err, services.ErrBelowWithdrawalMinimum), errors.Is(err, services.ErrWithdrawalLimitExceeded),
+		errors.Is(err, services.ErrWithdrawalFeeNotConfigured):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		h.logger.WithError(err).Error(message)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// requestDevice identifies the client for risk scoring. Apps send a stable
+// X-Device-Id; browsers are told apart by user agent.
+func requestDevice(c *gin.Context) models.RequestDevice {
+	return models.RequestDevice{
+		ID:        c.GetHeader("X-Device-Id"),
+		UserAgent: c.Request.UserAgent(),
+		IP:        c.ClientIP(),
+	}
+}
@@ -2,44 +2,85 @@ package handlers
 
 import (
 	"context"
+	"crypto-exchange-go/internal/config"
 	"crypto-exchange-go/internal/middleware"
 	"crypto-exchange-go/internal/models"
-	"crypto-exchange-go/internal/services"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"github.com/sirupsen/logrus"
 )
 
 type WebSocketHub struct {
-	clients    map[*WebSocketClient]bool
-	register   chan *WebSocketClient
-	unregister chan *WebSocketClient
-	broadcast  chan []byte
-	logger     *logrus.Logger
-	mu         sync.RWMutex
+	clients          map[*WebSocketClient]bool
+	draining         bool
+	queueSize        int
+	maxLag           time.Duration
+	compression      bool
+	compressionLevel int
+	stats            wsCounters
+	logger           *logrus.Logger
+	mu               sync.RWMutex
 }
 
 type WebSocketClient struct {
 	hub      *WebSocketHub
 	conn     *websocket.Conn
-	send     chan []byte
+	queue    *sendQueue
+	encoding wsEncoding
+	orders   OrderExecutor
 	userID   uuid.UUID
 	symbols  map[string]bool
 	mu       sync.RWMutex
 }
 
+type WebSocketStats struct {
+	Clients                 int    `json:"clients"`
+	Sent                    uint64 `json:"sent"`
+	Dropped                 uint64 `json:"dropped"`
+	Coalesced               uint64 `json:"coalesced"`
+	SlowConsumerDisconnects uint64 `json:"slowConsumerDisconnects"`
+}
+
+type wsCounters struct {
+	sent                    atomic.Uint64
+	dropped                 atomic.Uint64
+	coalesced               atomic.Uint64
+	slowConsumerDisconnects atomic.Uint64
+}
+
 type WebSocketMessage struct {
-	Type    string      `json:"type"`
-	Symbol  string      `json:"symbol,omitempty"`
-	Data    interface{} `json:"data,omitempty"`
-	UserID  string      `json:"userId,omitempty"`
-	Message string      `json:"message,omitempty"`
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Symbol  string          `json:"symbol,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	UserID  string          `json:"userId,omitempty"`
+	Message string          `json:"message,omitempty"`
+}
+
+type WebSocketResponse struct {
+	ID     string      `json:"id,omitempty"`
+	Type   string      `json:"type"`
+	Status string      `json:"status"`
+	Data   interface{} `json:"data,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+type wsOrderRef struct {
+	ID uuid.UUID `json:"id" binding:"required"`
+}
+
+type wsAmendOrder struct {
+	ID uuid.UUID `json:"id" binding:"required"`
+	models.AmendOrderRequest
 }
 
 var upgrader = websocket.Upgrader{
@@ -50,86 +91,220 @@ var upgrader = websocket.Upgrader{
 	WriteBufferSize: 1024,
 }
 
-func NewWebSocketHub(logger *logrus.Logger) *WebSocketHub {
+func NewWebSocketHub(cfg config.WebSocket, logger *logrus.Logger) *WebSocketHub {
+	queueSize := cfg.SendQueueSize
+	if queueSize <= 0 {
+		queueSize = 256
+	}
+
 	return &WebSocketHub{
-		clients:    make(map[*WebSocketClient]bool),
-		register:   make(chan *WebSocketClient),
-		unregister: make(chan *WebSocketClient),
-		broadcast:  make(chan []byte),
-		logger:     logger,
+		clients:          make(map[*WebSocketClient]bool),
+		queueSize:        queueSize,
+		maxLag:           time.Duration(cfg.MaxLagSeconds) * time.Second,
+		compression:      cfg.Compression,
+		compressionLevel: cfg.CompressionLevel,
+		logger:           logger,
+	}
+}
+
+func (h *WebSocketHub) register(client *WebSocketClient) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.draining {
+		return false
+	}
+	h.clients[client] = true
+
+	h.logger.WithField("userID", client.userID).Info("WebSocket client connected")
+	return true
+}
+
+func (h *WebSocketHub) unregister(client *WebSocketClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.clients[client]; ok {
+		delete(h.clients, client)
+		client.queue.close(websocket.CloseNormalClosure, "")
+		h.logger.WithField("userID", client.userID).Info("WebSocket client disconnected")
 	}
 }
 
-func (h *WebSocketHub) Run() {
+func (h *WebSocketHub) Accepting() bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return !h.draining
+}
+
+func (h *WebSocketHub) Presence() map[uuid.UUID]int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	users := make(map[uuid.UUID]int)
+	for client := range h.clients {
+		if client.userID != uuid.Nil {
+			users[client.userID]++
+		}
+	}
+	return users
+}
+
+func (h *WebSocketHub) Drain(ctx context.Context) {
+	h.mu.Lock()
+	h.draining = true
+	clients := make([]*WebSocketClient, 0, len(h.clients))
+	for client := range h.clients {
+		clients = append(clients, client)
+	}
+	h.mu.Unlock()
+
+	var interval time.Duration
+	if deadline, ok := ctx.Deadline(); ok && len(clients) > 0 {
+		interval = time.Until(deadline) / 2 / time.Duration(len(clients))
+	}
+
+	h.logger.WithField("clients", len(clients)).Info("Draining WebSocket connections")
+
+	for _, client := range clients {
+		client.queue.close(websocket.CloseGoingAway, "server draining, reconnect")
+		if interval > 0 && ctx.Err() == nil {
+			timer := time.NewTimer(interval)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+			case <-timer.C:
+			}
+		}
+	}
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
 	for {
+		h.mu.RLock()
+		remaining := len(h.clients)
+		h.mu.RUnlock()
+
+		if remaining == 0 {
+			return
+		}
+
 		select {
-		case client := <-h.register:
-			h.mu.Lock()
-			h.clients[client] = true
-			h.mu.Unlock()
-			h.logger.WithField("userID", client.userID).Info("WebSocket client connected")
-
-		case client := <-h.unregister:
-			h.mu.Lock()
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.send)
-			}
-			h.mu.Unlock()
-			h.logger.WithField("userID", client.userID).Info("WebSocket client disconnected")
-
-		case message := <-h.broadcast:
-			h.mu.RLock()
-			for client := range h.clients {
-				select {
-				case client.send <- message:
-				default:
-					delete(h.clients, client)
-					close(client.send)
-				}
-			}
-			h.mu.RUnlock()
+		case <-ctx.Done():
+			h.logger.WithField("clients", remaining).Warn("WebSocket drain deadline reached")
+			return
+		case <-ticker.C:
 		}
 	}
 }
 
+func (h *WebSocketHub) upgrade(c *gin.Context, subprotocols []string) (*websocket.Conn, error) {
+	u := upgrader
+	u.EnableCompression = h.compression
+	u.Subprotocols = subprotocols
+
+	conn, err := u.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if h.compression && h.compressionLevel != 0 {
+		if err := conn.SetCompressionLevel(h.compressionLevel); err != nil {
+			h.logger.WithError(err).Warn("Invalid WebSocket compression level")
+		}
+	}
+
+	return conn, nil
+}
+
+func (h *WebSocketHub) newClient(conn *websocket.Conn, userID uuid.UUID, encoding wsEncoding) *WebSocketClient {
+	return &WebSocketClient{
+		hub:      h,
+		conn:     conn,
+		queue:    newSendQueue(h.queueSize, h.maxLag),
+		encoding: encoding,
+		userID:   userID,
+		symbols:  make(map[string]bool),
+	}
+}
+
+func (h *WebSocketHub) deliver(client *WebSocketClient, key string, frame *wsFrame) bool {
+	result, dropped := client.queue.push(key, frame)
+	h.stats.dropped.Add(uint64(dropped))
+
+	switch result {
+	case queueAccepted:
+		return true
+	case queueCoalesced:
+		h.stats.coalesced.Add(1)
+		return true
+	case queueLagged:
+		h.stats.slowConsumerDisconnects.Add(1)
+		h.logger.WithField("userID", client.userID).Warn("Disconnecting slow WebSocket consumer")
+		return false
+	default:
+		return false
+	}
+}
+
 func (h *WebSocketHub) BroadcastToUser(userID uuid.UUID, message []byte) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
+	frame := newWSFrame(message)
 	for client := range h.clients {
 		if client.userID == userID {
-			select {
-			case client.send <- message:
-			default:
-				delete(h.clients, client)
-				close(client.send)
-			}
+			h.deliver(client, "", frame)
 		}
 	}
 }
 
 func (h *WebSocketHub) BroadcastToSymbol(symbol string, message []byte) {
+	h.broadcastToSymbol(symbol, "", message)
+}
+
+func (h *WebSocketHub) BroadcastSnapshot(symbol, stream string, message []byte) {
+	h.broadcastToSymbol(symbol, stream+":"+symbol, message)
+}
+
+func (h *WebSocketHub) broadcastToSymbol(symbol, key string, message []byte) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
+	frame := newWSFrame(message)
 	for client := range h.clients {
 		client.mu.RLock()
 		isWatching := client.symbols[symbol]
 		client.mu.RUnlock()
 
 		if isWatching {
-			select {
-			case client.send <- message:
-			default:
-				delete(h.clients, client)
-				close(client.send)
-			}
+			h.deliver(client, key, frame)
 		}
 	}
 }
 
-func (h *Handlers) HandleOrderWebSocket(hub *WebSocketHub) gin.HandlerFunc {
+func (h *WebSocketHub) Stats() WebSocketStats {
+	h.mu.RLock()
+	clients := len(h.clients)
+	h.mu.RUnlock()
+
+	return WebSocketStats{
+		Clients:                 clients,
+		Sent:                    h.stats.sent.Load(),
+		Dropped:                 h.stats.dropped.Load(),
+		Coalesced:               h.stats.coalesced.Load(),
+		SlowConsumerDisconnects: h.stats.slowConsumerDisconnects.Load(),
+	}
+}
+
+func (h *Handlers) GetWebSocketStats(hub *WebSocketHub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"data": hub.Stats()})
+	}
+}
+
+func (h *Handlers) HandleOrderWebSocket(hub *WebSocketHub, orders OrderExecutor) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		user, exists := middleware.GetUserFromContext(c)
 		if !exists {
@@ -137,21 +312,25 @@ func (h *Handlers) HandleOrderWebSocket(hub *WebSocketHub) gin.HandlerFunc {
 			return
 		}
 
-		conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+		if !hub.Accepting() {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Server is draining connections"})
+			return
+		}
+
+		conn, err := hub.upgrade(c, nil)
 		if err != nil {
 			h.logger.WithError(err).Error("Failed to upgrade WebSocket connection")
 			return
 		}
 
-		client := &WebSocketClient{
-			hub:     hub,
-			conn:    conn,
-			send:    make(chan []byte, 256),
-			userID:  user.ID,
-			symbols: make(map[string]bool),
-		}
+		client := hub.newClient(conn, user.ID, wsEncodingJSON)
+		client.orders = orders
 
-		client.hub.register <- client
+		if !hub.register(client) {
+			conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server draining, reconnect"))
+			conn.Close()
+			return
+		}
 
 		go client.writePump()
 		go client.readPump(h)
@@ -160,20 +339,29 @@ func (h *Handlers) HandleOrderWebSocket(hub *WebSocketHub) gin.HandlerFunc {
 
 func (h *Handlers) HandleMarketWebSocket(hub *WebSocketHub) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+		if !hub.Accepting() {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Server is draining connections"})
+			return
+		}
+
+		conn, err := hub.upgrade(c, []string{wsProtocolMsgpack, wsProtocolJSON})
 		if err != nil {
 			h.logger.WithError(err).Error("Failed to upgrade WebSocket connection")
 			return
 		}
 
-		client := &WebSocketClient{
-			hub:     hub,
-			conn:    conn,
-			send:    make(chan []byte, 256),
-			symbols: make(map[string]bool),
+		encoding := wsEncodingJSON
+		if conn.Subprotocol() == wsProtocolMsgpack || c.Query("encoding") == wsProtocolMsgpack {
+			encoding = wsEncodingMsgpack
 		}
 
-		client.hub.register <- client
+		client := hub.newClient(conn, uuid.Nil, encoding)
+
+		if !hub.register(client) {
+			conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server draining, reconnect"))
+			conn.Close()
+			return
+		}
 
 		go client.writePump()
 		go client.readPumpMarket(h)
@@ -182,11 +370,11 @@ func (h *Handlers) HandleMarketWebSocket(hub *WebSocketHub) gin.HandlerFunc {
 
 func (c *WebSocketClient) readPump(h *Handlers) {
 	defer func() {
-		c.hub.unregister <- c
+		c.hub.unregister(c)
 		c.conn.Close()
 	}()
 
-	c.conn.SetReadLimit(512)
+	c.conn.SetReadLimit(4096)
 	c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
 	c.conn.SetPongHandler(func(string) error {
 		c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
@@ -205,6 +393,7 @@ func (c *WebSocketClient) readPump(h *Handlers) {
 		var msg WebSocketMessage
 		if err := json.Unmarshal(messageBytes, &msg); err != nil {
 			h.logger.WithError(err).Error("Failed to unmarshal WebSocket message")
+			c.replyError(h, &msg, fmt.Errorf("invalid message: %w", err))
 			continue
 		}
 
@@ -219,24 +408,83 @@ func (c *WebSocketClient) readPump(h *Handlers) {
 			delete(c.symbols, msg.Symbol)
 			c.mu.Unlock()
 
-		case "cancelOrder":
-			if msg.Data != nil {
-				if orderIDStr, ok := msg.Data.(string); ok {
-					if orderID, err := uuid.Parse(orderIDStr); err == nil {
-						ctx := context.Background()
-						if err := h.orderService.CancelOrder(ctx, c.userID, orderID); err != nil {
-							h.logger.WithError(err).Error("Failed to cancel order via WebSocket")
-						}
-					}
-				}
-			}
+		case "placeOrder", "amendOrder", "cancelOrder", "cancelAll":
+			c.handleOrderRequest(h, &msg)
+
+		default:
+			c.replyError(h, &msg, fmt.Errorf("unknown message type: %s", msg.Type))
+		}
+	}
+}
+
+func (c *WebSocketClient) handleOrderRequest(h *Handlers, msg *WebSocketMessage) {
+	var result interface{}
+	err := errOrdersUnavailable
+	if c.orders != nil {
+		result, err = c.orders.ExecuteOrder(context.Background(), c.userID, msg)
+	}
+
+	if err != nil {
+		h.logger.WithError(err).WithField("type", msg.Type).Error("WebSocket order request failed")
+		c.replyError(h, msg, err)
+		return
+	}
+
+	c.reply(h, &WebSocketResponse{
+		ID:     msg.ID,
+		Type:   msg.Type,
+		Status: "ack",
+		Data:   result,
+	})
+}
+
+func decodeOrderPayload(data json.RawMessage, dst interface{}) error {
+	if len(data) == 0 {
+		return fmt.Errorf("data is required")
+	}
+	if err := json.Unmarshal(data, dst); err != nil {
+		return fmt.Errorf("invalid data: %w", err)
+	}
+	return binding.Validator.ValidateStruct(dst)
+}
+
+func decodeOrderRef(data json.RawMessage, ref *wsOrderRef) error {
+	var orderID string
+	if err := json.Unmarshal(data, &orderID); err == nil {
+		id, err := uuid.Parse(orderID)
+		if err != nil {
+			return fmt.Errorf("invalid order ID")
 		}
+		ref.ID = id
+		return nil
+	}
+	return decodeOrderPayload(data, ref)
+}
+
+func (c *WebSocketClient) replyError(h *Handlers, msg *WebSocketMessage, err error) {
+	c.reply(h, &WebSocketResponse{
+		ID:     msg.ID,
+		Type:   msg.Type,
+		Status: "error",
+		Error:  err.Error(),
+	})
+}
+
+func (c *WebSocketClient) reply(h *Handlers, resp *WebSocketResponse) {
+	payload, err := json.Marshal(resp)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to marshal WebSocket response")
+		return
+	}
+
+	if !c.hub.deliver(c, "", newWSFrame(payload)) {
+		h.logger.WithField("userID", c.userID).Warn("WebSocket send queue full, dropping response")
 	}
 }
 
 func (c *WebSocketClient) readPumpMarket(h *Handlers) {
 	defer func() {
-		c.hub.unregister <- c
+		c.hub.unregister(c)
 		c.conn.Close()
 	}()
 
@@ -285,26 +533,18 @@ func (c *WebSocketClient) writePump() {
 
 	for {
 		select {
-		case message, ok := <-c.send:
+		case <-c.queue.notify:
+			frames, closed := c.queue.drain()
 			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-			if !ok {
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
-				return
-			}
 
-			w, err := c.conn.NextWriter(websocket.TextMessage)
-			if err != nil {
-				return
-			}
-			w.Write(message)
-
-			n := len(c.send)
-			for i := 0; i < n; i++ {
-				w.Write([]byte{'\n'})
-				w.Write(<-c.send)
+			if len(frames) > 0 {
+				if err := c.writeFrames(frames); err != nil {
+					return
+				}
 			}
 
-			if err := w.Close(); err != nil {
+			if closed {
+				c.conn.WriteMessage(websocket.CloseMessage, c.queue.closeMessage())
 				return
 			}
 
@@ -316,3 +556,38 @@ func (c *WebSocketClient) writePump() {
 		}
 	}
 }
+
+func (c *WebSocketClient) writeFrames(frames []*wsFrame) error {
+	if c.encoding == wsEncodingMsgpack {
+		for _, frame := range frames {
+			data, err := frame.encode(c.encoding)
+			if err != nil {
+				c.hub.stats.dropped.Add(1)
+				c.hub.logger.WithError(err).Warn("Failed to encode WebSocket message")
+				continue
+			}
+			if err := c.conn.WriteMessage(websocket.BinaryMessage, data); err != nil {
+				return err
+			}
+			c.hub.stats.sent.Add(1)
+		}
+		return nil
+	}
+
+	w, err := c.conn.NextWriter(websocket.TextMessage)
+	if err != nil {
+		return err
+	}
+	for i, frame := range frames {
+		if i > 0 {
+			w.Write([]byte{'\n'})
+		}
+		w.Write(frame.json)
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	c.hub.stats.sent.Add(uint64(len(frames)))
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+type wsEncoding int
+
+const (
+	wsEncodingJSON wsEncoding = iota
+	wsEncodingMsgpack
+)
+
+const (
+	wsProtocolJSON    = "json"
+	wsProtocolMsgpack = "msgpack"
+)
+
+func (e wsEncoding) String() string {
+	if e == wsEncodingMsgpack {
+		return wsProtocolMsgpack
+	}
+	return wsProtocolJSON
+}
+
+type wsFrame struct {
+	json    []byte
+	once    sync.Once
+	msgpack []byte
+	err     error
+}
+
+func newWSFrame(payload []byte) *wsFrame {
+	return &wsFrame{json: payload}
+}
+
+func (f *wsFrame) encode(encoding wsEncoding) ([]byte, error) {
+	if encoding != wsEncodingMsgpack {
+		return f.json, nil
+	}
+
+	f.once.Do(func() {
+		f.msgpack, f.err = jsonToMsgpack(f.json)
+	})
+	return f.msgpack, f.err
+}
+
+func jsonToMsgpack(payload []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("failed to decode message: %w", err)
+	}
+
+	data, err := msgpack.Marshal(normalizeJSONNumbers(value))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode message: %w", err)
+	}
+
+	return data, nil
+}
+
+func normalizeJSONNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = normalizeJSONNumbers(item)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalizeJSONNumbers(item)
+		}
+		return v
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+		return v.String()
+	default:
+		return v
+	}
+}
@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"context"
+	"crypto-exchange-go/internal/database"
+	"crypto-exchange-go/internal/services"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	wsUserChannel      = "ws:user:"
+	wsSymbolChannel    = "ws:symbol:"
+	wsSnapshotChannel  = "ws:snapshot:"
+	engineOrderChannel = "order:"
+	engineBookChannel  = "orderbook:"
+	presenceInterval   = 15 * time.Second
+)
+
+type WebSocketPublisher interface {
+	BroadcastToUser(userID uuid.UUID, message []byte)
+	BroadcastToSymbol(symbol string, message []byte)
+	BroadcastSnapshot(symbol, stream string, message []byte)
+}
+
+type WebSocketBroker struct {
+	redis  *database.Redis
+	logger *logrus.Logger
+}
+
+func NewWebSocketBroker(redis *database.Redis, logger *logrus.Logger) *WebSocketBroker {
+	return &WebSocketBroker{
+		redis:  redis,
+		logger: logger,
+	}
+}
+
+func (b *WebSocketBroker) BroadcastToUser(userID uuid.UUID, message []byte) {
+	b.publish(wsUserChannel+userID.String(), message)
+}
+
+func (b *WebSocketBroker) BroadcastToSymbol(symbol string, message []byte) {
+	b.publish(wsSymbolChannel+symbol, message)
+}
+
+func (b *WebSocketBroker) BroadcastSnapshot(symbol, stream string, message []byte) {
+	b.publish(wsSnapshotChannel+stream+":"+symbol, message)
+}
+
+func (b *WebSocketBroker) publish(channel string, message []byte) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := b.redis.Publish(ctx, channel, message); err != nil {
+		b.logger.WithError(err).WithField("channel", channel).Error("Failed to publish WebSocket message")
+	}
+}
+
+type WebSocketGateway struct {
+	id       string
+	hub      *WebSocketHub
+	redis    *database.Redis
+	presence *services.PresenceService
+	logger   *logrus.Logger
+	stop     chan struct{}
+	stopped  chan struct{}
+
+	pending   map[string]chan wsOrderReply
+	pendingMu sync.Mutex
+}
+
+func NewWebSocketGateway(id string, hub *WebSocketHub, redis *database.Redis, presence *services.PresenceService, logger *logrus.Logger) *WebSocketGateway {
+	return &WebSocketGateway{
+		id:       id,
+		hub:      hub,
+		redis:    redis,
+		presence: presence,
+		logger:   logger,
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+		pending:  make(map[string]chan wsOrderReply),
+	}
+}
+
+func (g *WebSocketGateway) Run(ctx context.Context) {
+	go g.heartbeat(ctx)
+	g.fanOut(ctx)
+}
+
+func (g *WebSocketGateway) Shutdown(ctx context.Context) {
+	g.hub.Drain(ctx)
+
+	close(g.stop)
+	select {
+	case <-g.stopped:
+	case <-ctx.Done():
+	}
+
+	if err := g.presence.RemoveGateway(ctx, g.id); err != nil {
+		g.logger.WithError(err).Error("Failed to remove gateway presence")
+	}
+}
+
+func (g *WebSocketGateway) fanOut(ctx context.Context) {
+	pubsub := g.redis.PSubscribe(ctx,
+		wsUserChannel+"*",
+		wsSymbolChannel+"*",
+		wsSnapshotChannel+"*",
+		engineOrderChannel+"*",
+		engineBookChannel+"*",
+		services.BalanceEventChannel+"*",
+		wsOrderReplies+g.id,
+	)
+	defer pubsub.Close()
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			g.route(msg.Channel, []byte(msg.Payload))
+		}
+	}
+}
+
+func (g *WebSocketGateway) route(channel string, payload []byte) {
+	switch {
+	case channel == wsOrderReplies+g.id:
+		g.resolveOrderReply(payload)
+
+	case strings.HasPrefix(channel, wsUserChannel):
+		userID, err := uuid.Parse(strings.TrimPrefix(channel, wsUserChannel))
+		if err != nil {
+			g.logger.WithField("channel", channel).Warn("Invalid user channel")
+			return
+		}
+		g.hub.BroadcastToUser(userID, payload)
+
+	case strings.HasPrefix(channel, wsSymbolChannel):
+		g.hub.BroadcastToSymbol(strings.TrimPrefix(channel, wsSymbolChannel), payload)
+
+	case strings.HasPrefix(channel, wsSnapshotChannel):
+		stream, symbol, ok := strings.Cut(strings.TrimPrefix(channel, wsSnapshotChannel), ":")
+		if !ok {
+			g.logger.WithField("channel", channel).Warn("Invalid snapshot channel")
+			return
+		}
+		g.hub.BroadcastSnapshot(symbol, stream, payload)
+
+	case strings.HasPrefix(channel, engineBookChannel):
+		symbol := strings.TrimPrefix(channel, engineBookChannel)
+		message, err := json.Marshal(map[string]interface{}{
+			"stream": "orderbook",
+			"symbol": symbol,
+			"data":   json.RawMessage(payload),
+		})
+		if err != nil {
+			g.logger.WithError(err).Error("Failed to marshal order book message")
+			return
+		}
+		g.hub.BroadcastSnapshot(symbol, "orderbook", message)
+
+	case strings.HasPrefix(channel, engineOrderChannel):
+		g.routeToUser(channel, engineOrderChannel, "order", payload)
+
+	case strings.HasPrefix(channel, services.BalanceEventChannel):
+		g.routeToUser(channel, services.BalanceEventChannel, "balance", payload)
+	}
+}
+
+func (g *WebSocketGateway) routeToUser(channel, prefix, stream string, payload []byte) {
+	userID, err := uuid.Parse(strings.TrimPrefix(channel, prefix))
+	if err != nil {
+		g.logger.WithField("channel", channel).Warnf("Invalid %s channel", stream)
+		return
+	}
+
+	message, err := json.Marshal(map[string]interface{}{
+		"stream": stream,
+		"data":   json.RawMessage(payload),
+	})
+	if err != nil {
+		g.logger.WithError(err).Errorf("Failed to marshal %s message", stream)
+		return
+	}
+
+	g.hub.BroadcastToUser(userID, message)
+}
+
+func (g *WebSocketGateway) heartbeat(ctx context.Context) {
+	defer close(g.stopped)
+
+	ticker := time.NewTicker(presenceInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := g.presence.Heartbeat(ctx, g.id, g.hub.Presence()); err != nil && ctx.Err() == nil {
+			g.logger.WithError(err).Error("Failed to record gateway presence")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-g.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
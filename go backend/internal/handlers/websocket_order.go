@@ -17,7 +17,7 @@ import (
 type OrderHandler struct {
 	orderService   *services.OrderService
 	walletService  *services.WalletService
-	hub           *WebSocketHub
+	hub           WebSocketPublisher
 	logger        *logrus.Logger
 	trackedOrders map[string][]*TrackedOrder
 	watchedUsers  map[string]bool
@@ -40,7 +40,7 @@ type TrackedOrder struct {
 var orderHandlerInstance *OrderHandler
 var orderHandlerOnce sync.Once
 
-func GetOrderHandler(orderService *services.OrderService, walletService *services.WalletService, hub *WebSocketHub, logger *logrus.Logger) *OrderHandler {
+func GetOrderHandler(orderService *services.OrderService, walletService *services.WalletService, hub WebSocketPublisher, logger *logrus.Logger) *OrderHandler {
 	orderHandlerOnce.Do(func() {
 		orderHandlerInstance = &OrderHandler{
 			orderService:  orderService,
@@ -275,17 +275,50 @@ func (oh *OrderHandler) updateWalletBalance(ctx context.Context, userID uuid.UUI
 	pair := parts[1]
 
 	if order.Side == "BUY" {
+		pairWallet, err := oh.walletService.GetWallet(ctx, userID, pair, models.WalletTypeSpot)
+		if err != nil {
+			return fmt.Errorf("failed to get pair wallet: %w", err)
+		}
+
+		held := order.Amount.Mul(order.Price)
+		spent := order.Cost
+		if !spent.IsPositive() || spent.GreaterThan(held) {
+			spent = held
+		}
+
+		err = oh.walletService.Capture(ctx, pairWallet.ID, spent, models.BalanceReasonTrade, order.ID.String())
+		if err != nil {
+			return fmt.Errorf("failed to capture pair wallet hold: %w", err)
+		}
+
+		if leftover := held.Sub(spent); leftover.IsPositive() {
+			err = oh.walletService.Release(ctx, pairWallet.ID, leftover, models.BalanceReasonTrade, order.ID.String())
+			if err != nil {
+				return fmt.Errorf("failed to release pair wallet hold: %w", err)
+			}
+		}
+
 		currencyWallet, err := oh.walletService.GetOrCreateWallet(ctx, userID, currency, models.WalletTypeSpot)
 		if err != nil {
 			return fmt.Errorf("failed to get currency wallet: %w", err)
 		}
 
 		netAmount := order.Amount.Sub(order.Fee)
-		err = oh.walletService.UpdateBalance(ctx, currencyWallet.ID, netAmount)
+		err = oh.walletService.UpdateBalance(ctx, currencyWallet.ID, netAmount, models.BalanceReasonTrade, order.ID.String())
 		if err != nil {
 			return fmt.Errorf("failed to update currency wallet balance: %w", err)
 		}
 	} else {
+		currencyWallet, err := oh.walletService.GetWallet(ctx, userID, currency, models.WalletTypeSpot)
+		if err != nil {
+			return fmt.Errorf("failed to get currency wallet: %w", err)
+		}
+
+		err = oh.walletService.Capture(ctx, currencyWallet.ID, order.Amount, models.BalanceReasonTrade, order.ID.String())
+		if err != nil {
+			return fmt.Errorf("failed to capture currency wallet hold: %w", err)
+		}
+
 		pairWallet, err := oh.walletService.GetOrCreateWallet(ctx, userID, pair, models.WalletTypeSpot)
 		if err != nil {
 			return fmt.Errorf("failed to get pair wallet: %w", err)
@@ -293,7 +326,7 @@ func (oh *OrderHandler) updateWalletBalance(ctx context.Context, userID uuid.UUI
 
 		proceeds := order.Amount.Mul(order.Price)
 		netProceeds := proceeds.Sub(order.Fee)
-		err = oh.walletService.UpdateBalance(ctx, pairWallet.ID, netProceeds)
+		err = oh.walletService.UpdateBalance(ctx, pairWallet.ID, netProceeds, models.BalanceReasonTrade, order.ID.String())
 		if err != nil {
 			return fmt.Errorf("failed to update pair wallet balance: %w", err)
 		}
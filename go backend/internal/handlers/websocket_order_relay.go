@@ -0,0 +1,283 @@
+package handlers
+
+import (
+	"context"
+	"crypto-exchange-go/internal/database"
+	"crypto-exchange-go/internal/models"
+	"crypto-exchange-go/internal/services"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	wsOrderRequests     = "ws:order:requests:"
+	wsOrderReplies      = "ws:order:reply:"
+	wsOrderShardLease   = "ws:order:lease:"
+	orderRequestTimeout = 10 * time.Second
+	// Order requests are queued in shards by user. However many API
+	// processes run, each shard is worked by the one holding its lease, so
+	// a user's requests run one at a time, in order.
+	orderRequestShards = 16
+	// A lease outlives the longest round of the shard loop: a queue poll
+	// plus a request running to its deadline.
+	orderShardLease      = 30 * time.Second
+	orderShardLeaseRetry = 2 * time.Second
+	orderRequestPoll     = 5 * time.Second
+)
+
+var errOrdersUnavailable = errors.New("order requests are not available")
+
+// holdLease takes a free lease or extends one the caller already holds.
+var holdLease = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return 1
+end
+return 0`)
+
+// releaseLease drops a lease only if the caller still holds it.
+var releaseLease = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// orderRequestQueue is the queue of the shard userID's requests go to.
+func orderRequestQueue(userID uuid.UUID) string {
+	hash := fnv.New32a()
+	hash.Write(userID[:])
+	return fmt.Sprintf("%s%d", wsOrderRequests, hash.Sum32()%orderRequestShards)
+}
+
+// OrderExecutor runs the order requests a client sends over the order
+// WebSocket.
+type OrderExecutor interface {
+	ExecuteOrder(ctx context.Context, userID uuid.UUID, msg *WebSocketMessage) (interface{}, error)
+}
+
+type wsOrderRequest struct {
+	ID       string           `json:"id"`
+	ReplyTo  string           `json:"replyTo"`
+	UserID   uuid.UUID        `json:"userId"`
+	Deadline time.Time        `json:"deadline"`
+	Message  WebSocketMessage `json:"message"`
+}
+
+type wsOrderReply struct {
+	ID    string          `json:"id"`
+	Data  json.RawMessage `json:"data,omitempty"`
+	Error string          `json:"error,omitempty"`
+}
+
+// ExecuteOrder queues the request for the API process, which owns the
+// matching engine, and waits for its reply.
+func (g *WebSocketGateway) ExecuteOrder(ctx context.Context, userID uuid.UUID, msg *WebSocketMessage) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, orderRequestTimeout)
+	defer cancel()
+
+	deadline, _ := ctx.Deadline()
+	req := wsOrderRequest{
+		ID:       uuid.New().String(),
+		ReplyTo:  wsOrderReplies + g.id,
+		UserID:   userID,
+		Deadline: deadline,
+		Message:  *msg,
+	}
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal order request: %w", err)
+	}
+
+	reply := make(chan wsOrderReply, 1)
+	g.pendingMu.Lock()
+	g.pending[req.ID] = reply
+	g.pendingMu.Unlock()
+	defer func() {
+		g.pendingMu.Lock()
+		delete(g.pending, req.ID)
+		g.pendingMu.Unlock()
+	}()
+
+	if err := g.redis.Client().LPush(ctx, orderRequestQueue(userID), payload).Err(); err != nil {
+		return nil, fmt.Errorf("failed to queue order request: %w", err)
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, fmt.Errorf("order request timed out")
+	case r := <-reply:
+		if r.Error != "" {
+			return nil, errors.New(r.Error)
+		}
+		return r.Data, nil
+	}
+}
+
+func (g *WebSocketGateway) resolveOrderReply(payload []byte) {
+	var reply wsOrderReply
+	if err := json.Unmarshal(payload, &reply); err != nil {
+		g.logger.WithError(err).Warn("Invalid order reply")
+		return
+	}
+
+	g.pendingMu.Lock()
+	waiting, ok := g.pending[reply.ID]
+	g.pendingMu.Unlock()
+
+	if ok {
+		waiting <- reply
+	}
+}
+
+// OrderRequestWorker runs in the API process and executes the order requests
+// gateways queue in Redis. It works every shard whose lease it can get, each
+// one request at a time, so a user's requests keep their order across API
+// processes.
+type OrderRequestWorker struct {
+	id           string
+	orderService *services.OrderService
+	redis        *database.Redis
+	logger       *logrus.Logger
+}
+
+func NewOrderRequestWorker(orderService *services.OrderService, redis *database.Redis, logger *logrus.Logger) *OrderRequestWorker {
+	return &OrderRequestWorker{
+		id:           uuid.New().String(),
+		orderService: orderService,
+		redis:        redis,
+		logger:       logger,
+	}
+}
+
+func (w *OrderRequestWorker) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for shard := 0; shard < orderRequestShards; shard++ {
+		wg.Add(1)
+		go func(shard int) {
+			defer wg.Done()
+			w.runShard(ctx, shard)
+		}(shard)
+	}
+	wg.Wait()
+}
+
+// runShard works the shard's queue while it holds the shard's lease, and
+// waits for the lease while another process holds it.
+func (w *OrderRequestWorker) runShard(ctx context.Context, shard int) {
+	queue := fmt.Sprintf("%s%d", wsOrderRequests, shard)
+	lease := fmt.Sprintf("%s%d", wsOrderShardLease, shard)
+	defer releaseLease.Run(context.Background(), w.redis.Client(), []string{lease}, w.id)
+
+	for ctx.Err() == nil {
+		held, err := holdLease.Run(ctx, w.redis.Client(), []string{lease}, w.id, orderShardLease.Milliseconds()).Int()
+		if err != nil && ctx.Err() == nil {
+			w.logger.WithError(err).WithField("shard", shard).Error("Failed to take order request lease")
+		}
+		if held != 1 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(orderShardLeaseRetry):
+			}
+			continue
+		}
+
+		w.next(ctx, queue)
+	}
+}
+
+// next executes the queue's next request, if one arrives within the poll.
+func (w *OrderRequestWorker) next(ctx context.Context, queue string) {
+	result, err := w.redis.Client().BRPop(ctx, orderRequestPoll, queue).Result()
+	if errors.Is(err, redis.Nil) || ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		w.logger.WithError(err).Error("Failed to read order requests")
+		time.Sleep(time.Second)
+		return
+	}
+
+	var req wsOrderRequest
+	if err := json.Unmarshal([]byte(result[1]), &req); err != nil {
+		w.logger.WithError(err).Warn("Invalid order request")
+		return
+	}
+
+	// The gateway has already told the client this request failed.
+	if time.Now().After(req.Deadline) {
+		w.logger.WithField("type", req.Message.Type).Warn("Dropping expired order request")
+		return
+	}
+
+	w.reply(ctx, &req, w.execute(ctx, &req))
+}
+
+func (w *OrderRequestWorker) execute(ctx context.Context, req *wsOrderRequest) *wsOrderReply {
+	ctx, cancel := context.WithDeadline(ctx, req.Deadline)
+	defer cancel()
+
+	reply := &wsOrderReply{ID: req.ID}
+	result, err := executeOrderRequest(ctx, w.orderService, req.UserID, &req.Message)
+	if err == nil {
+		reply.Data, err = json.Marshal(result)
+	}
+	if err != nil {
+		reply.Error = err.Error()
+	}
+	return reply
+}
+
+func (w *OrderRequestWorker) reply(ctx context.Context, req *wsOrderRequest, reply *wsOrderReply) {
+	payload, err := json.Marshal(reply)
+	if err != nil {
+		w.logger.WithError(err).Error("Failed to marshal order reply")
+		return
+	}
+
+	if err := w.redis.Publish(ctx, req.ReplyTo, payload); err != nil {
+		w.logger.WithError(err).WithField("replyTo", req.ReplyTo).Error("Failed to publish order reply")
+	}
+}
+
+func executeOrderRequest(ctx context.Context, orderService *services.OrderService, userID uuid.UUID, msg *WebSocketMessage) (interface{}, error) {
+	switch msg.Type {
+	case "placeOrder":
+		var req models.CreateOrderRequest
+		if err := decodeOrderPayload(msg.Data, &req); err != nil {
+			return nil, err
+		}
+		return orderService.CreateOrder(ctx, userID, &req)
+
+	case "amendOrder":
+		var req wsAmendOrder
+		if err := decodeOrderPayload(msg.Data, &req); err != nil {
+			return nil, err
+		}
+		return orderService.AmendOrder(ctx, userID, req.ID, &req.AmendOrderRequest)
+
+	case "cancelOrder":
+		var ref wsOrderRef
+		if err := decodeOrderRef(msg.Data, &ref); err != nil {
+			return nil, err
+		}
+		if err := orderService.CancelOrder(ctx, userID, ref.ID); err != nil {
+			return nil, err
+		}
+		return orderService.GetOrder(ctx, userID, ref.ID)
+
+	case "cancelAll":
+		return orderService.CancelAllOrders(ctx, userID, msg.Symbol)
+	}
+
+	return nil, fmt.Errorf("unknown message type: %s", msg.Type)
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+type queueResult int
+
+const (
+	queueAccepted queueResult = iota
+	queueCoalesced
+	queueDropped
+	queueLagged
+)
+
+type outboundMessage struct {
+	key      string
+	frame    *wsFrame
+	queuedAt time.Time
+}
+
+type sendQueue struct {
+	mu          sync.Mutex
+	items       []*outboundMessage
+	keyed       map[string]*outboundMessage
+	limit       int
+	maxLag      time.Duration
+	notify      chan struct{}
+	closed      bool
+	closeCode   int
+	closeReason string
+}
+
+func newSendQueue(limit int, maxLag time.Duration) *sendQueue {
+	return &sendQueue{
+		items:  make([]*outboundMessage, 0, limit),
+		keyed:  make(map[string]*outboundMessage),
+		limit:  limit,
+		maxLag: maxLag,
+		notify: make(chan struct{}, 1),
+	}
+}
+
+func (q *sendQueue) push(key string, frame *wsFrame) (queueResult, int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return queueDropped, 1
+	}
+
+	now := time.Now()
+	if q.maxLag > 0 && len(q.items) > 0 && now.Sub(q.items[0].queuedAt) > q.maxLag {
+		discarded := len(q.items) + 1
+		q.items = q.items[:0]
+		q.keyed = make(map[string]*outboundMessage)
+		q.closeLocked(websocket.ClosePolicyViolation, "slow consumer: send queue lag exceeded")
+		return queueLagged, discarded
+	}
+
+	if key != "" {
+		if pending, ok := q.keyed[key]; ok {
+			pending.frame = frame
+			return queueCoalesced, 0
+		}
+	}
+
+	if len(q.items) >= q.limit {
+		return queueDropped, 1
+	}
+
+	msg := &outboundMessage{key: key, frame: frame, queuedAt: now}
+	q.items = append(q.items, msg)
+	if key != "" {
+		q.keyed[key] = msg
+	}
+
+	q.signal()
+	return queueAccepted, 0
+}
+
+func (q *sendQueue) drain() ([]*wsFrame, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	frames := make([]*wsFrame, len(q.items))
+	for i, msg := range q.items {
+		frames[i] = msg.frame
+	}
+
+	q.items = q.items[:0]
+	q.keyed = make(map[string]*outboundMessage)
+
+	return frames, q.closed
+}
+
+func (q *sendQueue) close(code int, reason string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closeLocked(code, reason)
+}
+
+func (q *sendQueue) closeLocked(code int, reason string) {
+	if q.closed {
+		return
+	}
+	q.closed = true
+	q.closeCode = code
+	q.closeReason = reason
+	q.signal()
+}
+
+func (q *sendQueue) closeMessage() []byte {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return websocket.FormatCloseMessage(q.closeCode, q.closeReason)
+}
+
+func (q *sendQueue) signal() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
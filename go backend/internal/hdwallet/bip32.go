@@ -0,0 +1,215 @@
+// Package hdwallet derives deposit addresses from a master extended public
+// key (BIP32) laid out as BIP44 accounts. Only public derivation is
+// implemented: the API server holds account xpubs and never a private key, so
+// it can hand out addresses but can't spend from them.
+package hdwallet
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"golang.org/x/crypto/ripemd160"
+)
+
+// HardenedOffset marks a hardened child index. Hardened children can only be
+// derived from a private key.
+const HardenedOffset uint32 = 0x80000000
+
+var (
+	ErrInvalidExtendedKey = errors.New("invalid extended key")
+	ErrPrivateKey         = errors.New("extended private keys are not accepted")
+	ErrHardenedChild      = errors.New("hardened children can't be derived from a public key")
+	// ErrInvalidChild is returned for the rare index whose derived key is
+	// invalid; BIP32 says to skip to the next index.
+	ErrInvalidChild = errors.New("invalid child key, use the next index")
+)
+
+// Versions of the public and private extended keys we recognise, by prefix:
+// xpub/xprv, ypub/yprv, zpub/zprv and the testnet tpub/tprv.
+var (
+	publicVersions = map[uint32]bool{
+		0x0488B21E: true, 0x049D7CB2: true, 0x04B24746: true, 0x043587CF: true,
+	}
+	privateVersions = map[uint32]bool{
+		0x0488ADE4: true, 0x049D7878: true, 0x04B2430C: true, 0x04358394: true,
+	}
+)
+
+type ExtendedKey struct {
+	Version           uint32
+	Depth             uint8
+	ParentFingerprint uint32
+	ChildNumber       uint32
+	ChainCode         []byte
+	PublicKey         *PublicKey
+}
+
+// ParseExtendedKey reads a base58check extended public key.
+func ParseExtendedKey(encoded string) (*ExtendedKey, error) {
+	data, err := DecodeBase58Check(encoded)
+	if err != nil || len(data) != 78 {
+		return nil, ErrInvalidExtendedKey
+	}
+
+	version := binary.BigEndian.Uint32(data[0:4])
+	if privateVersions[version] {
+		return nil, ErrPrivateKey
+	}
+	if !publicVersions[version] {
+		return nil, fmt.Errorf("%w: unknown version %08x", ErrInvalidExtendedKey, version)
+	}
+
+	key, err := ParsePublicKey(data[45:78])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidExtendedKey, err)
+	}
+
+	return &ExtendedKey{
+		Version:           version,
+		Depth:             data[4],
+		ParentFingerprint: binary.BigEndian.Uint32(data[5:9]),
+		ChildNumber:       binary.BigEndian.Uint32(data[9:13]),
+		ChainCode:         append([]byte(nil), data[13:45]...),
+		PublicKey:         key,
+	}, nil
+}
+
+func (k *ExtendedKey) String() string {
+	data := make([]byte, 0, 78)
+	data = binary.BigEndian.AppendUint32(data, k.Version)
+	data = append(data, k.Depth)
+	data = binary.BigEndian.AppendUint32(data, k.ParentFingerprint)
+	data = binary.BigEndian.AppendUint32(data, k.ChildNumber)
+	data = append(data, k.ChainCode...)
+	data = append(data, k.PublicKey.Compressed()...)
+	return encodeBase58Check(data)
+}
+
+func (k *ExtendedKey) fingerprint() uint32 {
+	return binary.BigEndian.Uint32(hash160(k.PublicKey.Compressed())[:4])
+}
+
+// Child derives the non-hardened child at index (CKDpub).
+func (k *ExtendedKey) Child(index uint32) (*ExtendedKey, error) {
+	if index >= HardenedOffset {
+		return nil, ErrHardenedChild
+	}
+
+	mac := hmac.New(sha512.New, k.ChainCode)
+	mac.Write(k.PublicKey.Compressed())
+	mac.Write(binary.BigEndian.AppendUint32(nil, index))
+	sum := mac.Sum(nil)
+
+	tweak := new(big.Int).SetBytes(sum[:32])
+	if tweak.Cmp(curveN) >= 0 {
+		return nil, ErrInvalidChild
+	}
+
+	child := addPoints(scalarBaseMult(tweak), k.PublicKey)
+	if child.infinity() {
+		return nil, ErrInvalidChild
+	}
+
+	return &ExtendedKey{
+		Version:           k.Version,
+		Depth:             k.Depth + 1,
+		ParentFingerprint: k.fingerprint(),
+		ChildNumber:       index,
+		ChainCode:         sum[32:],
+		PublicKey:         child,
+	}, nil
+}
+
+// Derive walks a path of non-hardened indexes.
+func (k *ExtendedKey) Derive(path ...uint32) (*ExtendedKey, error) {
+	key := k
+	for _, index := range path {
+		var err error
+		if key, err = key.Child(index); err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+func hash160(data []byte) []byte {
+	sha := sha256.Sum256(data)
+	h := ripemd160.New()
+	h.Write(sha[:])
+	return h.Sum(nil)
+}
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+func encodeBase58(data []byte) string {
+	n := new(big.Int).SetBytes(data)
+	radix := big.NewInt(58)
+	mod := new(big.Int)
+
+	var out []byte
+	for n.Sign() > 0 {
+		n.DivMod(n, radix, mod)
+		out = append(out, base58Alphabet[mod.Int64()])
+	}
+	for _, b := range data {
+		if b != 0 {
+			break
+		}
+		out = append(out, base58Alphabet[0])
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+func decodeBase58(encoded string) ([]byte, error) {
+	n := new(big.Int)
+	radix := big.NewInt(58)
+	for _, r := range encoded {
+		digit := bytes.IndexRune([]byte(base58Alphabet), r)
+		if digit < 0 {
+			return nil, fmt.Errorf("invalid base58 character %q", r)
+		}
+		n.Mul(n, radix).Add(n, big.NewInt(int64(digit)))
+	}
+
+	var zeros int
+	for zeros < len(encoded) && encoded[zeros] == base58Alphabet[0] {
+		zeros++
+	}
+	return append(make([]byte, zeros), n.Bytes()...), nil
+}
+
+func checksum(data []byte) []byte {
+	first := sha256.Sum256(data)
+	second := sha256.Sum256(first[:])
+	return second[:4]
+}
+
+func encodeBase58Check(data []byte) string {
+	return encodeBase58(append(append([]byte(nil), data...), checksum(data)...))
+}
+
+// DecodeBase58Check decodes base58 data and verifies its four byte
+// double-SHA256 checksum, returning the payload.
+func DecodeBase58Check(encoded string) ([]byte, error) {
+	data, err := decodeBase58(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 4 {
+		return nil, errors.New("base58check data too short")
+	}
+	payload, sum := data[:len(data)-4], data[len(data)-4:]
+	if !bytes.Equal(checksum(payload), sum) {
+		return nil, errors.New("base58check checksum mismatch")
+	}
+	return payload, nil
+}
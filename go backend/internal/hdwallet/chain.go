@@ -0,0 +1,284 @@
+package hdwallet
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// Chain turns a derived public key into an address on one blockchain.
+type Chain interface {
+	// CoinType is the chain's registered BIP44 coin type (SLIP-44).
+	CoinType() uint32
+	Address(key *PublicKey) (string, error)
+}
+
+// BIP44 lays accounts out as m/44'/coin'/account'/change/index. Master
+// wallets hold the xpub of an account, so addresses are derived below it on
+// the external (receiving) branch.
+const (
+	bip44Purpose   = 44
+	externalBranch = 0
+)
+
+// Path is the full derivation path of the address at index under an
+// account, recorded so the signer can find its key.
+func Path(chain Chain, account, index uint32) string {
+	return fmt.Sprintf("m/%d'/%d'/%d'/%d/%d", bip44Purpose, chain.CoinType(), account, externalBranch, index)
+}
+
+// DeriveAddress derives the address at index from an account-level xpub and
+// returns it with its derivation path.
+func DeriveAddress(chain Chain, accountKey *ExtendedKey, index uint32) (string, string, error) {
+	if accountKey.Depth != 3 || accountKey.ChildNumber < HardenedOffset {
+		return "", "", fmt.Errorf("%w: expected a BIP44 account key at depth 3", ErrInvalidExtendedKey)
+	}
+
+	child, err := accountKey.Derive(externalBranch, index)
+	if err != nil {
+		return "", "", err
+	}
+
+	address, err := chain.Address(child.PublicKey)
+	if err != nil {
+		return "", "", err
+	}
+
+	return address, Path(chain, accountKey.ChildNumber-HardenedOffset, index), nil
+}
+
+var chains = map[string]Chain{
+	"BTC":      segwitChain{coinType: 0, hrp: "bc"},
+	"LTC":      segwitChain{coinType: 2, hrp: "ltc"},
+	"DOGE":     legacyChain{coinType: 3, version: 0x1e},
+	"DASH":     legacyChain{coinType: 5, version: 0x4c},
+	"ETH":      evmChain{},
+	"BSC":      evmChain{},
+	"POLYGON":  evmChain{},
+	"MATIC":    evmChain{},
+	"ARBITRUM": evmChain{},
+	"OPTIMISM": evmChain{},
+	"BASE":     evmChain{},
+	"AVAX":     evmChain{},
+	"FTM":      evmChain{},
+	"TRON":     tronChain{},
+	"TRX":      tronChain{},
+}
+
+// ChainFor looks a chain up by the name ecosystem master wallets use.
+func ChainFor(name string) (Chain, bool) {
+	chain, ok := chains[strings.ToUpper(name)]
+	return chain, ok
+}
+
+// evmChain covers Ethereum and every chain sharing its accounts. They all
+// use coin type 60, so one account key serves all of them.
+type evmChain struct{}
+
+func (evmChain) CoinType() uint32 {
+	return 60
+}
+
+func (evmChain) Address(key *PublicKey) (string, error) {
+	return ChecksumAddress(keccakAddress(key)), nil
+}
+
+func keccakAddress(key *PublicKey) []byte {
+	h := sha3.NewLegacyKeccak256()
+	h.Write(key.Uncompressed()[1:])
+	return h.Sum(nil)[12:]
+}
+
+// ChecksumAddress writes a 20 byte EVM address with the EIP-55 mixed case
+// checksum.
+func ChecksumAddress(address []byte) string {
+	lower := hex.EncodeToString(address)
+	h := sha3.NewLegacyKeccak256()
+	h.Write([]byte(lower))
+	sum := h.Sum(nil)
+
+	out := []byte(lower)
+	for i, c := range out {
+		nibble := sum[i/2] >> 4
+		if i%2 == 1 {
+			nibble = sum[i/2] & 0x0f
+		}
+		if c >= 'a' && nibble >= 8 {
+			out[i] = c - 32
+		}
+	}
+	return "0x" + string(out)
+}
+
+type tronChain struct{}
+
+func (tronChain) CoinType() uint32 {
+	return 195
+}
+
+func (tronChain) Address(key *PublicKey) (string, error) {
+	return encodeBase58Check(append([]byte{0x41}, keccakAddress(key)...)), nil
+}
+
+// segwitChain derives native segwit (P2WPKH) addresses.
+type segwitChain struct {
+	coinType uint32
+	hrp      string
+}
+
+func (c segwitChain) CoinType() uint32 {
+	return c.coinType
+}
+
+func (c segwitChain) Address(key *PublicKey) (string, error) {
+	return encodeSegwit(c.hrp, 0, hash160(key.Compressed()))
+}
+
+// legacyChain derives base58 P2PKH addresses, for chains without segwit.
+type legacyChain struct {
+	coinType uint32
+	version  byte
+}
+
+func (c legacyChain) CoinType() uint32 {
+	return c.coinType
+}
+
+func (c legacyChain) Address(key *PublicKey) (string, error) {
+	return encodeBase58Check(append([]byte{c.version}, hash160(key.Compressed())...)), nil
+}
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+func bech32Polymod(values []byte) uint32 {
+	generator := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= generator[i]
+			}
+		}
+	}
+	return chk
+}
+
+// encodeSegwit writes a version 0 witness program as bech32 (BIP173).
+func encodeSegwit(hrp string, version byte, program []byte) (string, error) {
+	// Regroup the program's 8-bit bytes into 5-bit words.
+	data := []byte{version}
+	var acc, bits uint32
+	for _, b := range program {
+		acc = acc<<8 | uint32(b)
+		bits += 8
+		for bits >= 5 {
+			bits -= 5
+			data = append(data, byte(acc>>bits)&31)
+		}
+	}
+	if bits > 0 {
+		data = append(data, byte(acc<<(5-bits))&31)
+	}
+
+	values := make([]byte, 0, len(hrp)*2+1+len(data)+6)
+	for _, c := range []byte(hrp) {
+		values = append(values, c>>5)
+	}
+	values = append(values, 0)
+	for _, c := range []byte(hrp) {
+		values = append(values, c&31)
+	}
+	values = append(values, data...)
+	values = append(values, 0, 0, 0, 0, 0, 0)
+	polymod := bech32Polymod(values) ^ 1
+
+	var out strings.Builder
+	out.WriteString(hrp)
+	out.WriteByte('1')
+	for _, d := range data {
+		out.WriteByte(bech32Charset[d])
+	}
+	for i := 0; i < 6; i++ {
+		out.WriteByte(bech32Charset[(polymod>>uint(5*(5-i)))&31])
+	}
+	return out.String(), nil
+}
+
+// bech32m is the checksum constant BIP350 uses for witness versions 1 and
+// up; version 0 keeps the original bech32 constant 1.
+const bech32mConst = 0x2bc830a3
+
+// DecodeSegwit decodes a bech32 or bech32m segwit address for hrp and
+// returns its witness version and program.
+func DecodeSegwit(hrp, address string) (byte, []byte, error) {
+	if address != strings.ToLower(address) && address != strings.ToUpper(address) {
+		return 0, nil, errors.New("bech32 address has mixed case")
+	}
+	address = strings.ToLower(address)
+
+	sep := strings.LastIndexByte(address, '1')
+	if sep < 1 || sep+7 > len(address) || len(address) > 90 {
+		return 0, nil, errors.New("malformed bech32 address")
+	}
+	if address[:sep] != hrp {
+		return 0, nil, fmt.Errorf("bech32 prefix %q, want %q", address[:sep], hrp)
+	}
+
+	data := make([]byte, 0, len(address)-sep-1)
+	for _, c := range address[sep+1:] {
+		d := strings.IndexRune(bech32Charset, c)
+		if d < 0 {
+			return 0, nil, fmt.Errorf("invalid bech32 character %q", c)
+		}
+		data = append(data, byte(d))
+	}
+
+	values := make([]byte, 0, len(hrp)*2+1+len(data))
+	for _, c := range []byte(hrp) {
+		values = append(values, c>>5)
+	}
+	values = append(values, 0)
+	for _, c := range []byte(hrp) {
+		values = append(values, c&31)
+	}
+	values = append(values, data...)
+	polymod := bech32Polymod(values)
+
+	data = data[:len(data)-6]
+	if len(data) == 0 {
+		return 0, nil, errors.New("bech32 address has no witness version")
+	}
+	version := data[0]
+	if version > 16 {
+		return 0, nil, fmt.Errorf("invalid witness version %d", version)
+	}
+	if (version == 0 && polymod != 1) || (version > 0 && polymod != bech32mConst) {
+		return 0, nil, errors.New("bech32 checksum mismatch")
+	}
+
+	// Regroup the 5-bit words back into bytes; leftover padding must be
+	// under a byte and zero.
+	var program []byte
+	var acc, bits uint32
+	for _, d := range data[1:] {
+		acc = acc<<5 | uint32(d)
+		bits += 5
+		if bits >= 8 {
+			bits -= 8
+			program = append(program, byte(acc>>bits))
+		}
+	}
+	if bits >= 5 || acc&(1<<bits-1) != 0 {
+		return 0, nil, errors.New("invalid bech32 padding")
+	}
+
+	if len(program) < 2 || len(program) > 40 || (version == 0 && len(program) != 20 && len(program) != 32) {
+		return 0, nil, fmt.Errorf("invalid witness program length %d", len(program))
+	}
+	return version, program, nil
+}
@@ -0,0 +1,149 @@
+package hdwallet
+
+import (
+	"errors"
+	"math/big"
+)
+
+// Public key arithmetic on secp256k1. Plain math/big isn't constant time,
+// which is fine for public points and the public tweak from BIP32. The
+// software signer also multiplies private scalars here; it is meant for
+// local use, and production keys belong in an HSM.
+var (
+	curveP, _  = new(big.Int).SetString("FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEFFFFFC2F", 16)
+	curveN, _  = new(big.Int).SetString("FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEBAAEDCE6AF48A03BBFD25E8CD0364141", 16)
+	curveGx, _ = new(big.Int).SetString("79BE667EF9DCBBAC55A06295CE870B07029BFCDB2DCE28D959F2815B16F81798", 16)
+	curveGy, _ = new(big.Int).SetString("483ADA7726A3C4655DA4FBFC0E1108A8FD17B448A68554199C47D08FFB10D4B8", 16)
+	curveB     = big.NewInt(7)
+)
+
+var (
+	ErrInvalidPublicKey  = errors.New("invalid public key")
+	ErrInvalidPrivateKey = errors.New("invalid private key")
+)
+
+// PublicKey is a point on secp256k1. The zero value is the point at
+// infinity.
+type PublicKey struct {
+	x, y *big.Int
+}
+
+func (k *PublicKey) infinity() bool {
+	return k.x == nil
+}
+
+// ParsePublicKey reads a compressed or uncompressed SEC1 public key.
+func ParsePublicKey(data []byte) (*PublicKey, error) {
+	switch {
+	case len(data) == 33 && (data[0] == 2 || data[0] == 3):
+		x := new(big.Int).SetBytes(data[1:])
+		if x.Cmp(curveP) >= 0 {
+			return nil, ErrInvalidPublicKey
+		}
+		// y² = x³ + 7, and p ≡ 3 (mod 4) so the root is (y²)^((p+1)/4).
+		y2 := new(big.Int).Exp(x, big.NewInt(3), curveP)
+		y2.Add(y2, curveB).Mod(y2, curveP)
+		exp := new(big.Int).Add(curveP, big.NewInt(1))
+		exp.Rsh(exp, 2)
+		y := new(big.Int).Exp(y2, exp, curveP)
+		if new(big.Int).Exp(y, big.NewInt(2), curveP).Cmp(y2) != 0 {
+			return nil, ErrInvalidPublicKey
+		}
+		if y.Bit(0) != uint(data[0]&1) {
+			y.Sub(curveP, y)
+		}
+		return &PublicKey{x: x, y: y}, nil
+
+	case len(data) == 65 && data[0] == 4:
+		key := &PublicKey{x: new(big.Int).SetBytes(data[1:33]), y: new(big.Int).SetBytes(data[33:])}
+		if !key.onCurve() {
+			return nil, ErrInvalidPublicKey
+		}
+		return key, nil
+	}
+
+	return nil, ErrInvalidPublicKey
+}
+
+func (k *PublicKey) onCurve() bool {
+	if k.x.Cmp(curveP) >= 0 || k.y.Cmp(curveP) >= 0 {
+		return false
+	}
+	left := new(big.Int).Mul(k.y, k.y)
+	left.Mod(left, curveP)
+	right := new(big.Int).Exp(k.x, big.NewInt(3), curveP)
+	right.Add(right, curveB).Mod(right, curveP)
+	return left.Cmp(right) == 0
+}
+
+// Compressed is the 33 byte SEC1 encoding.
+func (k *PublicKey) Compressed() []byte {
+	out := make([]byte, 33)
+	out[0] = 2 + byte(k.y.Bit(0))
+	k.x.FillBytes(out[1:])
+	return out
+}
+
+// Uncompressed is the 65 byte SEC1 encoding.
+func (k *PublicKey) Uncompressed() []byte {
+	out := make([]byte, 65)
+	out[0] = 4
+	k.x.FillBytes(out[1:33])
+	k.y.FillBytes(out[33:])
+	return out
+}
+
+func addPoints(a, b *PublicKey) *PublicKey {
+	if a.infinity() {
+		return b
+	}
+	if b.infinity() {
+		return a
+	}
+
+	var num, den *big.Int
+	if a.x.Cmp(b.x) == 0 {
+		sum := new(big.Int).Add(a.y, b.y)
+		if sum.Mod(sum, curveP).Sign() == 0 {
+			return &PublicKey{}
+		}
+		// Doubling: λ = 3x² / 2y.
+		num = new(big.Int).Mul(a.x, a.x)
+		num.Mul(num, big.NewInt(3))
+		den = new(big.Int).Lsh(a.y, 1)
+	} else {
+		num = new(big.Int).Sub(b.y, a.y)
+		den = new(big.Int).Sub(b.x, a.x)
+	}
+	den.Mod(den, curveP)
+	lambda := num.Mul(num, den.ModInverse(den, curveP))
+	lambda.Mod(lambda, curveP)
+
+	x := new(big.Int).Mul(lambda, lambda)
+	x.Sub(x, a.x).Sub(x, b.x).Mod(x, curveP)
+	y := new(big.Int).Sub(a.x, x)
+	y.Mul(y, lambda).Sub(y, a.y).Mod(y, curveP)
+	return &PublicKey{x: x, y: y}
+}
+
+// scalarBaseMult computes k·G by double and add.
+func scalarBaseMult(k *big.Int) *PublicKey {
+	result := &PublicKey{}
+	addend := &PublicKey{x: curveGx, y: curveGy}
+	for i := 0; i < k.BitLen(); i++ {
+		if k.Bit(i) == 1 {
+			result = addPoints(result, addend)
+		}
+		addend = addPoints(addend, addend)
+	}
+	return result
+}
+
+// PublicKeyFromPrivate computes the public key of a 32 byte private scalar.
+func PublicKeyFromPrivate(key []byte) (*PublicKey, error) {
+	d := new(big.Int).SetBytes(key)
+	if len(key) != 32 || d.Sign() == 0 || d.Cmp(curveN) >= 0 {
+		return nil, ErrInvalidPrivateKey
+	}
+	return scalarBaseMult(d), nil
+}
@@ -0,0 +1,311 @@
+package ledger
+
+import (
+	"context"
+	"crypto-exchange-go/internal/database"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+type Side string
+
+const (
+	Debit  Side = "DEBIT"
+	Credit Side = "CREDIT"
+)
+
+type AccountType string
+
+const (
+	AccountWallet         AccountType = "WALLET"
+	AccountWalletHold     AccountType = "WALLET_HOLD"
+	AccountExternal       AccountType = "EXTERNAL"
+	AccountTradeClearing  AccountType = "TRADE_CLEARING"
+	AccountP2pEscrow      AccountType = "P2P_ESCROW"
+	AccountStakingRewards AccountType = "STAKING_REWARDS"
+	AccountFees           AccountType = "FEES"
+	AccountOpeningBalance AccountType = "OPENING_BALANCE"
+)
+
+var (
+	ErrUnbalanced     = errors.New("ledger entry is not balanced")
+	ErrDuplicateEntry = errors.New("ledger entry already posted")
+	// ErrInsufficientFunds is returned when a wallet projection would go
+	// negative, or the wallet row doesn't exist.
+	ErrInsufficientFunds = errors.New("wallet not found or insufficient funds")
+)
+
+type Account struct {
+	Type AccountType `json:"type"`
+	ID   string      `json:"id"`
+}
+
+func WalletAccount(walletID uuid.UUID) Account {
+	return Account{Type: AccountWallet, ID: walletID.String()}
+}
+
+func WalletHoldAccount(walletID uuid.UUID) Account {
+	return Account{Type: AccountWalletHold, ID: walletID.String()}
+}
+
+func SystemAccount(accountType AccountType) Account {
+	return Account{Type: accountType}
+}
+
+type Line struct {
+	Account  Account         `json:"account"`
+	Currency string          `json:"currency"`
+	Side     Side            `json:"side"`
+	Amount   decimal.Decimal `json:"amount"`
+}
+
+type Entry struct {
+	ID             uuid.UUID `json:"id"`
+	ReferenceType  string    `json:"referenceType"`
+	ReferenceID    string    `json:"referenceId"`
+	IdempotencyKey string    `json:"idempotencyKey,omitempty"`
+	Description    string    `json:"description"`
+	Lines          []Line    `json:"lines"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+type Balance struct {
+	Available decimal.Decimal `json:"available"`
+	Locked    decimal.Decimal `json:"locked"`
+}
+
+type Posting struct {
+	EntryID       uuid.UUID       `json:"entryId" db:"entryId"`
+	Account       AccountType     `json:"account" db:"accountType"`
+	ReferenceType string          `json:"referenceType" db:"referenceType"`
+	ReferenceID   string          `json:"referenceId" db:"referenceId"`
+	Description   string          `json:"description" db:"description"`
+	Currency      string          `json:"currency" db:"currency"`
+	Side          Side            `json:"side" db:"side"`
+	Amount        decimal.Decimal `json:"amount" db:"amount"`
+	CreatedAt     time.Time       `json:"createdAt" db:"createdAt"`
+}
+
+func Transfer(from, to Account, currency string, amount decimal.Decimal) []Line {
+	return []Line{
+		{Account: from, Currency: currency, Side: Debit, Amount: amount},
+		{Account: to, Currency: currency, Side: Credit, Amount: amount},
+	}
+}
+
+func (e *Entry) Validate() error {
+	if e.ReferenceType == "" {
+		return fmt.Errorf("reference type is required")
+	}
+	if len(e.Lines) < 2 {
+		return fmt.Errorf("ledger entry needs at least two lines")
+	}
+
+	totals := make(map[string]decimal.Decimal)
+	for _, line := range e.Lines {
+		if line.Currency == "" {
+			return fmt.Errorf("ledger line currency is required")
+		}
+		if !line.Amount.IsPositive() {
+			return fmt.Errorf("ledger line amount must be positive")
+		}
+
+		switch line.Side {
+		case Debit:
+			totals[line.Currency] = totals[line.Currency].Add(line.Amount)
+		case Credit:
+			totals[line.Currency] = totals[line.Currency].Sub(line.Amount)
+		default:
+			return fmt.Errorf("invalid ledger line side: %s", line.Side)
+		}
+	}
+
+	for currency, total := range totals {
+		if !total.IsZero() {
+			return fmt.Errorf("%w: %s is off by %s", ErrUnbalanced, currency, total.String())
+		}
+	}
+
+	return nil
+}
+
+func signedAmount(line Line) decimal.Decimal {
+	if line.Side == Debit {
+		return line.Amount.Neg()
+	}
+	return line.Amount
+}
+
+type Ledger struct {
+	mysql  *database.MySQL
+	logger *logrus.Logger
+}
+
+func New(mysql *database.MySQL, logger *logrus.Logger) *Ledger {
+	return &Ledger{
+		mysql:  mysql,
+		logger: logger,
+	}
+}
+
+func (l *Ledger) Post(ctx context.Context, tx *sqlx.Tx, entry *Entry) error {
+	if err := entry.Validate(); err != nil {
+		return err
+	}
+
+	if entry.ID == uuid.Nil {
+		entry.ID = uuid.New()
+	}
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+
+	var idempotencyKey *string
+	if entry.IdempotencyKey != "" {
+		idempotencyKey = &entry.IdempotencyKey
+	}
+
+	query := `INSERT INTO ledger_entry (id, referenceType, referenceId, idempotencyKey, description, createdAt)
+			  VALUES (?, ?, ?, ?, ?, ?)`
+	_, err := tx.ExecContext(ctx, query, entry.ID, entry.ReferenceType, entry.ReferenceID, idempotencyKey,
+		entry.Description, entry.CreatedAt)
+	if err != nil {
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
+			return ErrDuplicateEntry
+		}
+		return fmt.Errorf("failed to insert ledger entry: %w", err)
+	}
+
+	lineQuery := `INSERT INTO ledger_line (entryId, accountType, accountId, currency, side, amount, createdAt)
+				  VALUES (?, ?, ?, ?, ?, ?, ?)`
+	for _, line := range entry.Lines {
+		_, err := tx.ExecContext(ctx, lineQuery, entry.ID, line.Account.Type, line.Account.ID, line.Currency,
+			line.Side, line.Amount, entry.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to insert ledger line: %w", err)
+		}
+
+		// Projections are conditional updates: a debit only applies while the
+		// column still covers it, so no interleaving can drive it negative.
+		var projection string
+		switch line.Account.Type {
+		case AccountWallet:
+			projection = `UPDATE wallet SET balance = balance + ?, updatedAt = NOW()
+						  WHERE id = ? AND currency = ? AND balance + ? >= 0`
+		case AccountWalletHold:
+			projection = `UPDATE wallet SET inOrder = inOrder + ?, updatedAt = NOW()
+						  WHERE id = ? AND currency = ? AND inOrder + ? >= 0`
+		default:
+			continue
+		}
+
+		amount := signedAmount(line)
+		result, err := tx.ExecContext(ctx, projection, amount, line.Account.ID, line.Currency, amount)
+		if err != nil {
+			return fmt.Errorf("failed to project wallet balance: %w", err)
+		}
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			return fmt.Errorf("%w: wallet %s %s", ErrInsufficientFunds, line.Account.ID, line.Currency)
+		}
+	}
+
+	return nil
+}
+
+const accountBalanceQuery = `SELECT COALESCE(SUM(CASE WHEN side = 'CREDIT' THEN amount ELSE -amount END), 0)
+			  FROM ledger_line WHERE accountType = ? AND accountId = ?`
+
+func (l *Ledger) WalletBalance(ctx context.Context, walletID uuid.UUID) (*Balance, error) {
+	balance := &Balance{}
+
+	err := l.mysql.QueryRowContext(ctx, accountBalanceQuery, AccountWallet, walletID.String()).Scan(&balance.Available)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum ledger lines: %w", err)
+	}
+
+	err = l.mysql.QueryRowContext(ctx, accountBalanceQuery, AccountWalletHold, walletID.String()).Scan(&balance.Locked)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum ledger hold lines: %w", err)
+	}
+
+	return balance, nil
+}
+
+func (l *Ledger) History(ctx context.Context, walletID uuid.UUID, limit, offset int) ([]*Posting, error) {
+	query := `SELECT e.id, ll.accountType, e.referenceType, e.referenceId, e.description, ll.currency, ll.side, ll.amount, ll.createdAt
+			  FROM ledger_line ll JOIN ledger_entry e ON e.id = ll.entryId
+			  WHERE ll.accountType IN (?, ?) AND ll.accountId = ?
+			  ORDER BY ll.id DESC LIMIT ? OFFSET ?`
+
+	rows, err := l.mysql.QueryContext(ctx, query, AccountWallet, AccountWalletHold, walletID.String(), limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query ledger history: %w", err)
+	}
+	defer rows.Close()
+
+	postings := make([]*Posting, 0)
+	for rows.Next() {
+		posting := &Posting{}
+		err := rows.Scan(&posting.EntryID, &posting.Account, &posting.ReferenceType, &posting.ReferenceID, &posting.Description,
+			&posting.Currency, &posting.Side, &posting.Amount, &posting.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan ledger posting: %w", err)
+		}
+		postings = append(postings, posting)
+	}
+
+	return postings, nil
+}
+
+func (l *Ledger) Rebuild(ctx context.Context, walletID uuid.UUID) (*Balance, error) {
+	tx, err := l.mysql.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stored := &Balance{}
+	err = tx.QueryRowxContext(ctx, `SELECT balance, inOrder FROM wallet WHERE id = ? FOR UPDATE`, walletID).
+		Scan(&stored.Available, &stored.Locked)
+	if err != nil {
+		return nil, fmt.Errorf("wallet not found: %w", err)
+	}
+
+	balance := &Balance{}
+	if err := tx.QueryRowxContext(ctx, accountBalanceQuery, AccountWallet, walletID.String()).Scan(&balance.Available); err != nil {
+		return nil, fmt.Errorf("failed to sum ledger lines: %w", err)
+	}
+	if err := tx.QueryRowxContext(ctx, accountBalanceQuery, AccountWalletHold, walletID.String()).Scan(&balance.Locked); err != nil {
+		return nil, fmt.Errorf("failed to sum ledger hold lines: %w", err)
+	}
+
+	if !stored.Available.Equal(balance.Available) || !stored.Locked.Equal(balance.Locked) {
+		l.logger.WithFields(logrus.Fields{
+			"walletID":        walletID,
+			"storedAvailable": stored.Available.String(),
+			"storedLocked":    stored.Locked.String(),
+			"ledgerAvailable": balance.Available.String(),
+			"ledgerLocked":    balance.Locked.String(),
+		}).Warn("Wallet balance drifted from ledger, rebuilding")
+
+		_, err = tx.ExecContext(ctx, `UPDATE wallet SET balance = ?, inOrder = ?, updatedAt = NOW() WHERE id = ?`,
+			balance.Available, balance.Locked, walletID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to rebuild wallet balance: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit wallet rebuild: %w", err)
+	}
+
+	return balance, nil
+}
@@ -0,0 +1,318 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"crypto-exchange-go/internal/database"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	mysqldriver "github.com/go-sql-driver/mysql"
+)
+
+const (
+	IdempotencyHeader         = "Idempotency-Key"
+	IdempotencyReplayedHeader = "Idempotent-Replayed"
+
+	// ServerWriteTimeout bounds how long the API server spends on a request.
+	ServerWriteTimeout = time.Minute
+
+	idempotencyTTL = 24 * time.Hour
+	// A pending claim has to outlive the request holding it, or a retry could
+	// claim the key while the first attempt is still running.
+	idempotencyLockTTL = ServerWriteTimeout + 4*time.Minute
+	maxIdempotencyKey  = 191
+
+	idempotencyUncommittedKey = "idempotencyUncommitted"
+)
+
+type IdempotencyStatus string
+
+const (
+	IdempotencyPending   IdempotencyStatus = "PENDING"
+	IdempotencyCompleted IdempotencyStatus = "COMPLETED"
+)
+
+// IdempotencyRecord is what's stored against a key: the hash of the request
+// that claimed it and, once the handler has run, the response to replay.
+type IdempotencyRecord struct {
+	RequestHash  string            `json:"requestHash"`
+	Status       IdempotencyStatus `json:"status"`
+	ResponseCode int               `json:"responseCode"`
+	ContentType  string            `json:"contentType"`
+	ResponseBody []byte            `json:"responseBody"`
+}
+
+type IdempotencyStore interface {
+	// Reserve claims scope+key for a request. It returns nil if the key was
+	// free, or the existing record if another request already claimed it.
+	Reserve(ctx context.Context, scope, key, requestHash string) (*IdempotencyRecord, error)
+	Complete(ctx context.Context, scope, key string, record *IdempotencyRecord) error
+	Release(ctx context.Context, scope, key string) error
+}
+
+// Idempotency makes a route safe to retry. Requests carrying an
+// Idempotency-Key header are scoped to the user and route; a repeat with the
+// same body gets the original response replayed, and a repeat with a
+// different body is rejected. Requests without the header pass through.
+func Idempotency(store IdempotencyStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKey {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key is too long"})
+			c.Abort()
+			return
+		}
+
+		user, ok := GetUserFromContext(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		scope := fmt.Sprintf("%s:%s %s", user.ID, c.Request.Method, c.FullPath())
+		requestHash := hashIdempotentRequest(c.Request.URL.Path, body)
+
+		ctx := c.Request.Context()
+		existing, err := store.Reserve(ctx, scope, key, requestHash)
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Idempotency store unavailable, retry later"})
+			c.Abort()
+			return
+		}
+
+		if existing != nil {
+			switch {
+			case existing.RequestHash != requestHash:
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used with a different request"})
+			case existing.Status != IdempotencyCompleted:
+				c.JSON(http.StatusConflict, gin.H{"error": "A request with this Idempotency-Key is still in progress"})
+			default:
+				c.Header(IdempotencyReplayedHeader, "true")
+				c.Data(existing.ResponseCode, existing.ContentType, existing.ResponseBody)
+			}
+			c.Abort()
+			return
+		}
+
+		writer := &idempotencyWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+
+		c.Next()
+
+		// A server error the handler vouches left nothing behind can be
+		// retried with the same key. Any other response, 5xx included, may
+		// follow a committed change, so it's stored and replayed.
+		if writer.Status() >= http.StatusInternalServerError && c.GetBool(idempotencyUncommittedKey) {
+			store.Release(context.Background(), scope, key)
+			return
+		}
+
+		store.Complete(context.Background(), scope, key, &IdempotencyRecord{
+			RequestHash:  requestHash,
+			Status:       IdempotencyCompleted,
+			ResponseCode: writer.Status(),
+			ContentType:  writer.Header().Get("Content-Type"),
+			ResponseBody: writer.body.Bytes(),
+		})
+	}
+}
+
+// MarkUncommitted tells the Idempotency middleware that the request failed
+// before changing anything, so its key is released for a retry instead of
+// replaying the error.
+func MarkUncommitted(c *gin.Context) {
+	c.Set(idempotencyUncommittedKey, true)
+}
+
+func hashIdempotentRequest(path string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(path))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+type idempotencyWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *idempotencyWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *idempotencyWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// idempotencyStore keeps records in Redis and falls back to the
+// idempotency_key table when Redis can't be reached.
+type idempotencyStore struct {
+	redis *database.Redis
+	mysql *database.MySQL
+}
+
+func NewIdempotencyStore(redis *database.Redis, mysql *database.MySQL) IdempotencyStore {
+	return &idempotencyStore{
+		redis: redis,
+		mysql: mysql,
+	}
+}
+
+func idempotencyRedisKey(scope, key string) string {
+	return fmt.Sprintf("idempotency:%s:%s", scope, key)
+}
+
+func (s *idempotencyStore) Reserve(ctx context.Context, scope, key, requestHash string) (*IdempotencyRecord, error) {
+	// A key claimed while Redis was down only exists in MySQL. If MySQL is
+	// the one that's down, Redis alone still protects the key.
+	if existing, err := s.getMySQL(ctx, scope, key); err == nil && existing != nil {
+		return existing, nil
+	}
+
+	pending := &IdempotencyRecord{RequestHash: requestHash, Status: IdempotencyPending}
+	data, err := json.Marshal(pending)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal idempotency record: %w", err)
+	}
+
+	redisKey := idempotencyRedisKey(scope, key)
+	claimed, err := s.redis.Client().SetNX(ctx, redisKey, data, idempotencyLockTTL).Result()
+	if err != nil {
+		return s.reserveMySQL(ctx, scope, key, pending)
+	}
+	if claimed {
+		return nil, nil
+	}
+
+	raw, err := s.redis.Get(ctx, redisKey)
+	if errors.Is(err, redis.Nil) {
+		// Expired between SETNX and GET; try again.
+		return s.Reserve(ctx, scope, key, requestHash)
+	}
+	if err != nil {
+		return s.reserveMySQL(ctx, scope, key, pending)
+	}
+
+	existing := &IdempotencyRecord{}
+	if err := json.Unmarshal([]byte(raw), existing); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal idempotency record: %w", err)
+	}
+	return existing, nil
+}
+
+func (s *idempotencyStore) Complete(ctx context.Context, scope, key string, record *IdempotencyRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal idempotency record: %w", err)
+	}
+
+	if err := s.redis.Set(ctx, idempotencyRedisKey(scope, key), data, idempotencyTTL); err == nil {
+		// Drop any MySQL claim so Redis stays the source of truth.
+		s.mysql.ExecContext(ctx, `DELETE FROM idempotency_key WHERE scope = ? AND idempotencyKey = ?`, scope, key)
+		return nil
+	}
+
+	// Upsert, since the key may have been claimed in Redis before it went down.
+	now := time.Now()
+	query := `INSERT INTO idempotency_key (scope, idempotencyKey, requestHash, status, responseCode, contentType, responseBody, createdAt, expiresAt)
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+			  ON DUPLICATE KEY UPDATE status = VALUES(status), responseCode = VALUES(responseCode),
+			  contentType = VALUES(contentType), responseBody = VALUES(responseBody), expiresAt = VALUES(expiresAt)`
+	_, err = s.mysql.ExecContext(ctx, query, scope, key, record.RequestHash, record.Status, record.ResponseCode,
+		record.ContentType, record.ResponseBody, now, now.Add(idempotencyTTL))
+	if err != nil {
+		return fmt.Errorf("failed to store idempotency record: %w", err)
+	}
+	return nil
+}
+
+func (s *idempotencyStore) Release(ctx context.Context, scope, key string) error {
+	s.redis.Del(ctx, idempotencyRedisKey(scope, key))
+
+	_, err := s.mysql.ExecContext(ctx, `DELETE FROM idempotency_key WHERE scope = ? AND idempotencyKey = ?`, scope, key)
+	if err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
+
+func (s *idempotencyStore) reserveMySQL(ctx context.Context, scope, key string, pending *IdempotencyRecord) (*IdempotencyRecord, error) {
+	now := time.Now()
+	query := `INSERT INTO idempotency_key (scope, idempotencyKey, requestHash, status, responseCode, contentType, responseBody, createdAt, expiresAt)
+			  VALUES (?, ?, ?, ?, 0, '', '', ?, ?)`
+	_, err := s.mysql.ExecContext(ctx, query, scope, key, pending.RequestHash, pending.Status, now, now.Add(idempotencyLockTTL))
+	if err == nil {
+		return nil, nil
+	}
+
+	var mysqlErr *mysqldriver.MySQLError
+	if !errors.As(err, &mysqlErr) || mysqlErr.Number != 1062 {
+		return nil, fmt.Errorf("failed to reserve idempotency key: %w", err)
+	}
+
+	existing, err := s.getMySQL(ctx, scope, key)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		// The row had expired and was cleared; claim it again.
+		return s.reserveMySQL(ctx, scope, key, pending)
+	}
+	return existing, nil
+}
+
+// getMySQL returns the unexpired record for scope+key, or nil. Expired rows
+// are removed so the key can be claimed again.
+func (s *idempotencyStore) getMySQL(ctx context.Context, scope, key string) (*IdempotencyRecord, error) {
+	query := `SELECT requestHash, status, responseCode, contentType, responseBody, expiresAt
+			  FROM idempotency_key WHERE scope = ? AND idempotencyKey = ?`
+
+	record := &IdempotencyRecord{}
+	var expiresAt time.Time
+	err := s.mysql.QueryRowxContext(ctx, query, scope, key).Scan(&record.RequestHash, &record.Status,
+		&record.ResponseCode, &record.ContentType, &record.ResponseBody, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get idempotency record: %w", err)
+	}
+
+	if expiresAt.Before(time.Now()) {
+		_, err := s.mysql.ExecContext(ctx, `DELETE FROM idempotency_key WHERE scope = ? AND idempotencyKey = ? AND expiresAt = ?`,
+			scope, key, expiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to clear expired idempotency key: %w", err)
+		}
+		return nil, nil
+	}
+
+	return record, nil
+}
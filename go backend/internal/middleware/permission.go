@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"crypto-exchange-go/internal/database"
+	"crypto-exchange-go/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// SuperAdminRole is granted every permission, as in the Node backend.
+const SuperAdminRole = "Super Admin"
+
+const adminContextKey = "admin"
+
+// PermissionStore answers whether a user's role grants a permission.
+type PermissionStore interface {
+	HasPermission(ctx context.Context, userID uuid.UUID, permission string) (bool, error)
+}
+
+// RequirePermission only lets a request through if the authenticated user's
+// role grants permission. It uses the role, permission and role_permission
+// tables the admin dashboard manages, so the names match the permission
+// metadata on the Node backend's admin routes.
+func RequirePermission(store PermissionStore, permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := GetUserFromContext(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			c.Abort()
+			return
+		}
+
+		allowed, err := store.HasPermission(c.Request.Context(), user.ID, permission)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+			c.Abort()
+			return
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden - You do not have permission to access this"})
+			c.Abort()
+			return
+		}
+
+		c.Set(adminContextKey, user)
+		c.Next()
+	}
+}
+
+// GetAdminFromContext returns the user only if a RequirePermission guard
+// admitted them.
+func GetAdminFromContext(c *gin.Context) (*models.User, bool) {
+	admin, exists := c.Get(adminContextKey)
+	if !exists {
+		return nil, false
+	}
+
+	u, ok := admin.(*models.User)
+	return u, ok
+}
+
+type permissionStore struct {
+	mysql *database.MySQL
+}
+
+func NewPermissionStore(mysql *database.MySQL) PermissionStore {
+	return &permissionStore{mysql: mysql}
+}
+
+func (s *permissionStore) HasPermission(ctx context.Context, userID uuid.UUID, permission string) (bool, error) {
+	var allowed bool
+	err := s.mysql.GetContext(ctx, &allowed, `
+		SELECT r.name = ? OR EXISTS (
+			SELECT 1 FROM role_permission rp
+			JOIN permission p ON p.id = rp.permissionId
+			WHERE rp.roleId = r.id AND p.name = ?
+		)
+		FROM user u
+		JOIN role r ON r.id = u.roleId
+		WHERE u.id = ?`, SuperAdminRole, permission, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check permission: %w", err)
+	}
+
+	return allowed, nil
+}
@@ -0,0 +1,77 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+type BalanceChangeReason string
+
+const (
+	BalanceReasonDeposit          BalanceChangeReason = "DEPOSIT"
+	BalanceReasonWithdrawal       BalanceChangeReason = "WITHDRAWAL"
+	BalanceReasonWithdrawalRefund BalanceChangeReason = "WITHDRAWAL_REFUND"
+	BalanceReasonOrder            BalanceChangeReason = "ORDER"
+	BalanceReasonTrade            BalanceChangeReason = "TRADE"
+	BalanceReasonP2pTrade         BalanceChangeReason = "P2P_TRADE"
+	BalanceReasonStaking          BalanceChangeReason = "STAKING"
+	BalanceReasonStakingReward    BalanceChangeReason = "STAKING_REWARD"
+	BalanceReasonTransfer         BalanceChangeReason = "TRANSFER"
+	BalanceReasonUserTransfer     BalanceChangeReason = "USER_TRANSFER"
+)
+
+type BalanceOperation string
+
+const (
+	BalanceOperationAdjust  BalanceOperation = "ADJUST"
+	BalanceOperationHold    BalanceOperation = "HOLD"
+	BalanceOperationRelease BalanceOperation = "RELEASE"
+	BalanceOperationCapture BalanceOperation = "CAPTURE"
+)
+
+type BalanceEvent struct {
+	Sequence    int64               `json:"sequence" db:"sequence"`
+	UserID      uuid.UUID           `json:"userId" db:"userId"`
+	WalletID    uuid.UUID           `json:"walletId" db:"walletId"`
+	Currency    string              `json:"currency" db:"currency"`
+	WalletType  WalletType          `json:"walletType" db:"walletType"`
+	Delta       decimal.Decimal     `json:"delta" db:"delta"`
+	Available   decimal.Decimal     `json:"available" db:"available"`
+	Locked      decimal.Decimal     `json:"locked" db:"locked"`
+	Operation   BalanceOperation    `json:"operation" db:"operation"`
+	Reason      BalanceChangeReason `json:"reason" db:"reason"`
+	ReferenceID string              `json:"referenceId" db:"referenceId"`
+	CreatedAt   time.Time           `json:"createdAt" db:"createdAt"`
+}
+
+type BalanceEventResponse struct {
+	Sequence    int64               `json:"sequence"`
+	WalletID    uuid.UUID           `json:"walletId"`
+	Currency    string              `json:"currency"`
+	WalletType  WalletType          `json:"walletType"`
+	Delta       decimal.Decimal     `json:"delta"`
+	Available   decimal.Decimal     `json:"available"`
+	Locked      decimal.Decimal     `json:"locked"`
+	Operation   BalanceOperation    `json:"operation"`
+	Reason      BalanceChangeReason `json:"reason"`
+	ReferenceID string              `json:"referenceId"`
+	CreatedAt   time.Time           `json:"createdAt"`
+}
+
+func (e *BalanceEvent) ToResponse() *BalanceEventResponse {
+	return &BalanceEventResponse{
+		Sequence:    e.Sequence,
+		WalletID:    e.WalletID,
+		Currency:    e.Currency,
+		WalletType:  e.WalletType,
+		Delta:       e.Delta,
+		Available:   e.Available,
+		Locked:      e.Locked,
+		Operation:   e.Operation,
+		Reason:      e.Reason,
+		ReferenceID: e.ReferenceID,
+		CreatedAt:   e.CreatedAt,
+	}
+}
@@ -61,8 +61,9 @@ type EcosystemMasterWallet struct {
 	Chain       string    `json:"chain" gorm:"not null"`
 	Currency    string    `json:"currency" gorm:"not null"`
 	Address     string    `json:"address" gorm:"not null"`
+	// The account xpub. Private keys live in the signer; signer
+	// import-ecosystem moves legacy mnemonics there.
 	PublicKey   string    `json:"publicKey"`
-	Mnemonic    string    `json:"mnemonic"`
 	Balance     decimal.Decimal `json:"balance" gorm:"type:decimal(65,30);default:0"`
 	LastIndex   int       `json:"lastIndex" gorm:"default:0"`
 	Status      bool      `json:"status" gorm:"default:true"`
@@ -80,7 +81,6 @@ type EcosystemCustodialWallet struct {
 	Address        string    `json:"address" gorm:"not null"`
 	Network        string    `json:"network" gorm:"not null"`
 	PublicKey      string    `json:"publicKey"`
-	PrivateKey     string    `json:"privateKey"`
 	Status         bool      `json:"status" gorm:"default:true"`
 	CreatedAt      time.Time `json:"createdAt"`
 	UpdatedAt      time.Time `json:"updatedAt"`
@@ -96,6 +96,15 @@ type ExchangeOrder struct {
 	DeletedAt    *time.Time      `json:"deletedAt" db:"deletedAt"`
 }
 
+// OrderFilter narrows a user's orders and trades for export. From is
+// inclusive and To exclusive.
+type OrderFilter struct {
+	Symbol string
+	Status string
+	From   *time.Time
+	To     *time.Time
+}
+
 type CreateOrderRequest struct {
 	Currency string          `json:"currency" binding:"required"`
 	Pair     string          `json:"pair" binding:"required"`
@@ -105,6 +114,11 @@ type CreateOrderRequest struct {
 	Price    *decimal.Decimal `json:"price"`
 }
 
+type AmendOrderRequest struct {
+	Price  *decimal.Decimal `json:"price"`
+	Amount *decimal.Decimal `json:"amount"`
+}
+
 type OrderResponse struct {
 	ID          uuid.UUID        `json:"id"`
 	Status      OrderStatus      `json:"status"`
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+type BalanceSnapshot struct {
+	SnapshotDate      time.Time       `json:"snapshotDate" db:"snapshotDate"`
+	UserID            uuid.UUID       `json:"userId" db:"userId"`
+	WalletID          uuid.UUID       `json:"walletId" db:"walletId"`
+	Currency          string          `json:"currency" db:"currency"`
+	WalletType        WalletType      `json:"walletType" db:"walletType"`
+	Balance           decimal.Decimal `json:"balance" db:"balance"`
+	InOrder           decimal.Decimal `json:"inOrder" db:"inOrder"`
+	Price             decimal.Decimal `json:"price" db:"price"`
+	Value             decimal.Decimal `json:"value" db:"value"`
+	ReferenceCurrency string          `json:"referenceCurrency" db:"referenceCurrency"`
+}
+
+type PortfolioAllocation struct {
+	Currency string          `json:"currency"`
+	Amount   decimal.Decimal `json:"amount"`
+	Price    decimal.Decimal `json:"price"`
+	Value    decimal.Decimal `json:"value"`
+	// Share is the percentage of the portfolio's total value.
+	Share decimal.Decimal `json:"share"`
+}
+
+type PortfolioPoint struct {
+	Date  time.Time       `json:"date"`
+	Value decimal.Decimal `json:"value"`
+	// NetFlow is the value of deposits, withdrawals and user transfers since
+	// the previous point; PnL excludes it so funding doesn't count as profit.
+	NetFlow decimal.Decimal `json:"netFlow"`
+	PnL     decimal.Decimal `json:"pnl"`
+	// CumulativePnL is the running PnL since the first point in the series.
+	CumulativePnL decimal.Decimal `json:"cumulativePnl"`
+}
+
+type Portfolio struct {
+	ReferenceCurrency string                 `json:"referenceCurrency"`
+	TotalValue        decimal.Decimal        `json:"totalValue"`
+	Allocation        []*PortfolioAllocation `json:"allocation"`
+	// Unpriced lists held currencies with no route to the reference currency;
+	// they're left out of TotalValue.
+	Unpriced []string          `json:"unpriced"`
+	History  []*PortfolioPoint `json:"history"`
+}
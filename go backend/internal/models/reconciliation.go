@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+type ReconciliationCheck string
+
+const (
+	// ReconciliationLedger compares a wallet's balance and inOrder with its
+	// WALLET and WALLET_HOLD ledger accounts.
+	ReconciliationLedger ReconciliationCheck = "LEDGER"
+	// ReconciliationTransactions compares a wallet's balance with its opening
+	// balance plus every recorded balance change.
+	ReconciliationTransactions ReconciliationCheck = "TRANSACTIONS"
+	// ReconciliationHolds compares a wallet's inOrder with its open orders,
+	// pending withdrawals, P2P escrows and active stakes.
+	ReconciliationHolds ReconciliationCheck = "HOLDS"
+	// ReconciliationCustody compares master wallet balances plus private
+	// ledger differences with what ECO wallets owe users.
+	ReconciliationCustody ReconciliationCheck = "CUSTODY"
+)
+
+type Discrepancy struct {
+	Check      ReconciliationCheck `json:"check"`
+	WalletID   *uuid.UUID          `json:"walletId,omitempty"`
+	UserID     *uuid.UUID          `json:"userId,omitempty"`
+	Currency   string              `json:"currency"`
+	WalletType WalletType          `json:"walletType,omitempty"`
+	Field      string              `json:"field"`
+	Expected   decimal.Decimal     `json:"expected"`
+	Actual     decimal.Decimal     `json:"actual"`
+	Difference decimal.Decimal     `json:"difference"`
+}
+
+type ReconciliationReport struct {
+	ID             uuid.UUID      `json:"id"`
+	StartedAt      time.Time      `json:"startedAt"`
+	FinishedAt     time.Time      `json:"finishedAt"`
+	WalletsChecked int            `json:"walletsChecked"`
+	Discrepancies  []*Discrepancy `json:"discrepancies"`
+	FrozenWallets  []uuid.UUID    `json:"frozenWallets"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"crypto-exchange-go/internal/reserves"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ReserveSnapshot struct {
+	ID        uuid.UUID         `json:"id"`
+	RootHash  string            `json:"rootHash"`
+	Totals    reserves.Balances `json:"totals"`
+	UserCount int               `json:"userCount"`
+	CreatedAt time.Time         `json:"createdAt"`
+}
+
+type ReserveProofResponse struct {
+	Snapshot *ReserveSnapshot `json:"snapshot"`
+	Proof    *reserves.Proof  `json:"proof"`
+}
@@ -1,18 +1,28 @@
 package models
 
 import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/shopspring/decimal"
 )
 
+const (
+	TransactionDirectionCredit = "CREDIT"
+	TransactionDirectionDebit  = "DEBIT"
+)
+
 type Transaction struct {
 	ID          uuid.UUID              `json:"id" db:"id"`
 	UserID      uuid.UUID              `json:"userId" db:"userId"`
 	Type        string                 `json:"type" db:"type"`
 	Status      string                 `json:"status" db:"status"`
 	Currency    string                 `json:"currency" db:"currency"`
+	WalletType  *string                `json:"walletType" db:"walletType"`
 	Amount      decimal.Decimal        `json:"amount" db:"amount"`
 	Fee         decimal.Decimal        `json:"fee" db:"fee"`
 	Description string                 `json:"description" db:"description"`
@@ -20,15 +30,29 @@ type Transaction struct {
 	Metadata    map[string]interface{} `json:"metadata" db:"metadata"`
 	CreatedAt   time.Time              `json:"createdAt" db:"createdAt"`
 	UpdatedAt   time.Time              `json:"updatedAt" db:"updatedAt"`
+	// Direction is CREDIT or DEBIT; Amount is unsigned. Rows recorded
+	// before it existed have none and their type says the direction.
+	Direction *string `json:"direction" db:"direction"`
+}
+
+// SignedAmount is Amount, negative for debits.
+func (t *Transaction) SignedAmount() decimal.Decimal {
+	if t.Direction != nil && *t.Direction == TransactionDirectionDebit {
+		return t.Amount.Neg()
+	}
+	return t.Amount
 }
 
+// TransactionResponse shows Amount signed, negative for debits.
 type TransactionResponse struct {
 	ID          uuid.UUID              `json:"id"`
 	UserID      uuid.UUID              `json:"userId"`
 	Type        string                 `json:"type"`
 	Status      string                 `json:"status"`
 	Currency    string                 `json:"currency"`
+	WalletType  *string                `json:"walletType"`
 	Amount      decimal.Decimal        `json:"amount"`
+	Direction   *string                `json:"direction"`
 	Fee         decimal.Decimal        `json:"fee"`
 	Description string                 `json:"description"`
 	ReferenceID *string                `json:"referenceId"`
@@ -44,10 +68,68 @@ type TransactionAnalysis struct {
 }
 
 type TransactionSummary struct {
-	Type        string  `json:"type"`
-	Currency    string  `json:"currency"`
-	TotalAmount float64 `json:"totalAmount"`
-	Count       int     `json:"count"`
+	Type        string          `json:"type"`
+	Currency    string          `json:"currency"`
+	TotalAmount decimal.Decimal `json:"totalAmount"`
+	TotalFee    decimal.Decimal `json:"totalFee"`
+	Count       int             `json:"count"`
+}
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// TransactionCursor marks the last transaction of a page. Pages are ordered by
+// createdAt then id, newest first, so the next page starts strictly after it.
+type TransactionCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+func (c TransactionCursor) Encode() string {
+	raw := strconv.FormatInt(c.CreatedAt.UnixNano(), 10) + ":" + c.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func ParseTransactionCursor(cursor string) (*TransactionCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	nanos, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+
+	ts, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	parsedID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &TransactionCursor{CreatedAt: time.Unix(0, ts).UTC(), ID: parsedID}, nil
+}
+
+// TransactionFilter narrows a user's transaction history. Empty fields don't
+// filter; From is inclusive and To exclusive.
+type TransactionFilter struct {
+	Type        string
+	Status      string
+	Currency    string
+	WalletType  string
+	ReferenceID string
+	From        *time.Time
+	To          *time.Time
+	Cursor      *TransactionCursor
+	Limit       int
+}
+
+type TransactionPage struct {
+	Items      []*TransactionResponse `json:"items"`
+	NextCursor string                 `json:"nextCursor,omitempty"`
 }
 
 func (t *Transaction) ToResponse() *TransactionResponse {
@@ -57,7 +139,9 @@ func (t *Transaction) ToResponse() *TransactionResponse {
 		Type:        t.Type,
 		Status:      t.Status,
 		Currency:    t.Currency,
-		Amount:      t.Amount,
+		WalletType:  t.WalletType,
+		Amount:      t.SignedAmount(),
+		Direction:   t.Direction,
 		Fee:         t.Fee,
 		Description: t.Description,
 		ReferenceID: t.ReferenceID,
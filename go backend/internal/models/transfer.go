@@ -0,0 +1,110 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+type WalletTransfer struct {
+	ID             uuid.UUID       `json:"id" db:"id"`
+	UserID         uuid.UUID       `json:"userId" db:"userId"`
+	FromWalletID   uuid.UUID       `json:"fromWalletId" db:"fromWalletId"`
+	ToWalletID     uuid.UUID       `json:"toWalletId" db:"toWalletId"`
+	FromType       WalletType      `json:"fromType" db:"fromType"`
+	ToType         WalletType      `json:"toType" db:"toType"`
+	Currency       string          `json:"currency" db:"currency"`
+	Amount         decimal.Decimal `json:"amount" db:"amount"`
+	IdempotencyKey string          `json:"idempotencyKey" db:"idempotencyKey"`
+	CreatedAt      time.Time       `json:"createdAt" db:"createdAt"`
+}
+
+type CreateTransferRequest struct {
+	FromType WalletType      `json:"fromType" binding:"required"`
+	ToType   WalletType      `json:"toType" binding:"required"`
+	Currency string          `json:"currency" binding:"required"`
+	Amount   decimal.Decimal `json:"amount" binding:"required"`
+}
+
+type WalletTransferResponse struct {
+	ID        uuid.UUID       `json:"id"`
+	FromType  WalletType      `json:"fromType"`
+	ToType    WalletType      `json:"toType"`
+	Currency  string          `json:"currency"`
+	Amount    decimal.Decimal `json:"amount"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+func (t *WalletTransfer) ToResponse() *WalletTransferResponse {
+	return &WalletTransferResponse{
+		ID:        t.ID,
+		FromType:  t.FromType,
+		ToType:    t.ToType,
+		Currency:  t.Currency,
+		Amount:    t.Amount,
+		CreatedAt: t.CreatedAt,
+	}
+}
+
+type UserTransfer struct {
+	ID             uuid.UUID       `json:"id" db:"id"`
+	SenderID       uuid.UUID       `json:"senderId" db:"senderId"`
+	RecipientID    uuid.UUID       `json:"recipientId" db:"recipientId"`
+	Currency       string          `json:"currency" db:"currency"`
+	Amount         decimal.Decimal `json:"amount" db:"amount"`
+	IdempotencyKey string          `json:"idempotencyKey" db:"idempotencyKey"`
+	CreatedAt      time.Time       `json:"createdAt" db:"createdAt"`
+}
+
+type UserTransferRequest struct {
+	Recipient string          `json:"recipient" binding:"required"`
+	Currency  string          `json:"currency" binding:"required"`
+	Amount    decimal.Decimal `json:"amount" binding:"required"`
+	OTP       string          `json:"otp"`
+}
+
+type UserTransferRecipient struct {
+	ID    uuid.UUID `json:"id"`
+	Name  string    `json:"name"`
+	Email string    `json:"email"`
+}
+
+type UserTransferPreview struct {
+	Recipient      *UserTransferRecipient `json:"recipient"`
+	Currency       string                 `json:"currency"`
+	Amount         decimal.Decimal        `json:"amount"`
+	Fee            decimal.Decimal        `json:"fee"`
+	RequiresOTP    bool                   `json:"requiresOtp"`
+	DailyLimit     decimal.Decimal        `json:"dailyLimit"`
+	DailyRemaining decimal.Decimal        `json:"dailyRemaining"`
+}
+
+type UserTransferResponse struct {
+	ID        uuid.UUID              `json:"id"`
+	Recipient *UserTransferRecipient `json:"recipient"`
+	Currency  string                 `json:"currency"`
+	Amount    decimal.Decimal        `json:"amount"`
+	CreatedAt time.Time              `json:"createdAt"`
+}
+
+// NewUserTransferRecipient shows just enough of the recipient for the sender
+// to confirm who they're paying: first name, last initial and a masked email.
+func NewUserTransferRecipient(user *User) *UserTransferRecipient {
+	name := user.FirstName
+	if user.LastName != "" {
+		name = strings.TrimSpace(name + " " + string([]rune(user.LastName)[:1]) + ".")
+	}
+
+	email := user.Email
+	if local, domain, ok := strings.Cut(user.Email, "@"); ok && local != "" {
+		email = string([]rune(local)[:1]) + "***@" + domain
+	}
+
+	return &UserTransferRecipient{
+		ID:    user.ID,
+		Name:  name,
+		Email: email,
+	}
+}
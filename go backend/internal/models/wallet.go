@@ -13,6 +13,7 @@ const (
 	WalletTypeSpot    WalletType = "SPOT"
 	WalletTypeFutures WalletType = "FUTURES"
 	WalletTypeFiat    WalletType = "FIAT"
+	WalletTypeEco     WalletType = "ECO"
 )
 
 type Wallet struct {
@@ -21,6 +22,8 @@ type Wallet struct {
 	Type      WalletType      `json:"type" db:"type"`
 	Currency  string          `json:"currency" db:"currency"`
 	Balance   decimal.Decimal `json:"balance" db:"balance"`
+	InOrder   decimal.Decimal `json:"inOrder" db:"inOrder"`
+	Frozen    bool            `json:"frozen" db:"frozen"`
 	CreatedAt time.Time       `json:"createdAt" db:"createdAt"`
 	UpdatedAt time.Time       `json:"updatedAt" db:"updatedAt"`
 }
@@ -30,6 +33,9 @@ type WalletResponse struct {
 	Type     WalletType      `json:"type"`
 	Currency string          `json:"currency"`
 	Balance  decimal.Decimal `json:"balance"`
+	InOrder  decimal.Decimal `json:"inOrder"`
+	Total    decimal.Decimal `json:"total"`
+	Frozen   bool            `json:"frozen"`
 }
 
 func (w *Wallet) ToResponse() *WalletResponse {
@@ -38,5 +44,8 @@ func (w *Wallet) ToResponse() *WalletResponse {
 		Type:     w.Type,
 		Currency: w.Currency,
 		Balance:  w.Balance,
+		InOrder:  w.InOrder,
+		Total:    w.Balance.Add(w.InOrder),
+		Frozen:   w.Frozen,
 	}
 }
@@ -7,6 +7,49 @@ import (
 	"github.com/shopspring/decimal"
 )
 
+const (
+	WithdrawalStatusPending   = "PENDING"
+	WithdrawalStatusApproved  = "APPROVED"
+	WithdrawalStatusBroadcast = "BROADCAST"
+	WithdrawalStatusConfirmed = "CONFIRMED"
+	WithdrawalStatusFailed    = "FAILED"
+	WithdrawalStatusRejected  = "REJECTED"
+	WithdrawalStatusCanceled  = "CANCELED"
+)
+
+// withdrawalTransitions is the withdrawal state machine. Funds are held
+// from creation until the withdrawal is confirmed, which captures them, or
+// ends any other way, which releases them.
+var withdrawalTransitions = map[string][]string{
+	WithdrawalStatusPending:   {WithdrawalStatusApproved, WithdrawalStatusRejected, WithdrawalStatusCanceled},
+	WithdrawalStatusApproved:  {WithdrawalStatusBroadcast, WithdrawalStatusRejected},
+	WithdrawalStatusBroadcast: {WithdrawalStatusConfirmed, WithdrawalStatusFailed},
+}
+
+// WithdrawalHoldingStatuses are the statuses a withdrawal holds funds in.
+var WithdrawalHoldingStatuses = []string{WithdrawalStatusPending, WithdrawalStatusApproved, WithdrawalStatusBroadcast}
+
+func CanTransitionWithdrawal(from, to string) bool {
+	for _, next := range withdrawalTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Actions recorded in a withdrawal's audit trail.
+const (
+	WithdrawalActionCreated      = "CREATED"
+	WithdrawalActionAutoApproved = "AUTO_APPROVED"
+	WithdrawalActionApproved     = "APPROVED"
+	WithdrawalActionRejected     = "REJECTED"
+	WithdrawalActionBroadcast    = "BROADCAST"
+	WithdrawalActionConfirmed    = "CONFIRMED"
+	WithdrawalActionFailed       = "FAILED"
+	WithdrawalActionCanceled     = "CANCELED"
+)
+
 type Withdrawal struct {
 	ID          uuid.UUID              `json:"id" db:"id"`
 	UserID      uuid.UUID              `json:"userId" db:"userId"`
@@ -18,51 +61,140 @@ type Withdrawal struct {
 	Method      string                 `json:"method" db:"method"`
 	Address     *string                `json:"address" db:"address"`
 	Network     *string                `json:"network" db:"network"`
+	Memo        *string                `json:"memo" db:"memo"`
 	BankDetails map[string]interface{} `json:"bankDetails" db:"bankDetails"`
-	CreatedAt   time.Time              `json:"createdAt" db:"createdAt"`
-	UpdatedAt   time.Time              `json:"updatedAt" db:"updatedAt"`
+	// TransactionID is the on-chain or bank reference once the funds are
+	// sent.
+	TransactionID *string   `json:"transactionId" db:"transactionId"`
+	RiskScore     int       `json:"riskScore" db:"riskScore"`
+	RiskFactors   []string  `json:"riskFactors" db:"riskFactors"`
+	CreatedAt     time.Time `json:"createdAt" db:"createdAt"`
+	UpdatedAt     time.Time `json:"updatedAt" db:"updatedAt"`
+	// ReferenceValue is Amount in the valuation reference currency at
+	// creation, counted against the user's withdrawal limits.
+	ReferenceValue decimal.Decimal `json:"-" db:"referenceValue"`
+	// BatchID is the UTXO batch paying the withdrawal. A batched withdrawal
+	// only moves with its batch.
+	BatchID *uuid.UUID `json:"-" db:"batchId"`
 }
 
+// CreateWithdrawalRequest is what the user asks for. The fee isn't part of
+// it; the server charges it from the fee schedule on top of Amount.
 type CreateWithdrawalRequest struct {
 	Currency    string                 `json:"currency"`
 	Amount      decimal.Decimal        `json:"amount"`
-	Fee         decimal.Decimal        `json:"fee"`
 	Method      string                 `json:"method"`
 	Address     *string                `json:"address"`
 	Network     *string                `json:"network"`
+	Memo        *string                `json:"memo"`
 	BankDetails map[string]interface{} `json:"bankDetails"`
+	// Device is filled in by the handler from the request, for risk
+	// scoring.
+	Device RequestDevice `json:"-"`
+}
+
+// RequestDevice identifies the client a request came from. ID is the
+// client's own device id when it sends one.
+type RequestDevice struct {
+	ID        string
+	UserAgent string
+	IP        string
 }
 
 type WithdrawalResponse struct {
-	ID          uuid.UUID              `json:"id"`
-	UserID      uuid.UUID              `json:"userId"`
-	Type        string                 `json:"type"`
-	Currency    string                 `json:"currency"`
-	Amount      decimal.Decimal        `json:"amount"`
-	Fee         decimal.Decimal        `json:"fee"`
-	Status      string                 `json:"status"`
-	Method      string                 `json:"method"`
-	Address     *string                `json:"address"`
-	Network     *string                `json:"network"`
-	BankDetails map[string]interface{} `json:"bankDetails"`
-	CreatedAt   time.Time              `json:"createdAt"`
-	UpdatedAt   time.Time              `json:"updatedAt"`
+	ID            uuid.UUID              `json:"id"`
+	UserID        uuid.UUID              `json:"userId"`
+	Type          string                 `json:"type"`
+	Currency      string                 `json:"currency"`
+	Amount        decimal.Decimal        `json:"amount"`
+	Fee           decimal.Decimal        `json:"fee"`
+	Status        string                 `json:"status"`
+	Method        string                 `json:"method"`
+	Address       *string                `json:"address"`
+	Network       *string                `json:"network"`
+	Memo          *string                `json:"memo"`
+	BankDetails   map[string]interface{} `json:"bankDetails"`
+	TransactionID *string                `json:"transactionId"`
+	CreatedAt     time.Time              `json:"createdAt"`
+	UpdatedAt     time.Time              `json:"updatedAt"`
+}
+
+// AdminWithdrawal is a withdrawal as the review queue shows it, with its
+// risk assessment.
+type AdminWithdrawal struct {
+	*WithdrawalResponse
+	RiskScore   int        `json:"riskScore"`
+	RiskFactors []string   `json:"riskFactors"`
+	BatchID     *uuid.UUID `json:"batchId"`
+}
+
+// WithdrawalLimits shows a user's withdrawal limits and what is left of them
+// today and this month (UTC), valued in Currency. Limited is false when no
+// limits apply.
+type WithdrawalLimits struct {
+	KYCLevel         int             `json:"kycLevel"`
+	Currency         string          `json:"currency"`
+	Limited          bool            `json:"limited"`
+	DailyLimit       decimal.Decimal `json:"dailyLimit"`
+	DailyUsed        decimal.Decimal `json:"dailyUsed"`
+	DailyRemaining   decimal.Decimal `json:"dailyRemaining"`
+	MonthlyLimit     decimal.Decimal `json:"monthlyLimit"`
+	MonthlyUsed      decimal.Decimal `json:"monthlyUsed"`
+	MonthlyRemaining decimal.Decimal `json:"monthlyRemaining"`
+}
+
+type WithdrawalAudit struct {
+	ID           uuid.UUID `json:"id" db:"id"`
+	WithdrawalID uuid.UUID `json:"withdrawalId" db:"withdrawalId"`
+	// ActorID is the admin who acted, or the user for cancellations; nil
+	// for the system.
+	ActorID    *uuid.UUID             `json:"actorId" db:"actorId"`
+	Action     string                 `json:"action" db:"action"`
+	FromStatus *string                `json:"fromStatus" db:"fromStatus"`
+	ToStatus   string                 `json:"toStatus" db:"toStatus"`
+	Reason     *string                `json:"reason" db:"reason"`
+	Details    map[string]interface{} `json:"details" db:"details"`
+	CreatedAt  time.Time              `json:"createdAt" db:"createdAt"`
+}
+
+type WithdrawalReview struct {
+	Withdrawal *AdminWithdrawal   `json:"withdrawal"`
+	Audit      []*WithdrawalAudit `json:"audit"`
+}
+
+type ReviewWithdrawalRequest struct {
+	Reason string `json:"reason"`
+}
+
+type MarkWithdrawalBroadcastRequest struct {
+	TransactionID string `json:"transactionId" binding:"required"`
+}
+
+func (w *Withdrawal) ToAdmin() *AdminWithdrawal {
+	return &AdminWithdrawal{
+		WithdrawalResponse: w.ToResponse(),
+		RiskScore:          w.RiskScore,
+		RiskFactors:        w.RiskFactors,
+		BatchID:            w.BatchID,
+	}
 }
 
 func (w *Withdrawal) ToResponse() *WithdrawalResponse {
 	return &WithdrawalResponse{
-		ID:          w.ID,
-		UserID:      w.UserID,
-		Type:        w.Type,
-		Currency:    w.Currency,
-		Amount:      w.Amount,
-		Fee:         w.Fee,
-		Status:      w.Status,
-		Method:      w.Method,
-		Address:     w.Address,
-		Network:     w.Network,
-		BankDetails: w.BankDetails,
-		CreatedAt:   w.CreatedAt,
-		UpdatedAt:   w.UpdatedAt,
+		ID:            w.ID,
+		UserID:        w.UserID,
+		Type:          w.Type,
+		Currency:      w.Currency,
+		Amount:        w.Amount,
+		Fee:           w.Fee,
+		Status:        w.Status,
+		Method:        w.Method,
+		Address:       w.Address,
+		Network:       w.Network,
+		Memo:          w.Memo,
+		BankDetails:   w.BankDetails,
+		TransactionID: w.TransactionID,
+		CreatedAt:     w.CreatedAt,
+		UpdatedAt:     w.UpdatedAt,
 	}
 }
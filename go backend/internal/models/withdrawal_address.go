@@ -0,0 +1,83 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type WithdrawalAddress struct {
+	ID          uuid.UUID  `json:"id" db:"id"`
+	UserID      uuid.UUID  `json:"userId" db:"userId"`
+	Currency    string     `json:"currency" db:"currency"`
+	Network     string     `json:"network" db:"network"`
+	Address     string     `json:"address" db:"address"`
+	Memo        string     `json:"memo" db:"memo"`
+	Label       string     `json:"label" db:"label"`
+	ConfirmedAt *time.Time `json:"confirmedAt" db:"confirmedAt"`
+	UsableAt    time.Time  `json:"usableAt" db:"usableAt"`
+	CreatedAt   time.Time  `json:"createdAt" db:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt" db:"updatedAt"`
+}
+
+// Usable reports whether withdrawals may go to the address: its email
+// confirmation is done and its cooling period is over.
+func (a *WithdrawalAddress) Usable(now time.Time) bool {
+	return a.ConfirmedAt != nil && !now.Before(a.UsableAt)
+}
+
+type WithdrawalAddressResponse struct {
+	ID        uuid.UUID `json:"id"`
+	Currency  string    `json:"currency"`
+	Network   string    `json:"network"`
+	Address   string    `json:"address"`
+	Memo      string    `json:"memo"`
+	Label     string    `json:"label"`
+	Confirmed bool      `json:"confirmed"`
+	Usable    bool      `json:"usable"`
+	UsableAt  time.Time `json:"usableAt"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (a *WithdrawalAddress) ToResponse() *WithdrawalAddressResponse {
+	return &WithdrawalAddressResponse{
+		ID:        a.ID,
+		Currency:  a.Currency,
+		Network:   a.Network,
+		Address:   a.Address,
+		Memo:      a.Memo,
+		Label:     a.Label,
+		Confirmed: a.ConfirmedAt != nil,
+		Usable:    a.Usable(time.Now()),
+		UsableAt:  a.UsableAt,
+		CreatedAt: a.CreatedAt,
+	}
+}
+
+type CreateWithdrawalAddressRequest struct {
+	Currency string `json:"currency" binding:"required"`
+	Network  string `json:"network"`
+	Address  string `json:"address" binding:"required"`
+	Memo     string `json:"memo"`
+	Label    string `json:"label"`
+}
+
+type UpdateWithdrawalAddressRequest struct {
+	Label string `json:"label"`
+}
+
+// WithdrawalWhitelist is the user's whitelist-only setting. DisableAt is set
+// once turning it off has been confirmed; it stays on until then.
+type WithdrawalWhitelist struct {
+	Enabled        bool       `json:"enabled"`
+	DisablePending bool       `json:"disablePending"`
+	DisableAt      *time.Time `json:"disableAt"`
+}
+
+type UpdateWithdrawalWhitelistRequest struct {
+	Enabled bool `json:"enabled"`
+}
+
+type ConfirmationRequest struct {
+	Token string `json:"token" binding:"required"`
+}
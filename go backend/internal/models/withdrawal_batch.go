@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	WithdrawalBatchStatusUnsigned  = "UNSIGNED"
+	WithdrawalBatchStatusSigned    = "SIGNED"
+	WithdrawalBatchStatusBroadcast = "BROADCAST"
+	WithdrawalBatchStatusConfirmed = "CONFIRMED"
+	WithdrawalBatchStatusFailed    = "FAILED"
+	WithdrawalBatchStatusAbandoned = "ABANDONED"
+)
+
+// WithdrawalBatch is one transaction paying several withdrawals on a UTXO
+// chain. RawTx is unsigned; SignedTx is set once the signer signed it, and
+// TransactionID once it was broadcast. Its withdrawals move with it: an
+// abandoned batch gives them back to the next run, a confirmed one captures
+// their holds and a failed one releases them.
+type WithdrawalBatch struct {
+	ID            uuid.UUID `json:"id" db:"id"`
+	Chain         string    `json:"chain" db:"chain"`
+	Status        string    `json:"status" db:"status"`
+	RawTx         string    `json:"rawTx" db:"rawTx"`
+	SignedTx      *string   `json:"signedTx" db:"signedTx"`
+	Fee           int64     `json:"fee" db:"fee"`
+	TransactionID *string   `json:"transactionId" db:"transactionId"`
+	CreatedAt     time.Time `json:"createdAt" db:"createdAt"`
+	UpdatedAt     time.Time `json:"updatedAt" db:"updatedAt"`
+}
@@ -0,0 +1,442 @@
+package payments
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	PayPalTransmissionIDHeader   = "Paypal-Transmission-Id"
+	PayPalTransmissionTimeHeader = "Paypal-Transmission-Time"
+	PayPalTransmissionSigHeader  = "Paypal-Transmission-Sig"
+	PayPalCertURLHeader          = "Paypal-Cert-Url"
+	PayPalAuthAlgoHeader         = "Paypal-Auth-Algo"
+
+	paypalAPI        = "https://api-m.paypal.com"
+	paypalSandboxAPI = "https://api-m.sandbox.paypal.com"
+
+	// PayPal signs webhooks with a certificate issued to these names.
+	paypalCertName        = "messageverificationcerts.paypal.com"
+	paypalSandboxCertName = "messageverificationcerts.sandbox.paypal.com"
+)
+
+// CertificateSource returns the certificate PayPal signed a webhook with.
+type CertificateSource func(ctx context.Context, certURL string) (*x509.Certificate, error)
+
+type PayPalOptions struct {
+	ClientID     string
+	ClientSecret string
+	// WebhookID is the id PayPal assigned the webhook endpoint; it's part of
+	// the signed message, so a delivery for another endpoint won't verify.
+	WebhookID string
+	Sandbox   bool
+	// BaseURL, HTTPClient and Certificates default to the PayPal API,
+	// http.DefaultClient and fetching the certificate from PayPal. Roots
+	// defaults to the system roots.
+	BaseURL      string
+	HTTPClient   *http.Client
+	Certificates CertificateSource
+	Roots        *x509.CertPool
+}
+
+type PayPal struct {
+	opts PayPalOptions
+
+	mu           sync.Mutex
+	token        string
+	tokenExpires time.Time
+
+	certMu sync.Mutex
+	certs  map[string]*x509.Certificate
+}
+
+func NewPayPal(opts PayPalOptions) *PayPal {
+	if opts.BaseURL == "" {
+		opts.BaseURL = paypalAPI
+		if opts.Sandbox {
+			opts.BaseURL = paypalSandboxAPI
+		}
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+
+	p := &PayPal{opts: opts, certs: make(map[string]*x509.Certificate)}
+	if p.opts.Certificates == nil {
+		p.opts.Certificates = p.fetchCertificate
+	}
+	return p
+}
+
+func (p *PayPal) Name() string {
+	return "PAYPAL"
+}
+
+type paypalAmount struct {
+	CurrencyCode string `json:"currency_code"`
+	Value        string `json:"value"`
+}
+
+type paypalCapture struct {
+	ID                string       `json:"id"`
+	Status            string       `json:"status"`
+	Amount            paypalAmount `json:"amount"`
+	CustomID          string       `json:"custom_id"`
+	SupplementaryData struct {
+		RelatedIDs struct {
+			OrderID string `json:"order_id"`
+		} `json:"related_ids"`
+	} `json:"supplementary_data"`
+}
+
+type paypalOrder struct {
+	ID            string `json:"id"`
+	Status        string `json:"status"`
+	PurchaseUnits []struct {
+		CustomID string       `json:"custom_id"`
+		Amount   paypalAmount `json:"amount"`
+		Payments struct {
+			Captures []paypalCapture `json:"captures"`
+		} `json:"payments"`
+	} `json:"purchase_units"`
+	Links []struct {
+		Href string `json:"href"`
+		Rel  string `json:"rel"`
+	} `json:"links"`
+}
+
+func paypalPayment(id, status string, amount paypalAmount, reference string) (*Payment, error) {
+	value, err := decimal.NewFromString(amount.Value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid paypal amount %q: %w", amount.Value, err)
+	}
+
+	payment := &Payment{
+		ID:        id,
+		Status:    PaymentPending,
+		Amount:    value,
+		Currency:  strings.ToUpper(amount.CurrencyCode),
+		Reference: reference,
+	}
+	switch status {
+	case "COMPLETED":
+		payment.Status = PaymentSucceeded
+	case "DECLINED", "DENIED", "FAILED", "VOIDED":
+		payment.Status = PaymentFailed
+	}
+	return payment, nil
+}
+
+// payment describes an order by its first purchase unit. A completed order
+// only counts once its capture has completed too.
+func (o *paypalOrder) payment() (*Payment, error) {
+	if len(o.PurchaseUnits) == 0 {
+		return nil, fmt.Errorf("paypal order %s has no purchase units", o.ID)
+	}
+
+	unit := o.PurchaseUnits[0]
+	status := o.Status
+	if status == "COMPLETED" {
+		status = ""
+		for _, capture := range unit.Payments.Captures {
+			status = capture.Status
+		}
+	}
+	return paypalPayment(o.ID, status, unit.Amount, unit.CustomID)
+}
+
+func (p *PayPal) CreatePayment(ctx context.Context, amount decimal.Decimal, currency, reference string) (*Payment, error) {
+	body := map[string]interface{}{
+		"intent": "CAPTURE",
+		"purchase_units": []map[string]interface{}{{
+			"custom_id": reference,
+			"amount": paypalAmount{
+				CurrencyCode: strings.ToUpper(currency),
+				Value:        amount.String(),
+			},
+		}},
+	}
+
+	order := &paypalOrder{}
+	if err := p.do(ctx, http.MethodPost, "/v2/checkout/orders", body, order); err != nil {
+		return nil, err
+	}
+
+	payment, err := order.payment()
+	if err != nil {
+		return nil, err
+	}
+	for _, link := range order.Links {
+		if link.Rel == "approve" || link.Rel == "payer-action" {
+			payment.ClientData = map[string]interface{}{"approvalUrl": link.Href}
+		}
+	}
+	return payment, nil
+}
+
+// ConfirmPayment captures an order the buyer has approved. Orders that aren't
+// approved yet, or are already captured, are returned as they are.
+func (p *PayPal) ConfirmPayment(ctx context.Context, id string) (*Payment, error) {
+	path := "/v2/checkout/orders/" + url.PathEscape(id)
+
+	order := &paypalOrder{}
+	if err := p.do(ctx, http.MethodGet, path, nil, order); err != nil {
+		return nil, err
+	}
+
+	if order.Status == "APPROVED" {
+		order = &paypalOrder{}
+		if err := p.do(ctx, http.MethodPost, path+"/capture", struct{}{}, order); err != nil {
+			return nil, err
+		}
+	}
+
+	return order.payment()
+}
+
+func (p *PayPal) accessToken(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.token != "" && time.Now().Before(p.tokenExpires) {
+		return p.token, nil
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.opts.BaseURL+"/v1/oauth2/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to create paypal token request: %w", err)
+	}
+	req.SetBasicAuth(p.opts.ClientID, p.opts.ClientSecret)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := p.opts.HTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get paypal token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return "", fmt.Errorf("paypal token request returned %d", resp.StatusCode)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("failed to decode paypal token: %w", err)
+	}
+
+	// Renew a minute early so a token never expires mid-request.
+	p.token = token.AccessToken
+	p.tokenExpires = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - time.Minute)
+	return p.token, nil
+}
+
+func (p *PayPal) do(ctx context.Context, method, path string, in, out interface{}) error {
+	token, err := p.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("failed to encode paypal request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, p.opts.BaseURL+path, body)
+	if err != nil {
+		return fmt.Errorf("failed to create paypal request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := p.opts.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call paypal: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrPaymentNotFound
+	}
+	if resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("paypal returned %d: %s", resp.StatusCode, data)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode paypal response: %w", err)
+	}
+	return nil
+}
+
+// PayPalSignedMessage is what PayPal signs for a webhook delivery: the
+// transmission id and time, the webhook id and the CRC32 of the raw body.
+func PayPalSignedMessage(transmissionID, transmissionTime, webhookID string, body []byte) string {
+	return strings.Join([]string{
+		transmissionID,
+		transmissionTime,
+		webhookID,
+		strconv.FormatUint(uint64(crc32.ChecksumIEEE(body)), 10),
+	}, "|")
+}
+
+// VerifyWebhook checks the transmission signature, an SHA256withRSA
+// signature over PayPalSignedMessage, against the certificate named in the
+// delivery. The certificate must come from PayPal.
+func (p *PayPal) VerifyWebhook(ctx context.Context, header http.Header, body []byte) (*Event, error) {
+	if algo := header.Get(PayPalAuthAlgoHeader); algo != "SHA256withRSA" {
+		return nil, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidSignature, algo)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(header.Get(PayPalTransmissionSigHeader))
+	if err != nil || len(signature) == 0 {
+		return nil, ErrInvalidSignature
+	}
+
+	certURL := header.Get(PayPalCertURLHeader)
+	if err := checkPayPalCertURL(certURL); err != nil {
+		return nil, err
+	}
+
+	cert, err := p.opts.Certificates(ctx, certURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get paypal certificate: %w", err)
+	}
+
+	key, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: certificate key is not RSA", ErrInvalidSignature)
+	}
+
+	message := PayPalSignedMessage(header.Get(PayPalTransmissionIDHeader), header.Get(PayPalTransmissionTimeHeader), p.opts.WebhookID, body)
+	digest := sha256.Sum256([]byte(message))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, ErrInvalidSignature
+	}
+
+	var event struct {
+		ID           string          `json:"id"`
+		EventType    string          `json:"event_type"`
+		ResourceType string          `json:"resource_type"`
+		Resource     json.RawMessage `json:"resource"`
+	}
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, fmt.Errorf("failed to decode paypal event: %w", err)
+	}
+
+	result := &Event{ID: event.ID, Type: event.EventType}
+	if event.ResourceType == "capture" {
+		capture := &paypalCapture{}
+		if err := json.Unmarshal(event.Resource, capture); err != nil {
+			return nil, fmt.Errorf("failed to decode paypal capture: %w", err)
+		}
+		// Deposits track the order, so the payment is reported under the
+		// order id rather than the capture's.
+		result.Payment, err = paypalPayment(capture.SupplementaryData.RelatedIDs.OrderID, capture.Status, capture.Amount, capture.CustomID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+func checkPayPalCertURL(certURL string) error {
+	u, err := url.Parse(certURL)
+	if err != nil || u.Scheme != "https" {
+		return fmt.Errorf("%w: invalid certificate url", ErrInvalidSignature)
+	}
+	host := u.Hostname()
+	if host != "paypal.com" && !strings.HasSuffix(host, ".paypal.com") {
+		return fmt.Errorf("%w: certificate not served by paypal", ErrInvalidSignature)
+	}
+	return nil
+}
+
+// fetchCertificate downloads a signing certificate, checks it chains to a
+// trusted root and was issued to PayPal's signing name, and caches it by URL.
+func (p *PayPal) fetchCertificate(ctx context.Context, certURL string) (*x509.Certificate, error) {
+	p.certMu.Lock()
+	cert, ok := p.certs[certURL]
+	p.certMu.Unlock()
+	if ok && time.Now().Before(cert.NotAfter) {
+		return cert, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, certURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.opts.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("certificate request returned %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return nil, err
+	}
+
+	var chain []*x509.Certificate
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		c, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, c)
+	}
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("no certificate at %s", certURL)
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, c := range chain[1:] {
+		intermediates.AddCert(c)
+	}
+	name := paypalCertName
+	if p.opts.Sandbox {
+		name = paypalSandboxCertName
+	}
+	opts := x509.VerifyOptions{DNSName: name, Roots: p.opts.Roots, Intermediates: intermediates}
+	if _, err := chain[0].Verify(opts); err != nil {
+		return nil, fmt.Errorf("untrusted paypal certificate: %w", err)
+	}
+
+	p.certMu.Lock()
+	p.certs[certURL] = chain[0]
+	p.certMu.Unlock()
+
+	return chain[0], nil
+}
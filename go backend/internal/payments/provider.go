@@ -0,0 +1,77 @@
+// Package payments talks to the card and wallet providers fiat deposits are
+// paid through. Every provider creates a payment for a deposit, reports its
+// state when asked, and authenticates the webhooks it sends, so deposits are
+// only ever credited on the provider's word rather than the client's.
+package payments
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrPaymentNotFound  = errors.New("payment not found")
+	// ErrNoWebhookSecret means webhooks can't be authenticated, so the
+	// provider must not be used.
+	ErrNoWebhookSecret = errors.New("webhook secret is not configured")
+)
+
+type PaymentStatus string
+
+const (
+	PaymentPending   PaymentStatus = "PENDING"
+	PaymentSucceeded PaymentStatus = "SUCCEEDED"
+	PaymentFailed    PaymentStatus = "FAILED"
+)
+
+type Payment struct {
+	ID       string
+	Status   PaymentStatus
+	Amount   decimal.Decimal
+	Currency string
+	// Reference is the deposit id the payment was created for, as echoed
+	// back by the provider.
+	Reference string
+	// ClientData is what the client needs to complete the payment, like a
+	// Stripe client secret or a PayPal approval link.
+	ClientData map[string]interface{}
+}
+
+type Event struct {
+	ID   string
+	Type string
+	// Payment is nil for event types that don't describe a payment.
+	Payment *Payment
+}
+
+type PaymentProvider interface {
+	// Name matches the deposit method the provider handles.
+	Name() string
+	CreatePayment(ctx context.Context, amount decimal.Decimal, currency, reference string) (*Payment, error)
+	// ConfirmPayment completes a payment the customer has authorised, where
+	// the provider needs that, and returns its current state.
+	ConfirmPayment(ctx context.Context, id string) (*Payment, error)
+	// VerifyWebhook authenticates a webhook delivery and parses it.
+	VerifyWebhook(ctx context.Context, header http.Header, body []byte) (*Event, error)
+}
+
+// Registry looks providers up by deposit method.
+type Registry map[string]PaymentProvider
+
+func NewRegistry(providers ...PaymentProvider) Registry {
+	registry := Registry{}
+	for _, provider := range providers {
+		registry[provider.Name()] = provider
+	}
+	return registry
+}
+
+func (r Registry) Get(method string) (PaymentProvider, bool) {
+	provider, ok := r[strings.ToUpper(method)]
+	return provider, ok
+}
@@ -0,0 +1,263 @@
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	StripeSignatureHeader = "Stripe-Signature"
+	stripeAPI             = "https://api.stripe.com"
+	// stripeTolerance bounds how old a signed webhook may be, so a captured
+	// delivery can't be replayed later.
+	stripeTolerance = 5 * time.Minute
+)
+
+// Stripe amounts are in the currency's minor unit. These currencies have none
+// or three decimals instead of two.
+var (
+	stripeZeroDecimal  = map[string]bool{"BIF": true, "CLP": true, "DJF": true, "GNF": true, "JPY": true, "KMF": true, "KRW": true, "MGA": true, "PYG": true, "RWF": true, "UGX": true, "VND": true, "VUV": true, "XAF": true, "XOF": true, "XPF": true}
+	stripeThreeDecimal = map[string]bool{"BHD": true, "JOD": true, "KWD": true, "OMR": true, "TND": true}
+)
+
+func stripeExponent(currency string) int32 {
+	currency = strings.ToUpper(currency)
+	switch {
+	case stripeZeroDecimal[currency]:
+		return 0
+	case stripeThreeDecimal[currency]:
+		return 3
+	}
+	return 2
+}
+
+// StripeAmount converts a minor unit amount to a decimal amount.
+func StripeAmount(minor int64, currency string) decimal.Decimal {
+	return decimal.NewFromInt(minor).Shift(-stripeExponent(currency))
+}
+
+// StripeMinorAmount converts an amount to the currency's minor unit. Amounts
+// finer than the minor unit are rejected rather than rounded.
+func StripeMinorAmount(amount decimal.Decimal, currency string) (int64, error) {
+	minor := amount.Shift(stripeExponent(currency))
+	if !minor.Equal(minor.Truncate(0)) {
+		return 0, fmt.Errorf("amount %s has more precision than %s allows", amount, strings.ToUpper(currency))
+	}
+	return minor.IntPart(), nil
+}
+
+type StripeOptions struct {
+	SecretKey     string
+	WebhookSecret string
+	// BaseURL and HTTPClient default to the live API and http.DefaultClient.
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+type Stripe struct {
+	opts StripeOptions
+}
+
+// NewStripe refuses options without a webhook secret: anyone could sign a
+// webhook with an empty one.
+func NewStripe(opts StripeOptions) (*Stripe, error) {
+	if opts.WebhookSecret == "" {
+		return nil, fmt.Errorf("stripe: %w", ErrNoWebhookSecret)
+	}
+	if opts.BaseURL == "" {
+		opts.BaseURL = stripeAPI
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+	return &Stripe{opts: opts}, nil
+}
+
+func (s *Stripe) Name() string {
+	return "STRIPE"
+}
+
+type stripePaymentIntent struct {
+	ID           string            `json:"id"`
+	Amount       int64             `json:"amount"`
+	Currency     string            `json:"currency"`
+	Status       string            `json:"status"`
+	ClientSecret string            `json:"client_secret"`
+	Metadata     map[string]string `json:"metadata"`
+}
+
+func (i *stripePaymentIntent) payment() *Payment {
+	status := PaymentPending
+	switch i.Status {
+	case "succeeded":
+		status = PaymentSucceeded
+	case "canceled":
+		status = PaymentFailed
+	}
+	return &Payment{
+		ID:        i.ID,
+		Status:    status,
+		Amount:    StripeAmount(i.Amount, i.Currency),
+		Currency:  strings.ToUpper(i.Currency),
+		Reference: i.Metadata["reference"],
+	}
+}
+
+func (s *Stripe) CreatePayment(ctx context.Context, amount decimal.Decimal, currency, reference string) (*Payment, error) {
+	minor, err := StripeMinorAmount(amount, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("amount", strconv.FormatInt(minor, 10))
+	form.Set("currency", strings.ToLower(currency))
+	form.Set("metadata[reference]", reference)
+	form.Set("automatic_payment_methods[enabled]", "true")
+
+	intent := &stripePaymentIntent{}
+	if err := s.do(ctx, http.MethodPost, "/v1/payment_intents", form, intent); err != nil {
+		return nil, err
+	}
+
+	payment := intent.payment()
+	payment.ClientData = map[string]interface{}{"clientSecret": intent.ClientSecret}
+	return payment, nil
+}
+
+// ConfirmPayment only reads the intent: Stripe intents are confirmed by the
+// client with the client secret.
+func (s *Stripe) ConfirmPayment(ctx context.Context, id string) (*Payment, error) {
+	intent := &stripePaymentIntent{}
+	if err := s.do(ctx, http.MethodGet, "/v1/payment_intents/"+url.PathEscape(id), nil, intent); err != nil {
+		return nil, err
+	}
+	return intent.payment(), nil
+}
+
+func (s *Stripe) do(ctx context.Context, method, path string, form url.Values, out interface{}) error {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, s.opts.BaseURL+path, body)
+	if err != nil {
+		return fmt.Errorf("failed to create stripe request: %w", err)
+	}
+	req.SetBasicAuth(s.opts.SecretKey, "")
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	resp, err := s.opts.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call stripe: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrPaymentNotFound
+	}
+	if resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("stripe returned %d: %s", resp.StatusCode, data)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode stripe response: %w", err)
+	}
+	return nil
+}
+
+// SignStripePayload builds a Stripe-Signature header value for a payload, as
+// Stripe does when it sends a webhook.
+func SignStripePayload(secret string, timestamp time.Time, payload []byte) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t + "."))
+	mac.Write(payload)
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhook checks the Stripe-Signature header: an HMAC-SHA256 of the
+// timestamp and the raw body under the endpoint's signing secret. Any of the
+// v1 signatures may match, which lets the secret be rolled.
+func (s *Stripe) VerifyWebhook(ctx context.Context, header http.Header, body []byte) (*Event, error) {
+	if s.opts.WebhookSecret == "" {
+		return nil, ErrNoWebhookSecret
+	}
+
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header.Get(StripeSignatureHeader), ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return nil, ErrInvalidSignature
+	}
+
+	age := time.Since(time.Unix(seconds, 0))
+	if age > stripeTolerance || age < -stripeTolerance {
+		return nil, fmt.Errorf("%w: timestamp outside tolerance", ErrInvalidSignature)
+	}
+
+	expected := SignStripePayload(s.opts.WebhookSecret, time.Unix(seconds, 0), body)
+	expected = expected[strings.Index(expected, "v1=")+3:]
+	valid := false
+	for _, signature := range signatures {
+		if hmac.Equal([]byte(signature), []byte(expected)) {
+			valid = true
+		}
+	}
+	if !valid {
+		return nil, ErrInvalidSignature
+	}
+
+	var event struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+		Data struct {
+			Object json.RawMessage `json:"object"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, fmt.Errorf("failed to decode stripe event: %w", err)
+	}
+
+	result := &Event{ID: event.ID, Type: event.Type}
+	if strings.HasPrefix(event.Type, "payment_intent.") {
+		intent := &stripePaymentIntent{}
+		if err := json.Unmarshal(event.Data.Object, intent); err != nil {
+			return nil, fmt.Errorf("failed to decode stripe payment intent: %w", err)
+		}
+		// A failed attempt leaves the intent open for another try, so only a
+		// cancellation fails the deposit.
+		result.Payment = intent.payment()
+	}
+
+	return result, nil
+}
@@ -0,0 +1,205 @@
+// Package reserves builds the Merkle sum tree behind proof of reserves. Every
+// leaf commits to one user's liabilities per currency under a secret salt,
+// every node commits to its children's hashes and the per-currency sums below
+// it, so the root fixes both the set of users and the total owed. It only
+// depends on the standard library and decimal so the verifier can be built
+// and run offline.
+package reserves
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// AmountPlaces is the fixed precision amounts are hashed with, matching the
+// wallet columns.
+const AmountPlaces = 18
+
+var (
+	ErrNegativeBalance = errors.New("liabilities must not be negative")
+	ErrInvalidProof    = errors.New("proof does not match root")
+)
+
+// Balances maps currency to amount.
+type Balances map[string]decimal.Decimal
+
+// Encode writes balances in a canonical form: currencies sorted, amounts at
+// AmountPlaces.
+func (b Balances) Encode() string {
+	currencies := make([]string, 0, len(b))
+	for currency := range b {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+
+	parts := make([]string, 0, len(currencies))
+	for _, currency := range currencies {
+		parts = append(parts, currency+":"+b[currency].StringFixed(AmountPlaces))
+	}
+	return strings.Join(parts, ",")
+}
+
+func (b Balances) Add(other Balances) Balances {
+	sum := make(Balances, len(b)+len(other))
+	for currency, amount := range b {
+		sum[currency] = amount
+	}
+	for currency, amount := range other {
+		sum[currency] = sum[currency].Add(amount)
+	}
+	return sum
+}
+
+type Leaf struct {
+	UserID   string
+	Salt     string
+	Balances Balances
+}
+
+type Node struct {
+	Hash string   `json:"hash"`
+	Sums Balances `json:"sums"`
+}
+
+func hash(parts ...string) string {
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// LeafNode hashes a leaf. The salt keeps the user id and balances from being
+// guessed from the hash.
+func LeafNode(leaf Leaf) (Node, error) {
+	for currency, amount := range leaf.Balances {
+		if amount.IsNegative() {
+			return Node{}, fmt.Errorf("%w: %s %s", ErrNegativeBalance, currency, amount)
+		}
+	}
+	return Node{
+		Hash: hash("leaf", leaf.Salt, leaf.UserID, leaf.Balances.Encode()),
+		Sums: leaf.Balances,
+	}, nil
+}
+
+func parent(left, right Node) Node {
+	return Node{
+		Hash: hash("node", left.Hash, left.Sums.Encode(), right.Hash, right.Sums.Encode()),
+		Sums: left.Sums.Add(right.Sums),
+	}
+}
+
+// emptyNode pads a level with an odd number of nodes.
+var emptyNode = Node{Hash: hash("empty"), Sums: Balances{}}
+
+type Sibling struct {
+	Node
+	// Left is true when the sibling sits left of the path.
+	Left bool `json:"left"`
+}
+
+type Proof struct {
+	UserID   string    `json:"userId"`
+	Salt     string    `json:"salt"`
+	Balances Balances  `json:"balances"`
+	Path     []Sibling `json:"path"`
+}
+
+type Tree struct {
+	levels [][]Node
+	leaves []Leaf
+}
+
+// Build hashes the leaves and every level above them.
+func Build(leaves []Leaf) (*Tree, error) {
+	if len(leaves) == 0 {
+		return nil, errors.New("no leaves to build a tree from")
+	}
+
+	level := make([]Node, len(leaves))
+	for i, leaf := range leaves {
+		node, err := LeafNode(leaf)
+		if err != nil {
+			return nil, fmt.Errorf("leaf %d: %w", i, err)
+		}
+		level[i] = node
+	}
+
+	tree := &Tree{leaves: leaves, levels: [][]Node{level}}
+	for len(level) > 1 {
+		if len(level)%2 == 1 {
+			level = append(level, emptyNode)
+			tree.levels[len(tree.levels)-1] = level
+		}
+		next := make([]Node, len(level)/2)
+		for i := range next {
+			next[i] = parent(level[2*i], level[2*i+1])
+		}
+		tree.levels = append(tree.levels, next)
+		level = next
+	}
+
+	return tree, nil
+}
+
+func (t *Tree) Root() Node {
+	return t.levels[len(t.levels)-1][0]
+}
+
+func (t *Tree) Proof(index int) (*Proof, error) {
+	if index < 0 || index >= len(t.leaves) {
+		return nil, fmt.Errorf("leaf index %d out of range", index)
+	}
+
+	leaf := t.leaves[index]
+	proof := &Proof{UserID: leaf.UserID, Salt: leaf.Salt, Balances: leaf.Balances}
+	for _, level := range t.levels[:len(t.levels)-1] {
+		if index%2 == 0 {
+			proof.Path = append(proof.Path, Sibling{Node: level[index+1], Left: false})
+		} else {
+			proof.Path = append(proof.Path, Sibling{Node: level[index-1], Left: true})
+		}
+		index /= 2
+	}
+
+	return proof, nil
+}
+
+// Verify recomputes the root from a proof and checks it against the
+// published root hash and totals.
+func Verify(proof *Proof, rootHash string, totals Balances) error {
+	node, err := LeafNode(Leaf{UserID: proof.UserID, Salt: proof.Salt, Balances: proof.Balances})
+	if err != nil {
+		return err
+	}
+
+	for _, sibling := range proof.Path {
+		for currency, amount := range sibling.Sums {
+			if amount.IsNegative() {
+				return fmt.Errorf("%w: sibling sum %s %s", ErrNegativeBalance, currency, amount)
+			}
+		}
+		if sibling.Left {
+			node = parent(sibling.Node, node)
+		} else {
+			node = parent(node, sibling.Node)
+		}
+	}
+
+	if node.Hash != rootHash {
+		return fmt.Errorf("%w: computed %s", ErrInvalidProof, node.Hash)
+	}
+	if totals != nil && node.Sums.Encode() != totals.Encode() {
+		return fmt.Errorf("%w: totals %s don't match published %s", ErrInvalidProof, node.Sums.Encode(), totals.Encode())
+	}
+
+	return nil
+}
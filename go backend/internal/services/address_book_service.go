@@ -0,0 +1,339 @@
+package services
+
+import (
+	"context"
+	"crypto-exchange-go/internal/config"
+	"crypto-exchange-go/internal/database"
+	"crypto-exchange-go/internal/mail"
+	"crypto-exchange-go/internal/models"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrAddressNotWhitelisted    = errors.New("withdrawals are limited to whitelisted addresses")
+	ErrAddressAlreadySaved      = errors.New("address is already in the address book")
+	ErrInvalidConfirmationToken = errors.New("invalid or already used confirmation token")
+)
+
+// AddressBookService keeps each user's withdrawal addresses and their
+// whitelist-only setting. Anything that would widen where funds can go, a
+// new address or turning the whitelist off, has to be confirmed by email and
+// then waits out a cooling period, so a stolen session alone can't redirect
+// withdrawals.
+type AddressBookService struct {
+	mysql               *database.MySQL
+	destinations        *DestinationValidator
+	mailer              mail.Sender
+	notificationService *NotificationService
+	cooldown            time.Duration
+	siteURL             string
+	logger              *logrus.Logger
+}
+
+func NewAddressBookService(mysql *database.MySQL, destinations *DestinationValidator, mailer mail.Sender, notificationService *NotificationService, cfg config.Withdrawal, siteURL string, logger *logrus.Logger) *AddressBookService {
+	return &AddressBookService{
+		mysql:               mysql,
+		destinations:        destinations,
+		mailer:              mailer,
+		notificationService: notificationService,
+		cooldown:            time.Duration(cfg.WhitelistCooldownHours) * time.Hour,
+		siteURL:             strings.TrimRight(siteURL, "/"),
+		logger:              logger,
+	}
+}
+
+func (s *AddressBookService) GetAddresses(ctx context.Context, userID uuid.UUID, currency, network string) ([]*models.WithdrawalAddressResponse, error) {
+	query := `SELECT id, userId, currency, network, address, memo, label, confirmedAt, usableAt, createdAt, updatedAt
+			  FROM withdrawal_address WHERE userId = ?`
+	args := []interface{}{userID}
+
+	if currency != "" {
+		query += " AND currency = ?"
+		args = append(args, strings.ToUpper(currency))
+	}
+	if network != "" {
+		query += " AND network = ?"
+		args = append(args, strings.ToUpper(network))
+	}
+	query += " ORDER BY currency, network, label"
+
+	var addresses []*models.WithdrawalAddress
+	if err := s.mysql.SelectContext(ctx, &addresses, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to query withdrawal addresses: %w", err)
+	}
+
+	responses := make([]*models.WithdrawalAddressResponse, 0, len(addresses))
+	for _, address := range addresses {
+		responses = append(responses, address.ToResponse())
+	}
+	return responses, nil
+}
+
+// AddAddress saves an address and emails the user a link to confirm it.
+func (s *AddressBookService) AddAddress(ctx context.Context, userID uuid.UUID, req *models.CreateWithdrawalAddressRequest) (*models.WithdrawalAddressResponse, error) {
+	network, err := s.destinations.Validate(ctx, req.Currency, req.Network, req.Address, req.Memo)
+	if err != nil {
+		return nil, err
+	}
+
+	email, err := s.userEmail(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	token, tokenHash, err := newConfirmationToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	address := &models.WithdrawalAddress{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Currency:  strings.ToUpper(strings.TrimSpace(req.Currency)),
+		Network:   network,
+		Address:   strings.TrimSpace(req.Address),
+		Memo:      strings.TrimSpace(req.Memo),
+		Label:     strings.TrimSpace(req.Label),
+		UsableAt:  now.Add(s.cooldown),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	_, err = s.mysql.ExecContext(ctx, `INSERT INTO withdrawal_address (id, userId, currency, network, address, memo, label, confirmTokenHash, usableAt, createdAt, updatedAt)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		address.ID, address.UserID, address.Currency, address.Network, address.Address, address.Memo, address.Label,
+		tokenHash, address.UsableAt, address.CreatedAt, address.UpdatedAt)
+	if isDuplicateKey(err) {
+		return nil, ErrAddressAlreadySaved
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to save withdrawal address: %w", err)
+	}
+
+	destination := address.Address
+	if address.Memo != "" {
+		destination += " (memo " + address.Memo + ")"
+	}
+
+	err = s.mailer.Send(ctx, mail.Message{
+		To:      email,
+		Subject: "Confirm your new withdrawal address",
+		Body: fmt.Sprintf("A %s address was added to your withdrawal address book:\n\n%s\n\n"+
+			"Confirm it here:\n%s\n\n"+
+			"Withdrawals to it are possible from %s UTC. If you didn't add it, don't confirm it, "+
+			"change your password and remove the address.",
+			address.Currency, destination, s.confirmURL("address", token), address.UsableAt.UTC().Format("2006-01-02 15:04")),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.notify(ctx, userID, "Withdrawal address added",
+		fmt.Sprintf("%s address %s was added to your address book.", address.Currency, destination))
+
+	return address.ToResponse(), nil
+}
+
+func (s *AddressBookService) UpdateLabel(ctx context.Context, userID, addressID uuid.UUID, label string) error {
+	result, err := s.mysql.ExecContext(ctx, `UPDATE withdrawal_address SET label = ?, updatedAt = ? WHERE id = ? AND userId = ?`,
+		strings.TrimSpace(label), time.Now(), addressID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update withdrawal address: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return fmt.Errorf("withdrawal address not found: %w", sql.ErrNoRows)
+	}
+	return nil
+}
+
+// DeleteAddress removes an address. Narrowing the whitelist needs no
+// confirmation.
+func (s *AddressBookService) DeleteAddress(ctx context.Context, userID, addressID uuid.UUID) error {
+	result, err := s.mysql.ExecContext(ctx, `DELETE FROM withdrawal_address WHERE id = ? AND userId = ?`, addressID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete withdrawal address: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return fmt.Errorf("withdrawal address not found: %w", sql.ErrNoRows)
+	}
+	return nil
+}
+
+// ConfirmAddress confirms the address a token was sent for. The cooling
+// period still runs from when the address was added.
+func (s *AddressBookService) ConfirmAddress(ctx context.Context, token string) error {
+	result, err := s.mysql.ExecContext(ctx, `UPDATE withdrawal_address SET confirmedAt = ?, confirmTokenHash = NULL, updatedAt = ?
+			WHERE confirmTokenHash = ?`, time.Now(), time.Now(), hashConfirmationToken(token))
+	if err != nil {
+		return fmt.Errorf("failed to confirm withdrawal address: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrInvalidConfirmationToken
+	}
+	return nil
+}
+
+func (s *AddressBookService) GetWhitelist(ctx context.Context, userID uuid.UUID) (*models.WithdrawalWhitelist, error) {
+	var row struct {
+		Enabled          bool           `db:"enabled"`
+		DisableTokenHash sql.NullString `db:"disableTokenHash"`
+		DisableAt        sql.NullTime   `db:"disableAt"`
+	}
+	err := s.mysql.GetContext(ctx, &row, `SELECT enabled, disableTokenHash, disableAt FROM withdrawal_whitelist WHERE userId = ?`, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &models.WithdrawalWhitelist{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get withdrawal whitelist: %w", err)
+	}
+
+	whitelist := &models.WithdrawalWhitelist{Enabled: row.Enabled}
+	if row.DisableAt.Valid {
+		if !time.Now().Before(row.DisableAt.Time) {
+			// The cooldown is over; it's off.
+			whitelist.Enabled = false
+		} else {
+			whitelist.DisableAt = &row.DisableAt.Time
+		}
+	}
+	whitelist.DisablePending = whitelist.Enabled && (row.DisableTokenHash.Valid || whitelist.DisableAt != nil)
+	return whitelist, nil
+}
+
+// SetWhitelist turns whitelist-only mode on at once. Turning it off sends a
+// confirmation email; the mode stays on until the cooldown after
+// confirmation has passed.
+func (s *AddressBookService) SetWhitelist(ctx context.Context, userID uuid.UUID, enabled bool) (*models.WithdrawalWhitelist, error) {
+	if enabled {
+		_, err := s.mysql.ExecContext(ctx, `INSERT INTO withdrawal_whitelist (userId, enabled, updatedAt) VALUES (?, TRUE, ?)
+				ON DUPLICATE KEY UPDATE enabled = TRUE, disableTokenHash = NULL, disableAt = NULL, updatedAt = VALUES(updatedAt)`,
+			userID, time.Now())
+		if err != nil {
+			return nil, fmt.Errorf("failed to enable withdrawal whitelist: %w", err)
+		}
+		return s.GetWhitelist(ctx, userID)
+	}
+
+	current, err := s.GetWhitelist(ctx, userID)
+	if err != nil || !current.Enabled || current.DisablePending {
+		return current, err
+	}
+
+	email, err := s.userEmail(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	token, tokenHash, err := newConfirmationToken()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.mysql.ExecContext(ctx, `UPDATE withdrawal_whitelist SET disableTokenHash = ?, updatedAt = ? WHERE userId = ?`,
+		tokenHash, time.Now(), userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request whitelist removal: %w", err)
+	}
+
+	err = s.mailer.Send(ctx, mail.Message{
+		To:      email,
+		Subject: "Confirm turning off your withdrawal whitelist",
+		Body: fmt.Sprintf("Someone asked to let withdrawals from your account go to any address.\n\n"+
+			"Confirm it here:\n%s\n\n"+
+			"The whitelist stays on for %s after you confirm. If this wasn't you, don't confirm it and change your password.",
+			s.confirmURL("whitelist", token), s.cooldown),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.notify(ctx, userID, "Withdrawal whitelist change requested",
+		"Turning off the withdrawal whitelist was requested. Check your email to confirm it.")
+
+	return s.GetWhitelist(ctx, userID)
+}
+
+// ConfirmWhitelistDisable starts the cooldown after which whitelist-only mode
+// turns off.
+func (s *AddressBookService) ConfirmWhitelistDisable(ctx context.Context, token string) error {
+	now := time.Now()
+	result, err := s.mysql.ExecContext(ctx, `UPDATE withdrawal_whitelist SET disableAt = ?, disableTokenHash = NULL, updatedAt = ?
+			WHERE disableTokenHash = ? AND enabled = TRUE`, now.Add(s.cooldown), now, hashConfirmationToken(token))
+	if err != nil {
+		return fmt.Errorf("failed to confirm whitelist removal: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrInvalidConfirmationToken
+	}
+	return nil
+}
+
+// WhitelistOnly reports whether the user's withdrawals are limited to their
+// usable address book entries.
+func (s *AddressBookService) WhitelistOnly(ctx context.Context, userID uuid.UUID) (bool, error) {
+	whitelist, err := s.GetWhitelist(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return whitelist.Enabled, nil
+}
+
+// IsWhitelisted reports whether the address is a usable entry in the user's
+// address book.
+func (s *AddressBookService) IsWhitelisted(ctx context.Context, userID uuid.UUID, currency, network, address, memo string) (bool, error) {
+	var count int
+	err := s.mysql.GetContext(ctx, &count, `SELECT COUNT(*) FROM withdrawal_address
+			WHERE userId = ? AND currency = ? AND network = ? AND address = ? AND memo = ?
+			AND confirmedAt IS NOT NULL AND usableAt <= ?`,
+		userID, strings.ToUpper(currency), strings.ToUpper(network), strings.TrimSpace(address), strings.TrimSpace(memo), time.Now())
+	if err != nil {
+		return false, fmt.Errorf("failed to check withdrawal address: %w", err)
+	}
+	return count > 0, nil
+}
+
+func (s *AddressBookService) userEmail(ctx context.Context, userID uuid.UUID) (string, error) {
+	var email string
+	if err := s.mysql.GetContext(ctx, &email, `SELECT email FROM user WHERE id = ?`, userID); err != nil {
+		return "", fmt.Errorf("failed to get user email: %w", err)
+	}
+	return email, nil
+}
+
+func (s *AddressBookService) confirmURL(kind, token string) string {
+	return fmt.Sprintf("%s/user/withdraw/%s/confirm?token=%s", s.siteURL, kind, url.QueryEscape(token))
+}
+
+// notify tells the user in-app too, so an address added by someone else
+// shows up even if they don't read the email.
+func (s *AddressBookService) notify(ctx context.Context, userID uuid.UUID, title, message string) {
+	if err := s.notificationService.CreateNotification(ctx, userID, "SECURITY", title, message, nil); err != nil {
+		s.logger.WithError(err).WithField("userId", userID).Error("Failed to create address book notification")
+	}
+}
+
+func newConfirmationToken() (string, string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", fmt.Errorf("failed to generate confirmation token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	return token, hashConfirmationToken(token), nil
+}
+
+func hashConfirmationToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
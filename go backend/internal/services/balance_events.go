@@ -0,0 +1,323 @@
+package services
+
+import (
+	"context"
+	"crypto-exchange-go/internal/database"
+	"crypto-exchange-go/internal/ledger"
+	"crypto-exchange-go/internal/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+const BalanceEventChannel = "balance:"
+
+var (
+	ErrInsufficientBalance = errors.New("insufficient balance")
+	ErrInsufficientLocked  = errors.New("insufficient locked balance")
+	ErrWalletFrozen        = errors.New("wallet is frozen")
+)
+
+type balanceChange struct {
+	WalletID       uuid.UUID
+	Operation      models.BalanceOperation
+	Amount         decimal.Decimal
+	Reason         models.BalanceChangeReason
+	ReferenceID    string
+	IdempotencyKey string
+	// Record runs inside the balance transaction, so a row written for the
+	// change (an order, a withdrawal) commits or rolls back with it.
+	Record func(ctx context.Context, tx *sqlx.Tx) error
+}
+
+type balanceEvents struct {
+	mysql  *database.MySQL
+	redis  *database.Redis
+	ledger *ledger.Ledger
+	logger *logrus.Logger
+}
+
+func newBalanceEvents(mysql *database.MySQL, redis *database.Redis, logger *logrus.Logger) *balanceEvents {
+	return &balanceEvents{
+		mysql:  mysql,
+		redis:  redis,
+		ledger: ledger.New(mysql, logger),
+		logger: logger,
+	}
+}
+
+func counterAccount(reason models.BalanceChangeReason) ledger.Account {
+	switch reason {
+	case models.BalanceReasonOrder, models.BalanceReasonTrade:
+		return ledger.SystemAccount(ledger.AccountTradeClearing)
+	case models.BalanceReasonP2pTrade:
+		return ledger.SystemAccount(ledger.AccountP2pEscrow)
+	case models.BalanceReasonStaking:
+		return ledger.SystemAccount(ledger.AccountFees)
+	case models.BalanceReasonStakingReward:
+		return ledger.SystemAccount(ledger.AccountStakingRewards)
+	default:
+		return ledger.SystemAccount(ledger.AccountExternal)
+	}
+}
+
+// postingLines turns a change into ledger lines and the resulting delta of the
+// available balance. Holds move funds between the wallet and its hold account,
+// captures settle held funds out to the counter account.
+func postingLines(change balanceChange, currency string, available, locked decimal.Decimal) ([]ledger.Line, decimal.Decimal, error) {
+	wallet := ledger.WalletAccount(change.WalletID)
+	hold := ledger.WalletHoldAccount(change.WalletID)
+	counter := counterAccount(change.Reason)
+
+	if change.Operation != models.BalanceOperationAdjust && !change.Amount.IsPositive() {
+		return nil, decimal.Zero, fmt.Errorf("%s amount must be positive", change.Operation)
+	}
+
+	switch change.Operation {
+	case models.BalanceOperationAdjust:
+		if change.Amount.IsNegative() {
+			if available.LessThan(change.Amount.Neg()) {
+				return nil, decimal.Zero, ErrInsufficientBalance
+			}
+			return ledger.Transfer(wallet, counter, currency, change.Amount.Neg()), change.Amount, nil
+		}
+		return ledger.Transfer(counter, wallet, currency, change.Amount), change.Amount, nil
+
+	case models.BalanceOperationHold:
+		if available.LessThan(change.Amount) {
+			return nil, decimal.Zero, ErrInsufficientBalance
+		}
+		return ledger.Transfer(wallet, hold, currency, change.Amount), change.Amount.Neg(), nil
+
+	case models.BalanceOperationRelease:
+		if locked.LessThan(change.Amount) {
+			return nil, decimal.Zero, ErrInsufficientLocked
+		}
+		return ledger.Transfer(hold, wallet, currency, change.Amount), change.Amount, nil
+
+	case models.BalanceOperationCapture:
+		if locked.LessThan(change.Amount) {
+			return nil, decimal.Zero, ErrInsufficientLocked
+		}
+		return ledger.Transfer(hold, counter, currency, change.Amount), decimal.Zero, nil
+
+	default:
+		return nil, decimal.Zero, fmt.Errorf("invalid balance operation: %s", change.Operation)
+	}
+}
+
+func (b *balanceEvents) apply(ctx context.Context, change balanceChange) (*models.BalanceEvent, error) {
+	tx, err := b.mysql.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	event, err := b.applyTx(ctx, tx, change)
+	if err != nil {
+		return nil, err
+	}
+
+	if change.Record != nil {
+		if err := change.Record(ctx, tx); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit balance change: %w", err)
+	}
+
+	b.publish(ctx, event)
+
+	return event, nil
+}
+
+// applyAll makes several changes and record in one transaction, so they
+// commit or roll back together. Wallets are locked in id order, as transfers
+// lock them. The changes' own Record funcs are not run.
+func (b *balanceEvents) applyAll(ctx context.Context, changes []balanceChange, record func(ctx context.Context, tx *sqlx.Tx) error) error {
+	changes = append([]balanceChange(nil), changes...)
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].WalletID.String() < changes[j].WalletID.String()
+	})
+
+	tx, err := b.mysql.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	events := make([]*models.BalanceEvent, 0, len(changes))
+	for _, change := range changes {
+		event, err := b.applyTx(ctx, tx, change)
+		if err != nil {
+			return err
+		}
+		events = append(events, event)
+	}
+
+	if record != nil {
+		if err := record(ctx, tx); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit balance changes: %w", err)
+	}
+
+	for _, event := range events {
+		b.publish(ctx, event)
+	}
+	return nil
+}
+
+// applyTx locks the change's wallet in tx, posts the change to the ledger and
+// records its event.
+func (b *balanceEvents) applyTx(ctx context.Context, tx *sqlx.Tx, change balanceChange) (*models.BalanceEvent, error) {
+	if change.Amount.IsZero() {
+		return nil, fmt.Errorf("balance change amount must not be zero")
+	}
+	if change.Operation == "" {
+		change.Operation = models.BalanceOperationAdjust
+	}
+
+	event := &models.BalanceEvent{
+		WalletID:    change.WalletID,
+		Operation:   change.Operation,
+		Reason:      change.Reason,
+		ReferenceID: change.ReferenceID,
+		CreatedAt:   time.Now(),
+	}
+
+	var available, locked decimal.Decimal
+	var frozen bool
+	err := tx.QueryRowxContext(ctx, `SELECT userId, currency, type, balance, inOrder, frozen FROM wallet WHERE id = ? FOR UPDATE`, change.WalletID).
+		Scan(&event.UserID, &event.Currency, &event.WalletType, &available, &locked, &frozen)
+	if err != nil {
+		return nil, fmt.Errorf("wallet not found: %w", err)
+	}
+
+	if frozen && (change.Operation == models.BalanceOperationHold || change.Amount.IsNegative()) {
+		return nil, ErrWalletFrozen
+	}
+
+	lines, delta, err := postingLines(change, event.Currency, available, locked)
+	if err != nil {
+		return nil, err
+	}
+	event.Delta = delta
+
+	entry := &ledger.Entry{
+		ReferenceType:  string(change.Reason),
+		ReferenceID:    change.ReferenceID,
+		IdempotencyKey: change.IdempotencyKey,
+		Description:    fmt.Sprintf("%s %s %s", change.Operation, change.Reason, event.Currency),
+		Lines:          lines,
+		CreatedAt:      event.CreatedAt,
+	}
+	if err := b.ledger.Post(ctx, tx, entry); err != nil {
+		return nil, fmt.Errorf("failed to post ledger entry: %w", err)
+	}
+
+	if err := b.record(ctx, tx, event); err != nil {
+		return nil, err
+	}
+
+	// Holds and releases only move funds between the available and locked
+	// components, so they don't show up in the user's transaction history.
+	// Captures take held funds out of the wallet, so they are debits.
+	if change.Operation == models.BalanceOperationAdjust || change.Operation == models.BalanceOperationCapture {
+		direction := models.TransactionDirectionCredit
+		if change.Operation == models.BalanceOperationCapture || change.Amount.IsNegative() {
+			direction = models.TransactionDirectionDebit
+		}
+
+		query := `INSERT INTO transaction (id, userId, type, status, currency, walletType, amount, direction, fee, description, referenceId, metadata, createdAt, updatedAt)
+				  VALUES (?, ?, ?, 'COMPLETED', ?, ?, ?, ?, 0, ?, ?, '{}', ?, ?)`
+		_, err = tx.ExecContext(ctx, query, uuid.New(), event.UserID, change.Reason, event.Currency, event.WalletType, change.Amount.Abs(),
+			direction, entry.Description, change.ReferenceID, event.CreatedAt, event.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to record transaction: %w", err)
+		}
+	}
+
+	return event, nil
+}
+
+// record reads the wallet's balances after a posting and appends the event
+// that describes it. The event takes the next number of the user's sequence;
+// the counter row stays locked until the transaction commits, so events
+// become visible in sequence order.
+func (b *balanceEvents) record(ctx context.Context, tx *sqlx.Tx, event *models.BalanceEvent) error {
+	err := tx.QueryRowxContext(ctx, `SELECT balance, inOrder FROM wallet WHERE id = ?`, event.WalletID).
+		Scan(&event.Available, &event.Locked)
+	if err != nil {
+		return fmt.Errorf("failed to read wallet balance: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO wallet_balance_sequence (userId, sequence) VALUES (?, 1)
+			  ON DUPLICATE KEY UPDATE sequence = sequence + 1`, event.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to advance balance event sequence: %w", err)
+	}
+	err = tx.GetContext(ctx, &event.Sequence, `SELECT sequence FROM wallet_balance_sequence WHERE userId = ?`, event.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to get balance event sequence: %w", err)
+	}
+
+	query := `INSERT INTO wallet_balance_event (sequence, userId, walletId, currency, walletType, delta, available, locked, operation, reason, referenceId, createdAt)
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	_, err = tx.ExecContext(ctx, query, event.Sequence, event.UserID, event.WalletID, event.Currency, event.WalletType,
+		event.Delta, event.Available, event.Locked, event.Operation, event.Reason, event.ReferenceID, event.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record balance event: %w", err)
+	}
+
+	return nil
+}
+
+func (b *balanceEvents) publish(ctx context.Context, event *models.BalanceEvent) {
+	payload, err := json.Marshal(event.ToResponse())
+	if err != nil {
+		b.logger.WithError(err).Error("Failed to marshal balance event")
+		return
+	}
+
+	if err := b.redis.Publish(ctx, BalanceEventChannel+event.UserID.String(), payload); err != nil {
+		b.logger.WithError(err).WithField("userID", event.UserID).Error("Failed to publish balance event")
+	}
+}
+
+func (b *balanceEvents) since(ctx context.Context, userID uuid.UUID, sequence int64, limit int) ([]*models.BalanceEventResponse, error) {
+	query := `SELECT sequence, userId, walletId, currency, walletType, delta, available, locked, operation, reason, referenceId, createdAt
+			  FROM wallet_balance_event WHERE userId = ? AND sequence > ? ORDER BY sequence ASC LIMIT ?`
+
+	rows, err := b.mysql.QueryContext(ctx, query, userID, sequence, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query balance events: %w", err)
+	}
+	defer rows.Close()
+
+	events := make([]*models.BalanceEventResponse, 0)
+	for rows.Next() {
+		event := &models.BalanceEvent{}
+		err := rows.Scan(&event.Sequence, &event.UserID, &event.WalletID, &event.Currency, &event.WalletType,
+			&event.Delta, &event.Available, &event.Locked, &event.Operation, &event.Reason, &event.ReferenceID, &event.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan balance event: %w", err)
+		}
+		events = append(events, event.ToResponse())
+	}
+
+	return events, nil
+}
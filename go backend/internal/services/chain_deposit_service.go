@@ -0,0 +1,279 @@
+package services
+
+import (
+	"context"
+	"crypto-exchange-go/internal/chainwatch"
+	"crypto-exchange-go/internal/config"
+	"crypto-exchange-go/internal/database"
+	"crypto-exchange-go/internal/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+const onChainDepositMethod = "ONCHAIN"
+
+// ChainDepositService is the chain watcher's sink. Transfers to known deposit
+// addresses become PENDING deposits, which are credited to the ECO wallet
+// once they have the chain's configured confirmations. A reorg fails the
+// pending deposits it removed; if the transfer reappears on the new branch
+// the deposit is revived.
+type ChainDepositService struct {
+	mysql         *database.MySQL
+	walletService *WalletService
+	confirmations map[string]int
+	keepBlocks    uint64
+	logger        *logrus.Logger
+}
+
+func NewChainDepositService(mysql *database.MySQL, walletService *WalletService, cfg config.ChainWatch, logger *logrus.Logger) *ChainDepositService {
+	confirmations := make(map[string]int, len(cfg.Chains))
+	for name, chain := range cfg.Chains {
+		confirmations[strings.ToUpper(name)] = chain.Confirmations
+	}
+
+	return &ChainDepositService{
+		mysql:         mysql,
+		walletService: walletService,
+		confirmations: confirmations,
+		keepBlocks:    uint64(cfg.MaxReorgDepth),
+		logger:        logger,
+	}
+}
+
+func (s *ChainDepositService) LastScanned(ctx context.Context, chain string) (uint64, bool, error) {
+	var number sql.NullInt64
+	err := s.mysql.GetContext(ctx, &number, `SELECT MAX(number) FROM chain_scan_block WHERE chain = ?`, chain)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to get last scanned block: %w", err)
+	}
+	return uint64(number.Int64), number.Valid, nil
+}
+
+func (s *ChainDepositService) ScannedHash(ctx context.Context, chain string, number uint64) (string, bool, error) {
+	var hash string
+	err := s.mysql.GetContext(ctx, &hash, `SELECT hash FROM chain_scan_block WHERE chain = ? AND number = ?`, chain, number)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to get scanned block: %w", err)
+	}
+	return hash, true, nil
+}
+
+// Apply records deposits for the block's transfers to deposit addresses on
+// this chain, and the block itself, in one transaction.
+func (s *ChainDepositService) Apply(ctx context.Context, chain string, block *chainwatch.Block) error {
+	tx, err := s.mysql.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	owners, err := depositAddressOwners(ctx, tx, chain, block.Transfers)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, transfer := range block.Transfers {
+		owner, ok := owners[transfer.To]
+		if !ok {
+			continue
+		}
+
+		// A transfer seen again after a reorg moves to its new block and,
+		// if the reorg had failed it, is pending again.
+		_, err := tx.ExecContext(ctx, `INSERT INTO deposit (id, userId, type, currency, amount, fee, status, method, address, network,
+				transactionId, txIndex, blockNumber, blockHash, confirmations, createdAt, updatedAt)
+			VALUES (?, ?, 'ECO', ?, ?, 0, 'PENDING', ?, ?, ?, ?, ?, ?, ?, 1, ?, ?)
+			ON DUPLICATE KEY UPDATE
+				blockNumber = VALUES(blockNumber),
+				blockHash = VALUES(blockHash),
+				confirmations = IF(status = 'COMPLETED', confirmations, 1),
+				status = IF(status = 'FAILED', 'PENDING', status),
+				updatedAt = VALUES(updatedAt)`,
+			uuid.New(), owner, transfer.Currency, transfer.Amount, onChainDepositMethod, transfer.To, chain,
+			transfer.TxHash, transfer.Index, block.Number, block.Hash, now, now)
+		if err != nil {
+			return fmt.Errorf("failed to record deposit: %w", err)
+		}
+
+		s.logger.WithFields(logrus.Fields{
+			"chain":    chain,
+			"block":    block.Number,
+			"txHash":   transfer.TxHash,
+			"currency": transfer.Currency,
+			"amount":   transfer.Amount,
+		}).Info("On-chain deposit detected")
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO chain_scan_block (chain, number, hash, parentHash, createdAt) VALUES (?, ?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE hash = VALUES(hash), parentHash = VALUES(parentHash), createdAt = VALUES(createdAt)`,
+		chain, block.Number, block.Hash, block.ParentHash, now)
+	if err != nil {
+		return fmt.Errorf("failed to record scanned block: %w", err)
+	}
+
+	if block.Number > s.keepBlocks {
+		_, err = tx.ExecContext(ctx, `DELETE FROM chain_scan_block WHERE chain = ? AND number < ?`, chain, block.Number-s.keepBlocks)
+		if err != nil {
+			return fmt.Errorf("failed to prune scanned blocks: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit block: %w", err)
+	}
+	return nil
+}
+
+// depositAddressOwners maps the transfers' recipients to the users they
+// belong to. An address is requested for one currency, but whatever arrives
+// at it is the user's, so the currency isn't checked.
+func depositAddressOwners(ctx context.Context, tx *sqlx.Tx, chain string, transfers []chainwatch.Transfer) (map[string]uuid.UUID, error) {
+	owners := make(map[string]uuid.UUID)
+	if len(transfers) == 0 {
+		return owners, nil
+	}
+
+	addresses := make([]string, 0, len(transfers))
+	for _, transfer := range transfers {
+		addresses = append(addresses, transfer.To)
+	}
+
+	query, args, err := sqlx.In(`SELECT userId, address FROM deposit_address
+			WHERE network = ? AND address IN (?) AND derivationPath IS NOT NULL`, chain, addresses)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.QueryxContext(ctx, tx.Rebind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to match deposit addresses: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID uuid.UUID
+		var address string
+		if err := rows.Scan(&userID, &address); err != nil {
+			return nil, fmt.Errorf("failed to scan deposit address: %w", err)
+		}
+		owners[address] = userID
+	}
+	return owners, rows.Err()
+}
+
+// Rollback fails the pending deposits above the fork. Credited deposits
+// can't be taken back automatically; they are reported for an operator.
+func (s *ChainDepositService) Rollback(ctx context.Context, chain string, number uint64) error {
+	tx, err := s.mysql.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var credited []string
+	err = tx.SelectContext(ctx, &credited, `SELECT id FROM deposit
+			WHERE network = ? AND method = ? AND status = 'COMPLETED' AND blockNumber > ?`,
+		chain, onChainDepositMethod, number)
+	if err != nil {
+		return fmt.Errorf("failed to check credited deposits: %w", err)
+	}
+	if len(credited) > 0 {
+		s.logger.WithFields(logrus.Fields{
+			"chain":      chain,
+			"fork":       number,
+			"depositIds": credited,
+		}).Error("Reorg removed blocks with credited deposits")
+	}
+
+	result, err := tx.ExecContext(ctx, `UPDATE deposit SET status = 'FAILED', confirmations = 0, updatedAt = ?
+			WHERE network = ? AND method = ? AND status = 'PENDING' AND blockNumber > ?`,
+		time.Now(), chain, onChainDepositMethod, number)
+	if err != nil {
+		return fmt.Errorf("failed to roll back deposits: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM chain_scan_block WHERE chain = ? AND number > ?`, chain, number); err != nil {
+		return fmt.Errorf("failed to roll back scanned blocks: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit rollback: %w", err)
+	}
+
+	rolledBack, _ := result.RowsAffected()
+	s.logger.WithFields(logrus.Fields{
+		"chain":    chain,
+		"fork":     number,
+		"deposits": rolledBack,
+	}).Warn("Rolled back pending deposits")
+	return nil
+}
+
+// Confirm updates the confirmation count of pending deposits and credits the
+// ones that have enough.
+func (s *ChainDepositService) Confirm(ctx context.Context, chain string, latest uint64) error {
+	_, err := s.mysql.ExecContext(ctx, `UPDATE deposit SET confirmations = ? - blockNumber + 1, updatedAt = ?
+			WHERE network = ? AND method = ? AND status = 'PENDING' AND blockNumber <= ?`,
+		latest, time.Now(), chain, onChainDepositMethod, latest)
+	if err != nil {
+		return fmt.Errorf("failed to update confirmations: %w", err)
+	}
+
+	required := s.confirmations[chain]
+	if required < 1 {
+		required = 1
+	}
+
+	var deposits []*models.Deposit
+	err = s.mysql.SelectContext(ctx, &deposits, `SELECT id, userId, currency, amount FROM deposit
+			WHERE network = ? AND method = ? AND status = 'PENDING' AND confirmations >= ?`,
+		chain, onChainDepositMethod, required)
+	if err != nil {
+		return fmt.Errorf("failed to get confirmed deposits: %w", err)
+	}
+
+	for _, deposit := range deposits {
+		if err := s.credit(ctx, deposit.ID, deposit.UserID, deposit.Currency, deposit.Amount); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *ChainDepositService) credit(ctx context.Context, depositID, userID uuid.UUID, currency string, amount decimal.Decimal) error {
+	wallet, err := s.walletService.GetOrCreateWallet(ctx, userID, currency, models.WalletTypeEco)
+	if err != nil {
+		return fmt.Errorf("failed to get wallet: %w", err)
+	}
+
+	err = s.walletService.UpdateBalanceFor(ctx, wallet.ID, amount, models.BalanceReasonDeposit, depositID.String(),
+		func(ctx context.Context, tx *sqlx.Tx) error {
+			return finishDeposit(ctx, tx, depositID, "COMPLETED")
+		})
+	if errors.Is(err, errDepositSettled) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to credit deposit %s: %w", depositID, err)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"depositId": depositID,
+		"userId":    userID,
+		"currency":  currency,
+		"amount":    amount,
+	}).Info("On-chain deposit credited")
+	return nil
+}
@@ -3,25 +3,43 @@ package services
 import (
 	"context"
 	"crypto-exchange-go/internal/database"
+	"crypto-exchange-go/internal/hdwallet"
 	"crypto-exchange-go/internal/models"
+	"crypto-exchange-go/internal/payments"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
 	"github.com/shopspring/decimal"
 	"github.com/sirupsen/logrus"
 )
 
+var (
+	ErrUnknownPaymentProvider = errors.New("unknown payment provider")
+	ErrPaymentMismatch        = errors.New("payment does not match deposit")
+	ErrUnsupportedNetwork     = errors.New("deposits are not supported on this network")
+	errDuplicatePaymentEvent  = errors.New("payment event already processed")
+	errDepositSettled         = errors.New("deposit already settled")
+)
+
 type DepositService struct {
 	mysql         *database.MySQL
 	walletService *WalletService
+	providers     payments.Registry
 	logger        *logrus.Logger
 }
 
-func NewDepositService(mysql *database.MySQL, walletService *WalletService, logger *logrus.Logger) *DepositService {
+func NewDepositService(mysql *database.MySQL, walletService *WalletService, providers payments.Registry, logger *logrus.Logger) *DepositService {
 	return &DepositService{
 		mysql:         mysql,
 		walletService: walletService,
+		providers:     providers,
 		logger:        logger,
 	}
 }
@@ -42,11 +60,28 @@ func (s *DepositService) CreateFiatDeposit(ctx context.Context, userID uuid.UUID
 		UpdatedAt:     time.Now(),
 	}
 
+	// Deposits paid through a provider get their payment created here, so the
+	// payment id the deposit is settled by never comes from the client.
+	if provider, ok := s.providers.Get(req.Method); ok {
+		payment, err := provider.CreatePayment(ctx, req.Amount, req.Currency, deposit.ID.String())
+		if err != nil {
+			return nil, fmt.Errorf("failed to create %s payment: %w", provider.Name(), err)
+		}
+		deposit.Method = provider.Name()
+		deposit.TransactionID = &payment.ID
+		deposit.PaymentData = payment.ClientData
+	}
+
+	paymentData, err := json.Marshal(deposit.PaymentData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payment data: %w", err)
+	}
+
 	query := `INSERT INTO deposit (id, userId, type, currency, amount, fee, status, method, paymentData, transactionId, createdAt, updatedAt) 
 			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
-	_, err := s.mysql.Exec(query, deposit.ID, deposit.UserID, deposit.Type, deposit.Currency,
-		deposit.Amount, deposit.Fee, deposit.Status, deposit.Method, deposit.PaymentData,
+	_, err = s.mysql.Exec(query, deposit.ID, deposit.UserID, deposit.Type, deposit.Currency,
+		deposit.Amount, deposit.Fee, deposit.Status, deposit.Method, string(paymentData),
 		deposit.TransactionID, deposit.CreatedAt, deposit.UpdatedAt)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create fiat deposit: %w", err)
@@ -85,92 +120,271 @@ func (s *DepositService) CreateSpotDeposit(ctx context.Context, userID uuid.UUID
 	return deposit.ToResponse(), nil
 }
 
+// VerifyStripeDeposit asks Stripe for the state of the user's payment intent
+// and settles the deposit accordingly. It covers clients that return before
+// the webhook arrives.
 func (s *DepositService) VerifyStripeDeposit(ctx context.Context, userID uuid.UUID, paymentIntentID string) (*models.DepositVerificationResult, error) {
-	query := `SELECT id, currency, amount FROM deposit WHERE userId = ? AND paymentData LIKE ? AND status = 'PENDING'`
-	
-	var depositID uuid.UUID
-	var currency string
-	var amount decimal.Decimal
-	
-	err := s.mysql.Get(&depositID, query, userID, "%"+paymentIntentID+"%")
+	return s.confirmDeposit(ctx, userID, "STRIPE", paymentIntentID)
+}
+
+// VerifyPayPalDeposit captures the user's approved PayPal order and settles
+// the deposit accordingly.
+func (s *DepositService) VerifyPayPalDeposit(ctx context.Context, userID uuid.UUID, orderID string) (*models.DepositVerificationResult, error) {
+	return s.confirmDeposit(ctx, userID, "PAYPAL", orderID)
+}
+
+func (s *DepositService) confirmDeposit(ctx context.Context, userID uuid.UUID, method, paymentID string) (*models.DepositVerificationResult, error) {
+	provider, ok := s.providers.Get(method)
+	if !ok {
+		return nil, ErrUnknownPaymentProvider
+	}
+
+	deposit, err := s.providerDeposit(ctx, provider.Name(), paymentID)
 	if err != nil {
-		return nil, fmt.Errorf("deposit not found: %w", err)
+		return nil, err
+	}
+	if deposit.UserID != userID {
+		return nil, fmt.Errorf("deposit not found: %w", sql.ErrNoRows)
 	}
 
-	updateQuery := `UPDATE deposit SET status = 'COMPLETED', updatedAt = ? WHERE id = ?`
-	_, err = s.mysql.Exec(updateQuery, time.Now(), depositID)
+	payment, err := provider.ConfirmPayment(ctx, paymentID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to update deposit status: %w", err)
+		return nil, fmt.Errorf("failed to confirm %s payment: %w", provider.Name(), err)
+	}
+
+	return s.settle(ctx, provider.Name(), deposit, payment, nil)
+}
+
+// HandlePaymentWebhook authenticates a provider's webhook and settles the
+// deposit it's about. Redelivered events are skipped.
+func (s *DepositService) HandlePaymentWebhook(ctx context.Context, method string, header http.Header, body []byte) error {
+	provider, ok := s.providers.Get(method)
+	if !ok {
+		return ErrUnknownPaymentProvider
 	}
 
-	wallet, err := s.walletService.GetOrCreateWallet(ctx, userID, currency, models.WalletTypeFiat)
+	event, err := provider.VerifyWebhook(ctx, header, body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get wallet: %w", err)
+		return err
 	}
 
-	err = s.walletService.UpdateBalance(ctx, wallet.ID, amount)
+	logger := s.logger.WithFields(logrus.Fields{"provider": provider.Name(), "eventId": event.ID, "type": event.Type})
+	if event.Payment == nil {
+		return ignoreDuplicateEvent(s.withEvent(ctx, provider.Name(), event, nil))
+	}
+
+	deposit, err := s.providerDeposit(ctx, provider.Name(), event.Payment.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.WithField("paymentId", event.Payment.ID).Warn("Payment webhook for unknown deposit")
+		return ignoreDuplicateEvent(s.withEvent(ctx, provider.Name(), event, nil))
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to update wallet balance: %w", err)
+		return err
 	}
 
-	return &models.DepositVerificationResult{
-		Success:   true,
-		DepositID: depositID,
-		Amount:    amount,
-		Currency:  currency,
-	}, nil
+	_, err = s.settle(ctx, provider.Name(), deposit, event.Payment, event)
+	return err
 }
 
-func (s *DepositService) VerifyPayPalDeposit(ctx context.Context, userID uuid.UUID, orderID string) (*models.DepositVerificationResult, error) {
-	query := `SELECT id, currency, amount FROM deposit WHERE userId = ? AND paymentData LIKE ? AND status = 'PENDING'`
-	
-	var depositID uuid.UUID
-	var currency string
-	var amount decimal.Decimal
-	
-	err := s.mysql.Get(&depositID, query, userID, "%"+orderID+"%")
+func (s *DepositService) providerDeposit(ctx context.Context, method, paymentID string) (*models.Deposit, error) {
+	query := `SELECT id, userId, currency, amount, status FROM deposit WHERE type = 'FIAT' AND method = ? AND transactionId = ?`
+
+	deposit := &models.Deposit{Type: "FIAT", Method: method, TransactionID: &paymentID}
+	err := s.mysql.QueryRowxContext(ctx, query, method, paymentID).
+		Scan(&deposit.ID, &deposit.UserID, &deposit.Currency, &deposit.Amount, &deposit.Status)
 	if err != nil {
 		return nil, fmt.Errorf("deposit not found: %w", err)
 	}
 
-	updateQuery := `UPDATE deposit SET status = 'COMPLETED', updatedAt = ? WHERE id = ?`
-	_, err = s.mysql.Exec(updateQuery, time.Now(), depositID)
+	return deposit, nil
+}
+
+// MatchPayment checks that a provider's payment is the one the deposit was
+// created for, for the amount and currency it was created with.
+func MatchPayment(deposit *models.Deposit, payment *payments.Payment) error {
+	if payment.Reference != deposit.ID.String() {
+		return fmt.Errorf("%w: payment is for %q, not deposit %s", ErrPaymentMismatch, payment.Reference, deposit.ID)
+	}
+	if !payment.Amount.Equal(deposit.Amount) || !strings.EqualFold(payment.Currency, deposit.Currency) {
+		return fmt.Errorf("%w: paid %s %s, expected %s %s", ErrPaymentMismatch,
+			payment.Amount, payment.Currency, deposit.Amount, deposit.Currency)
+	}
+	return nil
+}
+
+// settle applies the provider's word on a deposit. A successful payment
+// credits the fiat wallet and completes the deposit in one transaction, a
+// failed one fails the deposit. The webhook event, if there is one, is
+// recorded in the same transaction, so a redelivery finds it and changes
+// nothing.
+func (s *DepositService) settle(ctx context.Context, provider string, deposit *models.Deposit, payment *payments.Payment, event *payments.Event) (*models.DepositVerificationResult, error) {
+	result := &models.DepositVerificationResult{
+		DepositID: deposit.ID,
+		Amount:    deposit.Amount,
+		Currency:  deposit.Currency,
+	}
+
+	if err := MatchPayment(deposit, payment); err != nil {
+		// Whatever was paid needs an operator; retrying the event won't
+		// change it.
+		s.logger.WithError(err).WithField("depositId", deposit.ID).Error("Payment does not match deposit")
+		if recordErr := ignoreDuplicateEvent(s.withEvent(ctx, provider, event, nil)); recordErr != nil {
+			return nil, recordErr
+		}
+		return nil, err
+	}
+
+	switch payment.Status {
+	case payments.PaymentSucceeded:
+		wallet, err := s.walletService.GetOrCreateWallet(ctx, deposit.UserID, deposit.Currency, models.WalletTypeFiat)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get wallet: %w", err)
+		}
+
+		err = s.walletService.UpdateBalanceFor(ctx, wallet.ID, deposit.Amount, models.BalanceReasonDeposit, deposit.ID.String(),
+			func(ctx context.Context, tx *sqlx.Tx) error {
+				if err := recordPaymentEvent(ctx, tx, provider, event); err != nil {
+					return err
+				}
+				return finishDeposit(ctx, tx, deposit.ID, "COMPLETED")
+			})
+		if err != nil && !errors.Is(err, errDuplicatePaymentEvent) && !errors.Is(err, errDepositSettled) {
+			return nil, fmt.Errorf("failed to credit deposit: %w", err)
+		}
+		if err != nil {
+			// Another delivery, or the user's own confirmation, got there
+			// first.
+			current, err := s.providerDeposit(ctx, provider, payment.ID)
+			if err != nil {
+				return nil, err
+			}
+			result.Success = current.Status == "COMPLETED"
+			return result, nil
+		}
+		result.Success = true
+
+	case payments.PaymentFailed:
+		err := s.withEvent(ctx, provider, event, func(tx *sqlx.Tx) error {
+			return finishDeposit(ctx, tx, deposit.ID, "FAILED")
+		})
+		if err != nil && !errors.Is(err, errDepositSettled) {
+			return nil, ignoreDuplicateEvent(err)
+		}
+
+	default:
+		if err := ignoreDuplicateEvent(s.withEvent(ctx, provider, event, nil)); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// withEvent records a webhook event and runs update in one transaction.
+func (s *DepositService) withEvent(ctx context.Context, provider string, event *payments.Event, update func(tx *sqlx.Tx) error) error {
+	if event == nil && update == nil {
+		return nil
+	}
+
+	tx, err := s.mysql.BeginTxx(ctx, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to update deposit status: %w", err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback()
 
-	wallet, err := s.walletService.GetOrCreateWallet(ctx, userID, currency, models.WalletTypeFiat)
+	if err := recordPaymentEvent(ctx, tx, provider, event); err != nil {
+		return err
+	}
+
+	if update != nil {
+		if err := update(tx); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit payment event: %w", err)
+	}
+	return nil
+}
+
+func recordPaymentEvent(ctx context.Context, tx *sqlx.Tx, provider string, event *payments.Event) error {
+	if event == nil {
+		return nil
+	}
+
+	var paymentID *string
+	if event.Payment != nil {
+		paymentID = &event.Payment.ID
+	}
+
+	_, err := tx.ExecContext(ctx, `INSERT INTO payment_webhook_event (provider, eventId, type, paymentId, createdAt) VALUES (?, ?, ?, ?, ?)`,
+		provider, event.ID, event.Type, paymentID, time.Now())
+	if isDuplicateKey(err) {
+		return errDuplicatePaymentEvent
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to get wallet: %w", err)
+		return fmt.Errorf("failed to record payment event: %w", err)
 	}
+	return nil
+}
 
-	err = s.walletService.UpdateBalance(ctx, wallet.ID, amount)
+func ignoreDuplicateEvent(err error) error {
+	if errors.Is(err, errDuplicatePaymentEvent) {
+		return nil
+	}
+	return err
+}
+
+func finishDeposit(ctx context.Context, tx *sqlx.Tx, depositID uuid.UUID, status string) error {
+	result, err := tx.ExecContext(ctx, `UPDATE deposit SET status = ?, updatedAt = ? WHERE id = ? AND status = 'PENDING'`,
+		status, time.Now(), depositID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to update wallet balance: %w", err)
+		return fmt.Errorf("failed to update deposit status: %w", err)
 	}
 
-	return &models.DepositVerificationResult{
-		Success:   true,
-		DepositID: depositID,
-		Amount:    amount,
-		Currency:  currency,
-	}, nil
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return errDepositSettled
+	}
+	return nil
 }
 
+// GetDepositAddress returns the user's address for a currency on a network,
+// deriving one from the network's master wallet the first time. The network
+// defaults to the currency for coins on their own chain.
 func (s *DepositService) GetDepositAddress(ctx context.Context, userID uuid.UUID, currency, network string) (*models.DepositAddress, error) {
-	query := `SELECT address FROM deposit_address WHERE userId = ? AND currency = ? AND network = ?`
-	
+	// The chain watcher matches transfers by network, so it's stored in one
+	// case.
+	currency = strings.ToUpper(currency)
+	network = strings.ToUpper(network)
+	if network == "" {
+		network = currency
+	}
+
+	address, err := depositAddress(ctx, s.mysql, userID, currency, network)
+	if err == nil {
+		return address, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	return s.deriveDepositAddress(ctx, userID, currency, network)
+}
+
+// depositAddress reads a stored address. Rows without a derivation path were
+// placeholders, not real addresses, and are passed over.
+func depositAddress(ctx context.Context, q sqlx.QueryerContext, userID uuid.UUID, currency, network string) (*models.DepositAddress, error) {
+	query := `SELECT address FROM deposit_address
+			  WHERE userId = ? AND currency = ? AND network = ? AND derivationPath IS NOT NULL
+			  ORDER BY createdAt DESC LIMIT 1`
+
 	var address string
-	err := s.mysql.Get(&address, query, userID, currency, network)
-	if err != nil {
-		address = s.generateDepositAddress(currency, network)
-		
-		insertQuery := `INSERT INTO deposit_address (id, userId, currency, network, address, createdAt) 
-						VALUES (?, ?, ?, ?, ?, ?)`
-		_, err = s.mysql.Exec(insertQuery, uuid.New(), userID, currency, network, address, time.Now())
-		if err != nil {
-			return nil, fmt.Errorf("failed to create deposit address: %w", err)
+	if err := sqlx.GetContext(ctx, q, &address, query, userID, currency, network); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
 		}
+		return nil, fmt.Errorf("failed to get deposit address: %w", err)
 	}
 
 	return &models.DepositAddress{
@@ -180,6 +394,81 @@ func (s *DepositService) GetDepositAddress(ctx context.Context, userID uuid.UUID
 	}, nil
 }
 
-func (s *DepositService) generateDepositAddress(currency, network string) string {
-	return fmt.Sprintf("%s_%s_%d", currency, network, time.Now().Unix())
+// deriveDepositAddress takes the next index from the network's master wallet
+// and derives the address for it from the wallet's account xpub. The master
+// wallet row stays locked until the address is stored, so concurrent requests
+// never share an index and a user never ends up with two addresses.
+func (s *DepositService) deriveDepositAddress(ctx context.Context, userID uuid.UUID, currency, network string) (*models.DepositAddress, error) {
+	chain, ok := hdwallet.ChainFor(network)
+	if !ok {
+		return nil, ErrUnsupportedNetwork
+	}
+
+	tx, err := s.mysql.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var masterWalletID uuid.UUID
+	var publicKey sql.NullString
+	var lastIndex uint32
+	err = tx.QueryRowxContext(ctx, `SELECT id, publicKey, lastIndex FROM ecosystem_master_wallet
+			  WHERE chain = ? AND status = true ORDER BY createdAt LIMIT 1 FOR UPDATE`, network).
+		Scan(&masterWalletID, &publicKey, &lastIndex)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUnsupportedNetwork
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get master wallet: %w", err)
+	}
+
+	// Another request may have stored the address while this one waited for
+	// the lock.
+	if address, err := depositAddress(ctx, tx, userID, currency, network); !errors.Is(err, sql.ErrNoRows) {
+		return address, err
+	}
+
+	accountKey, err := hdwallet.ParseExtendedKey(publicKey.String)
+	if err != nil {
+		return nil, fmt.Errorf("invalid master public key for %s: %w", network, err)
+	}
+
+	// Index 0 is the master wallet's own address, so user addresses start
+	// at 1.
+	index := lastIndex
+	var address, path string
+	for {
+		index++
+		address, path, err = hdwallet.DeriveAddress(chain, accountKey, index)
+		if !errors.Is(err, hdwallet.ErrInvalidChild) {
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive deposit address: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE ecosystem_master_wallet SET lastIndex = ?, updatedAt = ? WHERE id = ?`,
+		index, time.Now(), masterWalletID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update master wallet index: %w", err)
+	}
+
+	insertQuery := `INSERT INTO deposit_address (id, userId, currency, network, address, masterWalletId, derivationPath, createdAt) 
+					VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err = tx.ExecContext(ctx, insertQuery, uuid.New(), userID, currency, network, address, masterWalletID, path, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create deposit address: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit deposit address: %w", err)
+	}
+
+	return &models.DepositAddress{
+		Currency: currency,
+		Network:  network,
+		Address:  address,
+	}, nil
 }
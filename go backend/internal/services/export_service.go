@@ -0,0 +1,218 @@
+package services
+
+import (
+	"context"
+	"crypto-exchange-go/internal/database"
+	"crypto-exchange-go/internal/export"
+	"crypto-exchange-go/internal/models"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// ExportService streams a user's transactions, orders and trades straight
+// from the database cursor into an export writer.
+type ExportService struct {
+	mysql  *database.MySQL
+	logger *logrus.Logger
+}
+
+func NewExportService(mysql *database.MySQL, logger *logrus.Logger) *ExportService {
+	return &ExportService{
+		mysql:  mysql,
+		logger: logger,
+	}
+}
+
+func (s *ExportService) ExportTransactions(ctx context.Context, userID uuid.UUID, filter models.TransactionFilter, w export.Writer) error {
+	where, args := transactionConditions(userID, filter)
+	query := `SELECT ` + transactionColumns + ` FROM transaction WHERE ` + where + ` ORDER BY createdAt DESC, id DESC`
+
+	rows, err := s.mysql.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query transactions: %w", err)
+	}
+	defer rows.Close()
+
+	header := []string{"id", "createdAt", "type", "status", "currency", "walletType", "amount", "fee", "description", "referenceId"}
+	if err := w.Write(header); err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		transaction, err := scanTransaction(rows)
+		if err != nil {
+			return err
+		}
+
+		err = w.Write([]string{
+			transaction.ID.String(),
+			transaction.CreatedAt.UTC().Format(time.RFC3339),
+			transaction.Type,
+			transaction.Status,
+			transaction.Currency,
+			stringValue(transaction.WalletType),
+			transaction.SignedAmount().String(),
+			transaction.Fee.String(),
+			transaction.Description,
+			stringValue(transaction.ReferenceID),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read transactions: %w", err)
+	}
+
+	return w.Close()
+}
+
+func orderConditions(userID uuid.UUID, filter models.OrderFilter) (string, []interface{}) {
+	where := "userId = ?"
+	args := []interface{}{userID}
+
+	if filter.Symbol != "" {
+		where += " AND symbol = ?"
+		args = append(args, filter.Symbol)
+	}
+
+	if filter.Status != "" {
+		where += " AND status = ?"
+		args = append(args, filter.Status)
+	}
+
+	if filter.From != nil {
+		where += " AND createdAt >= ?"
+		args = append(args, *filter.From)
+	}
+
+	if filter.To != nil {
+		where += " AND createdAt < ?"
+		args = append(args, *filter.To)
+	}
+
+	return where, args
+}
+
+func (s *ExportService) ExportOrders(ctx context.Context, userID uuid.UUID, filter models.OrderFilter, w export.Writer) error {
+	where, args := orderConditions(userID, filter)
+	query := `SELECT id, symbol, type, side, status, price, amount, filled, remaining, cost, fee, feeCurrency, createdAt
+			  FROM exchange_order WHERE ` + where + ` ORDER BY createdAt DESC, id DESC`
+
+	rows, err := s.mysql.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query orders: %w", err)
+	}
+	defer rows.Close()
+
+	header := []string{"id", "createdAt", "symbol", "type", "side", "status", "price", "amount", "filled", "remaining", "cost", "fee", "feeCurrency"}
+	if err := w.Write(header); err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		order := &models.ExchangeOrder{}
+		err := rows.Scan(&order.ID, &order.Symbol, &order.Type, &order.Side, &order.Status, &order.Price,
+			&order.Amount, &order.Filled, &order.Remaining, &order.Cost, &order.Fee, &order.FeeCurrency, &order.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to scan order: %w", err)
+		}
+
+		err = w.Write([]string{
+			order.ID.String(),
+			order.CreatedAt.UTC().Format(time.RFC3339),
+			order.Symbol,
+			string(order.Type),
+			string(order.Side),
+			string(order.Status),
+			order.Price.String(),
+			order.Amount.String(),
+			order.Filled.String(),
+			order.Remaining.String(),
+			order.Cost.String(),
+			order.Fee.String(),
+			order.FeeCurrency,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read orders: %w", err)
+	}
+
+	return w.Close()
+}
+
+// ExportTrades writes one row per fill. Fills live on their order, so orders
+// are selected by creation time and the fills themselves filtered by when
+// they happened.
+func (s *ExportService) ExportTrades(ctx context.Context, userID uuid.UUID, filter models.OrderFilter, w export.Writer) error {
+	from := filter.From
+	filter.From = nil
+	filter.Status = ""
+	where, args := orderConditions(userID, filter)
+	query := `SELECT id, symbol, side, feeCurrency, trades FROM exchange_order
+			  WHERE ` + where + ` AND filled > 0 ORDER BY createdAt DESC, id DESC`
+
+	rows, err := s.mysql.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query trades: %w", err)
+	}
+	defer rows.Close()
+
+	header := []string{"id", "datetime", "orderId", "symbol", "side", "price", "amount", "cost", "fee", "feeCurrency"}
+	if err := w.Write(header); err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		order := &models.ExchangeOrder{}
+		if err := rows.Scan(&order.ID, &order.Symbol, &order.Side, &order.FeeCurrency, &order.Trades); err != nil {
+			return fmt.Errorf("failed to scan trades: %w", err)
+		}
+
+		for _, trade := range order.Trades {
+			if from != nil && trade.DateTime.Before(*from) {
+				continue
+			}
+			if filter.To != nil && !trade.DateTime.Before(*filter.To) {
+				continue
+			}
+
+			err := w.Write([]string{
+				trade.ID,
+				trade.DateTime.UTC().Format(time.RFC3339),
+				order.ID.String(),
+				order.Symbol,
+				string(order.Side),
+				trade.Price.String(),
+				trade.Amount.String(),
+				trade.Cost.String(),
+				trade.Fee.String(),
+				order.FeeCurrency,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read trades: %w", err)
+	}
+
+	return w.Close()
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
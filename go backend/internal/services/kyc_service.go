@@ -97,3 +97,14 @@ func (s *KYCService) UpdateApplication(ctx context.Context, userID, applicationI
 
 	return nil
 }
+
+// VerifiedLevel is the highest KYC level the user has been approved for, or
+// zero.
+func (s *KYCService) VerifiedLevel(ctx context.Context, userID uuid.UUID) (int, error) {
+	var level int
+	err := s.mysql.GetContext(ctx, &level, `SELECT COALESCE(MAX(level), 0) FROM kyc WHERE userId = ? AND status = 'APPROVED'`, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get KYC level: %w", err)
+	}
+	return level, nil
+}
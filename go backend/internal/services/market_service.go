@@ -113,3 +113,30 @@ func (s *MarketService) GetCandles(ctx context.Context, symbol, interval string,
 
 	return candles, nil
 }
+
+// GetTickers returns the last daily close of every active market, read from
+// the stored candles rather than a running matching engine.
+func (s *MarketService) GetTickers() map[string]*models.Ticker {
+	ctx := context.Background()
+
+	markets, err := s.GetMarkets(ctx)
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to get markets for tickers")
+		return nil
+	}
+
+	tickers := make(map[string]*models.Ticker, len(markets))
+	for _, market := range markets {
+		symbol := fmt.Sprintf("%s/%s", market.Currency, market.Pair)
+		candles, err := s.GetCandles(ctx, symbol, "1d", 1)
+		if err != nil {
+			s.logger.WithError(err).WithField("symbol", symbol).Error("Failed to get ticker candle")
+			continue
+		}
+		if len(candles) == 0 || candles[0].Close.IsZero() {
+			continue
+		}
+		tickers[symbol] = &models.Ticker{Symbol: symbol, Last: candles[0].Close}
+	}
+	return tickers
+}
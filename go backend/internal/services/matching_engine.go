@@ -5,6 +5,7 @@ import (
 	"crypto-exchange-go/internal/database"
 	"crypto-exchange-go/internal/models"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"sort"
 	"sync"
@@ -54,6 +55,8 @@ type OrderBook struct {
 	Asks   map[string]decimal.Decimal   `json:"asks"`
 }
 
+var ErrOrderNotInBook = errors.New("order is not in the book")
+
 var (
 	matchingEngineInstance *MatchingEngine
 	matchingEngineOnce     sync.Once
@@ -500,6 +503,57 @@ func (me *MatchingEngine) CancelOrder(orderID uuid.UUID, symbol string) error {
 	return me.scyllaDB.Session().Query(query, time.Now(), orderID).Exec()
 }
 
+// Amend changes the price and amount of a resting order. Remaining follows
+// from the order's own fills, and a new price or a larger amount loses time
+// priority.
+func (o *Order) Amend(price, amount decimal.Decimal, now time.Time) error {
+	if amount.LessThanOrEqual(o.Filled) {
+		return fmt.Errorf("amount must be greater than filled amount %s", o.Filled.String())
+	}
+
+	if !o.Price.Equal(price) || amount.GreaterThan(o.Amount) {
+		o.CreatedAt = now
+	}
+	o.Price = price
+	o.Amount = amount
+	o.Remaining = amount.Sub(o.Filled)
+	o.UpdatedAt = now
+	return nil
+}
+
+// AmendOrder amends the order as the book holds it, so a fill that lands
+// after the caller read the order still counts, and returns a copy of the
+// amended order.
+func (me *MatchingEngine) AmendOrder(orderID uuid.UUID, symbol string, price, amount decimal.Decimal) (*Order, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	var order *Order
+	for _, queued := range me.orderQueues[symbol] {
+		if queued.ID == orderID && queued.Status == models.OrderStatusOpen {
+			order = queued
+			break
+		}
+	}
+	if order == nil {
+		return nil, ErrOrderNotInBook
+	}
+
+	previous := *order
+	if err := order.Amend(price, amount, time.Now()); err != nil {
+		return nil, err
+	}
+
+	query := `UPDATE orders SET price = ?, amount = ?, remaining = ?, updated_at = ? WHERE id = ?`
+	if err := me.scyllaDB.Session().Query(query, order.Price, order.Amount, order.Remaining, order.UpdatedAt, orderID).Exec(); err != nil {
+		*order = previous
+		return nil, err
+	}
+
+	amended := *order
+	return &amended, nil
+}
+
 func (me *MatchingEngine) GetTickers() map[string]*models.Ticker {
 	me.mu.RLock()
 	defer me.mu.RUnlock()
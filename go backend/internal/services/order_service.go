@@ -4,19 +4,28 @@ import (
 	"context"
 	"crypto-exchange-go/internal/database"
 	"crypto-exchange-go/internal/models"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
 	"github.com/shopspring/decimal"
 	"github.com/sirupsen/logrus"
 )
 
+var (
+	ErrOrderNotCancelable = errors.New("order cannot be canceled")
+	ErrOrderNotAmendable  = errors.New("order cannot be amended")
+)
+
 type OrderService struct {
 	mysql         *database.MySQL
 	scyllaDB      *database.ScyllaDB
 	redis         *database.Redis
 	matchingEngine *MatchingEngine
+	balances      *balanceEvents
 	logger        *logrus.Logger
 }
 
@@ -26,6 +35,7 @@ func NewOrderService(mysql *database.MySQL, scyllaDB *database.ScyllaDB, redis *
 		scyllaDB:      scyllaDB,
 		redis:         redis,
 		matchingEngine: matchingEngine,
+		balances:      newBalanceEvents(mysql, redis, logger),
 		logger:        logger,
 	}
 }
@@ -53,12 +63,6 @@ func (s *OrderService) CreateOrder(ctx context.Context, userID uuid.UUID, req *m
 		orderPrice = ticker.Last
 	}
 
-	cost := req.Amount.Mul(orderPrice)
-
-	if err := s.validateBalance(userID, req, cost); err != nil {
-		return nil, err
-	}
-
 	order := &models.ExchangeOrder{
 		ID:          uuid.New(),
 		UserID:      userID,
@@ -78,12 +82,16 @@ func (s *OrderService) CreateOrder(ctx context.Context, userID uuid.UUID, req *m
 		UpdatedAt:   time.Now(),
 	}
 
-	if err := s.saveOrder(order); err != nil {
-		return nil, fmt.Errorf("failed to save order: %w", err)
+	holdCurrency, holdAmount := orderFunds(req.Side, req.Currency, req.Pair, req.Amount, orderPrice)
+	err = s.moveOrderFunds(ctx, models.BalanceOperationHold, userID, order.ID, holdCurrency, holdAmount,
+		func(ctx context.Context, tx *sqlx.Tx) error {
+			return s.saveOrder(ctx, tx, order)
+		})
+	if errors.Is(err, ErrInsufficientBalance) {
+		return nil, fmt.Errorf("%w, need %s %s", ErrInsufficientBalance, holdAmount.String(), holdCurrency)
 	}
-
-	if err := s.updateWalletBalances(userID, req, cost); err != nil {
-		return nil, fmt.Errorf("failed to update wallet balances: %w", err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to place order: %w", err)
 	}
 
 	matchingOrder := &Order{
@@ -168,22 +176,182 @@ func (s *OrderService) CancelOrder(ctx context.Context, userID, orderID uuid.UUI
 	}
 
 	if order.Status != models.OrderStatusOpen {
-		return fmt.Errorf("order cannot be canceled")
+		return ErrOrderNotCancelable
 	}
 
-	if err := s.matchingEngine.CancelOrder(orderID, order.Symbol); err != nil {
-		return fmt.Errorf("failed to cancel order in matching engine: %w", err)
+	currency, pair, err := splitSymbol(order.Symbol)
+	if err != nil {
+		return err
 	}
 
-	query := `UPDATE exchange_order SET status = ?, updatedAt = ? WHERE id = ? AND userId = ?`
-	_, err = s.mysql.Exec(query, models.OrderStatusCanceled, time.Now(), orderID, userID)
+	releaseCurrency, releaseAmount := orderFunds(order.Side, currency, pair, order.Remaining, order.Price)
+	err = s.adjustOrderFunds(ctx, userID, orderID, releaseCurrency, releaseAmount.Neg(),
+		func(ctx context.Context, tx *sqlx.Tx) error {
+			if err := lockUnchangedOrder(ctx, tx, order); err != nil {
+				return ErrOrderNotCancelable
+			}
+
+			query := `UPDATE exchange_order SET status = ?, updatedAt = ? WHERE id = ?`
+			if _, err := tx.ExecContext(ctx, query, models.OrderStatusCanceled, time.Now(), orderID); err != nil {
+				return fmt.Errorf("failed to update order status: %w", err)
+			}
+
+			// Last, so a failure here rolls the order and its funds back.
+			if err := s.matchingEngine.CancelOrder(orderID, order.Symbol); err != nil {
+				return fmt.Errorf("failed to cancel order in matching engine: %w", err)
+			}
+			return nil
+		})
+	if errors.Is(err, ErrOrderNotCancelable) {
+		return err
+	}
 	if err != nil {
-		return fmt.Errorf("failed to update order status: %w", err)
+		return fmt.Errorf("failed to cancel order: %w", err)
 	}
 
 	return nil
 }
 
+func (s *OrderService) AmendOrder(ctx context.Context, userID, orderID uuid.UUID, req *models.AmendOrderRequest) (*models.OrderResponse, error) {
+	if req.Price == nil && req.Amount == nil {
+		return nil, fmt.Errorf("price or amount is required")
+	}
+
+	order, err := s.GetOrder(ctx, userID, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	if order.Status != models.OrderStatusOpen {
+		return nil, ErrOrderNotAmendable
+	}
+
+	if order.Type != models.OrderTypeLimit {
+		return nil, fmt.Errorf("only limit orders can be amended")
+	}
+
+	currency, pair, err := splitSymbol(order.Symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	market, err := s.getMarket(currency, pair)
+	if err != nil {
+		return nil, fmt.Errorf("market not found: %w", err)
+	}
+
+	newPrice := order.Price
+	if req.Price != nil {
+		newPrice = *req.Price
+	}
+
+	newAmount := order.Amount
+	if req.Amount != nil {
+		newAmount = *req.Amount
+	}
+
+	if newAmount.LessThanOrEqual(order.Filled) {
+		return nil, fmt.Errorf("amount must be greater than filled amount %s", order.Filled.String())
+	}
+
+	amended := &models.CreateOrderRequest{
+		Currency: currency,
+		Pair:     pair,
+		Type:     order.Type,
+		Side:     order.Side,
+		Amount:   newAmount,
+		Price:    &newPrice,
+	}
+
+	if err := s.validateOrderRequest(amended, market); err != nil {
+		return nil, err
+	}
+
+	// Only the unfilled part of an order is on hold.
+	remaining := newAmount.Sub(order.Filled)
+	fundsCurrency, held := orderFunds(order.Side, currency, pair, order.Amount.Sub(order.Filled), order.Price)
+	_, required := orderFunds(order.Side, currency, pair, remaining, newPrice)
+	delta := required.Sub(held)
+
+	err = s.adjustOrderFunds(ctx, userID, orderID, fundsCurrency, delta,
+		func(ctx context.Context, tx *sqlx.Tx) error {
+			if err := lockUnchangedOrder(ctx, tx, order); err != nil {
+				return ErrOrderNotAmendable
+			}
+
+			query := `UPDATE exchange_order SET price = ?, amount = ?, remaining = ?, updatedAt = ? WHERE id = ?`
+			if _, err := tx.ExecContext(ctx, query, newPrice, newAmount, remaining, time.Now(), orderID); err != nil {
+				return fmt.Errorf("failed to amend order: %w", err)
+			}
+
+			// Last, so a failure here rolls the order and its funds back.
+			inBook, err := s.matchingEngine.AmendOrder(orderID, order.Symbol, newPrice, newAmount)
+			if errors.Is(err, ErrOrderNotInBook) {
+				return ErrOrderNotAmendable
+			}
+			if err != nil {
+				return fmt.Errorf("failed to amend order in matching engine: %w", err)
+			}
+
+			if !inBook.Remaining.Equal(remaining) {
+				_, err = tx.ExecContext(ctx, `UPDATE exchange_order SET remaining = ? WHERE id = ?`, inBook.Remaining, orderID)
+				if err != nil {
+					return fmt.Errorf("failed to amend order: %w", err)
+				}
+			}
+			return nil
+		})
+	if errors.Is(err, ErrInsufficientBalance) {
+		return nil, fmt.Errorf("%w, need %s %s", ErrInsufficientBalance, delta.String(), fundsCurrency)
+	}
+	if errors.Is(err, ErrOrderNotAmendable) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to amend order: %w", err)
+	}
+
+	return s.GetOrder(ctx, userID, orderID)
+}
+
+func (s *OrderService) CancelAllOrders(ctx context.Context, userID uuid.UUID, symbol string) ([]*models.OrderResponse, error) {
+	orders, err := s.GetOrders(ctx, userID, string(models.OrderStatusOpen), 1000, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	canceled := make([]*models.OrderResponse, 0, len(orders))
+	failed := 0
+	for _, order := range orders {
+		if symbol != "" && order.Symbol != symbol {
+			continue
+		}
+
+		if err := s.CancelOrder(ctx, userID, order.ID); err != nil {
+			s.logger.WithError(err).WithField("orderID", order.ID).Error("Failed to cancel order")
+			failed++
+			continue
+		}
+
+		order.Status = models.OrderStatusCanceled
+		canceled = append(canceled, order)
+	}
+
+	if failed > 0 {
+		return canceled, fmt.Errorf("failed to cancel %d of %d orders", failed, failed+len(canceled))
+	}
+
+	return canceled, nil
+}
+
+func splitSymbol(symbol string) (string, string, error) {
+	currency, pair, ok := strings.Cut(symbol, "/")
+	if !ok || currency == "" || pair == "" {
+		return "", "", fmt.Errorf("invalid symbol format: %s", symbol)
+	}
+	return currency, pair, nil
+}
+
 func (s *OrderService) getMarket(currency, pair string) (*models.ExchangeMarket, error) {
 	query := `SELECT id, currency, pair, isTrending, isHot, metadata, status 
 			  FROM exchange_market WHERE currency = ? AND pair = ? AND status = 1`
@@ -225,30 +393,8 @@ func (s *OrderService) validateOrderRequest(req *models.CreateOrderRequest, mark
 	return nil
 }
 
-func (s *OrderService) validateBalance(userID uuid.UUID, req *models.CreateOrderRequest, cost decimal.Decimal) error {
-	if req.Side == models.OrderSideBuy {
-		wallet, err := s.getWallet(userID, req.Pair)
-		if err != nil {
-			return fmt.Errorf("wallet not found for %s", req.Pair)
-		}
-		if wallet.Balance.LessThan(cost) {
-			return fmt.Errorf("insufficient balance, need %s %s", cost.String(), req.Pair)
-		}
-	} else {
-		wallet, err := s.getWallet(userID, req.Currency)
-		if err != nil {
-			return fmt.Errorf("wallet not found for %s", req.Currency)
-		}
-		if wallet.Balance.LessThan(req.Amount) {
-			return fmt.Errorf("insufficient balance, need %s %s", req.Amount.String(), req.Currency)
-		}
-	}
-
-	return nil
-}
-
 func (s *OrderService) getWallet(userID uuid.UUID, currency string) (*models.Wallet, error) {
-	query := `SELECT id, userId, type, currency, balance, createdAt, updatedAt 
+	query := `SELECT id, userId, type, currency, balance, inOrder, frozen, createdAt, updatedAt 
 			  FROM wallet WHERE userId = ? AND currency = ? AND type = 'SPOT'`
 
 	wallet := &models.Wallet{}
@@ -260,26 +406,80 @@ func (s *OrderService) getWallet(userID uuid.UUID, currency string) (*models.Wal
 	return wallet, nil
 }
 
-func (s *OrderService) saveOrder(order *models.ExchangeOrder) error {
+func (s *OrderService) saveOrder(ctx context.Context, tx *sqlx.Tx, order *models.ExchangeOrder) error {
 	query := `INSERT INTO exchange_order (id, userId, status, symbol, type, timeInForce, side, price, 
 			  amount, filled, remaining, cost, fee, feeCurrency, createdAt, updatedAt) 
 			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
-	_, err := s.mysql.Exec(query, order.ID, order.UserID, order.Status, order.Symbol, order.Type,
+	_, err := tx.ExecContext(ctx, query, order.ID, order.UserID, order.Status, order.Symbol, order.Type,
 		order.TimeInForce, order.Side, order.Price, order.Amount, order.Filled, order.Remaining,
 		order.Cost, order.Fee, order.FeeCurrency, order.CreatedAt, order.UpdatedAt)
 
 	return err
 }
 
-func (s *OrderService) updateWalletBalances(userID uuid.UUID, req *models.CreateOrderRequest, cost decimal.Decimal) error {
-	if req.Side == models.OrderSideBuy {
-		query := `UPDATE wallet SET balance = balance - ? WHERE userId = ? AND currency = ? AND type = 'SPOT'`
-		_, err := s.mysql.Exec(query, cost, userID, req.Pair)
+// orderFunds returns the currency and amount an open order keeps on hold: the
+// quote cost for buys and the base amount for sells.
+func orderFunds(side models.OrderSide, currency, pair string, amount, price decimal.Decimal) (string, decimal.Decimal) {
+	if side == models.OrderSideBuy {
+		return pair, amount.Mul(price)
+	}
+	return currency, amount
+}
+
+func (s *OrderService) moveOrderFunds(ctx context.Context, operation models.BalanceOperation, userID, orderID uuid.UUID, currency string, amount decimal.Decimal, record func(ctx context.Context, tx *sqlx.Tx) error) error {
+	wallet, err := s.getWallet(userID, currency)
+	if err != nil {
 		return err
-	} else {
-		query := `UPDATE wallet SET balance = balance - ? WHERE userId = ? AND currency = ? AND type = 'SPOT'`
-		_, err := s.mysql.Exec(query, req.Amount, userID, req.Currency)
+	}
+
+	_, err = s.balances.apply(ctx, balanceChange{
+		WalletID:    wallet.ID,
+		Operation:   operation,
+		Amount:      amount,
+		Reason:      models.BalanceReasonOrder,
+		ReferenceID: orderID.String(),
+		Record:      record,
+	})
+	return err
+}
+
+// adjustOrderFunds holds a positive delta or releases a negative one, running
+// record in the same transaction under the wallet lock. A zero delta runs
+// record on its own.
+func (s *OrderService) adjustOrderFunds(ctx context.Context, userID, orderID uuid.UUID, currency string, delta decimal.Decimal, record func(ctx context.Context, tx *sqlx.Tx) error) error {
+	switch {
+	case delta.IsPositive():
+		return s.moveOrderFunds(ctx, models.BalanceOperationHold, userID, orderID, currency, delta, record)
+	case delta.IsNegative():
+		return s.moveOrderFunds(ctx, models.BalanceOperationRelease, userID, orderID, currency, delta.Neg(), record)
+	}
+
+	tx, err := s.mysql.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := record(ctx, tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// lockUnchangedOrder locks the order's row and fails if it is no longer open
+// or changed since it was read, since the funds moving with it were sized
+// from that read.
+func lockUnchangedOrder(ctx context.Context, tx *sqlx.Tx, order *models.OrderResponse) error {
+	var current models.ExchangeOrder
+	query := `SELECT status, price, amount, filled, remaining FROM exchange_order WHERE id = ? FOR UPDATE`
+	if err := tx.GetContext(ctx, &current, query, order.ID); err != nil {
 		return err
 	}
+
+	if current.Status != models.OrderStatusOpen || !current.Price.Equal(order.Price) || !current.Amount.Equal(order.Amount) ||
+		!current.Filled.Equal(order.Filled) || !current.Remaining.Equal(order.Remaining) {
+		return fmt.Errorf("order %s changed", order.ID)
+	}
+	return nil
 }
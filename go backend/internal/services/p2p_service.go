@@ -11,14 +11,16 @@ import (
 )
 
 type P2pService struct {
-	db     *gorm.DB
-	logger *logrus.Logger
+	db            *gorm.DB
+	walletService *WalletService
+	logger        *logrus.Logger
 }
 
-func NewP2pService(db *gorm.DB, logger *logrus.Logger) *P2pService {
+func NewP2pService(db *gorm.DB, walletService *WalletService, logger *logrus.Logger) *P2pService {
 	return &P2pService{
-		db:     db,
-		logger: logger,
+		db:            db,
+		walletService: walletService,
+		logger:        logger,
 	}
 }
 
@@ -131,7 +133,8 @@ func (s *P2pService) UpdateOfferStatus(ctx context.Context, id uuid.UUID, status
 }
 
 func (s *P2pService) CreateTrade(ctx context.Context, trade *models.P2pTrade) error {
-	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+	var escrowWallet *models.WalletResponse
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		var offer models.P2pOffer
 		err := tx.First(&offer, "id = ?", trade.OfferID).Error
 		if err != nil {
@@ -152,6 +155,17 @@ func (s *P2pService) CreateTrade(ctx context.Context, trade *models.P2pTrade) er
 		trade.Status = "PENDING"
 		trade.Total = trade.Amount.Mul(trade.Price)
 		
+		wallet, err := s.walletService.GetWallet(ctx, trade.SellerID, offer.Currency, models.WalletTypeSpot)
+		if err != nil {
+			return err
+		}
+		
+		err = s.walletService.Hold(ctx, wallet.ID, trade.Amount, models.BalanceReasonP2pTrade, trade.ID.String())
+		if err != nil {
+			return err
+		}
+		escrowWallet = wallet
+		
 		err = tx.Create(trade).Error
 		if err != nil {
 			return err
@@ -168,6 +182,15 @@ func (s *P2pService) CreateTrade(ctx context.Context, trade *models.P2pTrade) er
 		
 		return tx.Create(escrow).Error
 	})
+	
+	if err != nil && escrowWallet != nil {
+		releaseErr := s.walletService.Release(ctx, escrowWallet.ID, trade.Amount, models.BalanceReasonP2pTrade, trade.ID.String())
+		if releaseErr != nil {
+			s.logger.WithError(releaseErr).WithField("tradeId", trade.ID).Error("Failed to release P2P escrow hold")
+		}
+	}
+	
+	return err
 }
 
 func (s *P2pService) GetTrades(ctx context.Context, userID *uuid.UUID, offerID *uuid.UUID, status string) ([]models.P2pTrade, error) {
@@ -214,19 +237,62 @@ func (s *P2pService) UpdateTradeStatus(ctx context.Context, id uuid.UUID, status
 			return err
 		}
 		
-		if status == "COMPLETED" {
-			err = tx.Model(&models.P2pEscrow{}).
-				Where("trade_id = ?", id).
-				Updates(map[string]interface{}{
-					"status":     "RELEASED",
-					"updated_at": time.Now(),
-				}).Error
+		escrowStatus := ""
+		switch status {
+		case "COMPLETED":
+			escrowStatus = "RELEASED"
+		case "CANCELLED":
+			escrowStatus = "REFUNDED"
+		default:
+			return nil
 		}
 		
-		return err
+		result := tx.Model(&models.P2pEscrow{}).
+			Where("trade_id = ? AND status = ?", id, "HELD").
+			Updates(map[string]interface{}{
+				"status":     escrowStatus,
+				"updated_at": time.Now(),
+			})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		
+		var trade models.P2pTrade
+		err = tx.Preload("Offer").First(&trade, "id = ?", id).Error
+		if err != nil {
+			return err
+		}
+		
+		return s.settleEscrow(ctx, &trade, status == "COMPLETED")
 	})
 }
 
+// settleEscrow moves the seller's held funds to the buyer when a trade
+// completes, or back to the seller's available balance when it's cancelled.
+func (s *P2pService) settleEscrow(ctx context.Context, trade *models.P2pTrade, completed bool) error {
+	sellerWallet, err := s.walletService.GetWallet(ctx, trade.SellerID, trade.Offer.Currency, models.WalletTypeSpot)
+	if err != nil {
+		return err
+	}
+	
+	reference := trade.ID.String()
+	if !completed {
+		return s.walletService.Release(ctx, sellerWallet.ID, trade.Amount, models.BalanceReasonP2pTrade, reference)
+	}
+	
+	err = s.walletService.Capture(ctx, sellerWallet.ID, trade.Amount, models.BalanceReasonP2pTrade, reference)
+	if err != nil {
+		return err
+	}
+	
+	buyerWallet, err := s.walletService.GetOrCreateWallet(ctx, trade.BuyerID, trade.Offer.Currency, models.WalletTypeSpot)
+	if err != nil {
+		return err
+	}
+	
+	return s.walletService.UpdateBalance(ctx, buyerWallet.ID, trade.Amount, models.BalanceReasonP2pTrade, reference)
+}
+
 func (s *P2pService) CreateDispute(ctx context.Context, dispute *models.P2pDispute) error {
 	dispute.ID = uuid.New()
 	dispute.CreatedAt = time.Now()
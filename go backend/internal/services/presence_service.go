@@ -0,0 +1,111 @@
+package services
+
+import (
+	"context"
+	"crypto-exchange-go/internal/database"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	presenceGatewaysKey = "presence:gateways"
+	presenceTTL         = 45 * time.Second
+)
+
+type PresenceService struct {
+	redis  *database.Redis
+	logger *logrus.Logger
+}
+
+func NewPresenceService(redis *database.Redis, logger *logrus.Logger) *PresenceService {
+	return &PresenceService{
+		redis:  redis,
+		logger: logger,
+	}
+}
+
+func presenceGatewayKey(gatewayID string) string {
+	return fmt.Sprintf("presence:gateway:%s", gatewayID)
+}
+
+func (s *PresenceService) Heartbeat(ctx context.Context, gatewayID string, users map[uuid.UUID]int) error {
+	key := presenceGatewayKey(gatewayID)
+	now := time.Now()
+
+	_, err := s.redis.Client().TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, key)
+		if len(users) > 0 {
+			fields := make(map[string]interface{}, len(users))
+			for userID, count := range users {
+				fields[userID.String()] = count
+			}
+			pipe.HSet(ctx, key, fields)
+			pipe.Expire(ctx, key, presenceTTL)
+		}
+		pipe.ZAdd(ctx, presenceGatewaysKey, &redis.Z{Score: float64(now.Unix()), Member: gatewayID})
+		pipe.ZRemRangeByScore(ctx, presenceGatewaysKey, "-inf", strconv.FormatInt(now.Add(-presenceTTL).Unix(), 10))
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record presence: %w", err)
+	}
+
+	return nil
+}
+
+func (s *PresenceService) RemoveGateway(ctx context.Context, gatewayID string) error {
+	_, err := s.redis.Client().TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, presenceGatewayKey(gatewayID))
+		pipe.ZRem(ctx, presenceGatewaysKey, gatewayID)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to remove gateway presence: %w", err)
+	}
+
+	return nil
+}
+
+func (s *PresenceService) ConnectionCount(ctx context.Context, userID uuid.UUID) (int, error) {
+	cutoff := strconv.FormatInt(time.Now().Add(-presenceTTL).Unix(), 10)
+	gateways, err := s.redis.Client().ZRangeByScore(ctx, presenceGatewaysKey, &redis.ZRangeBy{Min: cutoff, Max: "+inf"}).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get live gateways: %w", err)
+	}
+
+	if len(gateways) == 0 {
+		return 0, nil
+	}
+
+	pipe := s.redis.Client().Pipeline()
+	cmds := make([]*redis.StringCmd, len(gateways))
+	for i, gatewayID := range gateways {
+		cmds[i] = pipe.HGet(ctx, presenceGatewayKey(gatewayID), userID.String())
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return 0, fmt.Errorf("failed to get presence: %w", err)
+	}
+
+	total := 0
+	for _, cmd := range cmds {
+		count, err := cmd.Int()
+		if err == nil {
+			total += count
+		}
+	}
+
+	return total, nil
+}
+
+func (s *PresenceService) IsOnline(ctx context.Context, userID uuid.UUID) (bool, error) {
+	count, err := s.ConnectionCount(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
@@ -0,0 +1,450 @@
+package services
+
+import (
+	"context"
+	"crypto-exchange-go/internal/config"
+	"crypto-exchange-go/internal/database"
+	"crypto-exchange-go/internal/models"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+// WalletReconciliation is everything a wallet's balances are checked
+// against in a reconciliation run.
+type WalletReconciliation struct {
+	Wallet          models.Wallet
+	LedgerAvailable decimal.Decimal
+	LedgerLocked    decimal.Decimal
+	// JournalAvailable is the wallet's opening balance plus the delta of
+	// every balance change recorded for it.
+	JournalAvailable decimal.Decimal
+	// ExpectedLocked is what open orders, unsettled withdrawals, held P2P
+	// escrows and active stakes say the wallet should have locked.
+	ExpectedLocked decimal.Decimal
+}
+
+func (r *WalletReconciliation) Discrepancies() []*models.Discrepancy {
+	var discrepancies []*models.Discrepancy
+
+	check := func(kind models.ReconciliationCheck, field string, expected, actual decimal.Decimal) {
+		if expected.Equal(actual) {
+			return
+		}
+		walletID, userID := r.Wallet.ID, r.Wallet.UserID
+		discrepancies = append(discrepancies, &models.Discrepancy{
+			Check:      kind,
+			WalletID:   &walletID,
+			UserID:     &userID,
+			Currency:   r.Wallet.Currency,
+			WalletType: r.Wallet.Type,
+			Field:      field,
+			Expected:   expected,
+			Actual:     actual,
+			Difference: actual.Sub(expected),
+		})
+	}
+
+	check(models.ReconciliationLedger, "balance", r.LedgerAvailable, r.Wallet.Balance)
+	check(models.ReconciliationLedger, "inOrder", r.LedgerLocked, r.Wallet.InOrder)
+	check(models.ReconciliationTransactions, "balance", r.JournalAvailable, r.Wallet.Balance)
+	check(models.ReconciliationHolds, "inOrder", r.ExpectedLocked, r.Wallet.InOrder)
+
+	return discrepancies
+}
+
+// NextDailyRun returns the next time at or after now that falls on the given
+// UTC hour.
+func NextDailyRun(now time.Time, hour int) time.Time {
+	now = now.UTC()
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, time.UTC)
+	if next.Before(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+type ReconciliationService struct {
+	mysql               *database.MySQL
+	notificationService *NotificationService
+	cfg                 config.Reconciliation
+	logger              *logrus.Logger
+}
+
+func NewReconciliationService(mysql *database.MySQL, notificationService *NotificationService, cfg config.Reconciliation, logger *logrus.Logger) *ReconciliationService {
+	return &ReconciliationService{
+		mysql:               mysql,
+		notificationService: notificationService,
+		cfg:                 cfg,
+		logger:              logger,
+	}
+}
+
+// Run checks every wallet against the ledger, its balance change history and
+// its outstanding holds, and checks ecosystem custody totals. Everything is
+// read from one snapshot, so changes committing during the run can't show
+// up as discrepancies. The report is stored, alerted on when anything is
+// off, and affected wallets are frozen if configured to.
+func (s *ReconciliationService) Run(ctx context.Context) (*models.ReconciliationReport, error) {
+	report := &models.ReconciliationReport{
+		ID:            uuid.New(),
+		StartedAt:     time.Now(),
+		Discrepancies: []*models.Discrepancy{},
+		FrozenWallets: []uuid.UUID{},
+	}
+
+	snapshot, err := s.mysql.BeginTxx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin reconciliation snapshot: %w", err)
+	}
+	defer snapshot.Rollback()
+
+	wallets, err := s.walletReconciliations(ctx, snapshot, nil)
+	if err != nil {
+		return nil, err
+	}
+	report.WalletsChecked = len(wallets)
+
+	var affected []uuid.UUID
+	for _, wallet := range wallets {
+		discrepancies := wallet.Discrepancies()
+		report.Discrepancies = append(report.Discrepancies, discrepancies...)
+		if len(discrepancies) > 0 {
+			affected = append(affected, wallet.Wallet.ID)
+		}
+	}
+
+	custody, err := s.custodyDiscrepancies(ctx, snapshot)
+	if err != nil {
+		return nil, err
+	}
+	report.Discrepancies = append(report.Discrepancies, custody...)
+
+	if err := snapshot.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to end reconciliation snapshot: %w", err)
+	}
+
+	if s.cfg.FreezeWallets {
+		for _, walletID := range affected {
+			frozen, err := s.freezeIfOff(ctx, walletID)
+			if err != nil {
+				return nil, err
+			}
+			if frozen {
+				report.FrozenWallets = append(report.FrozenWallets, walletID)
+			}
+		}
+	}
+
+	report.FinishedAt = time.Now()
+
+	if err := s.saveReport(ctx, report); err != nil {
+		return nil, err
+	}
+
+	if len(report.Discrepancies) > 0 {
+		s.alert(ctx, report)
+	}
+
+	return report, nil
+}
+
+// freezeIfOff checks a wallet flagged by the snapshot again with the wallet
+// locked, so no balance change is half way, and freezes it only if it is
+// still off. A wallet that moved on since the snapshot isn't frozen for it.
+func (s *ReconciliationService) freezeIfOff(ctx context.Context, walletID uuid.UUID) (bool, error) {
+	tx, err := s.mysql.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var userID uuid.UUID
+	if err := tx.GetContext(ctx, &userID, `SELECT userId FROM wallet WHERE id = ? FOR UPDATE`, walletID); err != nil {
+		return false, fmt.Errorf("failed to lock wallet: %w", err)
+	}
+
+	wallets, err := s.walletReconciliations(ctx, tx, &userID)
+	if err != nil {
+		return false, err
+	}
+	off := false
+	for _, wallet := range wallets {
+		if wallet.Wallet.ID == walletID {
+			off = len(wallet.Discrepancies()) > 0
+		}
+	}
+	if !off {
+		return false, nil
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE wallet SET frozen = TRUE, updatedAt = NOW() WHERE id = ?`, walletID); err != nil {
+		return false, fmt.Errorf("failed to freeze wallet: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to freeze wallet: %w", err)
+	}
+	return true, nil
+}
+
+// walletReconciliations loads every wallet's figures through q, or only
+// userID's wallets if it is set.
+func (s *ReconciliationService) walletReconciliations(ctx context.Context, q sqlx.QueryerContext, userID *uuid.UUID) ([]*WalletReconciliation, error) {
+	deltas, err := s.journalDeltas(ctx, q, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	holds, err := s.outstandingHolds(ctx, q, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT w.id, w.userId, w.type, w.currency, w.balance, w.inOrder,
+				COALESCE(SUM(CASE WHEN ll.accountType = 'WALLET' THEN IF(ll.side = 'CREDIT', ll.amount, -ll.amount) END), 0),
+				COALESCE(SUM(CASE WHEN ll.accountType = 'WALLET_HOLD' THEN IF(ll.side = 'CREDIT', ll.amount, -ll.amount) END), 0),
+				COALESCE(SUM(CASE WHEN ll.accountType = 'WALLET' AND e.referenceType = 'OPENING_BALANCE'
+					THEN IF(ll.side = 'CREDIT', ll.amount, -ll.amount) END), 0)
+			  FROM wallet w
+			  LEFT JOIN ledger_line ll ON ll.accountId = w.id AND ll.accountType IN ('WALLET', 'WALLET_HOLD')
+			  LEFT JOIN ledger_entry e ON e.id = ll.entryId
+			  WHERE ? IS NULL OR w.userId = ?
+			  GROUP BY w.id, w.userId, w.type, w.currency, w.balance, w.inOrder`
+
+	rows, err := q.QueryxContext(ctx, query, userID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load wallet ledger totals: %w", err)
+	}
+	defer rows.Close()
+
+	var wallets []*WalletReconciliation
+	for rows.Next() {
+		r := &WalletReconciliation{}
+		var opening decimal.Decimal
+		err := rows.Scan(&r.Wallet.ID, &r.Wallet.UserID, &r.Wallet.Type, &r.Wallet.Currency, &r.Wallet.Balance,
+			&r.Wallet.InOrder, &r.LedgerAvailable, &r.LedgerLocked, &opening)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan wallet ledger totals: %w", err)
+		}
+
+		r.JournalAvailable = opening.Add(deltas[r.Wallet.ID])
+		r.ExpectedLocked = holds[holdKey(r.Wallet.UserID, r.Wallet.Currency, r.Wallet.Type)]
+		wallets = append(wallets, r)
+	}
+
+	return wallets, rows.Err()
+}
+
+func (s *ReconciliationService) journalDeltas(ctx context.Context, q sqlx.QueryerContext, userID *uuid.UUID) (map[uuid.UUID]decimal.Decimal, error) {
+	rows, err := q.QueryxContext(ctx, `SELECT walletId, SUM(delta) FROM wallet_balance_event
+			WHERE ? IS NULL OR userId = ? GROUP BY walletId`, userID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum balance changes: %w", err)
+	}
+	defer rows.Close()
+
+	deltas := make(map[uuid.UUID]decimal.Decimal)
+	for rows.Next() {
+		var walletID uuid.UUID
+		var delta decimal.Decimal
+		if err := rows.Scan(&walletID, &delta); err != nil {
+			return nil, fmt.Errorf("failed to scan balance changes: %w", err)
+		}
+		deltas[walletID] = delta
+	}
+
+	return deltas, rows.Err()
+}
+
+func holdKey(userID uuid.UUID, currency string, walletType models.WalletType) string {
+	return fmt.Sprintf("%s:%s:%s", userID, currency, walletType)
+}
+
+// outstandingHolds adds up what open orders, unsettled withdrawals, held P2P
+// escrows and active stakes should have locked, keyed by holdKey. The
+// expectations come from those rows, never from the ledger's hold lines,
+// so a hold posted without its row shows up.
+func (s *ReconciliationService) outstandingHolds(ctx context.Context, q sqlx.QueryerContext, userID *uuid.UUID) (map[string]decimal.Decimal, error) {
+	holds := make(map[string]decimal.Decimal)
+
+	rows, err := q.QueryxContext(ctx, `SELECT userId, symbol, side, price, remaining FROM exchange_order
+			WHERE status = ? AND (? IS NULL OR userId = ?)`, models.OrderStatusOpen, userID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load open orders: %w", err)
+	}
+	for rows.Next() {
+		var owner uuid.UUID
+		var symbol string
+		var side models.OrderSide
+		var price, remaining decimal.Decimal
+		if err := rows.Scan(&owner, &symbol, &side, &price, &remaining); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan open order: %w", err)
+		}
+
+		currency, pair, err := splitSymbol(symbol)
+		if err != nil {
+			s.logger.WithError(err).Warn("Skipping order with invalid symbol in reconciliation")
+			continue
+		}
+		heldCurrency, amount := orderFunds(side, currency, pair, remaining, price)
+		key := holdKey(owner, heldCurrency, models.WalletTypeSpot)
+		holds[key] = holds[key].Add(amount)
+	}
+	rows.Close()
+
+	query, args, err := sqlx.In(`SELECT userId, type, currency, amount + fee FROM withdrawal
+			WHERE status IN (?) AND (? IS NULL OR userId = ?)`, models.WithdrawalHoldingStatuses, userID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build withdrawal query: %w", err)
+	}
+	if err := addHolds(ctx, q, holds, "pending withdrawals", query, args...); err != nil {
+		return nil, err
+	}
+
+	// The seller's funds are held while a trade's escrow is.
+	err = addHolds(ctx, q, holds, "P2P escrows", `SELECT t.sellerId, ?, o.currency, e.amount FROM p2p_escrow e
+			JOIN p2p_trade t ON t.id = e.tradeId
+			JOIN p2p_offer o ON o.id = t.offerId
+			WHERE e.status = 'HELD' AND (? IS NULL OR t.sellerId = ?)`, models.WalletTypeSpot, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = addHolds(ctx, q, holds, "active stakes", `SELECT l.userId, ?, p.currency, l.amount FROM staking_log l
+			JOIN staking_pool p ON p.id = l.poolId
+			WHERE l.status = 'ACTIVE' AND l.deletedAt IS NULL AND (? IS NULL OR l.userId = ?)`, models.WalletTypeSpot, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return holds, nil
+}
+
+// addHolds adds what query says is held to holds. Its rows are user id,
+// wallet type, currency and amount.
+func addHolds(ctx context.Context, q sqlx.QueryerContext, holds map[string]decimal.Decimal, what, query string, args ...interface{}) error {
+	rows, err := q.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to load %s: %w", what, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID uuid.UUID
+		var walletType models.WalletType
+		var currency string
+		var amount decimal.Decimal
+		if err := rows.Scan(&userID, &walletType, &currency, &amount); err != nil {
+			return fmt.Errorf("failed to scan %s: %w", what, err)
+		}
+		key := holdKey(userID, currency, walletType)
+		holds[key] = holds[key].Add(amount)
+	}
+	return rows.Err()
+}
+
+// custodyDiscrepancies checks, per currency, that the master wallets'
+// balances plus the private ledger's off-chain differences cover what the
+// users' ECO wallets hold.
+func (s *ReconciliationService) custodyDiscrepancies(ctx context.Context, q sqlx.QueryerContext) ([]*models.Discrepancy, error) {
+	totals := func(query string, args ...interface{}) (map[string]decimal.Decimal, error) {
+		rows, err := q.QueryxContext(ctx, query, args...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		sums := make(map[string]decimal.Decimal)
+		for rows.Next() {
+			var currency string
+			var sum decimal.Decimal
+			if err := rows.Scan(&currency, &sum); err != nil {
+				return nil, err
+			}
+			sums[currency] = sum
+		}
+		return sums, rows.Err()
+	}
+
+	master, err := totals(`SELECT currency, SUM(balance) FROM ecosystem_master_wallet GROUP BY currency`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum master wallets: %w", err)
+	}
+	differences, err := totals(`SELECT currency, SUM(offchainDifference) FROM ecosystem_private_ledger GROUP BY currency`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum private ledger: %w", err)
+	}
+	custodial, err := totals(`SELECT currency, SUM(balance + inOrder) FROM wallet WHERE type = ? GROUP BY currency`, models.WalletTypeEco)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum custodial wallets: %w", err)
+	}
+
+	var discrepancies []*models.Discrepancy
+	for currency, balance := range master {
+		expected := custodial[currency]
+		actual := balance.Add(differences[currency])
+		if expected.Equal(actual) {
+			continue
+		}
+		discrepancies = append(discrepancies, &models.Discrepancy{
+			Check:      models.ReconciliationCustody,
+			Currency:   currency,
+			Field:      "balance",
+			Expected:   expected,
+			Actual:     actual,
+			Difference: actual.Sub(expected),
+		})
+	}
+
+	return discrepancies, nil
+}
+
+func (s *ReconciliationService) saveReport(ctx context.Context, report *models.ReconciliationReport) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to marshal reconciliation report: %w", err)
+	}
+
+	query := `INSERT INTO reconciliation_report (id, startedAt, finishedAt, walletsChecked, discrepancies, frozenWallets, report)
+			  VALUES (?, ?, ?, ?, ?, ?, ?)`
+	_, err = s.mysql.ExecContext(ctx, query, report.ID, report.StartedAt, report.FinishedAt, report.WalletsChecked,
+		len(report.Discrepancies), len(report.FrozenWallets), string(data))
+	if err != nil {
+		return fmt.Errorf("failed to save reconciliation report: %w", err)
+	}
+
+	return nil
+}
+
+func (s *ReconciliationService) alert(ctx context.Context, report *models.ReconciliationReport) {
+	title := "Wallet reconciliation found discrepancies"
+	message := fmt.Sprintf("%d discrepancies across %d wallets checked; %d wallets frozen",
+		len(report.Discrepancies), report.WalletsChecked, len(report.FrozenWallets))
+	metadata := map[string]interface{}{
+		"reportId": report.ID,
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"reportId":      report.ID,
+		"discrepancies": len(report.Discrepancies),
+		"frozenWallets": len(report.FrozenWallets),
+	}).Warn(title)
+
+	for _, id := range s.cfg.AlertUserIDs {
+		userID, err := uuid.Parse(id)
+		if err != nil {
+			s.logger.WithField("userId", id).Error("Invalid reconciliation alert user ID")
+			continue
+		}
+		if err := s.notificationService.CreateNotification(ctx, userID, "SYSTEM", title, message, metadata); err != nil {
+			s.logger.WithError(err).WithField("userId", userID).Error("Failed to send reconciliation alert")
+		}
+	}
+}
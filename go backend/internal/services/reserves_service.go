@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"crypto-exchange-go/internal/database"
+	"crypto-exchange-go/internal/models"
+	"crypto-exchange-go/internal/reserves"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+const reserveProofBatchSize = 500
+
+type ReservesService struct {
+	mysql  *database.MySQL
+	logger *logrus.Logger
+}
+
+func NewReservesService(mysql *database.MySQL, logger *logrus.Logger) *ReservesService {
+	return &ReservesService{
+		mysql:  mysql,
+		logger: logger,
+	}
+}
+
+// CreateSnapshot commits every user's liabilities to a new Merkle sum tree
+// and stores the root, the totals and each user's inclusion proof.
+func (s *ReservesService) CreateSnapshot(ctx context.Context) (*models.ReserveSnapshot, error) {
+	leaves, err := s.liabilities(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := reserves.Build(leaves)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build reserve tree: %w", err)
+	}
+
+	root := tree.Root()
+	snapshot := &models.ReserveSnapshot{
+		ID:        uuid.New(),
+		RootHash:  root.Hash,
+		Totals:    root.Sums,
+		UserCount: len(leaves),
+		CreatedAt: time.Now(),
+	}
+
+	totals, err := json.Marshal(snapshot.Totals)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal reserve totals: %w", err)
+	}
+
+	tx, err := s.mysql.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO reserve_snapshot (id, rootHash, totals, userCount, createdAt) VALUES (?, ?, ?, ?, ?)`,
+		snapshot.ID, snapshot.RootHash, string(totals), snapshot.UserCount, snapshot.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save reserve snapshot: %w", err)
+	}
+
+	for start := 0; start < len(leaves); start += reserveProofBatchSize {
+		end := start + reserveProofBatchSize
+		if end > len(leaves) {
+			end = len(leaves)
+		}
+		if err := s.saveProofs(ctx, tx, snapshot.ID, tree, start, end); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit reserve snapshot: %w", err)
+	}
+
+	return snapshot, nil
+}
+
+// liabilities reads what each user is owed per currency, available plus
+// locked, and gives each user a fresh salt.
+func (s *ReservesService) liabilities(ctx context.Context) ([]reserves.Leaf, error) {
+	query := `SELECT userId, currency, SUM(balance + inOrder) FROM wallet
+			  GROUP BY userId, currency HAVING SUM(balance + inOrder) <> 0
+			  ORDER BY userId, currency`
+	rows, err := s.mysql.QueryxContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get liabilities: %w", err)
+	}
+	defer rows.Close()
+
+	var leaves []reserves.Leaf
+	for rows.Next() {
+		var userID, currency string
+		var amount decimal.Decimal
+		if err := rows.Scan(&userID, &currency, &amount); err != nil {
+			return nil, fmt.Errorf("failed to scan liability: %w", err)
+		}
+
+		if len(leaves) == 0 || leaves[len(leaves)-1].UserID != userID {
+			salt, err := newSalt()
+			if err != nil {
+				return nil, err
+			}
+			leaves = append(leaves, reserves.Leaf{UserID: userID, Salt: salt, Balances: reserves.Balances{}})
+		}
+		leaves[len(leaves)-1].Balances[currency] = amount
+	}
+
+	return leaves, rows.Err()
+}
+
+func newSalt() (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+	return hex.EncodeToString(salt), nil
+}
+
+func (s *ReservesService) saveProofs(ctx context.Context, tx *sqlx.Tx, snapshotID uuid.UUID, tree *reserves.Tree, start, end int) error {
+	values := make([]string, 0, end-start)
+	args := make([]interface{}, 0, (end-start)*4)
+	for i := start; i < end; i++ {
+		proof, err := tree.Proof(i)
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(proof)
+		if err != nil {
+			return fmt.Errorf("failed to marshal reserve proof: %w", err)
+		}
+		values = append(values, "(?, ?, ?, ?)")
+		args = append(args, snapshotID, proof.UserID, i, string(data))
+	}
+
+	query := `INSERT INTO reserve_proof (snapshotId, userId, leafIndex, proof) VALUES ` + strings.Join(values, ", ")
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to save reserve proofs: %w", err)
+	}
+
+	return nil
+}
+
+func (s *ReservesService) LatestSnapshot(ctx context.Context) (*models.ReserveSnapshot, error) {
+	query := `SELECT id, rootHash, totals, userCount, createdAt FROM reserve_snapshot ORDER BY createdAt DESC LIMIT 1`
+
+	snapshot := &models.ReserveSnapshot{}
+	var totals string
+	err := s.mysql.QueryRowxContext(ctx, query).Scan(&snapshot.ID, &snapshot.RootHash, &totals, &snapshot.UserCount, &snapshot.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reserve snapshot: %w", err)
+	}
+
+	if err := json.Unmarshal([]byte(totals), &snapshot.Totals); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal reserve totals: %w", err)
+	}
+
+	return snapshot, nil
+}
+
+// GetProof returns the user's inclusion proof in the latest snapshot along
+// with the root it verifies against.
+func (s *ReservesService) GetProof(ctx context.Context, userID uuid.UUID) (*models.ReserveProofResponse, error) {
+	snapshot, err := s.LatestSnapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var data string
+	err = s.mysql.QueryRowxContext(ctx, `SELECT proof FROM reserve_proof WHERE snapshotId = ? AND userId = ?`,
+		snapshot.ID, userID).Scan(&data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reserve proof: %w", err)
+	}
+
+	proof := &reserves.Proof{}
+	if err := json.Unmarshal([]byte(data), proof); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal reserve proof: %w", err)
+	}
+
+	return &models.ReserveProofResponse{Snapshot: snapshot, Proof: proof}, nil
+}
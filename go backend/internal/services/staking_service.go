@@ -12,14 +12,16 @@ import (
 )
 
 type StakingService struct {
-	db     *gorm.DB
-	logger *logrus.Logger
+	db            *gorm.DB
+	walletService *WalletService
+	logger        *logrus.Logger
 }
 
-func NewStakingService(db *gorm.DB, logger *logrus.Logger) *StakingService {
+func NewStakingService(db *gorm.DB, walletService *WalletService, logger *logrus.Logger) *StakingService {
 	return &StakingService{
-		db:     db,
-		logger: logger,
+		db:            db,
+		walletService: walletService,
+		logger:        logger,
 	}
 }
 
@@ -125,7 +127,8 @@ func (s *StakingService) CreateDuration(ctx context.Context, duration *models.St
 }
 
 func (s *StakingService) CreateStake(ctx context.Context, stake *models.StakingLog) error {
-	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+	var stakeWallet *models.WalletResponse
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		var pool models.StakingPool
 		err := tx.First(&pool, "id = ?", stake.PoolID).Error
 		if err != nil {
@@ -151,8 +154,28 @@ func (s *StakingService) CreateStake(ctx context.Context, stake *models.StakingL
 		reward := stake.Amount.Mul(duration.InterestRate).Div(decimal.NewFromInt(100))
 		stake.Reward = reward
 		
+		wallet, err := s.walletService.GetWallet(ctx, stake.UserID, pool.Currency, models.WalletTypeSpot)
+		if err != nil {
+			return err
+		}
+		
+		err = s.walletService.Hold(ctx, wallet.ID, stake.Amount, models.BalanceReasonStaking, stake.ID.String())
+		if err != nil {
+			return err
+		}
+		stakeWallet = wallet
+		
 		return tx.Create(stake).Error
 	})
+	
+	if err != nil && stakeWallet != nil {
+		releaseErr := s.walletService.Release(ctx, stakeWallet.ID, stake.Amount, models.BalanceReasonStaking, stake.ID.String())
+		if releaseErr != nil {
+			s.logger.WithError(releaseErr).WithField("stakeId", stake.ID).Error("Failed to release stake hold")
+		}
+	}
+	
+	return err
 }
 
 func (s *StakingService) GetStakes(ctx context.Context, userID *uuid.UUID, poolID *uuid.UUID, status string) ([]models.StakingLog, error) {
@@ -243,6 +266,20 @@ func (s *StakingService) ReleaseStake(ctx context.Context, stakeID uuid.UUID) er
 			return err
 		}
 		
+		wallet, err := s.stakeWallet(ctx, tx, &stake)
+		if err != nil {
+			return err
+		}
+		
+		err = s.walletService.Release(ctx, wallet.ID, stake.Amount, models.BalanceReasonStaking, stake.ID.String())
+		if err != nil {
+			return err
+		}
+		
+		if stake.Reward.IsPositive() {
+			return s.walletService.UpdateBalance(ctx, wallet.ID, stake.Reward, models.BalanceReasonStakingReward, stake.ID.String())
+		}
+		
 		return nil
 	})
 }
@@ -269,6 +306,32 @@ func (s *StakingService) CancelStake(ctx context.Context, userID, stakeID uuid.U
 			"updated_at": time.Now(),
 		}).Error
 		
-		return err
+		if err != nil {
+			return err
+		}
+		
+		wallet, err := s.stakeWallet(ctx, tx, &stake)
+		if err != nil {
+			return err
+		}
+		
+		if penalty.IsPositive() {
+			err = s.walletService.Capture(ctx, wallet.ID, penalty, models.BalanceReasonStaking, stake.ID.String())
+			if err != nil {
+				return err
+			}
+		}
+		
+		return s.walletService.Release(ctx, wallet.ID, refundAmount, models.BalanceReasonStaking, stake.ID.String())
 	})
 }
+
+func (s *StakingService) stakeWallet(ctx context.Context, tx *gorm.DB, stake *models.StakingLog) (*models.WalletResponse, error) {
+	var pool models.StakingPool
+	err := tx.First(&pool, "id = ?", stake.PoolID).Error
+	if err != nil {
+		return nil, err
+	}
+	
+	return s.walletService.GetWallet(ctx, stake.UserID, pool.Currency, models.WalletTypeSpot)
+}
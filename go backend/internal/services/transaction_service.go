@@ -4,10 +4,13 @@ import (
 	"context"
 	"crypto-exchange-go/internal/database"
 	"crypto-exchange-go/internal/models"
+	"database/sql"
+	"encoding/json"
 	"fmt"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
 	"github.com/sirupsen/logrus"
 )
 
@@ -23,61 +26,135 @@ func NewTransactionService(mysql *database.MySQL, logger *logrus.Logger) *Transa
 	}
 }
 
-func (s *TransactionService) GetTransactions(ctx context.Context, userID uuid.UUID, transactionType, status string, limit, offset int) ([]*models.TransactionResponse, error) {
-	query := `SELECT id, userId, type, status, currency, amount, fee, description, 
-			  referenceId, metadata, createdAt, updatedAt 
-			  FROM transaction WHERE userId = ?`
+const transactionColumns = `id, userId, type, status, currency, walletType, amount, direction, fee, description,
+			  referenceId, metadata, createdAt, updatedAt`
+
+// transactionConditions turns a filter into the WHERE clause shared by the
+// history, the export and the analysis. The cursor and limit are left to the
+// caller.
+func transactionConditions(userID uuid.UUID, filter models.TransactionFilter) (string, []interface{}) {
+	where := "userId = ?"
 	args := []interface{}{userID}
 
-	if transactionType != "" {
-		query += " AND type = ?"
-		args = append(args, transactionType)
+	for _, condition := range []struct {
+		column string
+		value  string
+	}{
+		{"type", filter.Type},
+		{"status", filter.Status},
+		{"currency", filter.Currency},
+		{"walletType", filter.WalletType},
+		{"referenceId", filter.ReferenceID},
+	} {
+		if condition.value != "" {
+			where += " AND " + condition.column + " = ?"
+			args = append(args, condition.value)
+		}
 	}
 
-	if status != "" {
-		query += " AND status = ?"
-		args = append(args, status)
+	if filter.From != nil {
+		where += " AND createdAt >= ?"
+		args = append(args, *filter.From)
+	}
+
+	if filter.To != nil {
+		where += " AND createdAt < ?"
+		args = append(args, *filter.To)
+	}
+
+	return where, args
+}
+
+func scanTransaction(rows *sqlx.Rows) (*models.Transaction, error) {
+	transaction := &models.Transaction{}
+	var metadata []byte
+	err := rows.Scan(&transaction.ID, &transaction.UserID, &transaction.Type, &transaction.Status,
+		&transaction.Currency, &transaction.WalletType, &transaction.Amount, &transaction.Direction, &transaction.Fee, &transaction.Description,
+		&transaction.ReferenceID, &metadata, &transaction.CreatedAt, &transaction.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan transaction: %w", err)
+	}
+
+	if len(metadata) > 0 {
+		if err := json.Unmarshal(metadata, &transaction.Metadata); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal transaction metadata: %w", err)
+		}
+	}
+
+	return transaction, nil
+}
+
+// GetTransactions returns one page of the user's history, newest first. It
+// pages by (createdAt, id) rather than OFFSET so pages stay stable while new
+// transactions arrive and deep pages cost the same as the first.
+func (s *TransactionService) GetTransactions(ctx context.Context, userID uuid.UUID, filter models.TransactionFilter) (*models.TransactionPage, error) {
+	where, args := transactionConditions(userID, filter)
+
+	if filter.Cursor != nil {
+		where += " AND (createdAt < ? OR (createdAt = ? AND id < ?))"
+		args = append(args, filter.Cursor.CreatedAt, filter.Cursor.CreatedAt, filter.Cursor.ID)
 	}
 
-	query += " ORDER BY createdAt DESC LIMIT ? OFFSET ?"
-	args = append(args, limit, offset)
+	// One extra row tells us whether there is a next page.
+	query := `SELECT ` + transactionColumns + ` FROM transaction WHERE ` + where + ` ORDER BY createdAt DESC, id DESC LIMIT ?`
+	args = append(args, filter.Limit+1)
 
-	rows, err := s.mysql.Query(query, args...)
+	rows, err := s.mysql.QueryxContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query transactions: %w", err)
 	}
 	defer rows.Close()
 
-	var transactions []*models.TransactionResponse
+	page := &models.TransactionPage{Items: []*models.TransactionResponse{}}
+	var last *models.Transaction
 	for rows.Next() {
-		transaction := &models.Transaction{}
-		err := rows.Scan(&transaction.ID, &transaction.UserID, &transaction.Type, &transaction.Status,
-			&transaction.Currency, &transaction.Amount, &transaction.Fee, &transaction.Description,
-			&transaction.ReferenceID, &transaction.Metadata, &transaction.CreatedAt, &transaction.UpdatedAt)
+		transaction, err := scanTransaction(rows)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan transaction: %w", err)
+			return nil, err
+		}
+
+		if len(page.Items) == filter.Limit {
+			page.NextCursor = models.TransactionCursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+			break
 		}
-		transactions = append(transactions, transaction.ToResponse())
+
+		page.Items = append(page.Items, transaction.ToResponse())
+		last = transaction
 	}
 
-	return transactions, nil
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read transactions: %w", err)
+	}
+
+	return page, nil
 }
 
 func (s *TransactionService) GetTransaction(ctx context.Context, userID, transactionID uuid.UUID) (*models.TransactionResponse, error) {
-	query := `SELECT id, userId, type, status, currency, amount, fee, description, 
-			  referenceId, metadata, createdAt, updatedAt 
-			  FROM transaction WHERE id = ? AND userId = ?`
+	query := `SELECT ` + transactionColumns + ` FROM transaction WHERE id = ? AND userId = ?`
 
-	transaction := &models.Transaction{}
-	err := s.mysql.Get(transaction, query, transactionID, userID)
+	rows, err := s.mysql.QueryxContext(ctx, query, transactionID, userID)
 	if err != nil {
-		return nil, fmt.Errorf("transaction not found: %w", err)
+		return nil, fmt.Errorf("failed to query transaction: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, fmt.Errorf("transaction not found: %w", sql.ErrNoRows)
+	}
+
+	transaction, err := scanTransaction(rows)
+	if err != nil {
+		return nil, err
 	}
 
 	return transaction.ToResponse(), nil
 }
 
-func (s *TransactionService) AnalyzeTransactions(ctx context.Context, userID uuid.UUID, startDate, endDate, transactionType string) (*models.TransactionAnalysis, error) {
+// AnalyzeTransactions totals the user's transactions per type and currency
+// between two dates, both inclusive. Sums are computed by the database on the
+// DECIMAL columns and read back as decimals so nothing is lost to float
+// rounding. Debits count negative, so a type's total is its net amount.
+func (s *TransactionService) AnalyzeTransactions(ctx context.Context, userID uuid.UUID, startDate, endDate string, filter models.TransactionFilter) (*models.TransactionAnalysis, error) {
 	start, err := time.Parse("2006-01-02", startDate)
 	if err != nil {
 		return nil, fmt.Errorf("invalid start date: %w", err)
@@ -88,19 +165,16 @@ func (s *TransactionService) AnalyzeTransactions(ctx context.Context, userID uui
 		return nil, fmt.Errorf("invalid end date: %w", err)
 	}
 
-	query := `SELECT type, currency, SUM(amount) as total_amount, COUNT(*) as count
-			  FROM transaction 
-			  WHERE userId = ? AND createdAt BETWEEN ? AND ?`
-	args := []interface{}{userID, start, end}
+	until := end.AddDate(0, 0, 1)
+	filter.From = &start
+	filter.To = &until
+	where, args := transactionConditions(userID, filter)
 
-	if transactionType != "" {
-		query += " AND type = ?"
-		args = append(args, transactionType)
-	}
-
-	query += " GROUP BY type, currency ORDER BY total_amount DESC"
+	query := `SELECT type, currency, SUM(IF(direction <=> 'DEBIT', -amount, amount)) as total_amount, SUM(fee) as total_fee, COUNT(*) as count
+			  FROM transaction WHERE ` + where + `
+			  GROUP BY type, currency ORDER BY total_amount DESC`
 
-	rows, err := s.mysql.Query(query, args...)
+	rows, err := s.mysql.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to analyze transactions: %w", err)
 	}
@@ -113,23 +187,15 @@ func (s *TransactionService) AnalyzeTransactions(ctx context.Context, userID uui
 	}
 
 	for rows.Next() {
-		var txType, currency string
-		var totalAmount float64
-		var count int
-
-		err := rows.Scan(&txType, &currency, &totalAmount, &count)
+		summary := &models.TransactionSummary{}
+		err := rows.Scan(&summary.Type, &summary.Currency, &summary.TotalAmount, &summary.TotalFee, &summary.Count)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan analysis result: %w", err)
 		}
 
-		key := fmt.Sprintf("%s_%s", txType, currency)
-		analysis.Summary[key] = &models.TransactionSummary{
-			Type:        txType,
-			Currency:    currency,
-			TotalAmount: totalAmount,
-			Count:       count,
-		}
+		key := fmt.Sprintf("%s_%s", summary.Type, summary.Currency)
+		analysis.Summary[key] = summary
 	}
 
-	return analysis, nil
+	return analysis, rows.Err()
 }
@@ -0,0 +1,348 @@
+package services
+
+import (
+	"context"
+	"crypto-exchange-go/internal/config"
+	"crypto-exchange-go/internal/database"
+	"crypto-exchange-go/internal/ledger"
+	"crypto-exchange-go/internal/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+var ErrTransferNotAllowed = errors.New("transfer not allowed")
+
+// TransferRules decides which currencies each wallet type may hold. FIAT
+// wallets hold fiat currencies only, FUTURES wallets hold margin currencies
+// only, and SPOT wallets hold everything that isn't fiat. It also carries the
+// per-currency limits for sending to other users, keyed by lowercase currency.
+type TransferRules struct {
+	fiat              map[string]bool
+	futures           map[string]bool
+	userDailyLimits   map[string]decimal.Decimal
+	userOTPThresholds map[string]decimal.Decimal
+}
+
+func NewTransferRules(cfg config.Transfer) TransferRules {
+	rules := TransferRules{
+		fiat:              make(map[string]bool),
+		futures:           make(map[string]bool),
+		userDailyLimits:   make(map[string]decimal.Decimal),
+		userOTPThresholds: make(map[string]decimal.Decimal),
+	}
+	for _, currency := range cfg.FiatCurrencies {
+		rules.fiat[strings.ToUpper(currency)] = true
+	}
+	for _, currency := range cfg.FuturesCurrencies {
+		rules.futures[strings.ToUpper(currency)] = true
+	}
+	for currency, limit := range cfg.UserDailyLimits {
+		rules.userDailyLimits[strings.ToLower(currency)] = decimal.NewFromFloat(limit)
+	}
+	for currency, threshold := range cfg.UserOTPThresholds {
+		rules.userOTPThresholds[strings.ToLower(currency)] = decimal.NewFromFloat(threshold)
+	}
+	return rules
+}
+
+func (r TransferRules) Holds(walletType models.WalletType, currency string) bool {
+	currency = strings.ToUpper(currency)
+
+	switch walletType {
+	case models.WalletTypeFiat:
+		return r.fiat[currency]
+	case models.WalletTypeFutures:
+		return r.futures[currency]
+	case models.WalletTypeSpot:
+		return !r.fiat[currency]
+	default:
+		return false
+	}
+}
+
+func (r TransferRules) Validate(req *models.CreateTransferRequest) error {
+	if !req.Amount.IsPositive() {
+		return fmt.Errorf("%w: amount must be positive", ErrTransferNotAllowed)
+	}
+	if req.FromType == req.ToType {
+		return fmt.Errorf("%w: source and destination wallet types are the same", ErrTransferNotAllowed)
+	}
+	if !r.Holds(req.FromType, req.Currency) {
+		return fmt.Errorf("%w: %s wallets can't hold %s", ErrTransferNotAllowed, req.FromType, req.Currency)
+	}
+	if !r.Holds(req.ToType, req.Currency) {
+		return fmt.Errorf("%w: %s wallets can't hold %s", ErrTransferNotAllowed, req.ToType, req.Currency)
+	}
+	return nil
+}
+
+type TransferService struct {
+	mysql               *database.MySQL
+	walletService       *WalletService
+	userService         *UserService
+	notificationService *NotificationService
+	rules               TransferRules
+	logger              *logrus.Logger
+}
+
+func NewTransferService(mysql *database.MySQL, walletService *WalletService, userService *UserService, notificationService *NotificationService, cfg config.Transfer, logger *logrus.Logger) *TransferService {
+	return &TransferService{
+		mysql:               mysql,
+		walletService:       walletService,
+		userService:         userService,
+		notificationService: notificationService,
+		rules:               NewTransferRules(cfg),
+		logger:              logger,
+	}
+}
+
+// transferLeg is one side of a move between two wallets. A leg with a
+// TransactionType gets a row in the owner's transaction history.
+type transferLeg struct {
+	UserID          uuid.UUID
+	WalletID        uuid.UUID
+	WalletType      models.WalletType
+	TransactionType string
+	Description     string
+}
+
+type walletMove struct {
+	ID        uuid.UUID
+	Reason    models.BalanceChangeReason
+	Currency  string
+	Amount    decimal.Decimal
+	From      transferLeg
+	To        transferLeg
+	Metadata  map[string]interface{}
+	CreatedAt time.Time
+	// Record writes the row describing the move. It runs after both wallets
+	// are locked, so checks it makes against earlier moves are race-free.
+	Record func(ctx context.Context, tx *sqlx.Tx) error
+}
+
+// Transfer moves funds between two of the user's own wallets as a single
+// ledger entry. Replaying the same idempotency key returns the original
+// transfer instead of moving funds again.
+func (s *TransferService) Transfer(ctx context.Context, userID uuid.UUID, req *models.CreateTransferRequest, idempotencyKey string) (*models.WalletTransferResponse, error) {
+	req.Currency = strings.ToUpper(req.Currency)
+	if err := s.rules.Validate(req); err != nil {
+		return nil, err
+	}
+
+	if idempotencyKey == "" {
+		idempotencyKey = uuid.New().String()
+	} else if existing, err := s.getTransfer(ctx, userID, idempotencyKey); err == nil {
+		return existing.ToResponse(), nil
+	}
+
+	from, err := s.walletService.GetWallet(ctx, userID, req.Currency, req.FromType)
+	if err != nil {
+		return nil, fmt.Errorf("source wallet not found: %w", err)
+	}
+
+	to, err := s.walletService.GetOrCreateWallet(ctx, userID, req.Currency, req.ToType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get destination wallet: %w", err)
+	}
+
+	transfer := &models.WalletTransfer{
+		ID:             uuid.New(),
+		UserID:         userID,
+		FromWalletID:   from.ID,
+		ToWalletID:     to.ID,
+		FromType:       req.FromType,
+		ToType:         req.ToType,
+		Currency:       req.Currency,
+		Amount:         req.Amount,
+		IdempotencyKey: idempotencyKey,
+		CreatedAt:      time.Now(),
+	}
+
+	err = s.move(ctx, &walletMove{
+		ID:       transfer.ID,
+		Reason:   models.BalanceReasonTransfer,
+		Currency: transfer.Currency,
+		Amount:   transfer.Amount,
+		From: transferLeg{
+			UserID:          userID,
+			WalletID:        from.ID,
+			WalletType:      req.FromType,
+			TransactionType: string(models.BalanceReasonTransfer),
+			Description:     fmt.Sprintf("Transfer %s from %s to %s", transfer.Currency, transfer.FromType, transfer.ToType),
+		},
+		To: transferLeg{UserID: userID, WalletID: to.ID, WalletType: req.ToType},
+		Metadata: map[string]interface{}{
+			"fromType": transfer.FromType,
+			"toType":   transfer.ToType,
+		},
+		CreatedAt: transfer.CreatedAt,
+		Record: func(ctx context.Context, tx *sqlx.Tx) error {
+			query := `INSERT INTO wallet_transfer (id, userId, fromWalletId, toWalletId, fromType, toType, currency, amount, idempotencyKey, createdAt)
+					  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+			_, err := tx.ExecContext(ctx, query, transfer.ID, transfer.UserID, transfer.FromWalletID, transfer.ToWalletID,
+				transfer.FromType, transfer.ToType, transfer.Currency, transfer.Amount, transfer.IdempotencyKey, transfer.CreatedAt)
+			return err
+		},
+	})
+	if errors.Is(err, ledger.ErrDuplicateEntry) {
+		existing, getErr := s.getTransfer(ctx, userID, idempotencyKey)
+		if getErr != nil {
+			return nil, fmt.Errorf("failed to load existing transfer: %w", getErr)
+		}
+		return existing.ToResponse(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return transfer.ToResponse(), nil
+}
+
+// move debits one wallet and credits another in a single transaction and
+// ledger entry, then publishes the balance events for both wallets.
+func (s *TransferService) move(ctx context.Context, move *walletMove) error {
+	tx, err := s.mysql.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Lock both rows in id order so opposite-direction moves can't deadlock.
+	rows, err := tx.QueryxContext(ctx, `SELECT id, balance, frozen FROM wallet WHERE id IN (?, ?) ORDER BY id FOR UPDATE`,
+		move.From.WalletID, move.To.WalletID)
+	if err != nil {
+		return fmt.Errorf("failed to lock wallets: %w", err)
+	}
+	available := decimal.Zero
+	sourceFrozen := false
+	for rows.Next() {
+		var id uuid.UUID
+		var balance decimal.Decimal
+		var frozen bool
+		if err := rows.Scan(&id, &balance, &frozen); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan wallet: %w", err)
+		}
+		if id == move.From.WalletID {
+			available = balance
+			sourceFrozen = frozen
+		}
+	}
+	rows.Close()
+
+	if sourceFrozen {
+		return ErrWalletFrozen
+	}
+	if available.LessThan(move.Amount) {
+		return ErrInsufficientBalance
+	}
+
+	if err := move.Record(ctx, tx); err != nil {
+		if isDuplicateKey(err) {
+			return ledger.ErrDuplicateEntry
+		}
+		return err
+	}
+
+	entry := &ledger.Entry{
+		ReferenceType:  string(move.Reason),
+		ReferenceID:    move.ID.String(),
+		IdempotencyKey: fmt.Sprintf("%s:%s", move.Reason, move.ID),
+		Description:    move.From.Description,
+		Lines: ledger.Transfer(ledger.WalletAccount(move.From.WalletID), ledger.WalletAccount(move.To.WalletID),
+			move.Currency, move.Amount),
+		CreatedAt: move.CreatedAt,
+	}
+	if err := s.walletService.balances.ledger.Post(ctx, tx, entry); err != nil {
+		return fmt.Errorf("failed to post ledger entry: %w", err)
+	}
+
+	metadata, err := json.Marshal(move.Metadata)
+	if err != nil {
+		return fmt.Errorf("failed to marshal transfer metadata: %w", err)
+	}
+
+	legs := []struct {
+		transferLeg
+		delta decimal.Decimal
+	}{{move.From, move.Amount.Neg()}, {move.To, move.Amount}}
+	// Recording an event locks the user's sequence counter; taking the two
+	// users' counters in a fixed order keeps crossing transfers from
+	// deadlocking.
+	if legs[1].UserID.String() < legs[0].UserID.String() {
+		legs[0], legs[1] = legs[1], legs[0]
+	}
+
+	events := make([]*models.BalanceEvent, 0, 2)
+	for _, leg := range legs {
+		event := &models.BalanceEvent{
+			UserID:      leg.UserID,
+			WalletID:    leg.WalletID,
+			Currency:    move.Currency,
+			WalletType:  leg.WalletType,
+			Delta:       leg.delta,
+			Operation:   models.BalanceOperationAdjust,
+			Reason:      move.Reason,
+			ReferenceID: move.ID.String(),
+			CreatedAt:   move.CreatedAt,
+		}
+		if err := s.walletService.balances.record(ctx, tx, event); err != nil {
+			return err
+		}
+		events = append(events, event)
+
+		if leg.TransactionType == "" {
+			continue
+		}
+
+		direction := models.TransactionDirectionCredit
+		if leg.delta.IsNegative() {
+			direction = models.TransactionDirectionDebit
+		}
+
+		query := `INSERT INTO transaction (id, userId, type, status, currency, walletType, amount, direction, fee, description, referenceId, metadata, createdAt, updatedAt)
+				  VALUES (?, ?, ?, 'COMPLETED', ?, ?, ?, ?, 0, ?, ?, ?, ?, ?)`
+		_, err = tx.ExecContext(ctx, query, uuid.New(), leg.UserID, leg.TransactionType, move.Currency, leg.WalletType, move.Amount,
+			direction, leg.Description, move.ID.String(), string(metadata), move.CreatedAt, move.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to record transaction: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transfer: %w", err)
+	}
+
+	for _, event := range events {
+		s.walletService.balances.publish(ctx, event)
+	}
+
+	return nil
+}
+
+func (s *TransferService) getTransfer(ctx context.Context, userID uuid.UUID, idempotencyKey string) (*models.WalletTransfer, error) {
+	query := `SELECT id, userId, fromWalletId, toWalletId, fromType, toType, currency, amount, idempotencyKey, createdAt
+			  FROM wallet_transfer WHERE userId = ? AND idempotencyKey = ?`
+
+	transfer := &models.WalletTransfer{}
+	err := s.mysql.GetContext(ctx, transfer, query, userID, idempotencyKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transfer: %w", err)
+	}
+
+	return transfer, nil
+}
+
+func isDuplicateKey(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1062
+}
@@ -4,10 +4,15 @@ import (
 	"context"
 	"crypto-exchange-go/internal/database"
 	"crypto-exchange-go/internal/models"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
 	"encoding/base32"
+	"encoding/binary"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
@@ -132,15 +137,11 @@ func (s *UserService) SetupOTP(ctx context.Context, userID uuid.UUID) (string, s
 }
 
 func (s *UserService) VerifyOTP(ctx context.Context, userID uuid.UUID, code string) (bool, error) {
-	query := `SELECT JSON_EXTRACT(metadata, '$.otpSecret') FROM user WHERE id = ?`
-
-	var secret string
-	err := s.mysql.Get(&secret, query, userID)
+	valid, err := s.CheckOTP(ctx, userID, code)
 	if err != nil {
-		return false, fmt.Errorf("failed to get OTP secret: %w", err)
+		return false, err
 	}
 
-	valid := s.validateOTPCode(secret, code)
 	if valid {
 		updateQuery := `UPDATE user SET twoFactor = true WHERE id = ?`
 		_, err := s.mysql.Exec(updateQuery, userID)
@@ -152,6 +153,57 @@ func (s *UserService) VerifyOTP(ctx context.Context, userID uuid.UUID, code stri
 	return valid, nil
 }
 
+// CheckOTP validates a code against the user's OTP secret without changing
+// their 2FA settings.
+func (s *UserService) CheckOTP(ctx context.Context, userID uuid.UUID, code string) (bool, error) {
+	query := `SELECT COALESCE(JSON_UNQUOTE(JSON_EXTRACT(metadata, '$.otpSecret')), '') FROM user WHERE id = ?`
+
+	var secret string
+	err := s.mysql.GetContext(ctx, &secret, query, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to get OTP secret: %w", err)
+	}
+
+	if secret == "" {
+		return false, nil
+	}
+
+	return s.validateOTPCode(secret, code), nil
+}
+
+func (s *UserService) TwoFactorEnabled(ctx context.Context, userID uuid.UUID) (bool, error) {
+	var enabled bool
+	err := s.mysql.GetContext(ctx, &enabled, `SELECT twoFactor FROM user WHERE id = ?`, userID)
+	if err != nil {
+		return false, fmt.Errorf("user not found: %w", err)
+	}
+
+	return enabled, nil
+}
+
+// FindUser looks a user up by UID, email or phone number.
+func (s *UserService) FindUser(ctx context.Context, identifier string) (*models.User, error) {
+	identifier = strings.TrimSpace(identifier)
+
+	column := "phone"
+	var arg interface{} = identifier
+	if id, err := uuid.Parse(identifier); err == nil {
+		column, arg = "id", id
+	} else if strings.Contains(identifier, "@") {
+		column = "email"
+	}
+
+	query := fmt.Sprintf(`SELECT id, firstName, lastName, email, status FROM user WHERE %s = ? AND deletedAt IS NULL`, column)
+
+	user := &models.User{}
+	err := s.mysql.GetContext(ctx, user, query, arg)
+	if err != nil {
+		return nil, fmt.Errorf("user not found: %w", err)
+	}
+
+	return user, nil
+}
+
 func (s *UserService) getUserByEmail(email string) (*models.User, error) {
 	query := `SELECT id, firstName, lastName, email FROM user WHERE email = ?`
 
@@ -175,5 +227,32 @@ func (s *UserService) generateQRCode(secret string, userID uuid.UUID) string {
 }
 
 func (s *UserService) validateOTPCode(secret, code string) bool {
-	return true
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.TrimRight(strings.ToUpper(secret), "="))
+	if err != nil || len(code) != 6 {
+		return false
+	}
+
+	// Accept the previous and next 30s step to allow for clock drift.
+	step := time.Now().Unix() / 30
+	for _, offset := range []int64{-1, 0, 1} {
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step+offset)), []byte(code)) == 1 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func totpCode(key []byte, counter int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%06d", value%1000000)
 }
@@ -0,0 +1,315 @@
+package services
+
+import (
+	"context"
+	"crypto-exchange-go/internal/ledger"
+	"crypto-exchange-go/internal/models"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/shopspring/decimal"
+)
+
+var (
+	ErrDailyLimitExceeded = errors.New("daily transfer limit exceeded")
+	ErrOTPRequired        = errors.New("two-factor code required")
+	ErrInvalidOTP         = errors.New("invalid two-factor code")
+	// ErrTransferKeyReused means an idempotency key was sent again for a
+	// different transfer than the one it already made.
+	ErrTransferKeyReused = errors.New("idempotency key was already used for a different transfer")
+)
+
+const (
+	transactionOutgoingTransfer = "OUTGOING_TRANSFER"
+	transactionIncomingTransfer = "INCOMING_TRANSFER"
+)
+
+type userTransferLimits struct {
+	daily        decimal.Decimal
+	otpThreshold decimal.Decimal
+	requireOTP   bool
+}
+
+func (s *TransferService) userLimits(currency string) (*userTransferLimits, error) {
+	key := strings.ToLower(currency)
+
+	daily, ok := s.rules.userDailyLimits[key]
+	if !ok || !s.rules.Holds(models.WalletTypeSpot, currency) {
+		return nil, fmt.Errorf("%w: %s can't be sent to other users", ErrTransferNotAllowed, currency)
+	}
+
+	limits := &userTransferLimits{daily: daily, requireOTP: true}
+	if threshold, ok := s.rules.userOTPThresholds[key]; ok {
+		limits.otpThreshold = threshold
+		limits.requireOTP = false
+	}
+
+	return limits, nil
+}
+
+func (l *userTransferLimits) needsOTP(amount decimal.Decimal) bool {
+	return l.requireOTP || amount.GreaterThanOrEqual(l.otpThreshold)
+}
+
+// startOfDay is when the daily transfer limit resets.
+func startOfDay(now time.Time) time.Time {
+	return now.UTC().Truncate(24 * time.Hour)
+}
+
+func (s *TransferService) resolveRecipient(ctx context.Context, senderID uuid.UUID, req *models.UserTransferRequest) (*models.User, error) {
+	req.Currency = strings.ToUpper(req.Currency)
+	if !req.Amount.IsPositive() {
+		return nil, fmt.Errorf("%w: amount must be positive", ErrTransferNotAllowed)
+	}
+
+	recipient, err := s.userService.FindUser(ctx, req.Recipient)
+	if err != nil {
+		return nil, fmt.Errorf("%w: recipient not found", ErrTransferNotAllowed)
+	}
+	if recipient.ID == senderID {
+		return nil, fmt.Errorf("%w: can't send funds to yourself", ErrTransferNotAllowed)
+	}
+	if recipient.Status != "ACTIVE" {
+		return nil, fmt.Errorf("%w: recipient can't receive transfers", ErrTransferNotAllowed)
+	}
+
+	return recipient, nil
+}
+
+func (s *TransferService) sentToday(ctx context.Context, q sqlx.QueryerContext, senderID uuid.UUID, currency string) (decimal.Decimal, error) {
+	query := `SELECT COALESCE(SUM(amount), 0) FROM user_transfer WHERE senderId = ? AND currency = ? AND createdAt >= ?`
+
+	var sent decimal.Decimal
+	err := q.QueryRowxContext(ctx, query, senderID, currency, startOfDay(time.Now())).Scan(&sent)
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("failed to sum today's transfers: %w", err)
+	}
+
+	return sent, nil
+}
+
+// PreviewUserTransfer resolves the recipient and reports the limits that
+// apply, so the sender can confirm before anything moves.
+func (s *TransferService) PreviewUserTransfer(ctx context.Context, senderID uuid.UUID, req *models.UserTransferRequest) (*models.UserTransferPreview, error) {
+	recipient, err := s.resolveRecipient(ctx, senderID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	limits, err := s.userLimits(req.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	sent, err := s.sentToday(ctx, s.mysql, senderID, req.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	remaining := limits.daily.Sub(sent)
+	if remaining.IsNegative() {
+		remaining = decimal.Zero
+	}
+
+	return &models.UserTransferPreview{
+		Recipient:      models.NewUserTransferRecipient(recipient),
+		Currency:       req.Currency,
+		Amount:         req.Amount,
+		Fee:            decimal.Zero,
+		RequiresOTP:    limits.needsOTP(req.Amount),
+		DailyLimit:     limits.daily,
+		DailyRemaining: remaining,
+	}, nil
+}
+
+// SendToUser moves funds from the sender's SPOT wallet to the recipient's
+// SPOT wallet off-chain. Both users get a transaction record and a
+// notification.
+func (s *TransferService) SendToUser(ctx context.Context, senderID uuid.UUID, req *models.UserTransferRequest, idempotencyKey string) (*models.UserTransferResponse, error) {
+	if idempotencyKey == "" {
+		idempotencyKey = uuid.New().String()
+	} else if existing, err := s.getUserTransfer(ctx, senderID, idempotencyKey); err == nil {
+		return s.replayUserTransfer(ctx, existing, req)
+	}
+
+	recipient, err := s.resolveRecipient(ctx, senderID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	limits, err := s.userLimits(req.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	if limits.needsOTP(req.Amount) {
+		if err := s.checkOTP(ctx, senderID, req.OTP); err != nil {
+			return nil, err
+		}
+	}
+
+	from, err := s.walletService.GetWallet(ctx, senderID, req.Currency, models.WalletTypeSpot)
+	if err != nil {
+		return nil, fmt.Errorf("source wallet not found: %w", err)
+	}
+
+	to, err := s.walletService.GetOrCreateWallet(ctx, recipient.ID, req.Currency, models.WalletTypeSpot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recipient wallet: %w", err)
+	}
+
+	transfer := &models.UserTransfer{
+		ID:             uuid.New(),
+		SenderID:       senderID,
+		RecipientID:    recipient.ID,
+		Currency:       req.Currency,
+		Amount:         req.Amount,
+		IdempotencyKey: idempotencyKey,
+		CreatedAt:      time.Now(),
+	}
+
+	err = s.move(ctx, &walletMove{
+		ID:       transfer.ID,
+		Reason:   models.BalanceReasonUserTransfer,
+		Currency: transfer.Currency,
+		Amount:   transfer.Amount,
+		From: transferLeg{
+			UserID:          senderID,
+			WalletID:        from.ID,
+			WalletType:      models.WalletTypeSpot,
+			TransactionType: transactionOutgoingTransfer,
+			Description:     fmt.Sprintf("Sent %s %s to %s", transfer.Amount, transfer.Currency, recipient.Email),
+		},
+		To: transferLeg{
+			UserID:          recipient.ID,
+			WalletID:        to.ID,
+			WalletType:      models.WalletTypeSpot,
+			TransactionType: transactionIncomingTransfer,
+			Description:     fmt.Sprintf("Received %s %s", transfer.Amount, transfer.Currency),
+		},
+		Metadata: map[string]interface{}{
+			"senderId":    senderID,
+			"recipientId": recipient.ID,
+		},
+		CreatedAt: transfer.CreatedAt,
+		Record: func(ctx context.Context, tx *sqlx.Tx) error {
+			sent, err := s.sentToday(ctx, tx, senderID, transfer.Currency)
+			if err != nil {
+				return err
+			}
+			if sent.Add(transfer.Amount).GreaterThan(limits.daily) {
+				return fmt.Errorf("%w: %s of %s %s left today", ErrDailyLimitExceeded,
+					decimal.Max(limits.daily.Sub(sent), decimal.Zero), limits.daily, transfer.Currency)
+			}
+
+			query := `INSERT INTO user_transfer (id, senderId, recipientId, currency, amount, idempotencyKey, createdAt)
+					  VALUES (?, ?, ?, ?, ?, ?, ?)`
+			_, err = tx.ExecContext(ctx, query, transfer.ID, transfer.SenderID, transfer.RecipientID,
+				transfer.Currency, transfer.Amount, transfer.IdempotencyKey, transfer.CreatedAt)
+			return err
+		},
+	})
+	if errors.Is(err, ledger.ErrDuplicateEntry) {
+		existing, getErr := s.getUserTransfer(ctx, senderID, idempotencyKey)
+		if getErr != nil {
+			return nil, fmt.Errorf("failed to load existing transfer: %w", getErr)
+		}
+		return s.replayUserTransfer(ctx, existing, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.notifyUserTransfer(ctx, transfer)
+
+	return s.userTransferResponse(transfer, recipient), nil
+}
+
+func (s *TransferService) checkOTP(ctx context.Context, userID uuid.UUID, code string) error {
+	enabled, err := s.userService.TwoFactorEnabled(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return fmt.Errorf("%w: enable two-factor authentication to send this amount", ErrOTPRequired)
+	}
+	if code == "" {
+		return ErrOTPRequired
+	}
+
+	valid, err := s.userService.CheckOTP(ctx, userID, code)
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return ErrInvalidOTP
+	}
+
+	return nil
+}
+
+func (s *TransferService) notifyUserTransfer(ctx context.Context, transfer *models.UserTransfer) {
+	metadata := map[string]interface{}{
+		"transferId": transfer.ID,
+		"currency":   transfer.Currency,
+		"amount":     transfer.Amount.String(),
+	}
+
+	notifications := []struct {
+		userID         uuid.UUID
+		title, message string
+	}{
+		{transfer.SenderID, "Transfer sent", fmt.Sprintf("You sent %s %s", transfer.Amount, transfer.Currency)},
+		{transfer.RecipientID, "Transfer received", fmt.Sprintf("You received %s %s", transfer.Amount, transfer.Currency)},
+	}
+
+	for _, n := range notifications {
+		if err := s.notificationService.CreateNotification(ctx, n.userID, "ACTIVITY", n.title, n.message, metadata); err != nil {
+			s.logger.WithError(err).WithField("transferId", transfer.ID).Error("Failed to send transfer notification")
+		}
+	}
+}
+
+// replayUserTransfer answers a request repeating an idempotency key with the
+// transfer the key already made, as long as it asks for the same transfer.
+func (s *TransferService) replayUserTransfer(ctx context.Context, existing *models.UserTransfer, req *models.UserTransferRequest) (*models.UserTransferResponse, error) {
+	recipient, err := s.userService.FindUser(ctx, existing.RecipientID.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load transfer recipient: %w", err)
+	}
+
+	requested, err := s.userService.FindUser(ctx, req.Recipient)
+	if err != nil || requested.ID != recipient.ID ||
+		!strings.EqualFold(req.Currency, existing.Currency) || !req.Amount.Equal(existing.Amount) {
+		return nil, ErrTransferKeyReused
+	}
+
+	return s.userTransferResponse(existing, recipient), nil
+}
+
+func (s *TransferService) userTransferResponse(transfer *models.UserTransfer, recipient *models.User) *models.UserTransferResponse {
+	return &models.UserTransferResponse{
+		ID:        transfer.ID,
+		Recipient: models.NewUserTransferRecipient(recipient),
+		Currency:  transfer.Currency,
+		Amount:    transfer.Amount,
+		CreatedAt: transfer.CreatedAt,
+	}
+}
+
+func (s *TransferService) getUserTransfer(ctx context.Context, senderID uuid.UUID, idempotencyKey string) (*models.UserTransfer, error) {
+	query := `SELECT id, senderId, recipientId, currency, amount, idempotencyKey, createdAt
+			  FROM user_transfer WHERE senderId = ? AND idempotencyKey = ?`
+
+	transfer := &models.UserTransfer{}
+	err := s.mysql.GetContext(ctx, transfer, query, senderID, idempotencyKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transfer: %w", err)
+	}
+
+	return transfer, nil
+}
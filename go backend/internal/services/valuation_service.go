@@ -0,0 +1,366 @@
+package services
+
+import (
+	"context"
+	"crypto-exchange-go/internal/config"
+	"crypto-exchange-go/internal/database"
+	"crypto-exchange-go/internal/models"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+const snapshotBatchSize = 500
+
+// PriceGraph converts between currencies using market last prices. Each
+// BASE/QUOTE market is an edge both ways, so currencies without a direct
+// market to the target are routed through the fewest cross pairs.
+type PriceGraph struct {
+	edges map[string]map[string]decimal.Decimal
+}
+
+func NewPriceGraph(prices map[string]decimal.Decimal) *PriceGraph {
+	g := &PriceGraph{edges: make(map[string]map[string]decimal.Decimal)}
+	for symbol, price := range prices {
+		base, quote, err := splitSymbol(symbol)
+		if err != nil || !price.IsPositive() {
+			continue
+		}
+		g.AddRate(base, quote, price)
+	}
+	return g
+}
+
+// AddRate records that one unit of from is worth rate units of to.
+func (g *PriceGraph) AddRate(from, to string, rate decimal.Decimal) {
+	from, to = strings.ToUpper(from), strings.ToUpper(to)
+	if g.edges[from] == nil {
+		g.edges[from] = make(map[string]decimal.Decimal)
+	}
+	if g.edges[to] == nil {
+		g.edges[to] = make(map[string]decimal.Decimal)
+	}
+	g.edges[from][to] = rate
+	g.edges[to][from] = decimal.NewFromInt(1).DivRound(rate, 18)
+}
+
+// Rate returns how many units of to one unit of from is worth.
+func (g *PriceGraph) Rate(from, to string) (decimal.Decimal, bool) {
+	from, to = strings.ToUpper(from), strings.ToUpper(to)
+	if from == to {
+		return decimal.NewFromInt(1), true
+	}
+
+	rates := map[string]decimal.Decimal{from: decimal.NewFromInt(1)}
+	queue := []string{from}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		for next, rate := range g.edges[current] {
+			if _, seen := rates[next]; seen {
+				continue
+			}
+			rates[next] = rates[current].Mul(rate)
+			if next == to {
+				return rates[next], true
+			}
+			queue = append(queue, next)
+		}
+	}
+
+	return decimal.Zero, false
+}
+
+// FillPortfolioPnL sets each point's PnL to its change in value less its net
+// flow, and accumulates it from the first point.
+func FillPortfolioPnL(points []*models.PortfolioPoint) {
+	cumulative := decimal.Zero
+	for i, point := range points {
+		point.PnL = decimal.Zero
+		if i > 0 {
+			point.PnL = point.Value.Sub(points[i-1].Value).Sub(point.NetFlow)
+		}
+		cumulative = cumulative.Add(point.PnL)
+		point.CumulativePnL = cumulative
+	}
+}
+
+// TickerSource supplies the market tickers balances are valued from. The
+// matching engine is one; MarketService reads them from stored candles for
+// processes that don't run an engine.
+type TickerSource interface {
+	GetTickers() map[string]*models.Ticker
+}
+
+type ValuationService struct {
+	mysql   *database.MySQL
+	tickers TickerSource
+	cfg     config.Valuation
+	logger  *logrus.Logger
+}
+
+func NewValuationService(mysql *database.MySQL, tickers TickerSource, cfg config.Valuation, logger *logrus.Logger) *ValuationService {
+	return &ValuationService{
+		mysql:   mysql,
+		tickers: tickers,
+		cfg:     cfg,
+		logger:  logger,
+	}
+}
+
+func (s *ValuationService) ReferenceCurrency() string {
+	return strings.ToUpper(s.cfg.ReferenceCurrency)
+}
+
+// ReferenceValue values amount of currency in the reference currency at
+// current prices.
+func (s *ValuationService) ReferenceValue(currency string, amount decimal.Decimal) (decimal.Decimal, bool) {
+	rate, ok := s.prices().Rate(currency, s.ReferenceCurrency())
+	if !ok {
+		return decimal.Zero, false
+	}
+	return amount.Mul(rate), true
+}
+
+// prices builds the price graph from the current tickers. Pegged
+// currencies are valued one-to-one with the reference currency.
+func (s *ValuationService) prices() *PriceGraph {
+	last := make(map[string]decimal.Decimal)
+	for symbol, ticker := range s.tickers.GetTickers() {
+		last[symbol] = ticker.Last
+	}
+
+	graph := NewPriceGraph(last)
+	for _, currency := range s.cfg.PeggedCurrencies {
+		graph.AddRate(currency, s.ReferenceCurrency(), decimal.NewFromInt(1))
+	}
+	return graph
+}
+
+// Portfolio values the user's wallets in the reference currency and returns
+// the allocation by currency and the daily history over the last days.
+func (s *ValuationService) Portfolio(ctx context.Context, userID uuid.UUID, days int) (*models.Portfolio, error) {
+	reference := s.ReferenceCurrency()
+	graph := s.prices()
+
+	query := `SELECT currency, SUM(balance + inOrder) FROM wallet WHERE userId = ? GROUP BY currency HAVING SUM(balance + inOrder) <> 0`
+	rows, err := s.mysql.QueryxContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get wallet totals: %w", err)
+	}
+	defer rows.Close()
+
+	portfolio := &models.Portfolio{
+		ReferenceCurrency: reference,
+		TotalValue:        decimal.Zero,
+		Allocation:        []*models.PortfolioAllocation{},
+		Unpriced:          []string{},
+	}
+	for rows.Next() {
+		allocation := &models.PortfolioAllocation{}
+		if err := rows.Scan(&allocation.Currency, &allocation.Amount); err != nil {
+			return nil, fmt.Errorf("failed to scan wallet total: %w", err)
+		}
+
+		price, ok := graph.Rate(allocation.Currency, reference)
+		if !ok {
+			portfolio.Unpriced = append(portfolio.Unpriced, allocation.Currency)
+			continue
+		}
+		allocation.Price = price
+		allocation.Value = allocation.Amount.Mul(price)
+		portfolio.TotalValue = portfolio.TotalValue.Add(allocation.Value)
+		portfolio.Allocation = append(portfolio.Allocation, allocation)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read wallet totals: %w", err)
+	}
+
+	for _, allocation := range portfolio.Allocation {
+		allocation.Share = decimal.Zero
+		if portfolio.TotalValue.IsPositive() {
+			allocation.Share = allocation.Value.Div(portfolio.TotalValue).Mul(decimal.NewFromInt(100)).Round(2)
+		}
+	}
+	sort.Slice(portfolio.Allocation, func(i, j int) bool {
+		return portfolio.Allocation[i].Value.GreaterThan(portfolio.Allocation[j].Value)
+	})
+
+	history, err := s.history(ctx, userID, days, graph, portfolio.TotalValue)
+	if err != nil {
+		return nil, err
+	}
+	portfolio.History = history
+
+	return portfolio, nil
+}
+
+// history turns the user's daily snapshots into a value series ending with
+// the current value, with each point's net flow valued at that point's
+// prices.
+func (s *ValuationService) history(ctx context.Context, userID uuid.UUID, days int, graph *PriceGraph, current decimal.Decimal) ([]*models.PortfolioPoint, error) {
+	reference := s.ReferenceCurrency()
+	since := startOfDay(time.Now()).AddDate(0, 0, -days)
+
+	query := `SELECT snapshotDate, currency, SUM(value), MAX(price) FROM wallet_balance_snapshot
+			  WHERE userId = ? AND referenceCurrency = ? AND snapshotDate >= ?
+			  GROUP BY snapshotDate, currency ORDER BY snapshotDate`
+	rows, err := s.mysql.QueryxContext(ctx, query, userID, reference, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get balance snapshots: %w", err)
+	}
+	defer rows.Close()
+
+	var points []*models.PortfolioPoint
+	var prices []map[string]decimal.Decimal
+	for rows.Next() {
+		var date time.Time
+		var currency string
+		var value, price decimal.Decimal
+		if err := rows.Scan(&date, &currency, &value, &price); err != nil {
+			return nil, fmt.Errorf("failed to scan balance snapshot: %w", err)
+		}
+
+		if len(points) == 0 || !points[len(points)-1].Date.Equal(date) {
+			points = append(points, &models.PortfolioPoint{Date: date, Value: decimal.Zero, NetFlow: decimal.Zero})
+			prices = append(prices, make(map[string]decimal.Decimal))
+		}
+		points[len(points)-1].Value = points[len(points)-1].Value.Add(value)
+		prices[len(prices)-1][currency] = price
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read balance snapshots: %w", err)
+	}
+
+	points = append(points, &models.PortfolioPoint{Date: time.Now(), Value: current, NetFlow: decimal.Zero})
+	prices = append(prices, nil)
+
+	if err := s.addNetFlows(ctx, userID, points, prices, graph); err != nil {
+		return nil, err
+	}
+
+	FillPortfolioPnL(points)
+	return points, nil
+}
+
+// addNetFlows adds each day's external funding to the first point after it.
+// Holds and releases net out because both wallet accounts are summed.
+func (s *ValuationService) addNetFlows(ctx context.Context, userID uuid.UUID, points []*models.PortfolioPoint, prices []map[string]decimal.Decimal, graph *PriceGraph) error {
+	query := `SELECT DATE(ll.createdAt), ll.currency, SUM(IF(ll.side = 'CREDIT', ll.amount, -ll.amount))
+			  FROM ledger_line ll
+			  JOIN ledger_entry e ON e.id = ll.entryId
+			  JOIN wallet w ON w.id = ll.accountId
+			  WHERE w.userId = ? AND ll.accountType IN ('WALLET', 'WALLET_HOLD') AND ll.createdAt >= ?
+				AND e.referenceType IN (?, ?, ?, ?)
+			  GROUP BY DATE(ll.createdAt), ll.currency`
+	rows, err := s.mysql.QueryxContext(ctx, query, userID, points[0].Date,
+		models.BalanceReasonDeposit, models.BalanceReasonWithdrawal, models.BalanceReasonWithdrawalRefund, models.BalanceReasonUserTransfer)
+	if err != nil {
+		return fmt.Errorf("failed to get net flows: %w", err)
+	}
+	defer rows.Close()
+
+	reference := s.ReferenceCurrency()
+	for rows.Next() {
+		var day time.Time
+		var currency string
+		var amount decimal.Decimal
+		if err := rows.Scan(&day, &currency, &amount); err != nil {
+			return fmt.Errorf("failed to scan net flow: %w", err)
+		}
+
+		for i, point := range points {
+			if !point.Date.After(day) {
+				continue
+			}
+			price, ok := prices[i][currency]
+			if !ok {
+				price, ok = graph.Rate(currency, reference)
+			}
+			if ok {
+				point.NetFlow = point.NetFlow.Add(amount.Mul(price))
+			}
+			break
+		}
+	}
+
+	return rows.Err()
+}
+
+// Snapshot records every non-empty wallet's balance and value for the given
+// day. Running it again for the same day overwrites that day's snapshot.
+func (s *ValuationService) Snapshot(ctx context.Context, day time.Time) (int, error) {
+	reference := s.ReferenceCurrency()
+	graph := s.prices()
+	day = startOfDay(day)
+
+	rows, err := s.mysql.QueryxContext(ctx, `SELECT id, userId, type, currency, balance, inOrder FROM wallet
+			  WHERE balance <> 0 OR inOrder <> 0`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get wallets: %w", err)
+	}
+	defer rows.Close()
+
+	count := 0
+	batch := make([]*models.BalanceSnapshot, 0, snapshotBatchSize)
+	for rows.Next() {
+		snapshot := &models.BalanceSnapshot{SnapshotDate: day, ReferenceCurrency: reference}
+		err := rows.Scan(&snapshot.WalletID, &snapshot.UserID, &snapshot.WalletType, &snapshot.Currency,
+			&snapshot.Balance, &snapshot.InOrder)
+		if err != nil {
+			return count, fmt.Errorf("failed to scan wallet: %w", err)
+		}
+
+		if price, ok := graph.Rate(snapshot.Currency, reference); ok {
+			snapshot.Price = price
+			snapshot.Value = snapshot.Balance.Add(snapshot.InOrder).Mul(price)
+		}
+
+		batch = append(batch, snapshot)
+		if len(batch) == snapshotBatchSize {
+			if err := s.saveSnapshots(ctx, batch); err != nil {
+				return count, err
+			}
+			count += len(batch)
+			batch = batch[:0]
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return count, fmt.Errorf("failed to read wallets: %w", err)
+	}
+
+	if len(batch) > 0 {
+		if err := s.saveSnapshots(ctx, batch); err != nil {
+			return count, err
+		}
+		count += len(batch)
+	}
+
+	return count, nil
+}
+
+func (s *ValuationService) saveSnapshots(ctx context.Context, snapshots []*models.BalanceSnapshot) error {
+	values := make([]string, 0, len(snapshots))
+	args := make([]interface{}, 0, len(snapshots)*10)
+	for _, snapshot := range snapshots {
+		values = append(values, "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NOW())")
+		args = append(args, snapshot.SnapshotDate, snapshot.UserID, snapshot.WalletID, snapshot.Currency, snapshot.WalletType,
+			snapshot.Balance, snapshot.InOrder, snapshot.Price, snapshot.Value, snapshot.ReferenceCurrency)
+	}
+
+	query := `INSERT INTO wallet_balance_snapshot (snapshotDate, userId, walletId, currency, walletType, balance, inOrder, price, value, referenceCurrency, createdAt)
+			  VALUES ` + strings.Join(values, ", ") + `
+			  ON DUPLICATE KEY UPDATE balance = VALUES(balance), inOrder = VALUES(inOrder), price = VALUES(price),
+			  value = VALUES(value), referenceCurrency = VALUES(referenceCurrency)`
+	if _, err := s.mysql.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to save balance snapshots: %w", err)
+	}
+
+	return nil
+}
@@ -3,28 +3,33 @@ package services
 import (
 	"context"
 	"crypto-exchange-go/internal/database"
+	"crypto-exchange-go/internal/ledger"
 	"crypto-exchange-go/internal/models"
+	"errors"
 	"fmt"
 
 	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
 	"github.com/shopspring/decimal"
 	"github.com/sirupsen/logrus"
 )
 
 type WalletService struct {
-	mysql  *database.MySQL
-	logger *logrus.Logger
+	mysql    *database.MySQL
+	balances *balanceEvents
+	logger   *logrus.Logger
 }
 
-func NewWalletService(mysql *database.MySQL, logger *logrus.Logger) *WalletService {
+func NewWalletService(mysql *database.MySQL, redis *database.Redis, logger *logrus.Logger) *WalletService {
 	return &WalletService{
-		mysql:  mysql,
-		logger: logger,
+		mysql:    mysql,
+		balances: newBalanceEvents(mysql, redis, logger),
+		logger:   logger,
 	}
 }
 
 func (s *WalletService) GetWallets(ctx context.Context, userID uuid.UUID, walletType models.WalletType) ([]*models.WalletResponse, error) {
-	query := `SELECT id, userId, type, currency, balance, createdAt, updatedAt 
+	query := `SELECT id, userId, type, currency, balance, inOrder, frozen, createdAt, updatedAt 
 			  FROM wallet WHERE userId = ?`
 	args := []interface{}{userID}
 
@@ -35,28 +40,21 @@ func (s *WalletService) GetWallets(ctx context.Context, userID uuid.UUID, wallet
 
 	query += " ORDER BY currency ASC"
 
-	rows, err := s.mysql.Query(query, args...)
-	if err != nil {
+	var rows []models.Wallet
+	if err := s.mysql.SelectContext(ctx, &rows, query, args...); err != nil {
 		return nil, fmt.Errorf("failed to query wallets: %w", err)
 	}
-	defer rows.Close()
-
-	var wallets []*models.WalletResponse
-	for rows.Next() {
-		wallet := &models.Wallet{}
-		err := rows.Scan(&wallet.ID, &wallet.UserID, &wallet.Type, &wallet.Currency,
-			&wallet.Balance, &wallet.CreatedAt, &wallet.UpdatedAt)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan wallet: %w", err)
-		}
-		wallets = append(wallets, wallet.ToResponse())
+
+	wallets := make([]*models.WalletResponse, 0, len(rows))
+	for i := range rows {
+		wallets = append(wallets, rows[i].ToResponse())
 	}
 
 	return wallets, nil
 }
 
 func (s *WalletService) GetWallet(ctx context.Context, userID uuid.UUID, currency string, walletType models.WalletType) (*models.WalletResponse, error) {
-	query := `SELECT id, userId, type, currency, balance, createdAt, updatedAt 
+	query := `SELECT id, userId, type, currency, balance, inOrder, frozen, createdAt, updatedAt 
 			  FROM wallet WHERE userId = ? AND currency = ? AND type = ?`
 
 	wallet := &models.Wallet{}
@@ -75,12 +73,13 @@ func (s *WalletService) CreateWallet(ctx context.Context, userID uuid.UUID, curr
 		Type:     walletType,
 		Currency: currency,
 		Balance:  decimal.Zero,
+		InOrder:  decimal.Zero,
 	}
 
-	query := `INSERT INTO wallet (id, userId, type, currency, balance, createdAt, updatedAt) 
-			  VALUES (?, ?, ?, ?, ?, NOW(), NOW())`
+	query := `INSERT INTO wallet (id, userId, type, currency, balance, inOrder, createdAt, updatedAt) 
+			  VALUES (?, ?, ?, ?, ?, ?, NOW(), NOW())`
 
-	_, err := s.mysql.Exec(query, wallet.ID, wallet.UserID, wallet.Type, wallet.Currency, wallet.Balance)
+	_, err := s.mysql.Exec(query, wallet.ID, wallet.UserID, wallet.Type, wallet.Currency, wallet.Balance, wallet.InOrder)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create wallet: %w", err)
 	}
@@ -88,14 +87,90 @@ func (s *WalletService) CreateWallet(ctx context.Context, userID uuid.UUID, curr
 	return wallet.ToResponse(), nil
 }
 
-func (s *WalletService) UpdateBalance(ctx context.Context, walletID uuid.UUID, amount decimal.Decimal) error {
-	query := `UPDATE wallet SET balance = balance + ?, updatedAt = NOW() WHERE id = ?`
-	_, err := s.mysql.Exec(query, amount, walletID)
+func (s *WalletService) UpdateBalance(ctx context.Context, walletID uuid.UUID, amount decimal.Decimal, reason models.BalanceChangeReason, referenceID string) error {
+	return s.change(ctx, models.BalanceOperationAdjust, walletID, amount, reason, referenceID, nil)
+}
+
+// UpdateBalanceFor adjusts the balance and runs record in the same
+// transaction, like HoldFor.
+func (s *WalletService) UpdateBalanceFor(ctx context.Context, walletID uuid.UUID, amount decimal.Decimal, reason models.BalanceChangeReason, referenceID string, record func(ctx context.Context, tx *sqlx.Tx) error) error {
+	return s.change(ctx, models.BalanceOperationAdjust, walletID, amount, reason, referenceID, record)
+}
+
+func (s *WalletService) Hold(ctx context.Context, walletID uuid.UUID, amount decimal.Decimal, reason models.BalanceChangeReason, referenceID string) error {
+	return s.change(ctx, models.BalanceOperationHold, walletID, amount, reason, referenceID, nil)
+}
+
+// HoldFor places a hold and runs record in the same transaction, with the
+// wallet row locked, so the hold and the row it's for are written atomically.
+func (s *WalletService) HoldFor(ctx context.Context, walletID uuid.UUID, amount decimal.Decimal, reason models.BalanceChangeReason, referenceID string, record func(ctx context.Context, tx *sqlx.Tx) error) error {
+	return s.change(ctx, models.BalanceOperationHold, walletID, amount, reason, referenceID, record)
+}
+
+func (s *WalletService) Release(ctx context.Context, walletID uuid.UUID, amount decimal.Decimal, reason models.BalanceChangeReason, referenceID string) error {
+	return s.change(ctx, models.BalanceOperationRelease, walletID, amount, reason, referenceID, nil)
+}
+
+// ReleaseFor releases a hold and runs record in the same transaction.
+func (s *WalletService) ReleaseFor(ctx context.Context, walletID uuid.UUID, amount decimal.Decimal, reason models.BalanceChangeReason, referenceID string, record func(ctx context.Context, tx *sqlx.Tx) error) error {
+	return s.change(ctx, models.BalanceOperationRelease, walletID, amount, reason, referenceID, record)
+}
+
+func (s *WalletService) Capture(ctx context.Context, walletID uuid.UUID, amount decimal.Decimal, reason models.BalanceChangeReason, referenceID string) error {
+	return s.change(ctx, models.BalanceOperationCapture, walletID, amount, reason, referenceID, nil)
+}
+
+// CaptureFor captures a hold and runs record in the same transaction.
+func (s *WalletService) CaptureFor(ctx context.Context, walletID uuid.UUID, amount decimal.Decimal, reason models.BalanceChangeReason, referenceID string, record func(ctx context.Context, tx *sqlx.Tx) error) error {
+	return s.change(ctx, models.BalanceOperationCapture, walletID, amount, reason, referenceID, record)
+}
+
+// newBalanceChange builds a change keyed by what it does, so the same
+// operation for the same reference is only ever posted once.
+func newBalanceChange(operation models.BalanceOperation, walletID uuid.UUID, amount decimal.Decimal, reason models.BalanceChangeReason, referenceID string) balanceChange {
+	key := fmt.Sprintf("%s:%s:%s", reason, referenceID, walletID)
+	if operation != models.BalanceOperationAdjust {
+		key = fmt.Sprintf("%s:%s", operation, key)
+	}
+
+	return balanceChange{
+		WalletID:       walletID,
+		Operation:      operation,
+		Amount:         amount,
+		Reason:         reason,
+		ReferenceID:    referenceID,
+		IdempotencyKey: key,
+	}
+}
+
+func (s *WalletService) change(ctx context.Context, operation models.BalanceOperation, walletID uuid.UUID, amount decimal.Decimal, reason models.BalanceChangeReason, referenceID string, record func(ctx context.Context, tx *sqlx.Tx) error) error {
+	change := newBalanceChange(operation, walletID, amount, reason, referenceID)
+	change.Record = record
+
+	_, err := s.balances.apply(ctx, change)
+	if errors.Is(err, ledger.ErrDuplicateEntry) {
+		// The same operation was already applied for this reference, e.g. a
+		// settlement being retried after a partial failure.
+		return nil
+	}
+	return err
+}
+
+func (s *WalletService) GetLedgerHistory(ctx context.Context, userID uuid.UUID, currency string, walletType models.WalletType, limit, offset int) ([]*ledger.Posting, error) {
+	wallet, err := s.GetWallet(ctx, userID, currency, walletType)
 	if err != nil {
-		return fmt.Errorf("failed to update wallet balance: %w", err)
+		return nil, err
 	}
 
-	return nil
+	return s.balances.ledger.History(ctx, wallet.ID, limit, offset)
+}
+
+func (s *WalletService) RebuildBalance(ctx context.Context, walletID uuid.UUID) (*ledger.Balance, error) {
+	return s.balances.ledger.Rebuild(ctx, walletID)
+}
+
+func (s *WalletService) GetBalanceChanges(ctx context.Context, userID uuid.UUID, sinceSequence int64, limit int) ([]*models.BalanceEventResponse, error) {
+	return s.balances.since(ctx, userID, sinceSequence, limit)
 }
 
 func (s *WalletService) GetOrCreateWallet(ctx context.Context, userID uuid.UUID, currency string, walletType models.WalletType) (*models.WalletResponse, error) {
@@ -0,0 +1,335 @@
+package services
+
+import (
+	"context"
+	"crypto-exchange-go/internal/database"
+	"crypto-exchange-go/internal/models"
+	"crypto-exchange-go/internal/signer"
+	"crypto-exchange-go/internal/utxo"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrWithdrawalBatchSigned = errors.New("withdrawal batch is already signed")
+	ErrWithdrawalBatchState  = errors.New("withdrawal batch is not in a state that allows this")
+)
+
+// WithdrawalBatchService is the batcher's ledger in MySQL. Coins are the
+// unspent ecosystem_utxo rows of the chain's native currency; a batch
+// reserves them and its withdrawals by setting their batchId. Batches are
+// signed by the signer, which may be nil where nothing signs, and moved on
+// with their withdrawals through withdrawals, which may be nil where batches
+// are only built.
+type WithdrawalBatchService struct {
+	mysql       *database.MySQL
+	signer      signer.Signer
+	withdrawals *WithdrawalService
+	logger      *logrus.Logger
+}
+
+func NewWithdrawalBatchService(mysql *database.MySQL, signer signer.Signer, withdrawals *WithdrawalService, logger *logrus.Logger) *WithdrawalBatchService {
+	return &WithdrawalBatchService{
+		mysql:       mysql,
+		signer:      signer,
+		withdrawals: withdrawals,
+		logger:      logger,
+	}
+}
+
+// Payments returns the approved withdrawals of the chain's native coin that
+// no batch has taken yet.
+func (s *WithdrawalBatchService) Payments(ctx context.Context, chain string) ([]utxo.Payment, error) {
+	var rows []struct {
+		ID      string          `db:"id"`
+		Address sql.NullString  `db:"address"`
+		Amount  decimal.Decimal `db:"amount"`
+	}
+	err := s.mysql.SelectContext(ctx, &rows, `SELECT id, address, amount FROM withdrawal
+			WHERE status = ? AND network = ? AND currency = ? AND batchId IS NULL
+			ORDER BY createdAt`, models.WithdrawalStatusApproved, chain, chain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get approved withdrawals: %w", err)
+	}
+
+	payments := make([]utxo.Payment, 0, len(rows))
+	for _, row := range rows {
+		payments = append(payments, utxo.Payment{
+			WithdrawalID: row.ID,
+			Address:      row.Address.String,
+			Value:        baseUnits(row.Amount),
+		})
+	}
+	return payments, nil
+}
+
+func (s *WithdrawalBatchService) Unspent(ctx context.Context, chain string) ([]utxo.Coin, error) {
+	var rows []struct {
+		ID            string          `db:"id"`
+		TransactionID string          `db:"transactionId"`
+		Index         uint32          `db:"index"`
+		Amount        decimal.Decimal `db:"amount"`
+		Script        sql.NullString  `db:"script"`
+	}
+	err := s.mysql.SelectContext(ctx, &rows, "SELECT u.id, u.transactionId, u.`index`, u.amount, u.script FROM ecosystem_utxo u "+
+		"JOIN wallet w ON w.id = u.walletId "+
+		"WHERE w.currency = ? AND u.status = FALSE AND u.batchId IS NULL", chain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get unspent coins: %w", err)
+	}
+
+	coins := make([]utxo.Coin, 0, len(rows))
+	for _, row := range rows {
+		coins = append(coins, utxo.Coin{
+			ID:     row.ID,
+			TxID:   row.TransactionID,
+			Index:  row.Index,
+			Value:  baseUnits(row.Amount),
+			Script: row.Script.String,
+		})
+	}
+	return coins, nil
+}
+
+func (s *WithdrawalBatchService) ChangeAddress(ctx context.Context, chain string) (string, error) {
+	var address string
+	err := s.mysql.GetContext(ctx, &address, `SELECT address FROM ecosystem_master_wallet WHERE chain = ? AND status = TRUE LIMIT 1`, chain)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("no active master wallet for %s", chain)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get master wallet: %w", err)
+	}
+	return address, nil
+}
+
+// Reserve stores the batch and claims its coins and withdrawals in one
+// transaction. A withdrawal rejected or a coin spent since they were read
+// loses the whole batch; the next run builds it again without them.
+func (s *WithdrawalBatchService) Reserve(ctx context.Context, batch *utxo.Batch) error {
+	unsigned, err := json.Marshal(batch.Tx)
+	if err != nil {
+		return fmt.Errorf("failed to encode batch: %w", err)
+	}
+
+	tx, err := s.mysql.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO withdrawal_batch (id, chain, status, unsignedTx, rawTx, fee, createdAt, updatedAt)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		batch.ID, batch.Chain, models.WithdrawalBatchStatusUnsigned, unsigned, batch.Raw, batch.Tx.Fee, batch.CreatedAt, batch.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create withdrawal batch: %w", err)
+	}
+
+	coinIDs := make([]string, 0, len(batch.Tx.Inputs))
+	for _, coin := range batch.Tx.Inputs {
+		coinIDs = append(coinIDs, coin.ID)
+	}
+	if err := claim(ctx, tx, len(coinIDs), `UPDATE ecosystem_utxo SET batchId = ?
+			WHERE id IN (?) AND status = FALSE AND batchId IS NULL`, batch.ID, coinIDs); err != nil {
+		return err
+	}
+
+	withdrawalIDs := make([]string, 0, len(batch.Payments))
+	for _, payment := range batch.Payments {
+		withdrawalIDs = append(withdrawalIDs, payment.WithdrawalID)
+	}
+	if err := claim(ctx, tx, len(withdrawalIDs), `UPDATE withdrawal SET batchId = ?, updatedAt = ?
+			WHERE id IN (?) AND status = ? AND batchId IS NULL`, batch.ID, batch.CreatedAt, withdrawalIDs, models.WithdrawalStatusApproved); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit withdrawal batch: %w", err)
+	}
+	return nil
+}
+
+// GetBatches lists batches by status, newest first.
+func (s *WithdrawalBatchService) GetBatches(ctx context.Context, status string, limit, offset int) ([]*models.WithdrawalBatch, error) {
+	batches := []*models.WithdrawalBatch{}
+	err := s.mysql.SelectContext(ctx, &batches, `SELECT id, chain, status, rawTx, signedTx, fee, transactionId, createdAt, updatedAt
+			FROM withdrawal_batch WHERE status = ? ORDER BY createdAt DESC LIMIT ? OFFSET ?`, status, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get withdrawal batches: %w", err)
+	}
+	return batches, nil
+}
+
+// SignBatch has the signer sign an unsigned batch and stores the signed
+// transaction. The signer applies its own policy; the API holds no keys.
+func (s *WithdrawalBatchService) SignBatch(ctx context.Context, batchID uuid.UUID) (*models.WithdrawalBatch, error) {
+	var row struct {
+		Status     string `db:"status"`
+		UnsignedTx []byte `db:"unsignedTx"`
+	}
+	err := s.mysql.GetContext(ctx, &row, `SELECT status, unsignedTx FROM withdrawal_batch WHERE id = ?`, batchID)
+	if err != nil {
+		return nil, fmt.Errorf("withdrawal batch not found: %w", err)
+	}
+	if row.Status != models.WithdrawalBatchStatusUnsigned {
+		return nil, ErrWithdrawalBatchSigned
+	}
+
+	var unsigned utxo.UnsignedTx
+	if err := json.Unmarshal(row.UnsignedTx, &unsigned); err != nil {
+		return nil, fmt.Errorf("failed to decode withdrawal batch: %w", err)
+	}
+
+	signed, err := s.signer.SignTransaction(ctx, &signer.Request{Reference: batchID.String(), Tx: &unsigned})
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.mysql.ExecContext(ctx, `UPDATE withdrawal_batch SET status = ?, signedTx = ?, updatedAt = ? WHERE id = ? AND status = ?`,
+		models.WithdrawalBatchStatusSigned, signed, time.Now(), batchID, models.WithdrawalBatchStatusUnsigned)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store signed batch: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return nil, ErrWithdrawalBatchSigned
+	}
+
+	s.logger.WithField("batchId", batchID).Info("Withdrawal batch signed")
+
+	batch := &models.WithdrawalBatch{}
+	err = s.mysql.GetContext(ctx, batch, `SELECT id, chain, status, rawTx, signedTx, fee, transactionId, createdAt, updatedAt
+			FROM withdrawal_batch WHERE id = ?`, batchID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get withdrawal batch: %w", err)
+	}
+	return batch, nil
+}
+
+// AbandonBatch drops a batch that was never signed. Its withdrawals stay
+// approved and its coins unspent, free for the next run to batch again.
+func (s *WithdrawalBatchService) AbandonBatch(ctx context.Context, batchID uuid.UUID) error {
+	tx, err := s.mysql.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := moveBatchRow(ctx, tx, batchID, models.WithdrawalBatchStatusUnsigned, models.WithdrawalBatchStatusAbandoned, nil); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE withdrawal SET batchId = NULL, updatedAt = ? WHERE batchId = ?`, time.Now(), batchID); err != nil {
+		return fmt.Errorf("failed to release batch withdrawals: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE ecosystem_utxo SET batchId = NULL WHERE batchId = ?`, batchID); err != nil {
+		return fmt.Errorf("failed to release batch coins: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit withdrawal batch: %w", err)
+	}
+
+	s.logger.WithField("batchId", batchID).Info("Withdrawal batch abandoned")
+	return nil
+}
+
+// MarkBatchBroadcast records that a signed batch went out under
+// transactionID, and marks its withdrawals broadcast with it. Their funds
+// stay held until the batch confirms or fails.
+func (s *WithdrawalBatchService) MarkBatchBroadcast(ctx context.Context, adminID, batchID uuid.UUID, transactionID string) error {
+	return s.advanceBatch(ctx, batchID, models.WithdrawalBatchStatusSigned, models.WithdrawalBatchStatusBroadcast, &adminID,
+		models.WithdrawalActionBroadcast, models.WithdrawalStatusBroadcast, "", &transactionID, "")
+}
+
+// ConfirmBatch records that a broadcast batch settled on chain: its
+// withdrawals' holds are captured and its coins are spent.
+func (s *WithdrawalBatchService) ConfirmBatch(ctx context.Context, adminID, batchID uuid.UUID) error {
+	return s.advanceBatch(ctx, batchID, models.WithdrawalBatchStatusBroadcast, models.WithdrawalBatchStatusConfirmed, &adminID,
+		models.WithdrawalActionConfirmed, models.WithdrawalStatusConfirmed, "", nil,
+		`UPDATE ecosystem_utxo SET status = TRUE WHERE batchId = ?`)
+}
+
+// FailBatch records that a broadcast batch was dropped or reverted: its
+// withdrawals' holds are released and its coins are free to spend again.
+func (s *WithdrawalBatchService) FailBatch(ctx context.Context, adminID, batchID uuid.UUID, reason string) error {
+	return s.advanceBatch(ctx, batchID, models.WithdrawalBatchStatusBroadcast, models.WithdrawalBatchStatusFailed, &adminID,
+		models.WithdrawalActionFailed, models.WithdrawalStatusFailed, reason, nil,
+		`UPDATE ecosystem_utxo SET batchId = NULL WHERE batchId = ? AND status = FALSE`)
+}
+
+// advanceBatch moves a batch from one status to the next together with its
+// withdrawals, and runs coins (an update taking the batch id) on its coins,
+// in one transaction.
+func (s *WithdrawalBatchService) advanceBatch(ctx context.Context, batchID uuid.UUID, from, to string, actorID *uuid.UUID, action, withdrawalStatus, reason string, transactionID *string, coins string) error {
+	var status string
+	err := s.mysql.GetContext(ctx, &status, `SELECT status FROM withdrawal_batch WHERE id = ?`, batchID)
+	if err != nil {
+		return fmt.Errorf("withdrawal batch not found: %w", err)
+	}
+	if status != from {
+		return ErrWithdrawalBatchState
+	}
+
+	err = s.withdrawals.moveBatch(ctx, batchID, actorID, action, withdrawalStatus, reason, transactionID,
+		func(ctx context.Context, tx *sqlx.Tx) error {
+			if err := moveBatchRow(ctx, tx, batchID, from, to, transactionID); err != nil {
+				return err
+			}
+			if coins == "" {
+				return nil
+			}
+			if _, err := tx.ExecContext(ctx, coins, batchID); err != nil {
+				return fmt.Errorf("failed to update batch coins: %w", err)
+			}
+			return nil
+		})
+	if err != nil {
+		return err
+	}
+
+	s.logger.WithFields(logrus.Fields{"batchId": batchID, "status": to}).Info("Withdrawal batch moved")
+	return nil
+}
+
+// moveBatchRow moves the batch row on from status from, failing with
+// ErrWithdrawalBatchState if someone else moved it first.
+func moveBatchRow(ctx context.Context, tx *sqlx.Tx, batchID uuid.UUID, from, to string, transactionID *string) error {
+	result, err := tx.ExecContext(ctx, `UPDATE withdrawal_batch SET status = ?, transactionId = COALESCE(?, transactionId), updatedAt = ?
+			WHERE id = ? AND status = ?`, to, transactionID, time.Now(), batchID, from)
+	if err != nil {
+		return fmt.Errorf("failed to update withdrawal batch: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrWithdrawalBatchState
+	}
+	return nil
+}
+
+// claim runs an update that must change want rows, failing with
+// ErrAlreadyReserved if the conditions no longer hold for one of them.
+func claim(ctx context.Context, tx *sqlx.Tx, want int, query string, args ...interface{}) error {
+	query, args, err := sqlx.In(query, args...)
+	if err != nil {
+		return err
+	}
+	result, err := tx.ExecContext(ctx, tx.Rebind(query), args...)
+	if err != nil {
+		return fmt.Errorf("failed to reserve batch rows: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected != int64(want) {
+		return utxo.ErrAlreadyReserved
+	}
+	return nil
+}
+
+// baseUnits converts an amount to satoshis, dropping anything smaller.
+func baseUnits(amount decimal.Decimal) int64 {
+	return amount.Shift(utxo.Decimals).IntPart()
+}
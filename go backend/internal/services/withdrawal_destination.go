@@ -0,0 +1,60 @@
+package services
+
+import (
+	"context"
+	"crypto-exchange-go/internal/addresses"
+	"crypto-exchange-go/internal/database"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidDestination = errors.New("invalid withdrawal destination")
+
+// DestinationValidator checks where a crypto withdrawal is going: the
+// network is known, the currency is sent on it, and the address (and memo)
+// are well formed for it.
+type DestinationValidator struct {
+	mysql    *database.MySQL
+	networks addresses.Registry
+}
+
+func NewDestinationValidator(mysql *database.MySQL, networks addresses.Registry) *DestinationValidator {
+	return &DestinationValidator{
+		mysql:    mysql,
+		networks: networks,
+	}
+}
+
+// Validate returns the network's canonical name. An empty network means the
+// currency's own chain, for native coins like BTC.
+func (v *DestinationValidator) Validate(ctx context.Context, currency, network, address, memo string) (string, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	network = strings.TrimSpace(network)
+	if network == "" {
+		network = currency
+	}
+
+	chain, ok := v.networks.Get(network)
+	if !ok {
+		return "", fmt.Errorf("%w: %w %q", ErrInvalidDestination, addresses.ErrUnsupportedNetwork, network)
+	}
+
+	if currency != chain.Native {
+		// Tokens are only sent on the chains they are listed on.
+		var listed int
+		err := v.mysql.GetContext(ctx, &listed, `SELECT COUNT(*) FROM ecosystem_token WHERE currency = ? AND chain = ? AND status = TRUE`,
+			currency, chain.Name)
+		if err != nil {
+			return "", fmt.Errorf("failed to check ecosystem token: %w", err)
+		}
+		if listed == 0 {
+			return "", fmt.Errorf("%w: %s can't be withdrawn on %s", ErrInvalidDestination, currency, chain.Name)
+		}
+	}
+
+	if err := chain.Validate(strings.TrimSpace(address), strings.TrimSpace(memo)); err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidDestination, err)
+	}
+	return chain.Name, nil
+}
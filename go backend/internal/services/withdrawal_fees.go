@@ -0,0 +1,248 @@
+package services
+
+import (
+	"context"
+	"crypto-exchange-go/internal/config"
+	"crypto-exchange-go/internal/models"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/shopspring/decimal"
+)
+
+var (
+	ErrBelowWithdrawalMinimum     = errors.New("amount is below the withdrawal minimum")
+	ErrWithdrawalLimitExceeded    = errors.New("withdrawal limit exceeded")
+	ErrWithdrawalFeeNotConfigured = errors.New("withdrawals of this currency are not supported")
+)
+
+// defaultFeeKey is the schedule entry for currencies without one of their own.
+const defaultFeeKey = "default"
+
+// NetworkFeeEstimator quotes what sending currency on network costs right
+// now, in that currency.
+type NetworkFeeEstimator interface {
+	EstimateNetworkFee(ctx context.Context, currency, network string) (decimal.Decimal, error)
+}
+
+// StaticFeeEstimator quotes fixed network fees, keyed like the fee schedule.
+// It stands in until estimators that ask the chains exist.
+type StaticFeeEstimator map[string]decimal.Decimal
+
+func NewStaticFeeEstimator(fees map[string]float64) StaticFeeEstimator {
+	estimator := StaticFeeEstimator{}
+	for key, fee := range fees {
+		estimator[strings.ToLower(key)] = decimal.NewFromFloat(fee)
+	}
+	return estimator
+}
+
+func (e StaticFeeEstimator) EstimateNetworkFee(ctx context.Context, currency, network string) (decimal.Decimal, error) {
+	for _, key := range feeKeys(currency, network) {
+		if fee, ok := e[key]; ok {
+			return fee, nil
+		}
+	}
+	return decimal.Zero, nil
+}
+
+// feeKeys are the schedule keys for a withdrawal, most specific first.
+func feeKeys(currency, network string) []string {
+	currency = strings.ToLower(currency)
+	if network == "" {
+		return []string{currency}
+	}
+	return []string{currency + ":" + strings.ToLower(network), currency}
+}
+
+type withdrawalFee struct {
+	flat      decimal.Decimal
+	percent   decimal.Decimal
+	minAmount decimal.Decimal
+	dynamic   bool
+}
+
+// WithdrawalFees is the withdrawal fee schedule.
+type WithdrawalFees struct {
+	fees      map[string]withdrawalFee
+	estimator NetworkFeeEstimator
+}
+
+func NewWithdrawalFees(cfg config.Withdrawal, estimator NetworkFeeEstimator) WithdrawalFees {
+	fees := make(map[string]withdrawalFee, len(cfg.Fees))
+	for key, fee := range cfg.Fees {
+		fees[strings.ToLower(key)] = withdrawalFee{
+			flat:      decimal.NewFromFloat(fee.Flat),
+			percent:   decimal.NewFromFloat(fee.Percent),
+			minAmount: decimal.NewFromFloat(fee.MinAmount),
+			dynamic:   fee.Dynamic,
+		}
+	}
+	return WithdrawalFees{fees: fees, estimator: estimator}
+}
+
+// Quote returns the fee for withdrawing amount of currency on network, which
+// is charged on top of it. Currencies missing from the schedule use its
+// default entry, and are refused if there isn't one.
+func (f WithdrawalFees) Quote(ctx context.Context, currency, network string, amount decimal.Decimal) (decimal.Decimal, error) {
+	if !amount.IsPositive() {
+		return decimal.Zero, fmt.Errorf("%w: amount must be positive", ErrBelowWithdrawalMinimum)
+	}
+
+	var schedule withdrawalFee
+	found := false
+	for _, key := range append(feeKeys(currency, network), defaultFeeKey) {
+		if schedule, found = f.fees[key]; found {
+			break
+		}
+	}
+	if !found {
+		return decimal.Zero, fmt.Errorf("%w: %s", ErrWithdrawalFeeNotConfigured, strings.ToUpper(currency))
+	}
+
+	if amount.LessThan(schedule.minAmount) {
+		return decimal.Zero, fmt.Errorf("%w: at least %s %s", ErrBelowWithdrawalMinimum, schedule.minAmount, strings.ToUpper(currency))
+	}
+
+	fee := schedule.flat.Add(amount.Mul(schedule.percent).Div(decimal.NewFromInt(100)))
+	if schedule.dynamic && f.estimator != nil {
+		networkFee, err := f.estimator.EstimateNetworkFee(ctx, currency, network)
+		if err != nil {
+			return decimal.Zero, fmt.Errorf("failed to estimate network fee: %w", err)
+		}
+		fee = fee.Add(networkFee)
+	}
+	return fee, nil
+}
+
+type withdrawalLimitTier struct {
+	kycLevel int
+	daily    decimal.Decimal
+	monthly  decimal.Decimal
+}
+
+// WithdrawalLimits are the daily and monthly limits by KYC level.
+type WithdrawalLimits struct {
+	tiers []withdrawalLimitTier
+}
+
+func NewWithdrawalLimits(cfg config.Withdrawal) WithdrawalLimits {
+	tiers := make([]withdrawalLimitTier, 0, len(cfg.LimitTiers))
+	for _, tier := range cfg.LimitTiers {
+		tiers = append(tiers, withdrawalLimitTier{
+			kycLevel: tier.KYCLevel,
+			daily:    decimal.NewFromFloat(tier.Daily),
+			monthly:  decimal.NewFromFloat(tier.Monthly),
+		})
+	}
+	sort.Slice(tiers, func(i, j int) bool { return tiers[i].kycLevel < tiers[j].kycLevel })
+	return WithdrawalLimits{tiers: tiers}
+}
+
+// For returns the limits of the highest tier kycLevel reaches. Users below
+// every tier may withdraw nothing; limited is false when there are no tiers.
+func (l WithdrawalLimits) For(kycLevel int) (daily, monthly decimal.Decimal, limited bool) {
+	if len(l.tiers) == 0 {
+		return decimal.Zero, decimal.Zero, false
+	}
+	for i := len(l.tiers) - 1; i >= 0; i-- {
+		if kycLevel >= l.tiers[i].kycLevel {
+			return l.tiers[i].daily, l.tiers[i].monthly, true
+		}
+	}
+	return decimal.Zero, decimal.Zero, true
+}
+
+func startOfMonth(now time.Time) time.Time {
+	now = now.UTC()
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// GetLimits reports the user's withdrawal limits and what is left of them.
+func (s *WithdrawalService) GetLimits(ctx context.Context, userID uuid.UUID) (*models.WithdrawalLimits, error) {
+	return s.allowance(ctx, s.mysql, userID)
+}
+
+func (s *WithdrawalService) allowance(ctx context.Context, q sqlx.QueryerContext, userID uuid.UUID) (*models.WithdrawalLimits, error) {
+	level, err := s.kycService.VerifiedLevel(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	limits := &models.WithdrawalLimits{KYCLevel: level}
+	limits.DailyLimit, limits.MonthlyLimit, limits.Limited = s.limits.For(level)
+	if s.valuation != nil {
+		limits.Currency = s.valuation.ReferenceCurrency()
+	}
+	if !limits.Limited {
+		return limits, nil
+	}
+
+	// Everything whose funds didn't come back counts, pending withdrawals
+	// included.
+	query := `SELECT COALESCE(SUM(referenceValue), 0) FROM withdrawal
+			  WHERE userId = ? AND status NOT IN (?, ?, ?) AND createdAt >= ?`
+	now := time.Now()
+
+	err = q.QueryRowxContext(ctx, query, userID, models.WithdrawalStatusRejected, models.WithdrawalStatusCanceled,
+		models.WithdrawalStatusFailed, startOfDay(now)).Scan(&limits.DailyUsed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum today's withdrawals: %w", err)
+	}
+	err = q.QueryRowxContext(ctx, query, userID, models.WithdrawalStatusRejected, models.WithdrawalStatusCanceled,
+		models.WithdrawalStatusFailed, startOfMonth(now)).Scan(&limits.MonthlyUsed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum this month's withdrawals: %w", err)
+	}
+
+	limits.DailyRemaining = decimal.Max(limits.DailyLimit.Sub(limits.DailyUsed), decimal.Zero)
+	limits.MonthlyRemaining = decimal.Max(limits.MonthlyLimit.Sub(limits.MonthlyUsed), decimal.Zero)
+	return limits, nil
+}
+
+// price values a withdrawal in the reference currency for the limits. It
+// only fails when limits apply and there is no price to value it with.
+func (s *WithdrawalService) price(currency string, amount decimal.Decimal) (decimal.Decimal, error) {
+	if s.valuation != nil {
+		if value, ok := s.valuation.ReferenceValue(currency, amount); ok {
+			return value, nil
+		}
+	}
+	if len(s.limits.tiers) == 0 {
+		return decimal.Zero, nil
+	}
+	return decimal.Zero, fmt.Errorf("%w: %s can't be valued right now", ErrWithdrawalLimitExceeded, currency)
+}
+
+// checkLimits runs inside the hold's transaction. The user row lock makes
+// concurrent withdrawals in different currencies take turns, so they can't
+// both fit under the same remaining limit.
+func (s *WithdrawalService) checkLimits(ctx context.Context, tx *sqlx.Tx, withdrawal *models.Withdrawal) error {
+	if len(s.limits.tiers) == 0 {
+		return nil
+	}
+
+	var id string
+	if err := tx.GetContext(ctx, &id, `SELECT id FROM user WHERE id = ? FOR UPDATE`, withdrawal.UserID); err != nil {
+		return fmt.Errorf("failed to lock user: %w", err)
+	}
+
+	limits, err := s.allowance(ctx, tx, withdrawal.UserID)
+	if err != nil {
+		return err
+	}
+	if withdrawal.ReferenceValue.GreaterThan(limits.DailyRemaining) {
+		return fmt.Errorf("%w: %s of %s %s left today", ErrWithdrawalLimitExceeded,
+			limits.DailyRemaining, limits.DailyLimit, limits.Currency)
+	}
+	if withdrawal.ReferenceValue.GreaterThan(limits.MonthlyRemaining) {
+		return fmt.Errorf("%w: %s of %s %s left this month", ErrWithdrawalLimitExceeded,
+			limits.MonthlyRemaining, limits.MonthlyLimit, limits.Currency)
+	}
+	return nil
+}
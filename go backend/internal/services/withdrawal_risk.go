@@ -0,0 +1,187 @@
+package services
+
+import (
+	"context"
+	"crypto-exchange-go/internal/config"
+	"crypto-exchange-go/internal/models"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// Risk factors a withdrawal can carry.
+const (
+	RiskNewDevice                = "NEW_DEVICE"
+	RiskRecentPasswordChange     = "RECENT_PASSWORD_CHANGE"
+	RiskFirstWithdrawalToAddress = "FIRST_WITHDRAWAL_TO_ADDRESS"
+)
+
+// A stolen session usually shows up as a new device, often right after the
+// password was changed, sending to an address the account never used.
+var riskWeights = map[string]int{
+	RiskNewDevice:                40,
+	RiskRecentPasswordChange:     50,
+	RiskFirstWithdrawalToAddress: 25,
+}
+
+// AddressWhitelist says whether a user has whitelisted a withdrawal address
+// and whether they only allow withdrawals to such addresses.
+type AddressWhitelist interface {
+	IsWhitelisted(ctx context.Context, userID uuid.UUID, currency, network, address, memo string) (bool, error)
+	WhitelistOnly(ctx context.Context, userID uuid.UUID) (bool, error)
+}
+
+// WithdrawalSignals are what review decisions are made from.
+type WithdrawalSignals struct {
+	NewDevice            bool
+	RecentPasswordChange bool
+	FirstToAddress       bool
+	Whitelisted          bool
+	KYCLevel             int
+}
+
+// WithdrawalRules scores withdrawals and decides which can skip admin
+// review. Auto-approve limits are keyed by lowercase currency.
+type WithdrawalRules struct {
+	autoApproveLimits   map[string]decimal.Decimal
+	autoApproveKYCLevel int
+	autoApproveMaxRisk  int
+	newDeviceWindow     time.Duration
+	passwordWindow      time.Duration
+}
+
+func NewWithdrawalRules(cfg config.Withdrawal) WithdrawalRules {
+	rules := WithdrawalRules{
+		autoApproveLimits:   make(map[string]decimal.Decimal),
+		autoApproveKYCLevel: cfg.AutoApproveKYCLevel,
+		autoApproveMaxRisk:  cfg.AutoApproveMaxRisk,
+		newDeviceWindow:     time.Duration(cfg.NewDeviceHours) * time.Hour,
+		passwordWindow:      time.Duration(cfg.PasswordChangeHours) * time.Hour,
+	}
+	for currency, limit := range cfg.AutoApproveLimits {
+		rules.autoApproveLimits[strings.ToLower(currency)] = decimal.NewFromFloat(limit)
+	}
+	return rules
+}
+
+// Score adds up the weights of the risk factors present.
+func (r WithdrawalRules) Score(signals WithdrawalSignals) (int, []string) {
+	var factors []string
+	if signals.NewDevice {
+		factors = append(factors, RiskNewDevice)
+	}
+	if signals.RecentPasswordChange {
+		factors = append(factors, RiskRecentPasswordChange)
+	}
+	if signals.FirstToAddress {
+		factors = append(factors, RiskFirstWithdrawalToAddress)
+	}
+
+	score := 0
+	for _, factor := range factors {
+		score += riskWeights[factor]
+	}
+	return score, factors
+}
+
+// AutoApprove reports whether a withdrawal is small, goes to a whitelisted
+// address from a verified user and scores low enough to skip review.
+// Currencies without a limit always need an admin.
+func (r WithdrawalRules) AutoApprove(currency string, amount decimal.Decimal, signals WithdrawalSignals, score int) bool {
+	limit, ok := r.autoApproveLimits[strings.ToLower(currency)]
+	return ok &&
+		amount.LessThanOrEqual(limit) &&
+		signals.Whitelisted &&
+		signals.KYCLevel >= r.autoApproveKYCLevel &&
+		score <= r.autoApproveMaxRisk
+}
+
+// assess gathers the review signals for a withdrawal request. The
+// request's device is remembered, so it is only new once.
+func (s *WithdrawalService) assess(ctx context.Context, userID uuid.UUID, req *models.CreateWithdrawalRequest) (*WithdrawalSignals, error) {
+	now := time.Now()
+	signals := &WithdrawalSignals{}
+
+	newDevice, err := s.touchDevice(ctx, userID, req.Device, now)
+	if err != nil {
+		return nil, err
+	}
+	signals.NewDevice = newDevice
+
+	var passwordChangedAt sql.NullTime
+	err = s.mysql.GetContext(ctx, &passwordChangedAt, `SELECT passwordChangedAt FROM user WHERE id = ?`, userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to get password change time: %w", err)
+	}
+	signals.RecentPasswordChange = passwordChangedAt.Valid && now.Sub(passwordChangedAt.Time) < s.rules.passwordWindow
+
+	if req.Address != nil {
+		var sent int
+		err = s.mysql.GetContext(ctx, &sent, `SELECT COUNT(*) FROM withdrawal WHERE userId = ? AND address = ? AND status = ?`,
+			userID, *req.Address, models.WithdrawalStatusConfirmed)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count withdrawals to address: %w", err)
+		}
+		signals.FirstToAddress = sent == 0
+
+		if s.whitelist != nil {
+			signals.Whitelisted, err = s.whitelist.IsWhitelisted(ctx, userID, req.Currency, stringValue(req.Network), *req.Address, stringValue(req.Memo))
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if signals.KYCLevel, err = s.kycService.VerifiedLevel(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	return signals, nil
+}
+
+// touchDevice records a request from device and reports whether the device
+// is new: never seen before, or first seen within the new-device window.
+func (s *WithdrawalService) touchDevice(ctx context.Context, userID uuid.UUID, device models.RequestDevice, now time.Time) (bool, error) {
+	key := device.ID
+	if key == "" {
+		key = device.UserAgent
+	}
+	if key == "" {
+		// Nothing to recognise the client by.
+		return true, nil
+	}
+	sum := sha256.Sum256([]byte(key))
+	fingerprint := hex.EncodeToString(sum[:])
+
+	var firstSeenAt time.Time
+	err := s.mysql.GetContext(ctx, &firstSeenAt, `SELECT firstSeenAt FROM user_device WHERE userId = ? AND fingerprint = ?`,
+		userID, fingerprint)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, fmt.Errorf("failed to get device: %w", err)
+	}
+	isNew := errors.Is(err, sql.ErrNoRows) || now.Sub(firstSeenAt) < s.rules.newDeviceWindow
+
+	_, err = s.mysql.ExecContext(ctx, `INSERT INTO user_device (userId, fingerprint, userAgent, ip, firstSeenAt, lastSeenAt)
+			VALUES (?, ?, ?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE userAgent = VALUES(userAgent), ip = VALUES(ip), lastSeenAt = VALUES(lastSeenAt)`,
+		userID, fingerprint, truncate(device.UserAgent, 255), device.IP, now, now)
+	if err != nil {
+		return false, fmt.Errorf("failed to record device: %w", err)
+	}
+
+	return isNew, nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
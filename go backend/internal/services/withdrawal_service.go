@@ -2,26 +2,53 @@ package services
 
 import (
 	"context"
+	"crypto-exchange-go/internal/config"
 	"crypto-exchange-go/internal/database"
 	"crypto-exchange-go/internal/models"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/shopspring/decimal"
+	"github.com/jmoiron/sqlx"
 	"github.com/sirupsen/logrus"
 )
 
+var (
+	ErrWithdrawalStateConflict = errors.New("withdrawal is not in a state that allows this")
+	ErrWithdrawalBatched       = errors.New("withdrawal is in a batch and only moves with it")
+)
+
 type WithdrawalService struct {
 	mysql         *database.MySQL
 	walletService *WalletService
+	kycService    *KYCService
+	valuation     *ValuationService
+	destinations  *DestinationValidator
+	whitelist     AddressWhitelist
+	rules         WithdrawalRules
+	fees          WithdrawalFees
+	limits        WithdrawalLimits
 	logger        *logrus.Logger
 }
 
-func NewWithdrawalService(mysql *database.MySQL, walletService *WalletService, logger *logrus.Logger) *WithdrawalService {
+// NewWithdrawalService creates the service. Without a whitelist no address
+// counts as whitelisted, so nothing is auto-approved. Without valuation,
+// withdrawals can only be made if no limits are configured.
+func NewWithdrawalService(mysql *database.MySQL, walletService *WalletService, kycService *KYCService, valuation *ValuationService, destinations *DestinationValidator, whitelist AddressWhitelist, estimator NetworkFeeEstimator, cfg config.Withdrawal, logger *logrus.Logger) *WithdrawalService {
 	return &WithdrawalService{
 		mysql:         mysql,
 		walletService: walletService,
+		kycService:    kycService,
+		valuation:     valuation,
+		destinations:  destinations,
+		whitelist:     whitelist,
+		rules:         NewWithdrawalRules(cfg),
+		fees:          NewWithdrawalFees(cfg, estimator),
+		limits:        NewWithdrawalLimits(cfg),
 		logger:        logger,
 	}
 }
@@ -32,39 +59,61 @@ func (s *WithdrawalService) CreateFiatWithdrawal(ctx context.Context, userID uui
 		return nil, fmt.Errorf("wallet not found: %w", err)
 	}
 
-	totalAmount := req.Amount.Add(req.Fee)
-	if wallet.Balance.LessThan(totalAmount) {
-		return nil, fmt.Errorf("insufficient balance")
+	fee, err := s.fees.Quote(ctx, req.Currency, "", req.Amount)
+	if err != nil {
+		return nil, err
 	}
+	value, err := s.price(req.Currency, req.Amount)
+	if err != nil {
+		return nil, err
+	}
+	totalAmount := req.Amount.Add(fee)
 
 	withdrawal := &models.Withdrawal{
-		ID:          uuid.New(),
-		UserID:      userID,
-		Type:        "FIAT",
-		Currency:    req.Currency,
-		Amount:      req.Amount,
-		Fee:         req.Fee,
-		Status:      "PENDING",
-		Method:      req.Method,
-		Address:     req.Address,
-		BankDetails: req.BankDetails,
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
-	}
-
-	query := `INSERT INTO withdrawal (id, userId, type, currency, amount, fee, status, method, address, bankDetails, createdAt, updatedAt) 
-			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
-
-	_, err = s.mysql.Exec(query, withdrawal.ID, withdrawal.UserID, withdrawal.Type, withdrawal.Currency,
-		withdrawal.Amount, withdrawal.Fee, withdrawal.Status, withdrawal.Method, withdrawal.Address,
-		withdrawal.BankDetails, withdrawal.CreatedAt, withdrawal.UpdatedAt)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create fiat withdrawal: %w", err)
+		ID:             uuid.New(),
+		UserID:         userID,
+		Type:           "FIAT",
+		Currency:       req.Currency,
+		Amount:         req.Amount,
+		Fee:            fee,
+		ReferenceValue: value,
+		Status:         "PENDING",
+		Method:         req.Method,
+		Address:        req.Address,
+		BankDetails:    req.BankDetails,
+		CreatedAt:      time.Now(),
+		UpdatedAt:      time.Now(),
+	}
+
+	if err := s.review(ctx, userID, req, withdrawal); err != nil {
+		return nil, err
 	}
+	riskFactors, _ := json.Marshal(withdrawal.RiskFactors)
 
-	err = s.walletService.UpdateBalance(ctx, wallet.ID, totalAmount.Neg())
+	query := `INSERT INTO withdrawal (id, userId, type, currency, amount, fee, referenceValue, status, method, address, bankDetails, riskScore, riskFactors, createdAt, updatedAt) 
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	err = s.walletService.HoldFor(ctx, wallet.ID, totalAmount, models.BalanceReasonWithdrawal, withdrawal.ID.String(),
+		func(ctx context.Context, tx *sqlx.Tx) error {
+			if err := s.checkLimits(ctx, tx, withdrawal); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx, query, withdrawal.ID, withdrawal.UserID, withdrawal.Type, withdrawal.Currency,
+				withdrawal.Amount, withdrawal.Fee, withdrawal.ReferenceValue, withdrawal.Status, withdrawal.Method, withdrawal.Address,
+				withdrawal.BankDetails, withdrawal.RiskScore, riskFactors, withdrawal.CreatedAt, withdrawal.UpdatedAt)
+			if err != nil {
+				return err
+			}
+			return recordCreated(ctx, tx, withdrawal)
+		})
+	if errors.Is(err, ErrInsufficientBalance) {
+		return nil, ErrInsufficientBalance
+	}
+	if errors.Is(err, ErrWithdrawalLimitExceeded) {
+		return nil, err
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to update wallet balance: %w", err)
+		return nil, fmt.Errorf("failed to create fiat withdrawal: %w", err)
 	}
 
 	return withdrawal.ToResponse(), nil
@@ -76,46 +125,106 @@ func (s *WithdrawalService) CreateSpotWithdrawal(ctx context.Context, userID uui
 		return nil, fmt.Errorf("wallet not found: %w", err)
 	}
 
-	totalAmount := req.Amount.Add(req.Fee)
-	if wallet.Balance.LessThan(totalAmount) {
-		return nil, fmt.Errorf("insufficient balance")
+	address := strings.TrimSpace(stringValue(req.Address))
+	network, err := s.destinations.Validate(ctx, req.Currency, stringValue(req.Network), address, stringValue(req.Memo))
+	if err != nil {
+		return nil, err
+	}
+	req.Address, req.Network = &address, &network
+	req.Memo = nullIfEmpty(strings.TrimSpace(stringValue(req.Memo)))
+
+	if err := s.checkWhitelist(ctx, userID, req); err != nil {
+		return nil, err
 	}
 
-	withdrawal := &models.Withdrawal{
-		ID:        uuid.New(),
-		UserID:    userID,
-		Type:      "SPOT",
-		Currency:  req.Currency,
-		Amount:    req.Amount,
-		Fee:       req.Fee,
-		Status:    "PENDING",
-		Method:    req.Method,
-		Address:   req.Address,
-		Network:   req.Network,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
-	}
-
-	query := `INSERT INTO withdrawal (id, userId, type, currency, amount, fee, status, method, address, network, createdAt, updatedAt) 
-			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
-
-	_, err = s.mysql.Exec(query, withdrawal.ID, withdrawal.UserID, withdrawal.Type, withdrawal.Currency,
-		withdrawal.Amount, withdrawal.Fee, withdrawal.Status, withdrawal.Method, withdrawal.Address,
-		withdrawal.Network, withdrawal.CreatedAt, withdrawal.UpdatedAt)
+	fee, err := s.fees.Quote(ctx, req.Currency, network, req.Amount)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create spot withdrawal: %w", err)
+		return nil, err
+	}
+	value, err := s.price(req.Currency, req.Amount)
+	if err != nil {
+		return nil, err
+	}
+	totalAmount := req.Amount.Add(fee)
+
+	withdrawal := &models.Withdrawal{
+		ID:             uuid.New(),
+		UserID:         userID,
+		Type:           "SPOT",
+		Currency:       req.Currency,
+		Amount:         req.Amount,
+		Fee:            fee,
+		ReferenceValue: value,
+		Status:         "PENDING",
+		Method:         req.Method,
+		Address:        req.Address,
+		Network:        req.Network,
+		Memo:           req.Memo,
+		CreatedAt:      time.Now(),
+		UpdatedAt:      time.Now(),
+	}
+
+	if err := s.review(ctx, userID, req, withdrawal); err != nil {
+		return nil, err
 	}
+	riskFactors, _ := json.Marshal(withdrawal.RiskFactors)
 
-	err = s.walletService.UpdateBalance(ctx, wallet.ID, totalAmount.Neg())
+	query := `INSERT INTO withdrawal (id, userId, type, currency, amount, fee, referenceValue, status, method, address, network, memo, riskScore, riskFactors, createdAt, updatedAt) 
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	err = s.walletService.HoldFor(ctx, wallet.ID, totalAmount, models.BalanceReasonWithdrawal, withdrawal.ID.String(),
+		func(ctx context.Context, tx *sqlx.Tx) error {
+			if err := s.checkLimits(ctx, tx, withdrawal); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx, query, withdrawal.ID, withdrawal.UserID, withdrawal.Type, withdrawal.Currency,
+				withdrawal.Amount, withdrawal.Fee, withdrawal.ReferenceValue, withdrawal.Status, withdrawal.Method, withdrawal.Address,
+				withdrawal.Network, withdrawal.Memo, withdrawal.RiskScore, riskFactors, withdrawal.CreatedAt, withdrawal.UpdatedAt)
+			if err != nil {
+				return err
+			}
+			return recordCreated(ctx, tx, withdrawal)
+		})
+	if errors.Is(err, ErrInsufficientBalance) {
+		return nil, ErrInsufficientBalance
+	}
+	if errors.Is(err, ErrWithdrawalLimitExceeded) {
+		return nil, err
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to update wallet balance: %w", err)
+		return nil, fmt.Errorf("failed to create spot withdrawal: %w", err)
 	}
 
 	return withdrawal.ToResponse(), nil
 }
 
+// checkWhitelist refuses withdrawals to addresses outside the address book
+// for users who turned on whitelist-only mode.
+func (s *WithdrawalService) checkWhitelist(ctx context.Context, userID uuid.UUID, req *models.CreateWithdrawalRequest) error {
+	if s.whitelist == nil {
+		return nil
+	}
+
+	only, err := s.whitelist.WhitelistOnly(ctx, userID)
+	if err != nil || !only {
+		return err
+	}
+	if req.Address == nil {
+		return ErrAddressNotWhitelisted
+	}
+
+	whitelisted, err := s.whitelist.IsWhitelisted(ctx, userID, req.Currency, stringValue(req.Network), *req.Address, stringValue(req.Memo))
+	if err != nil {
+		return err
+	}
+	if !whitelisted {
+		return ErrAddressNotWhitelisted
+	}
+	return nil
+}
+
 func (s *WithdrawalService) GetUserWithdrawals(ctx context.Context, userID uuid.UUID) ([]*models.WithdrawalResponse, error) {
-	query := `SELECT id, userId, type, currency, amount, fee, status, method, address, network, bankDetails, createdAt, updatedAt 
+	query := `SELECT id, userId, type, currency, amount, fee, status, method, address, network, memo, bankDetails, createdAt, updatedAt 
 			  FROM withdrawal WHERE userId = ? ORDER BY createdAt DESC`
 
 	rows, err := s.mysql.Query(query, userID)
@@ -129,7 +238,7 @@ func (s *WithdrawalService) GetUserWithdrawals(ctx context.Context, userID uuid.
 		withdrawal := &models.Withdrawal{}
 		err := rows.Scan(&withdrawal.ID, &withdrawal.UserID, &withdrawal.Type, &withdrawal.Currency,
 			&withdrawal.Amount, &withdrawal.Fee, &withdrawal.Status, &withdrawal.Method,
-			&withdrawal.Address, &withdrawal.Network, &withdrawal.BankDetails,
+			&withdrawal.Address, &withdrawal.Network, &withdrawal.Memo, &withdrawal.BankDetails,
 			&withdrawal.CreatedAt, &withdrawal.UpdatedAt)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan withdrawal: %w", err)
@@ -140,41 +249,374 @@ func (s *WithdrawalService) GetUserWithdrawals(ctx context.Context, userID uuid.
 	return withdrawals, nil
 }
 
+// CancelWithdrawal lets a user withdraw a request nobody has acted on yet,
+// releasing its hold back to the wallet it came from. It loses to an
+// approval that lands first.
 func (s *WithdrawalService) CancelWithdrawal(ctx context.Context, userID, withdrawalID uuid.UUID) error {
-	query := `SELECT currency, amount, fee, type FROM withdrawal WHERE id = ? AND userId = ? AND status = 'PENDING'`
-	
-	var currency string
-	var amount, fee decimal.Decimal
-	var walletType string
-	
-	err := s.mysql.Get(&currency, query, withdrawalID, userID)
+	withdrawal, err := s.getWithdrawal(ctx, withdrawalID)
+	if err != nil {
+		return err
+	}
+	if withdrawal.UserID != userID {
+		return fmt.Errorf("withdrawal not found: %w", sql.ErrNoRows)
+	}
+	if withdrawal.BatchID != nil {
+		return ErrWithdrawalBatched
+	}
+	if !models.CanTransitionWithdrawal(withdrawal.Status, models.WithdrawalStatusCanceled) {
+		return ErrWithdrawalStateConflict
+	}
+
+	return s.settle(ctx, withdrawal, &userID, models.WithdrawalActionCanceled, models.WithdrawalStatusCanceled, "", false)
+}
+
+// review scores a new withdrawal and decides whether it waits for an admin.
+func (s *WithdrawalService) review(ctx context.Context, userID uuid.UUID, req *models.CreateWithdrawalRequest, withdrawal *models.Withdrawal) error {
+	signals, err := s.assess(ctx, userID, req)
+	if err != nil {
+		return fmt.Errorf("failed to assess withdrawal risk: %w", err)
+	}
+
+	withdrawal.RiskScore, withdrawal.RiskFactors = s.rules.Score(*signals)
+	if withdrawal.RiskFactors == nil {
+		withdrawal.RiskFactors = []string{}
+	}
+
+	withdrawal.Status = models.WithdrawalStatusPending
+	if s.rules.AutoApprove(withdrawal.Currency, withdrawal.Amount, *signals, withdrawal.RiskScore) {
+		withdrawal.Status = models.WithdrawalStatusApproved
+	}
+	return nil
+}
+
+// recordCreated audits a new withdrawal, and its auto-approval if it got one.
+func recordCreated(ctx context.Context, tx *sqlx.Tx, withdrawal *models.Withdrawal) error {
+	details := map[string]interface{}{
+		"riskScore":   withdrawal.RiskScore,
+		"riskFactors": withdrawal.RiskFactors,
+	}
+
+	err := recordWithdrawalAudit(ctx, tx, withdrawal.ID, nil, models.WithdrawalActionCreated, "", models.WithdrawalStatusPending, "", details)
+	if err != nil || withdrawal.Status != models.WithdrawalStatusApproved {
+		return err
+	}
+	return recordWithdrawalAudit(ctx, tx, withdrawal.ID, nil, models.WithdrawalActionAutoApproved,
+		models.WithdrawalStatusPending, models.WithdrawalStatusApproved, "", details)
+}
+
+func recordWithdrawalAudit(ctx context.Context, tx *sqlx.Tx, withdrawalID uuid.UUID, actorID *uuid.UUID, action, from, to, reason string, details map[string]interface{}) error {
+	var detailsJSON []byte
+	if details != nil {
+		var err error
+		if detailsJSON, err = json.Marshal(details); err != nil {
+			return fmt.Errorf("failed to marshal audit details: %w", err)
+		}
+	}
+
+	_, err := tx.ExecContext(ctx, `INSERT INTO withdrawal_audit (id, withdrawalId, actorId, action, fromStatus, toStatus, reason, details, createdAt)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		uuid.New(), withdrawalID, actorID, action, nullIfEmpty(from), to, nullIfEmpty(reason), detailsJSON, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to record withdrawal audit: %w", err)
+	}
+	return nil
+}
+
+func nullIfEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+const adminWithdrawalColumns = `id, userId, type, currency, amount, fee, status, method, address, network, memo, bankDetails,
+	transactionId, riskScore, riskFactors, batchId, createdAt, updatedAt`
+
+func scanAdminWithdrawal(row interface{ Scan(...interface{}) error }) (*models.Withdrawal, error) {
+	withdrawal := &models.Withdrawal{}
+	var bankDetails, riskFactors []byte
+	err := row.Scan(&withdrawal.ID, &withdrawal.UserID, &withdrawal.Type, &withdrawal.Currency,
+		&withdrawal.Amount, &withdrawal.Fee, &withdrawal.Status, &withdrawal.Method,
+		&withdrawal.Address, &withdrawal.Network, &withdrawal.Memo, &bankDetails, &withdrawal.TransactionID,
+		&withdrawal.RiskScore, &riskFactors, &withdrawal.BatchID, &withdrawal.CreatedAt, &withdrawal.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(bankDetails) > 0 {
+		if err := json.Unmarshal(bankDetails, &withdrawal.BankDetails); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal bank details: %w", err)
+		}
+	}
+	if len(riskFactors) > 0 {
+		if err := json.Unmarshal(riskFactors, &withdrawal.RiskFactors); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal risk factors: %w", err)
+		}
+	}
+	return withdrawal, nil
+}
+
+// GetReviewQueue lists withdrawals in a status for admins, riskiest first.
+// Pending withdrawals are the review queue; approved ones wait to be sent.
+func (s *WithdrawalService) GetReviewQueue(ctx context.Context, status string, limit, offset int) ([]*models.AdminWithdrawal, error) {
+	query := `SELECT ` + adminWithdrawalColumns + ` FROM withdrawal WHERE status = ?
+			  ORDER BY riskScore DESC, createdAt ASC LIMIT ? OFFSET ?`
+
+	rows, err := s.mysql.QueryContext(ctx, query, status, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query withdrawals: %w", err)
+	}
+	defer rows.Close()
+
+	withdrawals := []*models.AdminWithdrawal{}
+	for rows.Next() {
+		withdrawal, err := scanAdminWithdrawal(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan withdrawal: %w", err)
+		}
+		withdrawals = append(withdrawals, withdrawal.ToAdmin())
+	}
+
+	return withdrawals, rows.Err()
+}
+
+// GetWithdrawalReview returns a withdrawal with its audit trail.
+func (s *WithdrawalService) GetWithdrawalReview(ctx context.Context, withdrawalID uuid.UUID) (*models.WithdrawalReview, error) {
+	withdrawal, err := s.getWithdrawal(ctx, withdrawalID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.mysql.QueryContext(ctx, `SELECT id, withdrawalId, actorId, action, fromStatus, toStatus, reason, details, createdAt
+			  FROM withdrawal_audit WHERE withdrawalId = ? ORDER BY createdAt ASC`, withdrawalID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query withdrawal audit: %w", err)
+	}
+	defer rows.Close()
+
+	review := &models.WithdrawalReview{
+		Withdrawal: withdrawal.ToAdmin(),
+		Audit:      []*models.WithdrawalAudit{},
+	}
+	for rows.Next() {
+		entry := &models.WithdrawalAudit{}
+		var details []byte
+		err := rows.Scan(&entry.ID, &entry.WithdrawalID, &entry.ActorID, &entry.Action, &entry.FromStatus,
+			&entry.ToStatus, &entry.Reason, &details, &entry.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan withdrawal audit: %w", err)
+		}
+		if len(details) > 0 {
+			if err := json.Unmarshal(details, &entry.Details); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal audit details: %w", err)
+			}
+		}
+		review.Audit = append(review.Audit, entry)
+	}
+
+	return review, rows.Err()
+}
+
+func (s *WithdrawalService) getWithdrawal(ctx context.Context, withdrawalID uuid.UUID) (*models.Withdrawal, error) {
+	row := s.mysql.QueryRowContext(ctx, `SELECT `+adminWithdrawalColumns+` FROM withdrawal WHERE id = ?`, withdrawalID)
+	withdrawal, err := scanAdminWithdrawal(row)
+	if err != nil {
+		return nil, fmt.Errorf("withdrawal not found: %w", err)
+	}
+	return withdrawal, nil
+}
+
+// ApproveWithdrawal clears a pending withdrawal to be sent.
+func (s *WithdrawalService) ApproveWithdrawal(ctx context.Context, adminID, withdrawalID uuid.UUID, reason string) error {
+	withdrawal, err := s.withdrawalFor(ctx, withdrawalID, models.WithdrawalStatusApproved)
+	if err != nil {
+		return err
+	}
+	return s.advance(ctx, withdrawal, &adminID, models.WithdrawalActionApproved, models.WithdrawalStatusApproved, reason, nil)
+}
+
+// RejectWithdrawal refuses a withdrawal that hasn't been sent or batched and
+// releases its hold back to the user.
+func (s *WithdrawalService) RejectWithdrawal(ctx context.Context, adminID, withdrawalID uuid.UUID, reason string) error {
+	withdrawal, err := s.withdrawalFor(ctx, withdrawalID, models.WithdrawalStatusRejected)
+	if err != nil {
+		return err
+	}
+	return s.settle(ctx, withdrawal, &adminID, models.WithdrawalActionRejected, models.WithdrawalStatusRejected, reason, false)
+}
+
+// MarkWithdrawalBroadcast records that an approved withdrawal's transaction
+// went out under transactionID. Its funds stay held until it confirms or
+// fails.
+func (s *WithdrawalService) MarkWithdrawalBroadcast(ctx context.Context, adminID, withdrawalID uuid.UUID, transactionID string) error {
+	withdrawal, err := s.withdrawalFor(ctx, withdrawalID, models.WithdrawalStatusBroadcast)
+	if err != nil {
+		return err
+	}
+	return s.advance(ctx, withdrawal, &adminID, models.WithdrawalActionBroadcast, models.WithdrawalStatusBroadcast, "", &transactionID)
+}
+
+// ConfirmWithdrawal records that a broadcast withdrawal settled on chain and
+// captures its hold.
+func (s *WithdrawalService) ConfirmWithdrawal(ctx context.Context, adminID, withdrawalID uuid.UUID) error {
+	withdrawal, err := s.withdrawalFor(ctx, withdrawalID, models.WithdrawalStatusConfirmed)
+	if err != nil {
+		return err
+	}
+	return s.settle(ctx, withdrawal, &adminID, models.WithdrawalActionConfirmed, models.WithdrawalStatusConfirmed, "", true)
+}
+
+// FailWithdrawal records that a broadcast transaction was dropped or
+// reverted and releases the hold back to the user.
+func (s *WithdrawalService) FailWithdrawal(ctx context.Context, adminID, withdrawalID uuid.UUID, reason string) error {
+	withdrawal, err := s.withdrawalFor(ctx, withdrawalID, models.WithdrawalStatusFailed)
 	if err != nil {
-		return fmt.Errorf("withdrawal not found or cannot be canceled: %w", err)
+		return err
 	}
+	return s.settle(ctx, withdrawal, &adminID, models.WithdrawalActionFailed, models.WithdrawalStatusFailed, reason, false)
+}
 
-	updateQuery := `UPDATE withdrawal SET status = 'CANCELED', updatedAt = ? WHERE id = ?`
-	_, err = s.mysql.Exec(updateQuery, time.Now(), withdrawalID)
+// withdrawalFor loads a withdrawal that is about to move to status to on
+// its own; batched withdrawals move with their batch instead.
+func (s *WithdrawalService) withdrawalFor(ctx context.Context, withdrawalID uuid.UUID, to string) (*models.Withdrawal, error) {
+	withdrawal, err := s.getWithdrawal(ctx, withdrawalID)
 	if err != nil {
-		return fmt.Errorf("failed to cancel withdrawal: %w", err)
+		return nil, err
+	}
+	if withdrawal.BatchID != nil {
+		return nil, ErrWithdrawalBatched
 	}
+	if !models.CanTransitionWithdrawal(withdrawal.Status, to) {
+		return nil, ErrWithdrawalStateConflict
+	}
+	return withdrawal, nil
+}
 
-	var wType models.WalletType
-	if walletType == "FIAT" {
-		wType = models.WalletTypeFiat
-	} else {
-		wType = models.WalletTypeSpot
+// advance makes a transition that leaves the hold alone.
+func (s *WithdrawalService) advance(ctx context.Context, withdrawal *models.Withdrawal, actorID *uuid.UUID, action, to, reason string, transactionID *string) error {
+	tx, err := s.mysql.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback()
+
+	if err := transitionWithdrawal(ctx, tx, withdrawal, actorID, action, to, reason, transactionID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit withdrawal transition: %w", err)
+	}
+	return nil
+}
 
-	wallet, err := s.walletService.GetWallet(ctx, userID, currency, wType)
+// settle makes a transition that ends the hold: capturing it when the funds
+// left, releasing it to the wallet they came from otherwise. The balance
+// change and the status change commit together.
+func (s *WithdrawalService) settle(ctx context.Context, withdrawal *models.Withdrawal, actorID *uuid.UUID, action, to, reason string, capture bool) error {
+	wallet, err := s.walletService.GetWallet(ctx, withdrawal.UserID, withdrawal.Currency, models.WalletType(withdrawal.Type))
 	if err != nil {
 		return fmt.Errorf("failed to get wallet: %w", err)
 	}
 
-	refundAmount := amount.Add(fee)
-	err = s.walletService.UpdateBalance(ctx, wallet.ID, refundAmount)
+	move := s.walletService.ReleaseFor
+	if capture {
+		move = s.walletService.CaptureFor
+	}
+
+	err = move(ctx, wallet.ID, withdrawal.Amount.Add(withdrawal.Fee), models.BalanceReasonWithdrawal, withdrawal.ID.String(),
+		func(ctx context.Context, tx *sqlx.Tx) error {
+			return transitionWithdrawal(ctx, tx, withdrawal, actorID, action, to, reason, nil)
+		})
+	if errors.Is(err, ErrWithdrawalStateConflict) {
+		return err
+	}
 	if err != nil {
-		return fmt.Errorf("failed to refund wallet balance: %w", err)
+		return fmt.Errorf("failed to settle withdrawal funds: %w", err)
+	}
+	return nil
+}
+
+// moveBatch makes the same transition for every withdrawal of a batch,
+// settling their holds as settle would, and runs record, all in one
+// transaction. Holds are captured when the batch confirmed and released
+// when it failed; other transitions leave them alone.
+func (s *WithdrawalService) moveBatch(ctx context.Context, batchID uuid.UUID, actorID *uuid.UUID, action, to, reason string, transactionID *string, record func(ctx context.Context, tx *sqlx.Tx) error) error {
+	rows, err := s.mysql.QueryContext(ctx, `SELECT `+adminWithdrawalColumns+` FROM withdrawal WHERE batchId = ?`, batchID)
+	if err != nil {
+		return fmt.Errorf("failed to query batch withdrawals: %w", err)
+	}
+	defer rows.Close()
+
+	var withdrawals []*models.Withdrawal
+	for rows.Next() {
+		withdrawal, err := scanAdminWithdrawal(rows)
+		if err != nil {
+			return fmt.Errorf("failed to scan withdrawal: %w", err)
+		}
+		if !models.CanTransitionWithdrawal(withdrawal.Status, to) {
+			return ErrWithdrawalStateConflict
+		}
+		withdrawals = append(withdrawals, withdrawal)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to query batch withdrawals: %w", err)
+	}
+
+	var operation models.BalanceOperation
+	switch to {
+	case models.WithdrawalStatusConfirmed:
+		operation = models.BalanceOperationCapture
+	case models.WithdrawalStatusFailed:
+		operation = models.BalanceOperationRelease
+	}
+
+	var changes []balanceChange
+	if operation != "" {
+		for _, withdrawal := range withdrawals {
+			wallet, err := s.walletService.GetWallet(ctx, withdrawal.UserID, withdrawal.Currency, models.WalletType(withdrawal.Type))
+			if err != nil {
+				return fmt.Errorf("failed to get wallet: %w", err)
+			}
+			changes = append(changes, newBalanceChange(operation, wallet.ID, withdrawal.Amount.Add(withdrawal.Fee),
+				models.BalanceReasonWithdrawal, withdrawal.ID.String()))
+		}
 	}
 
+	err = s.walletService.balances.applyAll(ctx, changes, func(ctx context.Context, tx *sqlx.Tx) error {
+		for _, withdrawal := range withdrawals {
+			if err := transitionWithdrawal(ctx, tx, withdrawal, actorID, action, to, reason, transactionID); err != nil {
+				return err
+			}
+		}
+		return record(ctx, tx)
+	})
+	if errors.Is(err, ErrWithdrawalStateConflict) || errors.Is(err, ErrWithdrawalBatchState) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to settle batch withdrawals: %w", err)
+	}
 	return nil
 }
+
+// transitionWithdrawal moves a withdrawal on from the status it was read in
+// and audits the move. If someone else moved it first, or batched or
+// unbatched it, nothing is written and ErrWithdrawalStateConflict is
+// returned, rolling back the transaction.
+func transitionWithdrawal(ctx context.Context, tx *sqlx.Tx, withdrawal *models.Withdrawal, actorID *uuid.UUID, action, to, reason string, transactionID *string) error {
+	result, err := tx.ExecContext(ctx, `UPDATE withdrawal SET status = ?, transactionId = COALESCE(?, transactionId), updatedAt = ?
+			WHERE id = ? AND status = ? AND batchId <=> ?`, to, transactionID, time.Now(), withdrawal.ID, withdrawal.Status, withdrawal.BatchID)
+	if err != nil {
+		return fmt.Errorf("failed to update withdrawal status: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrWithdrawalStateConflict
+	}
+
+	var details map[string]interface{}
+	if transactionID != nil {
+		details = map[string]interface{}{"transactionId": *transactionID}
+	}
+	return recordWithdrawalAudit(ctx, tx, withdrawal.ID, actorID, action, withdrawal.Status, to, reason, details)
+}
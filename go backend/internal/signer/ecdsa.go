@@ -0,0 +1,87 @@
+package signer
+
+import (
+	"crypto-exchange-go/internal/hdwallet"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+)
+
+var (
+	curveN, _ = new(big.Int).SetString("FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEBAAEDCE6AF48A03BBFD25E8CD0364141", 16)
+	halfN     = new(big.Int).Rsh(curveN, 1)
+)
+
+// Sign makes a DER encoded secp256k1 ECDSA signature of a 32 byte digest,
+// with the nonce derived as RFC 6979 describes and the low S value
+// Bitcoin requires.
+func Sign(key, digest []byte) ([]byte, error) {
+	if len(digest) != 32 {
+		return nil, errors.New("digest must be 32 bytes")
+	}
+	d := new(big.Int).SetBytes(key)
+	z := new(big.Int).SetBytes(digest)
+
+	h1 := new(big.Int).Mod(z, curveN).FillBytes(make([]byte, 32))
+	v := make([]byte, 32)
+	for i := range v {
+		v[i] = 0x01
+	}
+	k := make([]byte, 32)
+
+	k = hmacSHA256(k, v, []byte{0x00}, key, h1)
+	v = hmacSHA256(k, v)
+	k = hmacSHA256(k, v, []byte{0x01}, key, h1)
+	v = hmacSHA256(k, v)
+
+	for {
+		v = hmacSHA256(k, v)
+		nonce := new(big.Int).SetBytes(v)
+
+		if nonce.Sign() > 0 && nonce.Cmp(curveN) < 0 {
+			point, err := hdwallet.PublicKeyFromPrivate(v)
+			if err != nil {
+				return nil, err
+			}
+			r := new(big.Int).SetBytes(point.Compressed()[1:])
+			r.Mod(r, curveN)
+
+			s := new(big.Int).Mul(r, d)
+			s.Add(s, z)
+			s.Mul(s, new(big.Int).ModInverse(nonce, curveN))
+			s.Mod(s, curveN)
+
+			if r.Sign() != 0 && s.Sign() != 0 {
+				if s.Cmp(halfN) > 0 {
+					s.Sub(curveN, s)
+				}
+				return encodeDER(r, s), nil
+			}
+		}
+
+		k = hmacSHA256(k, v, []byte{0x00})
+		v = hmacSHA256(k, v)
+	}
+}
+
+func hmacSHA256(key []byte, data ...[]byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	for _, d := range data {
+		mac.Write(d)
+	}
+	return mac.Sum(nil)
+}
+
+func encodeDER(r, s *big.Int) []byte {
+	integer := func(n *big.Int) []byte {
+		b := n.Bytes()
+		if b[0]&0x80 != 0 {
+			b = append([]byte{0x00}, b...)
+		}
+		return append([]byte{0x02, byte(len(b))}, b...)
+	}
+
+	body := append(integer(r), integer(s)...)
+	return append([]byte{0x30, byte(len(body))}, body...)
+}
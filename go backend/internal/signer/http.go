@@ -0,0 +1,139 @@
+package signer
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// NewHandler serves signer to the API: GET /keys and POST /sign, for
+// requests carrying token as a bearer token.
+func NewHandler(signer Signer, token string, logger *logrus.Logger) http.Handler {
+	router := gin.New()
+	router.Use(gin.Recovery())
+
+	router.Use(func(c *gin.Context) {
+		given := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if token == "" || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": ErrUnauthorized.Error()})
+			return
+		}
+		c.Next()
+	})
+
+	router.GET("/keys", func(c *gin.Context) {
+		keys, err := signer.PublicKeys(c.Request.Context())
+		if err != nil {
+			logger.WithError(err).Error("Failed to list signer keys")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list keys"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"data": keys})
+	})
+
+	router.POST("/sign", func(c *gin.Context) {
+		var req Request
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		signed, err := signer.SignTransaction(c.Request.Context(), &req)
+		switch {
+		case errors.Is(err, ErrPolicy):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, ErrUnknownKey):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		case err != nil:
+			logger.WithError(err).WithField("reference", req.Reference).Error("Failed to sign transaction")
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusOK, gin.H{"data": signed})
+		}
+	})
+
+	return router
+}
+
+// Client is a Signer that calls the signer process over HTTP.
+type Client struct {
+	url   string
+	token string
+	http  *http.Client
+}
+
+func NewClient(url, token string) *Client {
+	return &Client{
+		url:   strings.TrimRight(url, "/"),
+		token: token,
+		http:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (c *Client) PublicKeys(ctx context.Context) (map[string]string, error) {
+	var keys map[string]string
+	if err := c.call(ctx, http.MethodGet, "/keys", nil, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (c *Client) SignTransaction(ctx context.Context, req *Request) (string, error) {
+	var signed string
+	if err := c.call(ctx, http.MethodPost, "/sign", req, &signed); err != nil {
+		return "", err
+	}
+	return signed, nil
+}
+
+func (c *Client) call(ctx context.Context, method, path string, body, data interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.url+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach signer: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Data  json.RawMessage `json:"data"`
+		Error string          `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode signer response: %w", err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return json.Unmarshal(result.Data, data)
+	case http.StatusUnauthorized:
+		return ErrUnauthorized
+	case http.StatusForbidden:
+		return fmt.Errorf("%w%s", ErrPolicy, strings.TrimPrefix(result.Error, ErrPolicy.Error()))
+	case http.StatusUnprocessableEntity:
+		return fmt.Errorf("%w%s", ErrUnknownKey, strings.TrimPrefix(result.Error, ErrUnknownKey.Error()))
+	}
+	return fmt.Errorf("signer returned %d: %s", resp.StatusCode, result.Error)
+}
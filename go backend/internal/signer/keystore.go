@@ -0,0 +1,194 @@
+package signer
+
+import (
+	"crypto-exchange-go/internal/hdwallet"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+var (
+	ErrWrongPassphrase = errors.New("wrong keystore passphrase")
+	ErrKeyExists       = errors.New("a key with this id already exists")
+)
+
+// scrypt cost parameters; the keystore is opened once per process start.
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// Keystore is a file of secp256k1 private keys, each sealed with NaCl
+// secretbox under a key scrypt derives from the passphrase. Public keys are
+// stored in the clear so they can be listed without it.
+type Keystore struct {
+	path   string
+	secret [32]byte
+	file   keystoreFile
+}
+
+type keystoreFile struct {
+	Version int                  `json:"version"`
+	Salt    string               `json:"salt"`
+	Keys    map[string]sealedKey `json:"keys"`
+}
+
+type sealedKey struct {
+	PublicKey string `json:"publicKey"`
+	Nonce     string `json:"nonce"`
+	Box       string `json:"box"`
+}
+
+// OpenKeystore opens the keystore at path, creating an empty one if there
+// is none. Every key is opened once to check the passphrase.
+func OpenKeystore(path, passphrase string) (*Keystore, error) {
+	if passphrase == "" {
+		return nil, errors.New("keystore passphrase is empty")
+	}
+
+	ks := &Keystore{path: path}
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		ks.file = keystoreFile{Version: 1, Salt: hex.EncodeToString(salt), Keys: map[string]sealedKey{}}
+	case err != nil:
+		return nil, fmt.Errorf("failed to read keystore: %w", err)
+	default:
+		if err := json.Unmarshal(data, &ks.file); err != nil {
+			return nil, fmt.Errorf("failed to parse keystore: %w", err)
+		}
+		if ks.file.Keys == nil {
+			ks.file.Keys = map[string]sealedKey{}
+		}
+	}
+
+	salt, err := hex.DecodeString(ks.file.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid keystore salt: %w", err)
+	}
+	secret, err := scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, 32)
+	if err != nil {
+		return nil, err
+	}
+	copy(ks.secret[:], secret)
+
+	if _, err := ks.keys(); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+// Add seals a 32 byte private key under id and saves the keystore. It
+// returns the compressed public key.
+func (ks *Keystore) Add(id string, key []byte) (string, error) {
+	if _, ok := ks.file.Keys[id]; ok {
+		return "", ErrKeyExists
+	}
+	public, err := hdwallet.PublicKeyFromPrivate(key)
+	if err != nil {
+		return "", err
+	}
+
+	var nonce [24]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return "", err
+	}
+	box := secretbox.Seal(nil, key, &nonce, &ks.secret)
+
+	publicKey := hex.EncodeToString(public.Compressed())
+	ks.file.Keys[id] = sealedKey{
+		PublicKey: publicKey,
+		Nonce:     hex.EncodeToString(nonce[:]),
+		Box:       hex.EncodeToString(box),
+	}
+	if err := ks.save(); err != nil {
+		delete(ks.file.Keys, id)
+		return "", err
+	}
+	return publicKey, nil
+}
+
+// Generate adds a new random key under id.
+func (ks *Keystore) Generate(id string) (string, error) {
+	key := make([]byte, 32)
+	for {
+		if _, err := rand.Read(key); err != nil {
+			return "", err
+		}
+		if _, err := hdwallet.PublicKeyFromPrivate(key); err == nil {
+			return ks.Add(id, key)
+		}
+	}
+}
+
+// PublicKeys returns the public keys by id.
+func (ks *Keystore) PublicKeys() map[string]string {
+	keys := make(map[string]string, len(ks.file.Keys))
+	for id, sealed := range ks.file.Keys {
+		keys[id] = sealed.PublicKey
+	}
+	return keys
+}
+
+// keys opens every key.
+func (ks *Keystore) keys() (map[string][]byte, error) {
+	keys := make(map[string][]byte, len(ks.file.Keys))
+	for id, sealed := range ks.file.Keys {
+		nonceBytes, err := hex.DecodeString(sealed.Nonce)
+		if err != nil || len(nonceBytes) != 24 {
+			return nil, fmt.Errorf("key %s: invalid nonce", id)
+		}
+		box, err := hex.DecodeString(sealed.Box)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: invalid box", id)
+		}
+
+		var nonce [24]byte
+		copy(nonce[:], nonceBytes)
+		key, ok := secretbox.Open(nil, box, &nonce, &ks.secret)
+		if !ok {
+			return nil, ErrWrongPassphrase
+		}
+		keys[id] = key
+	}
+	return keys, nil
+}
+
+// save writes the keystore next to itself and renames it into place, so a
+// crash never leaves half a file.
+func (ks *Keystore) save() error {
+	data, err := json.MarshalIndent(ks.file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(ks.path), ".keystore-*")
+	if err != nil {
+		return fmt.Errorf("failed to save keystore: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save keystore: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save keystore: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), ks.path); err != nil {
+		return fmt.Errorf("failed to save keystore: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package signer
+
+import (
+	"crypto-exchange-go/internal/hdwallet"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"unicode"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Master wallets made before the signer existed kept a BIP39 mnemonic in
+// MySQL. Private derivation lives here, next to the keystore, so those
+// wallets' keys can be moved into it; hdwallet stays public only.
+
+var ErrInvalidMnemonic = errors.New("invalid mnemonic")
+
+// receivingBranch is the BIP44 change level of addresses handed out.
+const receivingBranch = 0
+
+type extendedPrivateKey struct {
+	key       []byte
+	chainCode []byte
+}
+
+// AccountKey is the extended private key of a BIP44 account,
+// m/44'/coin'/account'.
+type AccountKey struct {
+	extendedPrivateKey
+}
+
+// MnemonicAccount derives a BIP44 account key from a BIP39 mnemonic with no
+// passphrase. The words aren't checked against a word list; check a derived
+// address instead.
+func MnemonicAccount(mnemonic string, coinType, account uint32) (*AccountKey, error) {
+	words := strings.Fields(mnemonic)
+	if len(words) < 12 || len(words)%3 != 0 {
+		return nil, fmt.Errorf("%w: expected a multiple of 3 words, at least 12", ErrInvalidMnemonic)
+	}
+	phrase := strings.Join(words, " ")
+	for _, r := range phrase {
+		if r > unicode.MaxASCII {
+			return nil, fmt.Errorf("%w: only ASCII word lists are supported", ErrInvalidMnemonic)
+		}
+	}
+
+	seed := pbkdf2.Key([]byte(phrase), []byte("mnemonic"), 2048, 64, sha512.New)
+	mac := hmac.New(sha512.New, []byte("Bitcoin seed"))
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+
+	node := extendedPrivateKey{key: sum[:32], chainCode: sum[32:]}
+	if _, err := hdwallet.PublicKeyFromPrivate(node.key); err != nil {
+		return nil, fmt.Errorf("%w: unusable seed", ErrInvalidMnemonic)
+	}
+
+	for _, index := range []uint32{44, coinType, account} {
+		var err error
+		if node, err = node.child(index + hdwallet.HardenedOffset); err != nil {
+			return nil, err
+		}
+	}
+	return &AccountKey{node}, nil
+}
+
+// PublicKey is the account's public key, the one its xpub carries.
+func (a *AccountKey) PublicKey() (*hdwallet.PublicKey, error) {
+	return hdwallet.PublicKeyFromPrivate(a.key)
+}
+
+// Key derives the private key of the receiving address at index, the one
+// hdwallet.DeriveAddress derives from the account's xpub.
+func (a *AccountKey) Key(index uint32) ([]byte, error) {
+	branch, err := a.child(receivingBranch)
+	if err != nil {
+		return nil, err
+	}
+	child, err := branch.child(index)
+	if err != nil {
+		return nil, err
+	}
+	return child.key, nil
+}
+
+// child derives the child at index (CKDpriv).
+func (k extendedPrivateKey) child(index uint32) (extendedPrivateKey, error) {
+	mac := hmac.New(sha512.New, k.chainCode)
+	if index >= hdwallet.HardenedOffset {
+		mac.Write([]byte{0})
+		mac.Write(k.key)
+	} else {
+		public, err := hdwallet.PublicKeyFromPrivate(k.key)
+		if err != nil {
+			return extendedPrivateKey{}, err
+		}
+		mac.Write(public.Compressed())
+	}
+	mac.Write(binary.BigEndian.AppendUint32(nil, index))
+	sum := mac.Sum(nil)
+
+	tweak := new(big.Int).SetBytes(sum[:32])
+	if tweak.Cmp(curveN) >= 0 {
+		return extendedPrivateKey{}, hdwallet.ErrInvalidChild
+	}
+	key := tweak.Add(tweak, new(big.Int).SetBytes(k.key))
+	key.Mod(key, curveN)
+	if key.Sign() == 0 {
+		return extendedPrivateKey{}, hdwallet.ErrInvalidChild
+	}
+
+	return extendedPrivateKey{key: key.FillBytes(make([]byte, 32)), chainCode: sum[32:]}, nil
+}
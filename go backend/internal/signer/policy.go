@@ -0,0 +1,59 @@
+package signer
+
+import (
+	"crypto-exchange-go/internal/config"
+	"crypto-exchange-go/internal/utxo"
+	"fmt"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// Policy is what the signer checks before it signs. Chains without a
+// ChainPolicy are refused.
+type Policy struct {
+	Chains map[string]ChainPolicy
+}
+
+// ChainPolicy limits one chain, in base units; a zero limit is off. Amounts
+// count what leaves the signer's keys, so change back to them is free.
+type ChainPolicy struct {
+	MaxAmount   int64
+	DailyAmount int64
+	MaxFee      int64
+}
+
+func NewPolicy(cfg map[string]config.SignerPolicy) Policy {
+	units := func(amount float64) int64 {
+		return decimal.NewFromFloat(amount).Shift(utxo.Decimals).IntPart()
+	}
+
+	policy := Policy{Chains: make(map[string]ChainPolicy, len(cfg))}
+	for chain, limits := range cfg {
+		policy.Chains[strings.ToUpper(chain)] = ChainPolicy{
+			MaxAmount:   units(limits.MaxAmount),
+			DailyAmount: units(limits.DailyAmount),
+			MaxFee:      units(limits.MaxFee),
+		}
+	}
+	return policy
+}
+
+// check allows a transaction sending amount with fee on chain, after
+// signedToday was already sent there today.
+func (p Policy) check(chain string, amount, fee, signedToday int64) error {
+	limits, ok := p.Chains[strings.ToUpper(chain)]
+	if !ok {
+		return fmt.Errorf("%w: %s isn't enabled", ErrPolicy, chain)
+	}
+	if limits.MaxAmount > 0 && amount > limits.MaxAmount {
+		return fmt.Errorf("%w: sends %d, more than %d per transaction", ErrPolicy, amount, limits.MaxAmount)
+	}
+	if limits.DailyAmount > 0 && signedToday+amount > limits.DailyAmount {
+		return fmt.Errorf("%w: %d of the daily %d already signed", ErrPolicy, signedToday, limits.DailyAmount)
+	}
+	if limits.MaxFee > 0 && fee > limits.MaxFee {
+		return fmt.Errorf("%w: fee %d is more than %d", ErrPolicy, fee, limits.MaxFee)
+	}
+	return nil
+}
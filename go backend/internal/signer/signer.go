@@ -0,0 +1,33 @@
+// Package signer keeps the keys that spend custodial funds out of the API.
+// The API only knows public keys: it sends unsigned transactions to a
+// Signer, normally the separate signer process, which checks each one
+// against its policy before signing it.
+package signer
+
+import (
+	"context"
+	"crypto-exchange-go/internal/utxo"
+	"errors"
+)
+
+var (
+	ErrUnknownKey   = errors.New("the signer holds no key for this input")
+	ErrPolicy       = errors.New("refused by the signing policy")
+	ErrUnauthorized = errors.New("signer request not authorized")
+)
+
+// Request asks for a transaction to be signed. Reference names what it pays
+// out, a withdrawal batch id, for the signer's log.
+type Request struct {
+	Reference string           `json:"reference"`
+	Tx        *utxo.UnsignedTx `json:"tx"`
+}
+
+type Signer interface {
+	// PublicKeys returns the compressed public keys the signer holds, hex
+	// encoded, by key id.
+	PublicKeys(ctx context.Context) (map[string]string, error)
+	// SignTransaction signs every input of the request's transaction and
+	// returns it hex encoded, ready to broadcast.
+	SignTransaction(ctx context.Context, req *Request) (string, error)
+}
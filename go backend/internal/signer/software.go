@@ -0,0 +1,178 @@
+package signer
+
+import (
+	"bytes"
+	"context"
+	"crypto-exchange-go/internal/hdwallet"
+	"crypto-exchange-go/internal/utxo"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ripemd160"
+)
+
+type softwareKey struct {
+	private []byte
+	public  []byte
+}
+
+// SoftwareSigner signs with the keys of a Keystore, held in memory. Its
+// daily totals restart with the process.
+type SoftwareSigner struct {
+	mu         sync.Mutex
+	keys       map[string]softwareKey
+	publicKeys map[string]string
+	policy     Policy
+	day        time.Time
+	signed     map[string]int64
+	logger     *logrus.Logger
+}
+
+func NewSoftwareSigner(keystore *Keystore, policy Policy, logger *logrus.Logger) (*SoftwareSigner, error) {
+	private, err := keystore.keys()
+	if err != nil {
+		return nil, err
+	}
+
+	// Inputs name the key that spends them by its hash.
+	keys := make(map[string]softwareKey, len(private))
+	for id, key := range private {
+		public, err := hdwallet.PublicKeyFromPrivate(key)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", id, err)
+		}
+		compressed := public.Compressed()
+		keys[hex.EncodeToString(hash160(compressed))] = softwareKey{private: key, public: compressed}
+	}
+
+	return &SoftwareSigner{
+		keys:       keys,
+		publicKeys: keystore.PublicKeys(),
+		policy:     policy,
+		signed:     make(map[string]int64),
+		logger:     logger,
+	}, nil
+}
+
+func (s *SoftwareSigner) PublicKeys(ctx context.Context) (map[string]string, error) {
+	return s.publicKeys, nil
+}
+
+// SignTransaction signs if the policy allows what the transaction sends.
+// Legacy inputs don't commit to the value they spend, so for those the fee
+// limit trusts the values in the request.
+func (s *SoftwareSigner) SignTransaction(ctx context.Context, req *Request) (string, error) {
+	if req.Tx == nil || req.Reference == "" {
+		return "", fmt.Errorf("%w: a transaction and its reference are required", ErrPolicy)
+	}
+	tx := req.Tx
+	chain, ok := utxo.ChainByName(tx.Chain)
+	if !ok {
+		return "", fmt.Errorf("%w: unsupported chain %q", ErrPolicy, tx.Chain)
+	}
+
+	signers := make([]softwareKey, len(tx.Inputs))
+	var in int64
+	for i, input := range tx.Inputs {
+		hash, err := tx.KeyHash(i)
+		if err != nil {
+			return "", err
+		}
+		key, ok := s.keys[hex.EncodeToString(hash)]
+		if !ok {
+			return "", fmt.Errorf("%w: input %s:%d", ErrUnknownKey, input.TxID, input.Index)
+		}
+		signers[i] = key
+		in += input.Value
+	}
+
+	var out, sent int64
+	for _, output := range tx.Outputs {
+		out += output.Value
+		own, err := s.pays(chain, output.Address)
+		if err != nil {
+			return "", err
+		}
+		if !own {
+			sent += output.Value
+		}
+	}
+	fee := in - out
+	if fee < 0 {
+		return "", fmt.Errorf("%w: outputs are worth more than the inputs", ErrPolicy)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	if !today.Equal(s.day) {
+		s.day, s.signed = today, make(map[string]int64)
+	}
+	if err := s.policy.check(chain.Name, sent, fee, s.signed[chain.Name]); err != nil {
+		s.logger.WithError(err).WithField("reference", req.Reference).Warn("Signing refused")
+		return "", err
+	}
+
+	signatures := make([]utxo.InputSignature, len(tx.Inputs))
+	for i, key := range signers {
+		digest, err := tx.SigHash(i)
+		if err != nil {
+			return "", err
+		}
+		signature, err := Sign(key.private, digest)
+		if err != nil {
+			return "", err
+		}
+		signatures[i] = utxo.InputSignature{
+			Signature: append(signature, utxo.SigHashAll),
+			PublicKey: key.public,
+		}
+	}
+
+	raw, err := tx.Signed(signatures)
+	if err != nil {
+		return "", err
+	}
+	s.signed[chain.Name] += sent
+
+	s.logger.WithFields(logrus.Fields{
+		"reference": req.Reference,
+		"chain":     chain.Name,
+		"inputs":    len(tx.Inputs),
+		"sent":      sent,
+		"fee":       fee,
+	}).Info("Transaction signed")
+	return hex.EncodeToString(raw), nil
+}
+
+// pays reports whether address belongs to one of the signer's keys.
+func (s *SoftwareSigner) pays(chain utxo.Chain, address string) (bool, error) {
+	script, err := chain.Script(address)
+	if err != nil {
+		return false, err
+	}
+
+	var hash []byte
+	switch {
+	case len(script) == 22 && script[0] == 0x00 && script[1] == 0x14:
+		hash = script[2:]
+	case len(script) == 25 && bytes.HasPrefix(script, []byte{0x76, 0xa9, 0x14}):
+		hash = script[3:23]
+	default:
+		return false, nil
+	}
+	_, ok := s.keys[hex.EncodeToString(hash)]
+	return ok, nil
+}
+
+func hash160(data []byte) []byte {
+	sha := sha256.Sum256(data)
+	h := ripemd160.New()
+	h.Write(sha[:])
+	return h.Sum(nil)
+}
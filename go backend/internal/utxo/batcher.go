@@ -0,0 +1,185 @@
+package utxo
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+var ErrAlreadyReserved = errors.New("coins or withdrawals already reserved by another batch")
+
+// Payment is an approved withdrawal waiting to be sent.
+type Payment struct {
+	WithdrawalID string
+	Address      string
+	Value        int64
+}
+
+// Batch is one withdrawal transaction. Raw is the unsigned transaction,
+// hex encoded.
+type Batch struct {
+	ID        string
+	Chain     string
+	Payments  []Payment
+	Tx        *UnsignedTx
+	Raw       string
+	CreatedAt time.Time
+}
+
+// Ledger is where the batcher finds withdrawals and coins, and keeps the
+// batches it builds.
+type Ledger interface {
+	// Payments returns the chain's approved withdrawals that are in no
+	// batch yet, oldest first.
+	Payments(ctx context.Context, chain string) ([]Payment, error)
+	// Unspent returns the chain's coins no batch has reserved.
+	Unspent(ctx context.Context, chain string) ([]Coin, error)
+	// ChangeAddress is where change goes back to: the chain's master wallet.
+	ChangeAddress(ctx context.Context, chain string) (string, error)
+	// Reserve stores the batch and reserves its coins and withdrawals, all
+	// or nothing. It fails with ErrAlreadyReserved if another batch took any
+	// of them first.
+	Reserve(ctx context.Context, batch *Batch) error
+}
+
+type BatcherOptions struct {
+	// FeeRate is in base units per virtual byte.
+	FeeRate int64
+	// MaxOutputs caps the withdrawals in one batch; zero means no cap.
+	MaxOutputs int
+}
+
+type Batcher struct {
+	chain  Chain
+	ledger Ledger
+	opts   BatcherOptions
+	logger *logrus.Logger
+}
+
+func NewBatcher(chain Chain, ledger Ledger, opts BatcherOptions, logger *logrus.Logger) *Batcher {
+	return &Batcher{
+		chain:  chain,
+		ledger: ledger,
+		opts:   opts,
+		logger: logger,
+	}
+}
+
+func (b *Batcher) Chain() string {
+	return b.chain.Name
+}
+
+// Run builds and reserves a batch of the waiting withdrawals. It returns nil
+// when none are waiting. When the coins can't pay for all of them, the
+// newest wait for the next run.
+func (b *Batcher) Run(ctx context.Context) (*Batch, error) {
+	waiting, err := b.ledger.Payments(ctx, b.chain.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	payments := make([]Payment, 0, len(waiting))
+	for _, payment := range waiting {
+		if err := b.check(payment); err != nil {
+			b.logger.WithError(err).WithFields(logrus.Fields{
+				"chain":        b.chain.Name,
+				"withdrawalId": payment.WithdrawalID,
+			}).Error("Withdrawal can't be batched")
+			continue
+		}
+		payments = append(payments, payment)
+	}
+	if b.opts.MaxOutputs > 0 && len(payments) > b.opts.MaxOutputs {
+		payments = payments[:b.opts.MaxOutputs]
+	}
+	if len(payments) == 0 {
+		return nil, nil
+	}
+
+	coins, err := b.ledger.Unspent(ctx, b.chain.Name)
+	if err != nil {
+		return nil, err
+	}
+	change, err := b.ledger.ChangeAddress(ctx, b.chain.Name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := b.chain.Script(change); err != nil {
+		return nil, fmt.Errorf("invalid change address: %w", err)
+	}
+
+	for n := len(payments); n > 0; n-- {
+		batch, err := b.build(payments[:n], coins, change)
+		if errors.Is(err, ErrInsufficientFunds) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if err := b.ledger.Reserve(ctx, batch); err != nil {
+			return nil, err
+		}
+
+		b.logger.WithFields(logrus.Fields{
+			"chain":       b.chain.Name,
+			"batchId":     batch.ID,
+			"withdrawals": len(batch.Payments),
+			"inputs":      len(batch.Tx.Inputs),
+			"fee":         batch.Tx.Fee,
+			"waiting":     len(payments) - n,
+		}).Info("Withdrawal batch built")
+		return batch, nil
+	}
+	return nil, ErrInsufficientFunds
+}
+
+func (b *Batcher) check(payment Payment) error {
+	if payment.Value < b.chain.Dust {
+		return fmt.Errorf("amount %d is below the dust limit %d", payment.Value, b.chain.Dust)
+	}
+	_, err := b.chain.Script(payment.Address)
+	return err
+}
+
+func (b *Batcher) build(payments []Payment, coins []Coin, change string) (*Batch, error) {
+	var target int64
+	outputs := make([]Output, 0, len(payments)+1)
+	for _, payment := range payments {
+		target += payment.Value
+		outputs = append(outputs, Output{Address: payment.Address, Value: payment.Value})
+	}
+
+	selection, err := SelectCoins(coins, target, len(outputs), b.opts.FeeRate, b.chain.Dust)
+	if err != nil {
+		return nil, err
+	}
+	if selection.Change > 0 {
+		outputs = append(outputs, Output{Address: change, Value: selection.Change})
+	}
+
+	tx := &UnsignedTx{
+		Chain:   b.chain.Name,
+		Inputs:  selection.Coins,
+		Outputs: outputs,
+		Fee:     selection.Fee,
+	}
+	raw, err := tx.Serialize()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Batch{
+		ID:        uuid.New().String(),
+		Chain:     b.chain.Name,
+		Payments:  append([]Payment(nil), payments...),
+		Tx:        tx,
+		Raw:       hex.EncodeToString(raw),
+		CreatedAt: time.Now(),
+	}, nil
+}
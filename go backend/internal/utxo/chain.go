@@ -0,0 +1,75 @@
+// Package utxo builds withdrawal transactions on UTXO chains. A Batcher
+// gathers approved withdrawals into one transaction per chain, selects the
+// coins that pay for it, reserves them through a Ledger and leaves the
+// unsigned transaction for the signer.
+package utxo
+
+import (
+	"crypto-exchange-go/internal/hdwallet"
+	"fmt"
+	"strings"
+)
+
+// Chain holds what building a transaction needs to know about a UTXO chain.
+// Amounts on all of them have 8 decimals.
+type Chain struct {
+	Name       string
+	PubKeyHash byte
+	ScriptHash []byte
+	// Bech32 is the segwit human readable part, empty where there is no
+	// segwit.
+	Bech32 string
+	// Dust is the smallest output worth creating, in base units.
+	Dust int64
+}
+
+const Decimals = 8
+
+var chains = map[string]Chain{
+	"BTC":  {Name: "BTC", PubKeyHash: 0x00, ScriptHash: []byte{0x05}, Bech32: "bc", Dust: 546},
+	"LTC":  {Name: "LTC", PubKeyHash: 0x30, ScriptHash: []byte{0x32, 0x05}, Bech32: "ltc", Dust: 1000},
+	"DOGE": {Name: "DOGE", PubKeyHash: 0x1e, ScriptHash: []byte{0x16}, Dust: 1000000},
+	"DASH": {Name: "DASH", PubKeyHash: 0x4c, ScriptHash: []byte{0x10}, Dust: 546},
+}
+
+// ChainByName returns a supported chain.
+func ChainByName(name string) (Chain, bool) {
+	chain, ok := chains[strings.ToUpper(name)]
+	return chain, ok
+}
+
+// Script returns the output script that pays address.
+func (c Chain) Script(address string) ([]byte, error) {
+	if c.Bech32 != "" && strings.HasPrefix(strings.ToLower(address), c.Bech32+"1") {
+		version, program, err := hdwallet.DecodeSegwit(c.Bech32, address)
+		if err != nil {
+			return nil, fmt.Errorf("%s address %s: %w", c.Name, address, err)
+		}
+		op := byte(0x00)
+		if version > 0 {
+			op = 0x50 + version
+		}
+		return append([]byte{op, byte(len(program))}, program...), nil
+	}
+
+	payload, err := hdwallet.DecodeBase58Check(address)
+	if err != nil {
+		return nil, fmt.Errorf("%s address %s: %w", c.Name, address, err)
+	}
+	if len(payload) != 21 {
+		return nil, fmt.Errorf("%s address %s: expected a 20 byte hash", c.Name, address)
+	}
+	hash := payload[1:]
+
+	if payload[0] == c.PubKeyHash {
+		script := append([]byte{0x76, 0xa9, 0x14}, hash...)
+		return append(script, 0x88, 0xac), nil
+	}
+	for _, version := range c.ScriptHash {
+		if payload[0] == version {
+			script := append([]byte{0xa9, 0x14}, hash...)
+			return append(script, 0x87), nil
+		}
+	}
+	return nil, fmt.Errorf("%s address %s: unexpected version byte 0x%02x", c.Name, address, payload[0])
+}
@@ -0,0 +1,152 @@
+package utxo
+
+import (
+	"errors"
+	"sort"
+)
+
+var ErrInsufficientFunds = errors.New("not enough unspent coins")
+
+// Coin is an unspent output the exchange can spend. ID is the ledger's id
+// for it; Script is its hex encoded output script.
+type Coin struct {
+	ID     string `json:"id"`
+	TxID   string `json:"txId"`
+	Index  uint32 `json:"index"`
+	Value  int64  `json:"value"`
+	Script string `json:"script"`
+}
+
+// Transaction sizes in virtual bytes, assuming P2WPKH inputs and outputs.
+const (
+	overheadVBytes = 11
+	inputVBytes    = 68
+	outputVBytes   = 31
+
+	maxBnBTries = 100000
+)
+
+// Selection is the coins that pay for a transaction. Change is zero when
+// the transaction has no change output; anything left over is in Fee.
+type Selection struct {
+	Coins  []Coin
+	Fee    int64
+	Change int64
+}
+
+// SelectCoins picks coins paying target in outputs outputs at feeRate
+// satoshis per virtual byte. It first looks for a set that needs no change
+// (branch and bound, as Bitcoin Core does), and falls back to spending the
+// largest coins first with a change output.
+func SelectCoins(coins []Coin, target int64, outputs int, feeRate, dust int64) (*Selection, error) {
+	inputFee := inputVBytes * feeRate
+	changeFee := outputVBytes * feeRate
+	needed := target + (overheadVBytes+int64(outputs)*outputVBytes)*feeRate
+
+	// Coins that cost more to spend than they are worth are left alone.
+	usable := make([]Coin, 0, len(coins))
+	for _, coin := range coins {
+		if coin.Value > inputFee {
+			usable = append(usable, coin)
+		}
+	}
+	sort.SliceStable(usable, func(i, j int) bool { return usable[i].Value > usable[j].Value })
+
+	effective := make([]int64, len(usable))
+	for i, coin := range usable {
+		effective[i] = coin.Value - inputFee
+	}
+
+	// Without change, overshooting by less than a change output and the
+	// input that later spends it costs nothing extra.
+	if picked := branchAndBound(effective, needed, needed+changeFee+inputFee); picked != nil {
+		selected := make([]Coin, 0, len(picked))
+		for _, i := range picked {
+			selected = append(selected, usable[i])
+		}
+		return newSelection(selected, target, 0), nil
+	}
+
+	var sum int64
+	for i := range usable {
+		sum += effective[i]
+		if sum < needed+changeFee {
+			continue
+		}
+		change := sum - needed - changeFee
+		if change < dust {
+			change = 0
+		}
+		return newSelection(usable[:i+1], target, change), nil
+	}
+	if sum >= needed {
+		return newSelection(usable, target, 0), nil
+	}
+	return nil, ErrInsufficientFunds
+}
+
+func newSelection(coins []Coin, target, change int64) *Selection {
+	var total int64
+	for _, coin := range coins {
+		total += coin.Value
+	}
+	return &Selection{
+		Coins:  append([]Coin(nil), coins...),
+		Fee:    total - target - change,
+		Change: change,
+	}
+}
+
+// branchAndBound searches for the subset of effective values, sorted
+// largest first, whose sum is in [target, upper] and overshoots target
+// least. It returns the indexes picked, or nil.
+func branchAndBound(effective []int64, target, upper int64) []int {
+	remaining := make([]int64, len(effective)+1)
+	for i := len(effective) - 1; i >= 0; i-- {
+		remaining[i] = remaining[i+1] + effective[i]
+	}
+	if remaining[0] < target {
+		return nil
+	}
+
+	var (
+		tries      int
+		current    []int
+		best       []int
+		bestExcess int64
+	)
+
+	var search func(i int, sum int64) bool
+	search = func(i int, sum int64) bool {
+		tries++
+		if tries > maxBnBTries || sum > upper {
+			return tries > maxBnBTries
+		}
+		if sum >= target {
+			if excess := sum - target; best == nil || excess < bestExcess {
+				best, bestExcess = append([]int(nil), current...), excess
+			}
+			return bestExcess == 0
+		}
+		if i == len(effective) || sum+remaining[i] < target {
+			return false
+		}
+
+		current = append(current, i)
+		if search(i+1, sum+effective[i]) {
+			return true
+		}
+		current = current[:len(current)-1]
+
+		// Leaving this coin out makes leaving its equals out too: picking
+		// one of them instead was just tried.
+		next := i + 1
+		for next < len(effective) && effective[next] == effective[i] {
+			next++
+		}
+		return search(next, sum)
+	}
+	search(0, 0)
+
+	return best
+}
@@ -0,0 +1,133 @@
+package utxo
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// SigHashAll is the only signature hash type batches are signed with.
+const SigHashAll = 0x01
+
+var ErrUnsupportedScript = errors.New("only P2PKH and P2WPKH coins can be signed")
+
+// InputSignature unlocks one input: a DER signature followed by its sighash
+// byte, and the compressed public key that made it.
+type InputSignature struct {
+	Signature []byte
+	PublicKey []byte
+}
+
+// spend reads the key hash a coin's script pays to, and whether it is a
+// segwit (P2WPKH) output rather than P2PKH.
+func spend(coin Coin) (hash []byte, segwit bool, err error) {
+	script, err := hex.DecodeString(coin.Script)
+	if err != nil {
+		return nil, false, fmt.Errorf("coin %s: invalid script", coin.ID)
+	}
+	switch {
+	case len(script) == 22 && script[0] == 0x00 && script[1] == 0x14:
+		return script[2:], true, nil
+	case len(script) == 25 && bytes.HasPrefix(script, []byte{0x76, 0xa9, 0x14}) && bytes.HasSuffix(script, []byte{0x88, 0xac}):
+		return script[3:23], false, nil
+	}
+	return nil, false, fmt.Errorf("coin %s: %w", coin.ID, ErrUnsupportedScript)
+}
+
+// KeyHash returns the hash160 of the public key that can spend input i.
+func (t *UnsignedTx) KeyHash(i int) ([]byte, error) {
+	hash, _, err := spend(t.Inputs[i])
+	return hash, err
+}
+
+// SigHash returns the digest input i's key signs: BIP143 for P2WPKH inputs,
+// the original algorithm for P2PKH ones.
+func (t *UnsignedTx) SigHash(i int) ([]byte, error) {
+	hash, segwit, err := spend(t.Inputs[i])
+	if err != nil {
+		return nil, err
+	}
+	scriptCode := append([]byte{0x76, 0xa9, 0x14}, hash...)
+	scriptCode = append(scriptCode, 0x88, 0xac)
+
+	if !segwit {
+		scriptSigs := make([][]byte, len(t.Inputs))
+		scriptSigs[i] = scriptCode
+		raw, err := t.encode(scriptSigs, nil)
+		if err != nil {
+			return nil, err
+		}
+		return doubleSHA256(binary.LittleEndian.AppendUint32(raw, SigHashAll)), nil
+	}
+
+	var prevouts, sequences bytes.Buffer
+	for _, input := range t.Inputs {
+		outpoint, err := encodeOutpoint(input)
+		if err != nil {
+			return nil, err
+		}
+		prevouts.Write(outpoint)
+		writeUint32(&sequences, sequence)
+	}
+	outputs, err := t.encodeOutputs()
+	if err != nil {
+		return nil, err
+	}
+	outpoint, err := encodeOutpoint(t.Inputs[i])
+	if err != nil {
+		return nil, err
+	}
+
+	var preimage bytes.Buffer
+	writeUint32(&preimage, 2)
+	preimage.Write(doubleSHA256(prevouts.Bytes()))
+	preimage.Write(doubleSHA256(sequences.Bytes()))
+	preimage.Write(outpoint)
+	writeVarInt(&preimage, uint64(len(scriptCode)))
+	preimage.Write(scriptCode)
+	preimage.Write(binary.LittleEndian.AppendUint64(nil, uint64(t.Inputs[i].Value)))
+	writeUint32(&preimage, sequence)
+	preimage.Write(doubleSHA256(outputs))
+	writeUint32(&preimage, 0)
+	writeUint32(&preimage, SigHashAll)
+	return doubleSHA256(preimage.Bytes()), nil
+}
+
+// Signed encodes the transaction with an InputSignature for every input.
+func (t *UnsignedTx) Signed(signatures []InputSignature) ([]byte, error) {
+	if len(signatures) != len(t.Inputs) {
+		return nil, fmt.Errorf("%d signatures for %d inputs", len(signatures), len(t.Inputs))
+	}
+
+	scriptSigs := make([][]byte, len(t.Inputs))
+	witnesses := make([][][]byte, len(t.Inputs))
+	anyWitness := false
+	for i, sig := range signatures {
+		_, segwit, err := spend(t.Inputs[i])
+		if err != nil {
+			return nil, err
+		}
+		if segwit {
+			witnesses[i] = [][]byte{sig.Signature, sig.PublicKey}
+			anyWitness = true
+			continue
+		}
+		script := append([]byte{byte(len(sig.Signature))}, sig.Signature...)
+		script = append(script, byte(len(sig.PublicKey)))
+		scriptSigs[i] = append(script, sig.PublicKey...)
+	}
+
+	if !anyWitness {
+		witnesses = nil
+	}
+	return t.encode(scriptSigs, witnesses)
+}
+
+func doubleSHA256(data []byte) []byte {
+	first := sha256.Sum256(data)
+	second := sha256.Sum256(first[:])
+	return second[:]
+}
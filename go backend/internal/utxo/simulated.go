@@ -0,0 +1,108 @@
+package utxo
+
+import (
+	"context"
+	"strconv"
+	"sync"
+)
+
+// SimulatedLedger is an in-memory Ledger for tests: a UTXO set and a queue
+// of approved withdrawals for one change address.
+type SimulatedLedger struct {
+	mu       sync.Mutex
+	change   string
+	coins    []Coin
+	payments []Payment
+	reserved map[string]string
+	batches  []*Batch
+}
+
+func NewSimulatedLedger(change string) *SimulatedLedger {
+	return &SimulatedLedger{
+		change:   change,
+		reserved: make(map[string]string),
+	}
+}
+
+// AddCoin adds an unspent coin. Its ID defaults to "txid:index".
+func (l *SimulatedLedger) AddCoin(coin Coin) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if coin.ID == "" {
+		coin.ID = coinKey(coin)
+	}
+	l.coins = append(l.coins, coin)
+}
+
+// AddPayment queues an approved withdrawal.
+func (l *SimulatedLedger) AddPayment(payment Payment) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.payments = append(l.payments, payment)
+}
+
+// Batches returns the batches reserved so far.
+func (l *SimulatedLedger) Batches() []*Batch {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]*Batch(nil), l.batches...)
+}
+
+func (l *SimulatedLedger) Payments(ctx context.Context, chain string) ([]Payment, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var waiting []Payment
+	for _, payment := range l.payments {
+		if _, ok := l.reserved["withdrawal:"+payment.WithdrawalID]; !ok {
+			waiting = append(waiting, payment)
+		}
+	}
+	return waiting, nil
+}
+
+func (l *SimulatedLedger) Unspent(ctx context.Context, chain string) ([]Coin, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var unspent []Coin
+	for _, coin := range l.coins {
+		if _, ok := l.reserved["coin:"+coin.ID]; !ok {
+			unspent = append(unspent, coin)
+		}
+	}
+	return unspent, nil
+}
+
+func (l *SimulatedLedger) ChangeAddress(ctx context.Context, chain string) (string, error) {
+	return l.change, nil
+}
+
+func (l *SimulatedLedger) Reserve(ctx context.Context, batch *Batch) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	keys := make([]string, 0, len(batch.Tx.Inputs)+len(batch.Payments))
+	for _, coin := range batch.Tx.Inputs {
+		keys = append(keys, "coin:"+coin.ID)
+	}
+	for _, payment := range batch.Payments {
+		keys = append(keys, "withdrawal:"+payment.WithdrawalID)
+	}
+	for _, key := range keys {
+		if _, ok := l.reserved[key]; ok {
+			return ErrAlreadyReserved
+		}
+	}
+
+	for _, key := range keys {
+		l.reserved[key] = batch.ID
+	}
+	l.batches = append(l.batches, batch)
+	return nil
+}
+
+func coinKey(coin Coin) string {
+	return coin.TxID + ":" + strconv.FormatUint(uint64(coin.Index), 10)
+}
@@ -0,0 +1,140 @@
+package utxo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+)
+
+// Output pays Value base units to Address.
+type Output struct {
+	Address string `json:"address"`
+	Value   int64  `json:"value"`
+}
+
+// UnsignedTx is a transaction waiting for the signer. Inputs keep the value
+// and script of the coins they spend, which signing needs and the raw
+// transaction doesn't carry.
+type UnsignedTx struct {
+	Chain   string   `json:"chain"`
+	Inputs  []Coin   `json:"inputs"`
+	Outputs []Output `json:"outputs"`
+	Fee     int64    `json:"fee"`
+}
+
+// Serialize encodes the transaction with empty input scripts, in the
+// version 2 format, signalling replace-by-fee so a stuck batch can be
+// bumped.
+func (t *UnsignedTx) Serialize() ([]byte, error) {
+	return t.encode(nil, nil)
+}
+
+// encode writes the transaction with the given input scripts, and in the
+// segwit format when there are witnesses.
+func (t *UnsignedTx) encode(scriptSigs [][]byte, witnesses [][][]byte) ([]byte, error) {
+	outputs, err := t.encodeOutputs()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	writeUint32(&buf, 2)
+	if witnesses != nil {
+		buf.Write([]byte{0x00, 0x01})
+	}
+
+	writeVarInt(&buf, uint64(len(t.Inputs)))
+	for i, input := range t.Inputs {
+		outpoint, err := encodeOutpoint(input)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(outpoint)
+		var script []byte
+		if scriptSigs != nil {
+			script = scriptSigs[i]
+		}
+		writeVarInt(&buf, uint64(len(script)))
+		buf.Write(script)
+		writeUint32(&buf, sequence)
+	}
+
+	writeVarInt(&buf, uint64(len(t.Outputs)))
+	buf.Write(outputs)
+
+	for _, witness := range witnesses {
+		writeVarInt(&buf, uint64(len(witness)))
+		for _, item := range witness {
+			writeVarInt(&buf, uint64(len(item)))
+			buf.Write(item)
+		}
+	}
+
+	writeUint32(&buf, 0)
+	return buf.Bytes(), nil
+}
+
+// sequence opts every input into replace-by-fee.
+const sequence = 0xfffffffd
+
+func encodeOutpoint(input Coin) ([]byte, error) {
+	txid, err := hex.DecodeString(input.TxID)
+	if err != nil || len(txid) != 32 {
+		return nil, fmt.Errorf("invalid transaction id %q", input.TxID)
+	}
+	// Transaction ids are shown byte reversed.
+	outpoint := make([]byte, 36)
+	for i := range txid {
+		outpoint[i] = txid[31-i]
+	}
+	binary.LittleEndian.PutUint32(outpoint[32:], input.Index)
+	return outpoint, nil
+}
+
+func (t *UnsignedTx) encodeOutputs() ([]byte, error) {
+	chain, ok := ChainByName(t.Chain)
+	if !ok {
+		return nil, fmt.Errorf("unsupported chain %q", t.Chain)
+	}
+
+	var buf bytes.Buffer
+	for _, output := range t.Outputs {
+		script, err := chain.Script(output.Address)
+		if err != nil {
+			return nil, err
+		}
+		var value [8]byte
+		binary.LittleEndian.PutUint64(value[:], uint64(output.Value))
+		buf.Write(value[:])
+		writeVarInt(&buf, uint64(len(script)))
+		buf.Write(script)
+	}
+	return buf.Bytes(), nil
+}
+
+func writeUint32(buf *bytes.Buffer, v uint32) {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], v)
+	buf.Write(b[:])
+}
+
+func writeVarInt(buf *bytes.Buffer, v uint64) {
+	switch {
+	case v < 0xfd:
+		buf.WriteByte(byte(v))
+	case v <= 0xffff:
+		buf.WriteByte(0xfd)
+		var b [2]byte
+		binary.LittleEndian.PutUint16(b[:], uint16(v))
+		buf.Write(b[:])
+	case v <= 0xffffffff:
+		buf.WriteByte(0xfe)
+		writeUint32(buf, uint32(v))
+	default:
+		buf.WriteByte(0xff)
+		var b [8]byte
+		binary.LittleEndian.PutUint64(b[:], v)
+		buf.Write(b[:])
+	}
+}
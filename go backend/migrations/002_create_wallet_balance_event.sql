@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS wallet_balance_event (
+  sequence BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+  userId CHAR(36) NOT NULL,
+  walletId CHAR(36) NOT NULL,
+  currency VARCHAR(191) NOT NULL,
+  walletType VARCHAR(16) NOT NULL,
+  delta DECIMAL(36, 18) NOT NULL,
+  available DECIMAL(36, 18) NOT NULL,
+  locked DECIMAL(36, 18) NOT NULL DEFAULT 0,
+  reason VARCHAR(32) NOT NULL,
+  referenceId VARCHAR(191) NOT NULL DEFAULT '',
+  createdAt DATETIME(3) NOT NULL,
+  PRIMARY KEY (sequence),
+  KEY wallet_balance_event_user_sequence (userId, sequence)
+);
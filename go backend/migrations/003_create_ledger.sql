@@ -0,0 +1,43 @@
+CREATE TABLE IF NOT EXISTS ledger_entry (
+  id CHAR(36) NOT NULL,
+  referenceType VARCHAR(32) NOT NULL,
+  referenceId VARCHAR(191) NOT NULL DEFAULT '',
+  idempotencyKey VARCHAR(191) NULL,
+  description VARCHAR(255) NOT NULL DEFAULT '',
+  createdAt DATETIME(3) NOT NULL,
+  PRIMARY KEY (id),
+  UNIQUE KEY ledger_entry_idempotency_key (idempotencyKey),
+  KEY ledger_entry_reference (referenceType, referenceId)
+);
+
+CREATE TABLE IF NOT EXISTS ledger_line (
+  id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+  entryId CHAR(36) NOT NULL,
+  accountType VARCHAR(32) NOT NULL,
+  accountId VARCHAR(191) NOT NULL DEFAULT '',
+  currency VARCHAR(191) NOT NULL,
+  side VARCHAR(6) NOT NULL,
+  amount DECIMAL(36, 18) NOT NULL,
+  createdAt DATETIME(3) NOT NULL,
+  PRIMARY KEY (id),
+  KEY ledger_line_account (accountType, accountId),
+  KEY ledger_line_entry (entryId),
+  CONSTRAINT ledger_line_entry_fk FOREIGN KEY (entryId) REFERENCES ledger_entry (id)
+);
+
+-- Seed an opening balance entry for every wallet that already holds funds so
+-- that wallet balances can be rebuilt from ledger history alone.
+INSERT INTO ledger_entry (id, referenceType, referenceId, idempotencyKey, description, createdAt)
+SELECT UUID(), 'OPENING_BALANCE', w.id, CONCAT('OPENING_BALANCE:', w.id), 'Opening balance', NOW(3)
+FROM wallet w
+WHERE w.balance <> 0;
+
+INSERT INTO ledger_line (entryId, accountType, accountId, currency, side, amount, createdAt)
+SELECT e.id, 'WALLET', w.id, w.currency, IF(w.balance > 0, 'CREDIT', 'DEBIT'), ABS(w.balance), e.createdAt
+FROM wallet w
+JOIN ledger_entry e ON e.idempotencyKey = CONCAT('OPENING_BALANCE:', w.id);
+
+INSERT INTO ledger_line (entryId, accountType, accountId, currency, side, amount, createdAt)
+SELECT e.id, 'OPENING_BALANCE', '', w.currency, IF(w.balance > 0, 'DEBIT', 'CREDIT'), ABS(w.balance), e.createdAt
+FROM wallet w
+JOIN ledger_entry e ON e.idempotencyKey = CONCAT('OPENING_BALANCE:', w.id);
@@ -0,0 +1,3 @@
+ALTER TABLE wallet ADD COLUMN inOrder DECIMAL(36, 18) NOT NULL DEFAULT 0 AFTER balance;
+
+ALTER TABLE wallet_balance_event ADD COLUMN operation VARCHAR(16) NOT NULL DEFAULT 'ADJUST' AFTER locked;
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS wallet_transfer (
+  id CHAR(36) NOT NULL,
+  userId CHAR(36) NOT NULL,
+  fromWalletId CHAR(36) NOT NULL,
+  toWalletId CHAR(36) NOT NULL,
+  fromType VARCHAR(16) NOT NULL,
+  toType VARCHAR(16) NOT NULL,
+  currency VARCHAR(191) NOT NULL,
+  amount DECIMAL(36, 18) NOT NULL,
+  idempotencyKey VARCHAR(191) NOT NULL,
+  createdAt DATETIME(3) NOT NULL,
+  PRIMARY KEY (id),
+  UNIQUE KEY wallet_transfer_idempotency_key (userId, idempotencyKey),
+  KEY wallet_transfer_user_created (userId, createdAt)
+);
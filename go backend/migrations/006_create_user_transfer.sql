@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS user_transfer (
+  id CHAR(36) NOT NULL,
+  senderId CHAR(36) NOT NULL,
+  recipientId CHAR(36) NOT NULL,
+  currency VARCHAR(191) NOT NULL,
+  amount DECIMAL(36, 18) NOT NULL,
+  idempotencyKey VARCHAR(191) NOT NULL,
+  createdAt DATETIME(3) NOT NULL,
+  PRIMARY KEY (id),
+  UNIQUE KEY user_transfer_idempotency_key (senderId, idempotencyKey),
+  KEY user_transfer_sender_day (senderId, currency, createdAt),
+  KEY user_transfer_recipient (recipientId, createdAt)
+);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS idempotency_key (
+  scope VARCHAR(191) NOT NULL,
+  idempotencyKey VARCHAR(191) NOT NULL,
+  requestHash CHAR(64) NOT NULL,
+  status VARCHAR(16) NOT NULL,
+  responseCode INT NOT NULL,
+  contentType VARCHAR(191) NOT NULL,
+  responseBody MEDIUMBLOB NOT NULL,
+  createdAt DATETIME(3) NOT NULL,
+  expiresAt DATETIME(3) NOT NULL,
+  PRIMARY KEY (scope, idempotencyKey),
+  KEY idempotency_key_expires (expiresAt)
+);
@@ -0,0 +1,15 @@
+-- Frozen wallets still receive funds and settle existing holds, but nothing
+-- new can be debited or held from them until an operator clears the flag.
+ALTER TABLE wallet ADD COLUMN frozen BOOLEAN NOT NULL DEFAULT FALSE AFTER inOrder;
+
+CREATE TABLE IF NOT EXISTS reconciliation_report (
+  id CHAR(36) NOT NULL,
+  startedAt DATETIME(3) NOT NULL,
+  finishedAt DATETIME(3) NOT NULL,
+  walletsChecked INT NOT NULL,
+  discrepancies INT NOT NULL,
+  frozenWallets INT NOT NULL,
+  report JSON NOT NULL,
+  PRIMARY KEY (id),
+  KEY reconciliation_report_started (startedAt)
+);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS wallet_balance_snapshot (
+  snapshotDate DATE NOT NULL,
+  walletId CHAR(36) NOT NULL,
+  userId CHAR(36) NOT NULL,
+  currency VARCHAR(191) NOT NULL,
+  walletType VARCHAR(16) NOT NULL,
+  balance DECIMAL(36, 18) NOT NULL,
+  inOrder DECIMAL(36, 18) NOT NULL,
+  price DECIMAL(36, 18) NOT NULL DEFAULT 0,
+  value DECIMAL(36, 18) NOT NULL DEFAULT 0,
+  referenceCurrency VARCHAR(191) NOT NULL,
+  createdAt DATETIME(3) NOT NULL,
+  PRIMARY KEY (walletId, snapshotDate),
+  KEY wallet_balance_snapshot_user_date (userId, snapshotDate)
+);
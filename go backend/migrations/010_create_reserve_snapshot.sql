@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS reserve_snapshot (
+  id CHAR(36) NOT NULL,
+  rootHash CHAR(64) NOT NULL,
+  totals JSON NOT NULL,
+  userCount INT NOT NULL,
+  createdAt DATETIME(3) NOT NULL,
+  PRIMARY KEY (id),
+  KEY reserve_snapshot_created (createdAt)
+);
+
+CREATE TABLE IF NOT EXISTS reserve_proof (
+  snapshotId CHAR(36) NOT NULL,
+  userId CHAR(36) NOT NULL,
+  leafIndex INT NOT NULL,
+  proof JSON NOT NULL,
+  PRIMARY KEY (snapshotId, userId),
+  CONSTRAINT reserve_proof_snapshot_fk FOREIGN KEY (snapshotId) REFERENCES reserve_snapshot (id)
+);
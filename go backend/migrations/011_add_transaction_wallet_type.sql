@@ -0,0 +1,5 @@
+-- The wallet type a transaction moved funds in, so history can be filtered by
+-- it, and the index transaction history pages through newest first.
+ALTER TABLE transaction ADD COLUMN walletType VARCHAR(16) NULL AFTER currency;
+
+CREATE INDEX transaction_user_created ON transaction (userId, createdAt, id);
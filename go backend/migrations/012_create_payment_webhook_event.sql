@@ -0,0 +1,13 @@
+-- Provider webhooks are delivered at least once; each event is recorded with
+-- the deposit change it caused so a redelivery is recognised and skipped.
+CREATE TABLE IF NOT EXISTS payment_webhook_event (
+  provider VARCHAR(32) NOT NULL,
+  eventId VARCHAR(255) NOT NULL,
+  type VARCHAR(191) NOT NULL,
+  paymentId VARCHAR(255) NULL,
+  createdAt DATETIME(3) NOT NULL,
+  PRIMARY KEY (provider, eventId)
+);
+
+-- Fiat deposits paid through a provider are found by the provider's payment id.
+CREATE INDEX deposit_method_transaction ON deposit (method, transactionId);
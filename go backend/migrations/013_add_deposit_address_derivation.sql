@@ -0,0 +1,7 @@
+-- Deposit addresses are derived from a master wallet's account xpub. The path
+-- lets the offline signer find the key; rows without one were placeholders.
+ALTER TABLE deposit_address
+  ADD COLUMN masterWalletId CHAR(36) NULL AFTER address,
+  ADD COLUMN derivationPath VARCHAR(64) NULL AFTER masterWalletId;
+
+CREATE INDEX deposit_address_user ON deposit_address (userId, currency, network);
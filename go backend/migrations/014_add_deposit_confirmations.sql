@@ -0,0 +1,22 @@
+-- On-chain deposits are found by the chain watcher. Each one is a single
+-- transfer (the output or log index within its transaction), and remembers
+-- the block it was seen in so a reorg can find and undo it.
+ALTER TABLE deposit
+  ADD COLUMN txIndex INT NULL AFTER transactionId,
+  ADD COLUMN blockNumber BIGINT UNSIGNED NULL AFTER txIndex,
+  ADD COLUMN blockHash VARCHAR(100) NULL AFTER blockNumber,
+  ADD COLUMN confirmations INT NOT NULL DEFAULT 0 AFTER blockHash;
+
+CREATE UNIQUE INDEX deposit_network_transfer ON deposit (network, transactionId, txIndex);
+CREATE INDEX deposit_network_block ON deposit (network, status, blockNumber);
+
+-- The hashes of recently scanned blocks, to notice when the chain replaces
+-- one. Older rows are pruned.
+CREATE TABLE IF NOT EXISTS chain_scan_block (
+  chain VARCHAR(32) NOT NULL,
+  number BIGINT UNSIGNED NOT NULL,
+  hash VARCHAR(100) NOT NULL,
+  parentHash VARCHAR(100) NOT NULL,
+  createdAt DATETIME(3) NOT NULL,
+  PRIMARY KEY (chain, number)
+);
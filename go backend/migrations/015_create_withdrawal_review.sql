@@ -0,0 +1,36 @@
+-- Withdrawals are risk scored when created and wait in a review queue unless
+-- they qualify for auto-approval. Every decision on one is audited.
+ALTER TABLE withdrawal
+  ADD COLUMN transactionId VARCHAR(191) NULL AFTER bankDetails,
+  ADD COLUMN riskScore INT NOT NULL DEFAULT 0 AFTER transactionId,
+  ADD COLUMN riskFactors JSON NULL AFTER riskScore;
+
+CREATE INDEX withdrawal_status_created ON withdrawal (status, createdAt);
+
+CREATE TABLE IF NOT EXISTS withdrawal_audit (
+  id CHAR(36) NOT NULL PRIMARY KEY,
+  withdrawalId CHAR(36) NOT NULL,
+  actorId CHAR(36) NULL,
+  action VARCHAR(32) NOT NULL,
+  fromStatus VARCHAR(16) NULL,
+  toStatus VARCHAR(16) NOT NULL,
+  reason TEXT NULL,
+  details JSON NULL,
+  createdAt DATETIME(3) NOT NULL,
+  INDEX withdrawal_audit_withdrawal (withdrawalId, createdAt)
+);
+
+-- Devices a user has made requests from. A device seen for the first time
+-- makes a withdrawal riskier.
+CREATE TABLE IF NOT EXISTS user_device (
+  userId CHAR(36) NOT NULL,
+  fingerprint CHAR(64) NOT NULL,
+  userAgent VARCHAR(255) NULL,
+  ip VARCHAR(45) NULL,
+  firstSeenAt DATETIME(3) NOT NULL,
+  lastSeenAt DATETIME(3) NOT NULL,
+  PRIMARY KEY (userId, fingerprint)
+);
+
+-- Set by the auth service whenever the password changes or is reset.
+ALTER TABLE user ADD COLUMN passwordChangedAt DATETIME(3) NULL;
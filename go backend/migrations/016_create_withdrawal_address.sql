@@ -0,0 +1,29 @@
+-- The withdrawal address book. An entry is usable once its email
+-- confirmation is done and usableAt has passed; only a hash of the
+-- confirmation token is kept.
+CREATE TABLE IF NOT EXISTS withdrawal_address (
+  id CHAR(36) NOT NULL PRIMARY KEY,
+  userId CHAR(36) NOT NULL,
+  currency VARCHAR(32) NOT NULL,
+  network VARCHAR(32) NOT NULL DEFAULT '',
+  address VARCHAR(191) NOT NULL,
+  label VARCHAR(100) NOT NULL DEFAULT '',
+  confirmTokenHash CHAR(64) NULL,
+  confirmedAt DATETIME(3) NULL,
+  usableAt DATETIME(3) NOT NULL,
+  createdAt DATETIME(3) NOT NULL,
+  updatedAt DATETIME(3) NOT NULL,
+  UNIQUE KEY withdrawal_address_entry (userId, currency, network, address),
+  UNIQUE KEY withdrawal_address_token (confirmTokenHash)
+);
+
+-- Whitelist-only mode. Turning it on is immediate; turning it off needs an
+-- email confirmation and then waits out the cooldown until disableAt.
+CREATE TABLE IF NOT EXISTS withdrawal_whitelist (
+  userId CHAR(36) NOT NULL PRIMARY KEY,
+  enabled BOOLEAN NOT NULL DEFAULT FALSE,
+  disableTokenHash CHAR(64) NULL,
+  disableAt DATETIME(3) NULL,
+  updatedAt DATETIME(3) NOT NULL,
+  UNIQUE KEY withdrawal_whitelist_token (disableTokenHash)
+);
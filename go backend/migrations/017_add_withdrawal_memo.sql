@@ -0,0 +1,10 @@
+-- Memo / destination tag for networks like XRP and XLM where exchanges share
+-- one address between users. Address book entries differ by memo too, so it
+-- joins their unique key.
+ALTER TABLE withdrawal
+  ADD COLUMN memo VARCHAR(100) NULL AFTER network;
+
+ALTER TABLE withdrawal_address
+  ADD COLUMN memo VARCHAR(100) NOT NULL DEFAULT '' AFTER address,
+  DROP INDEX withdrawal_address_entry,
+  ADD UNIQUE KEY withdrawal_address_entry (userId, currency, network, address, memo);
@@ -0,0 +1,6 @@
+-- What a withdrawal was worth in the valuation reference currency when it
+-- was made, summed to check the user's daily and monthly limits.
+ALTER TABLE withdrawal
+  ADD COLUMN referenceValue DECIMAL(65,18) NOT NULL DEFAULT 0 AFTER fee;
+
+CREATE INDEX withdrawal_user_created ON withdrawal (userId, createdAt);
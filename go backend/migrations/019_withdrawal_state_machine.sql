@@ -0,0 +1,4 @@
+-- Withdrawals now go PENDING -> APPROVED -> BROADCAST -> CONFIRMED or
+-- FAILED, or end REJECTED or CANCELED. COMPLETED meant sent and settled, so
+-- those rows are CONFIRMED.
+UPDATE withdrawal SET status = 'CONFIRMED' WHERE status = 'COMPLETED';
@@ -0,0 +1,23 @@
+-- Withdrawals on UTXO chains go out in batches: one transaction paying
+-- several approved withdrawals from reserved coins, left unsigned for the
+-- signer. A coin or withdrawal belongs to at most one batch.
+CREATE TABLE IF NOT EXISTS withdrawal_batch (
+  id CHAR(36) NOT NULL PRIMARY KEY,
+  chain VARCHAR(32) NOT NULL,
+  status VARCHAR(16) NOT NULL,
+  unsignedTx JSON NOT NULL,
+  rawTx MEDIUMTEXT NOT NULL,
+  fee BIGINT NOT NULL,
+  transactionId VARCHAR(191) NULL,
+  createdAt DATETIME(3) NOT NULL,
+  updatedAt DATETIME(3) NOT NULL,
+  INDEX withdrawal_batch_chain_status (chain, status)
+);
+
+ALTER TABLE withdrawal
+  ADD COLUMN batchId CHAR(36) NULL AFTER transactionId,
+  ADD INDEX withdrawal_batch (batchId);
+
+ALTER TABLE ecosystem_utxo
+  ADD COLUMN batchId CHAR(36) NULL,
+  ADD INDEX ecosystem_utxo_batch (batchId);
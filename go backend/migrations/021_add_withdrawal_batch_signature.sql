@@ -0,0 +1,2 @@
+-- Batches are signed by the signer process and stored ready to broadcast.
+ALTER TABLE withdrawal_batch ADD COLUMN signedTx MEDIUMTEXT NULL AFTER rawTx;
@@ -0,0 +1,19 @@
+-- Balance event sequences are counted per user inside the posting
+-- transaction. The counter row stays locked until commit, so a user's events
+-- commit in sequence order and replaying "since N" can't skip one that was
+-- still in flight. Existing events keep their numbers; counters continue
+-- from each user's highest one.
+CREATE TABLE IF NOT EXISTS wallet_balance_sequence (
+  userId CHAR(36) NOT NULL,
+  sequence BIGINT UNSIGNED NOT NULL,
+  PRIMARY KEY (userId)
+);
+
+INSERT INTO wallet_balance_sequence (userId, sequence)
+  SELECT userId, MAX(sequence) FROM wallet_balance_event GROUP BY userId;
+
+ALTER TABLE wallet_balance_event
+  MODIFY sequence BIGINT UNSIGNED NOT NULL,
+  DROP PRIMARY KEY,
+  ADD PRIMARY KEY (userId, sequence),
+  DROP INDEX wallet_balance_event_user_sequence;
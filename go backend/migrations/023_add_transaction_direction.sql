@@ -0,0 +1,4 @@
+-- Balance changes are recorded under their reason, so one type holds both
+-- credits and debits. direction tells them apart; amount stays unsigned.
+-- Older rows have none, their type says which way the funds went.
+ALTER TABLE transaction ADD COLUMN direction VARCHAR(8) NULL AFTER amount;
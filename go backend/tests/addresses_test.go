@@ -0,0 +1,62 @@
+package tests
+
+import (
+	"crypto-exchange-go/internal/addresses"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddressFormats(t *testing.T) {
+	networks := addresses.Default()
+
+	cases := []struct {
+		network, address, memo string
+		err                    error
+	}{
+		{"ETH", "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", "", nil},
+		{"BSC", "0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed", "", nil},
+		{"ETH", "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAeD", "", addresses.ErrInvalidAddress},
+		{"ETH", "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAe", "", addresses.ErrInvalidAddress},
+		{"ETH", "0x0000000000000000000000000000000000000000", "", addresses.ErrInvalidAddress},
+		{"ETH", "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", "123", addresses.ErrInvalidMemo},
+
+		{"BTC", "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2", "", nil},
+		{"BTC", "3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy", "", nil},
+		{"BTC", "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4", "", nil},
+		{"BTC", "BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4", "", nil},
+		{"BTC", "bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0", "", nil},
+		{"BTC", "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t5", "", addresses.ErrInvalidAddress},
+		{"BTC", "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN3", "", addresses.ErrInvalidAddress},
+		{"BTC", "ltc1qw508d6qejxtdg4y5r3zarvary0c5xw7kgmn4n9", "", addresses.ErrInvalidAddress},
+		{"LTC", "ltc1qw508d6qejxtdg4y5r3zarvary0c5xw7kgmn4n9", "", nil},
+
+		{"TRON", "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t", "", nil},
+		{"TRON", "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6u", "", addresses.ErrInvalidAddress},
+
+		{"XRP", "rHb9CJAWyB4rj91VRWn96DkukG4bwdtyTh", "12345", nil},
+		{"XRP", "rHb9CJAWyB4rj91VRWn96DkukG4bwdtyTh", "", addresses.ErrMemoRequired},
+		{"XRP", "rHb9CJAWyB4rj91VRWn96DkukG4bwdtyTh", "tag", addresses.ErrInvalidMemo},
+		{"XRP", "rHb9CJAWyB4rj91VRWn96DkukG4bwdtyTj", "12345", addresses.ErrInvalidAddress},
+
+		{"XLM", "GAAZI4TCR3TY5OJHCTJC2A4QSY6CJWJH5IAJTGKIN2ER7LBNVKOCCWN7", "hello", nil},
+		{"XLM", "GAAZI4TCR3TY5OJHCTJC2A4QSY6CJWJH5IAJTGKIN2ER7LBNVKOCCWN6", "hello", addresses.ErrInvalidAddress},
+		{"XLM", "GAAZI4TCR3TY5OJHCTJC2A4QSY6CJWJH5IAJTGKIN2ER7LBNVKOCCWN7", "a memo that is longer than 28 bytes", addresses.ErrInvalidMemo},
+	}
+
+	for _, c := range cases {
+		network, ok := networks.Get(c.network)
+		require.True(t, ok, c.network)
+
+		err := network.Validate(c.address, c.memo)
+		if c.err == nil {
+			assert.NoError(t, err, "%s %s", c.network, c.address)
+		} else {
+			assert.ErrorIs(t, err, c.err, "%s %s", c.network, c.address)
+		}
+	}
+
+	_, ok := networks.Get("NOPE")
+	assert.False(t, ok)
+}
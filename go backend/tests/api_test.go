@@ -64,7 +64,7 @@ func setupTestRouter() (*gin.Engine, error) {
 	}
 
 	orderService := services.NewOrderService(db, scyllaDB, redisClient, matchingEngine, log)
-	walletService := services.NewWalletService(db, log)
+	walletService := services.NewWalletService(db, redisClient, log)
 	marketService := services.NewMarketService(db, scyllaDB, redisClient, log)
 
 	gin.SetMode(gin.TestMode)
@@ -0,0 +1,418 @@
+package tests
+
+import (
+	"context"
+	"crypto-exchange-go/internal/addresses"
+	"crypto-exchange-go/internal/config"
+	"crypto-exchange-go/internal/database"
+	"crypto-exchange-go/internal/models"
+	"crypto-exchange-go/internal/services"
+	"crypto-exchange-go/internal/utxo"
+	"crypto-exchange-go/pkg/logger"
+	"database/sql"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// These tests need the Orbex_test MySQL schema and Redis used by the API
+// tests; they skip when either isn't reachable.
+func setupBalanceServices(t *testing.T) (*database.MySQL, *services.WalletService, *services.WithdrawalService) {
+	t.Helper()
+
+	db, err := database.NewMySQL(config.MySQL{
+		Host:     "localhost",
+		Port:     3306,
+		Database: "Orbex_test",
+		Username: "root",
+		Password: "",
+	})
+	if err != nil {
+		t.Skipf("MySQL not available: %v", err)
+	}
+
+	redisClient, err := database.NewRedis(config.Redis{Host: "localhost", Port: 6379, DB: 1})
+	if err != nil {
+		t.Skipf("Redis not available: %v", err)
+	}
+
+	log := logger.New("error")
+	walletService := services.NewWalletService(db, redisClient, log)
+
+	// The test wallets hold USDT; treating it as the chain's native coin keeps
+	// the destination check from needing an ecosystem_token row.
+	destinations := services.NewDestinationValidator(db, addresses.NewRegistry(
+		addresses.Network{Name: "ERC20", Native: "USDT", Format: addresses.EVM()},
+	))
+	withdrawalService := services.NewWithdrawalService(db, walletService, services.NewKYCService(db, log), nil, destinations, nil, nil,
+		config.Withdrawal{Fees: map[string]config.WithdrawalFee{"usdt": {Flat: 1}}}, log)
+
+	return db, walletService, withdrawalService
+}
+
+func fundedWallet(t *testing.T, walletService *services.WalletService, balance decimal.Decimal) (uuid.UUID, uuid.UUID) {
+	t.Helper()
+
+	ctx := context.Background()
+	userID := uuid.New()
+
+	wallet, err := walletService.CreateWallet(ctx, userID, "USDT", models.WalletTypeSpot)
+	require.NoError(t, err)
+
+	err = walletService.UpdateBalance(ctx, wallet.ID, balance, models.BalanceReasonDeposit, uuid.New().String())
+	require.NoError(t, err)
+
+	return userID, wallet.ID
+}
+
+func runConcurrently(n int, fn func(i int) error) (succeeded, insufficient int64, other []error) {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			err := fn(i)
+			switch {
+			case err == nil:
+				atomic.AddInt64(&succeeded, 1)
+			case errors.Is(err, services.ErrInsufficientBalance):
+				atomic.AddInt64(&insufficient, 1)
+			default:
+				mu.Lock()
+				other = append(other, err)
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	return succeeded, insufficient, other
+}
+
+func assertWalletMatchesLedger(t *testing.T, walletService *services.WalletService, userID uuid.UUID, available, locked string) {
+	t.Helper()
+
+	wallet, err := walletService.GetWallet(context.Background(), userID, "USDT", models.WalletTypeSpot)
+	require.NoError(t, err)
+	assert.True(t, wallet.Balance.Equal(decimal.RequireFromString(available)), "available %s", wallet.Balance)
+	assert.True(t, wallet.InOrder.Equal(decimal.RequireFromString(locked)), "locked %s", wallet.InOrder)
+
+	rebuilt, err := walletService.RebuildBalance(context.Background(), wallet.ID)
+	require.NoError(t, err)
+	assert.True(t, rebuilt.Available.Equal(wallet.Balance))
+	assert.True(t, rebuilt.Locked.Equal(wallet.InOrder))
+}
+
+func TestConcurrentHoldsNeverOverdraw(t *testing.T) {
+	_, walletService, _ := setupBalanceServices(t)
+	userID, walletID := fundedWallet(t, walletService, decimal.NewFromInt(100))
+
+	succeeded, insufficient, other := runConcurrently(40, func(i int) error {
+		return walletService.Hold(context.Background(), walletID, decimal.NewFromInt(10), models.BalanceReasonOrder, uuid.New().String())
+	})
+
+	require.Empty(t, other)
+	assert.Equal(t, int64(10), succeeded)
+	assert.Equal(t, int64(30), insufficient)
+	assertWalletMatchesLedger(t, walletService, userID, "0", "100")
+}
+
+func TestConcurrentDebitsNeverOverdraw(t *testing.T) {
+	_, walletService, _ := setupBalanceServices(t)
+	userID, walletID := fundedWallet(t, walletService, decimal.NewFromInt(100))
+
+	succeeded, insufficient, other := runConcurrently(30, func(i int) error {
+		return walletService.UpdateBalance(context.Background(), walletID, decimal.NewFromInt(-7), models.BalanceReasonWithdrawal, uuid.New().String())
+	})
+
+	require.Empty(t, other)
+	assert.Equal(t, int64(14), succeeded)
+	assert.Equal(t, int64(16), insufficient)
+	assertWalletMatchesLedger(t, walletService, userID, "2", "0")
+}
+
+func TestConcurrentChangesKeepSequenceGapFree(t *testing.T) {
+	_, walletService, _ := setupBalanceServices(t)
+	userID, walletID := fundedWallet(t, walletService, decimal.NewFromInt(100))
+
+	succeeded, _, other := runConcurrently(20, func(i int) error {
+		return walletService.Hold(context.Background(), walletID, decimal.NewFromInt(1), models.BalanceReasonOrder, uuid.New().String())
+	})
+	require.Empty(t, other)
+	require.Equal(t, int64(20), succeeded)
+
+	events, err := walletService.GetBalanceChanges(context.Background(), userID, 0, 100)
+	require.NoError(t, err)
+	require.Len(t, events, 21, "the deposit and every hold")
+	for i, event := range events {
+		assert.Equal(t, int64(i+1), event.Sequence)
+	}
+}
+
+func TestConcurrentReleasesNeverExceedHold(t *testing.T) {
+	_, walletService, _ := setupBalanceServices(t)
+	userID, walletID := fundedWallet(t, walletService, decimal.NewFromInt(50))
+
+	ctx := context.Background()
+	require.NoError(t, walletService.Hold(ctx, walletID, decimal.NewFromInt(50), models.BalanceReasonOrder, uuid.New().String()))
+
+	var released int64
+	var rejected int64
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := walletService.Release(ctx, walletID, decimal.NewFromInt(5), models.BalanceReasonOrder, uuid.New().String())
+			if err == nil {
+				atomic.AddInt64(&released, 1)
+			} else if errors.Is(err, services.ErrInsufficientLocked) {
+				atomic.AddInt64(&rejected, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int64(10), released)
+	assert.Equal(t, int64(10), rejected)
+	assertWalletMatchesLedger(t, walletService, userID, "50", "0")
+}
+
+func TestConcurrentSpotWithdrawalsNeverDoubleSpend(t *testing.T) {
+	db, walletService, withdrawalService := setupBalanceServices(t)
+	userID, _ := fundedWallet(t, walletService, decimal.NewFromInt(100))
+
+	address := "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"
+	network := "ERC20"
+
+	succeeded, insufficient, other := runConcurrently(25, func(i int) error {
+		_, err := withdrawalService.CreateSpotWithdrawal(context.Background(), userID, &models.CreateWithdrawalRequest{
+			Currency: "USDT",
+			Amount:   decimal.NewFromInt(9),
+			Method:   "USDT",
+			Address:  &address,
+			Network:  &network,
+		})
+		return err
+	})
+
+	require.Empty(t, other)
+	assert.Equal(t, int64(10), succeeded)
+	assert.Equal(t, int64(15), insufficient)
+
+	var withdrawals int
+	err := db.Get(&withdrawals, `SELECT COUNT(*) FROM withdrawal WHERE userId = ?`, userID)
+	require.NoError(t, err)
+	assert.Equal(t, 10, withdrawals, "rejected withdrawals must not leave rows behind")
+
+	assertWalletMatchesLedger(t, walletService, userID, "0", "100")
+}
+
+func TestCancelRacingApprovalSettlesOnce(t *testing.T) {
+	_, walletService, withdrawalService := setupBalanceServices(t)
+	userID, _ := fundedWallet(t, walletService, decimal.NewFromInt(100))
+	ctx := context.Background()
+
+	address := "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"
+	network := "ERC20"
+	withdrawal, err := withdrawalService.CreateSpotWithdrawal(ctx, userID, &models.CreateWithdrawalRequest{
+		Currency: "USDT",
+		Amount:   decimal.NewFromInt(9),
+		Method:   "USDT",
+		Address:  &address,
+		Network:  &network,
+	})
+	require.NoError(t, err)
+	assertWalletMatchesLedger(t, walletService, userID, "90", "10")
+
+	err = withdrawalService.CancelWithdrawal(ctx, uuid.New(), withdrawal.ID)
+	assert.ErrorIs(t, err, sql.ErrNoRows, "only the owner can cancel")
+
+	var canceled, approved, conflicts int64
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		err := withdrawalService.CancelWithdrawal(ctx, userID, withdrawal.ID)
+		if err == nil {
+			atomic.AddInt64(&canceled, 1)
+		} else if errors.Is(err, services.ErrWithdrawalStateConflict) {
+			atomic.AddInt64(&conflicts, 1)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		err := withdrawalService.ApproveWithdrawal(ctx, uuid.New(), withdrawal.ID, "")
+		if err == nil {
+			atomic.AddInt64(&approved, 1)
+		} else if errors.Is(err, services.ErrWithdrawalStateConflict) {
+			atomic.AddInt64(&conflicts, 1)
+		}
+	}()
+	wg.Wait()
+
+	require.Equal(t, int64(1), canceled+approved)
+	assert.Equal(t, int64(1), conflicts)
+	if canceled == 1 {
+		assertWalletMatchesLedger(t, walletService, userID, "100", "0")
+	} else {
+		assertWalletMatchesLedger(t, walletService, userID, "90", "10")
+	}
+}
+
+func TestConcurrentOrdersNeverOverdraw(t *testing.T) {
+	orderService, walletService, currency := setupOrderServices(t)
+	userID, _ := fundedWallet(t, walletService, decimal.NewFromInt(100))
+
+	succeeded, insufficient, other := runConcurrently(30, func(i int) error {
+		_, err := placeBuyOrder(context.Background(), orderService, userID, currency, 1, 10)
+		return err
+	})
+
+	require.Empty(t, other)
+	assert.Equal(t, int64(10), succeeded)
+	assert.Equal(t, int64(20), insufficient)
+	assertWalletMatchesLedger(t, walletService, userID, "0", "100")
+}
+
+func TestConcurrentCancelsReleaseOnce(t *testing.T) {
+	orderService, walletService, currency := setupOrderServices(t)
+	userID, _ := fundedWallet(t, walletService, decimal.NewFromInt(100))
+	ctx := context.Background()
+
+	order, err := placeBuyOrder(ctx, orderService, userID, currency, 2, 10)
+	require.NoError(t, err)
+
+	succeeded, _, other := runConcurrently(10, func(i int) error {
+		return orderService.CancelOrder(ctx, userID, order.ID)
+	})
+
+	assert.Equal(t, int64(1), succeeded)
+	for _, err := range other {
+		assert.ErrorIs(t, err, services.ErrOrderNotCancelable)
+	}
+	assertWalletMatchesLedger(t, walletService, userID, "100", "0")
+}
+
+func TestConcurrentAmendsKeepHoldInStep(t *testing.T) {
+	orderService, walletService, currency := setupOrderServices(t)
+	userID, _ := fundedWallet(t, walletService, decimal.NewFromInt(100))
+	ctx := context.Background()
+
+	order, err := placeBuyOrder(ctx, orderService, userID, currency, 1, 10)
+	require.NoError(t, err)
+
+	succeeded, insufficient, other := runConcurrently(10, func(i int) error {
+		amount := decimal.NewFromInt(int64(i + 1))
+		_, err := orderService.AmendOrder(ctx, userID, order.ID, &models.AmendOrderRequest{Amount: &amount})
+		return err
+	})
+
+	assert.Positive(t, succeeded)
+	assert.Zero(t, insufficient)
+	for _, err := range other {
+		assert.ErrorIs(t, err, services.ErrOrderNotAmendable)
+	}
+
+	amended, err := orderService.GetOrder(ctx, userID, order.ID)
+	require.NoError(t, err)
+	held := amended.Remaining.Mul(amended.Price)
+	assertWalletMatchesLedger(t, walletService, userID, decimal.NewFromInt(100).Sub(held).String(), held.String())
+}
+
+func TestBatchedWithdrawalsOnlyMoveWithTheirBatch(t *testing.T) {
+	db, walletService, withdrawalService := setupBalanceServices(t)
+	userID, _ := fundedWallet(t, walletService, decimal.NewFromInt(100))
+	ctx := context.Background()
+	adminID := uuid.New()
+
+	address := "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"
+	network := "ERC20"
+	withdrawal, err := withdrawalService.CreateSpotWithdrawal(ctx, userID, &models.CreateWithdrawalRequest{
+		Currency: "USDT",
+		Amount:   decimal.NewFromInt(9),
+		Method:   "USDT",
+		Address:  &address,
+		Network:  &network,
+	})
+	require.NoError(t, err)
+	require.NoError(t, withdrawalService.ApproveWithdrawal(ctx, adminID, withdrawal.ID, ""))
+
+	_, err = db.Exec(`UPDATE withdrawal SET batchId = ? WHERE id = ?`, uuid.New(), withdrawal.ID)
+	require.NoError(t, err)
+
+	err = withdrawalService.MarkWithdrawalBroadcast(ctx, adminID, withdrawal.ID, "0xabc")
+	assert.ErrorIs(t, err, services.ErrWithdrawalBatched)
+	err = withdrawalService.RejectWithdrawal(ctx, adminID, withdrawal.ID, "changed my mind")
+	assert.ErrorIs(t, err, services.ErrWithdrawalBatched)
+
+	review, err := withdrawalService.GetWithdrawalReview(ctx, withdrawal.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.WithdrawalStatusApproved, review.Withdrawal.Status)
+	assertWalletMatchesLedger(t, walletService, userID, "90", "10")
+}
+
+func TestBatchedWithdrawalConfirmsWithItsBatch(t *testing.T) {
+	db, walletService, withdrawalService := setupBalanceServices(t)
+	batchService := services.NewWithdrawalBatchService(db, nil, withdrawalService, logger.New("error"))
+	userID, walletID := fundedWallet(t, walletService, decimal.NewFromInt(100))
+	ctx := context.Background()
+	adminID := uuid.New()
+
+	address := "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"
+	network := "ERC20"
+	withdrawal, err := withdrawalService.CreateSpotWithdrawal(ctx, userID, &models.CreateWithdrawalRequest{
+		Currency: "USDT",
+		Amount:   decimal.NewFromInt(9),
+		Method:   "USDT",
+		Address:  &address,
+		Network:  &network,
+	})
+	require.NoError(t, err)
+	require.NoError(t, withdrawalService.ApproveWithdrawal(ctx, adminID, withdrawal.ID, ""))
+
+	coinID := uuid.New().String()
+	_, err = db.Exec("INSERT INTO ecosystem_utxo (id, walletId, transactionId, `index`, amount, script, status, createdAt, updatedAt) "+
+		"VALUES (?, ?, ?, 0, 10, '00', FALSE, NOW(), NOW())", coinID, walletID, uuid.New().String())
+	require.NoError(t, err)
+
+	batchID := uuid.New()
+	require.NoError(t, batchService.Reserve(ctx, &utxo.Batch{
+		ID:        batchID.String(),
+		Chain:     "USDT",
+		Payments:  []utxo.Payment{{WithdrawalID: withdrawal.ID.String(), Address: address, Value: 9}},
+		Tx:        &utxo.UnsignedTx{Chain: "USDT", Inputs: []utxo.Coin{{ID: coinID}}, Fee: 1},
+		Raw:       "00",
+		CreatedAt: time.Now(),
+	}))
+
+	// Broadcasting needs a signed batch; signing itself is the signer's.
+	err = batchService.MarkBatchBroadcast(ctx, adminID, batchID, "0xabc")
+	assert.ErrorIs(t, err, services.ErrWithdrawalBatchState)
+	_, err = db.Exec(`UPDATE withdrawal_batch SET status = ?, signedTx = '00' WHERE id = ?`, models.WithdrawalBatchStatusSigned, batchID)
+	require.NoError(t, err)
+
+	require.NoError(t, batchService.MarkBatchBroadcast(ctx, adminID, batchID, "0xabc"))
+	assertWalletMatchesLedger(t, walletService, userID, "90", "10")
+	require.NoError(t, batchService.ConfirmBatch(ctx, adminID, batchID))
+
+	review, err := withdrawalService.GetWithdrawalReview(ctx, withdrawal.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.WithdrawalStatusConfirmed, review.Withdrawal.Status)
+	assert.Equal(t, "0xabc", *review.Withdrawal.TransactionID)
+	assertWalletMatchesLedger(t, walletService, userID, "90", "0")
+
+	var spent bool
+	require.NoError(t, db.Get(&spent, `SELECT status FROM ecosystem_utxo WHERE id = ?`, coinID))
+	assert.True(t, spent)
+}
@@ -0,0 +1,185 @@
+package tests
+
+import (
+	"context"
+	"crypto-exchange-go/internal/chainwatch"
+	"fmt"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type watchedDeposit struct {
+	block         uint64
+	status        string
+	confirmations uint64
+}
+
+// memorySink keeps deposits the way ChainDepositService does, without a
+// database.
+type memorySink struct {
+	required  uint64
+	blocks    map[uint64]string
+	deposits  map[string]*watchedDeposit
+	rollbacks []uint64
+}
+
+func newMemorySink(required uint64) *memorySink {
+	return &memorySink{
+		required: required,
+		blocks:   make(map[uint64]string),
+		deposits: make(map[string]*watchedDeposit),
+	}
+}
+
+func (s *memorySink) LastScanned(ctx context.Context, chain string) (uint64, bool, error) {
+	var last uint64
+	for number := range s.blocks {
+		if number > last {
+			last = number
+		}
+	}
+	return last, len(s.blocks) > 0, nil
+}
+
+func (s *memorySink) ScannedHash(ctx context.Context, chain string, number uint64) (string, bool, error) {
+	hash, ok := s.blocks[number]
+	return hash, ok, nil
+}
+
+func (s *memorySink) Apply(ctx context.Context, chain string, block *chainwatch.Block) error {
+	for _, transfer := range block.Transfers {
+		key := fmt.Sprintf("%s:%d", transfer.TxHash, transfer.Index)
+		deposit, ok := s.deposits[key]
+		if !ok {
+			deposit = &watchedDeposit{status: "PENDING"}
+			s.deposits[key] = deposit
+		}
+		deposit.block = block.Number
+		if deposit.status == "FAILED" {
+			deposit.status = "PENDING"
+		}
+	}
+	s.blocks[block.Number] = block.Hash
+	return nil
+}
+
+func (s *memorySink) Rollback(ctx context.Context, chain string, number uint64) error {
+	s.rollbacks = append(s.rollbacks, number)
+	for _, deposit := range s.deposits {
+		if deposit.status == "PENDING" && deposit.block > number {
+			deposit.status = "FAILED"
+			deposit.confirmations = 0
+		}
+	}
+	for scanned := range s.blocks {
+		if scanned > number {
+			delete(s.blocks, scanned)
+		}
+	}
+	return nil
+}
+
+func (s *memorySink) Confirm(ctx context.Context, chain string, latest uint64) error {
+	for _, deposit := range s.deposits {
+		if deposit.status != "PENDING" {
+			continue
+		}
+		deposit.confirmations = latest - deposit.block + 1
+		if deposit.confirmations >= s.required {
+			deposit.status = "COMPLETED"
+		}
+	}
+	return nil
+}
+
+func depositTransfer(txHash string) chainwatch.Transfer {
+	return chainwatch.Transfer{
+		TxHash:   txHash,
+		Index:    0,
+		To:       "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4",
+		Currency: "BTC",
+		Amount:   decimal.RequireFromString("0.5"),
+	}
+}
+
+func TestScannerCreditsAfterConfirmations(t *testing.T) {
+	ctx := context.Background()
+	chain := chainwatch.NewSimulatedChain("BTC")
+	sink := newMemorySink(3)
+	scanner := chainwatch.NewScanner(chain, sink, chainwatch.ScannerOptions{StartBlock: 1}, logrus.New())
+
+	chain.Mine()
+	chain.Mine(depositTransfer("tx1"))
+	require.NoError(t, scanner.Scan(ctx))
+
+	deposit := sink.deposits["tx1:0"]
+	require.NotNil(t, deposit)
+	assert.Equal(t, "PENDING", deposit.status)
+	assert.Equal(t, uint64(1), deposit.confirmations)
+
+	chain.Mine()
+	require.NoError(t, scanner.Scan(ctx))
+	assert.Equal(t, "PENDING", deposit.status)
+	assert.Equal(t, uint64(2), deposit.confirmations)
+
+	chain.Mine()
+	require.NoError(t, scanner.Scan(ctx))
+	assert.Equal(t, "COMPLETED", deposit.status)
+	assert.Empty(t, sink.rollbacks)
+}
+
+func TestScannerRollsBackReorgedDeposits(t *testing.T) {
+	ctx := context.Background()
+	chain := chainwatch.NewSimulatedChain("BTC")
+	sink := newMemorySink(6)
+	scanner := chainwatch.NewScanner(chain, sink, chainwatch.ScannerOptions{StartBlock: 1}, logrus.New())
+
+	chain.Mine()
+	chain.Mine(depositTransfer("tx1"))
+	chain.Mine(depositTransfer("tx2"))
+	require.NoError(t, scanner.Scan(ctx))
+
+	// Blocks 2 and 3 are replaced by a longer branch where only tx2 made
+	// it, a block later.
+	chain.Reorg(2)
+	chain.Mine()
+	chain.Mine(depositTransfer("tx2"))
+	chain.Mine()
+	require.NoError(t, scanner.Scan(ctx))
+
+	assert.Equal(t, []uint64{1}, sink.rollbacks)
+	assert.Equal(t, "FAILED", sink.deposits["tx1:0"].status)
+	assert.Equal(t, "PENDING", sink.deposits["tx2:0"].status)
+	assert.Equal(t, uint64(3), sink.deposits["tx2:0"].block)
+	assert.Equal(t, uint64(2), sink.deposits["tx2:0"].confirmations)
+
+	latest, _ := chain.LatestBlock(ctx)
+	for number := uint64(1); number <= latest; number++ {
+		block, err := chain.BlockByNumber(ctx, number)
+		require.NoError(t, err)
+		assert.Equal(t, block.Hash, sink.blocks[number])
+	}
+}
+
+func TestScannerRejectsReorgBeyondLimit(t *testing.T) {
+	ctx := context.Background()
+	chain := chainwatch.NewSimulatedChain("ETH")
+	sink := newMemorySink(1)
+	scanner := chainwatch.NewScanner(chain, sink, chainwatch.ScannerOptions{StartBlock: 1, MaxReorgDepth: 2}, logrus.New())
+
+	for i := 0; i < 5; i++ {
+		chain.Mine()
+	}
+	require.NoError(t, scanner.Scan(ctx))
+
+	chain.Reorg(3)
+	for i := 0; i < 4; i++ {
+		chain.Mine()
+	}
+	assert.ErrorIs(t, scanner.Scan(ctx), chainwatch.ErrReorgTooDeep)
+	assert.Empty(t, sink.rollbacks)
+}
@@ -0,0 +1,97 @@
+package tests
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto-exchange-go/internal/export"
+	"crypto-exchange-go/internal/models"
+	"crypto-exchange-go/internal/services"
+	"crypto-exchange-go/pkg/logger"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransactionCursorRoundTrip(t *testing.T) {
+	cursor := models.TransactionCursor{
+		CreatedAt: time.Date(2024, 5, 1, 12, 30, 0, 123456789, time.UTC),
+		ID:        uuid.New(),
+	}
+
+	parsed, err := models.ParseTransactionCursor(cursor.Encode())
+	require.NoError(t, err)
+	assert.Equal(t, cursor, *parsed)
+
+	_, err = models.ParseTransactionCursor("not-a-cursor")
+	assert.ErrorIs(t, err, models.ErrInvalidCursor)
+}
+
+func TestCSVExportEscapesFormulas(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := export.NewWriter(export.FormatCSV, &buf, "transactions")
+	require.NoError(t, err)
+
+	require.NoError(t, w.Write([]string{"description", "amount"}))
+	require.NoError(t, w.Write([]string{"=HYPERLINK(\"x\")", "-1.5"}))
+	require.NoError(t, w.Close())
+
+	assert.Equal(t, "description,amount\n\"'=HYPERLINK(\"\"x\"\")\",-1.5\n", buf.String())
+}
+
+func TestXLSXExportWritesSheet(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := export.NewWriter(export.FormatXLSX, &buf, "orders")
+	require.NoError(t, err)
+
+	require.NoError(t, w.Write([]string{"symbol", "amount"}))
+	require.NoError(t, w.Write([]string{"BTC/USDT <&>", "0.000000000000000001"}))
+	require.NoError(t, w.Close())
+
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+
+	var sheet []byte
+	for _, f := range archive.File {
+		if f.Name == "xl/worksheets/sheet1.xml" {
+			r, err := f.Open()
+			require.NoError(t, err)
+			sheet, err = io.ReadAll(r)
+			require.NoError(t, err)
+		}
+	}
+	require.NotNil(t, sheet)
+
+	assert.Contains(t, string(sheet), "BTC/USDT &lt;&amp;&gt;")
+	assert.Contains(t, string(sheet), "<c><v>0.000000000000000001</v></c>")
+}
+
+func TestTransactionHistoryShowsDebitsNegative(t *testing.T) {
+	db, walletService, _ := setupBalanceServices(t)
+	userID, walletID := fundedWallet(t, walletService, decimal.NewFromInt(100))
+	ctx := context.Background()
+
+	err := walletService.UpdateBalance(ctx, walletID, decimal.NewFromInt(-30), models.BalanceReasonDeposit, uuid.New().String())
+	require.NoError(t, err)
+
+	log := logger.New("error")
+	page, err := services.NewTransactionService(db, log).GetTransactions(ctx, userID, models.TransactionFilter{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, page.Items, 2)
+	directions := map[string]string{}
+	for _, item := range page.Items {
+		directions[item.Amount.String()] = *item.Direction
+	}
+	assert.Equal(t, map[string]string{"100": models.TransactionDirectionCredit, "-30": models.TransactionDirectionDebit}, directions)
+
+	var buf bytes.Buffer
+	w, err := export.NewWriter(export.FormatCSV, &buf, "transactions")
+	require.NoError(t, err)
+	require.NoError(t, services.NewExportService(db, log).ExportTransactions(ctx, userID, models.TransactionFilter{}, w))
+	assert.Contains(t, buf.String(), ",-30,")
+}
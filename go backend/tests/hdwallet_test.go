@@ -0,0 +1,80 @@
+package tests
+
+import (
+	"crypto-exchange-go/internal/hdwallet"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Public derivation steps from BIP32 test vector 1.
+func TestExtendedKeyPublicDerivation(t *testing.T) {
+	parent, err := hdwallet.ParseExtendedKey("xpub68Gmy5EdvgibQVfPdqkBBCHxA5htiqg55crXYuXoQRKfDBFA1WEjWgP6LHhwBZeNK1VTsfTFUHCdrfp1bgwQ9xv5ski8PX9rL2dZXvgGDnw")
+	require.NoError(t, err)
+
+	child, err := parent.Child(1)
+	require.NoError(t, err)
+	assert.Equal(t, "xpub6ASuArnXKPbfEwhqN6e3mwBcDTgzisQN1wXN9BJcM47sSikHjJf3UFHKkNAWbWMiGj7Wf5uMash7SyYq527Hqck2AxYysAA7xmALppuCkwQ", child.String())
+
+	parent, err = hdwallet.ParseExtendedKey("xpub6D4BDPcP2GT577Vvch3R8wDkScZWzQzMMUm3PWbmWvVJrZwQY4VUNgqFJPMM3No2dFDFGTsxxpG5uJh7n7epu4trkrX7x7DogT5Uv6fcLW5")
+	require.NoError(t, err)
+
+	child, err = parent.Derive(2)
+	require.NoError(t, err)
+	assert.Equal(t, "xpub6FHa3pjLCk84BayeJxFW2SP4XRrFd1JYnxeLeU8EqN3vDfZmbqBqaGJAyiLjTAwm6ZLRQUMv1ZACTj37sR62cfN7fe5JnJ7dh8zL4fiyLHV", child.String())
+
+	_, err = parent.Child(hdwallet.HardenedOffset)
+	assert.ErrorIs(t, err, hdwallet.ErrHardenedChild)
+}
+
+func TestExtendedKeyRejectsPrivateKeys(t *testing.T) {
+	_, err := hdwallet.ParseExtendedKey("xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi")
+	assert.ErrorIs(t, err, hdwallet.ErrPrivateKey)
+}
+
+// The generator point is the public key of private key 1, whose addresses
+// are well known on every chain.
+func TestChainAddresses(t *testing.T) {
+	g, err := hex.DecodeString("0279BE667EF9DCBBAC55A06295CE870B07029BFCDB2DCE28D959F2815B16F81798")
+	require.NoError(t, err)
+	key, err := hdwallet.ParsePublicKey(g)
+	require.NoError(t, err)
+
+	for name, expected := range map[string]string{
+		"ETH": "0x7E5F4552091A69125d5DfCb7b8C2659029395Bdf",
+		"BTC": "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4",
+	} {
+		chain, ok := hdwallet.ChainFor(name)
+		require.True(t, ok, name)
+		address, err := chain.Address(key)
+		require.NoError(t, err)
+		assert.Equal(t, expected, address, name)
+	}
+
+	_, ok := hdwallet.ChainFor("UNKNOWN")
+	assert.False(t, ok)
+}
+
+func TestDeriveAddressNeedsAccountKey(t *testing.T) {
+	chain, _ := hdwallet.ChainFor("ETH")
+
+	// Depth 1 key from the BIP32 vector, not an account.
+	key, err := hdwallet.ParseExtendedKey("xpub68Gmy5EdvgibQVfPdqkBBCHxA5htiqg55crXYuXoQRKfDBFA1WEjWgP6LHhwBZeNK1VTsfTFUHCdrfp1bgwQ9xv5ski8PX9rL2dZXvgGDnw")
+	require.NoError(t, err)
+	_, _, err = hdwallet.DeriveAddress(chain, key, 1)
+	assert.ErrorIs(t, err, hdwallet.ErrInvalidExtendedKey)
+
+	// m/0H/1/2H is at depth 3 with a hardened child number.
+	account, err := hdwallet.ParseExtendedKey("xpub6D4BDPcP2GT577Vvch3R8wDkScZWzQzMMUm3PWbmWvVJrZwQY4VUNgqFJPMM3No2dFDFGTsxxpG5uJh7n7epu4trkrX7x7DogT5Uv6fcLW5")
+	require.NoError(t, err)
+	address, path, err := hdwallet.DeriveAddress(chain, account, 7)
+	require.NoError(t, err)
+	assert.Equal(t, "m/44'/60'/2'/0/7", path)
+	assert.Len(t, address, 42)
+
+	again, _, err := hdwallet.DeriveAddress(chain, account, 7)
+	require.NoError(t, err)
+	assert.Equal(t, address, again)
+}
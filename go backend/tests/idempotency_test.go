@@ -0,0 +1,133 @@
+package tests
+
+import (
+	"context"
+	"crypto-exchange-go/internal/middleware"
+	"crypto-exchange-go/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+type memoryIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]*middleware.IdempotencyRecord
+}
+
+func (s *memoryIdempotencyStore) Reserve(ctx context.Context, scope, key, requestHash string) (*middleware.IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.records[scope+key]; ok {
+		return existing, nil
+	}
+	s.records[scope+key] = &middleware.IdempotencyRecord{RequestHash: requestHash, Status: middleware.IdempotencyPending}
+	return nil, nil
+}
+
+func (s *memoryIdempotencyStore) Complete(ctx context.Context, scope, key string, record *middleware.IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records[scope+key] = record
+	return nil
+}
+
+func (s *memoryIdempotencyStore) Release(ctx context.Context, scope, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, scope+key)
+	return nil
+}
+
+func setupIdempotentRouter(status int, uncommitted ...bool) (*gin.Engine, *int) {
+	gin.SetMode(gin.TestMode)
+
+	calls := 0
+	userID := uuid.New()
+	store := &memoryIdempotencyStore{records: make(map[string]*middleware.IdempotencyRecord)}
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", &models.User{ID: userID})
+		c.Next()
+	})
+	router.POST("/order", middleware.Idempotency(store), func(c *gin.Context) {
+		calls++
+		if len(uncommitted) > 0 && uncommitted[0] {
+			middleware.MarkUncommitted(c)
+		}
+		c.JSON(status, gin.H{"data": gin.H{"call": calls}})
+	})
+
+	return router, &calls
+}
+
+func postIdempotent(router *gin.Engine, key, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/order", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set(middleware.IdempotencyHeader, key)
+	}
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotencyReplaysOriginalResponse(t *testing.T) {
+	router, calls := setupIdempotentRouter(http.StatusCreated)
+
+	first := postIdempotent(router, "key-1", `{"amount":"1"}`)
+	second := postIdempotent(router, "key-1", `{"amount":"1"}`)
+
+	assert.Equal(t, 1, *calls)
+	assert.Equal(t, http.StatusCreated, second.Code)
+	assert.Equal(t, first.Body.String(), second.Body.String())
+	assert.Equal(t, "true", second.Header().Get(middleware.IdempotencyReplayedHeader))
+}
+
+func TestIdempotencyRejectsKeyReuseWithDifferentBody(t *testing.T) {
+	router, calls := setupIdempotentRouter(http.StatusCreated)
+
+	postIdempotent(router, "key-1", `{"amount":"1"}`)
+	w := postIdempotent(router, "key-1", `{"amount":"2"}`)
+
+	assert.Equal(t, 1, *calls)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+}
+
+func TestIdempotencyAllowsRetryAfterUncommittedServerError(t *testing.T) {
+	router, calls := setupIdempotentRouter(http.StatusInternalServerError, true)
+
+	postIdempotent(router, "key-1", `{"amount":"1"}`)
+	postIdempotent(router, "key-1", `{"amount":"1"}`)
+
+	assert.Equal(t, 2, *calls)
+}
+
+func TestIdempotencyReplaysServerErrorThatMayHaveCommitted(t *testing.T) {
+	router, calls := setupIdempotentRouter(http.StatusInternalServerError)
+
+	postIdempotent(router, "key-1", `{"amount":"1"}`)
+	w := postIdempotent(router, "key-1", `{"amount":"1"}`)
+
+	assert.Equal(t, 1, *calls)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "true", w.Header().Get(middleware.IdempotencyReplayedHeader))
+}
+
+func TestIdempotencyWithoutKeyPassesThrough(t *testing.T) {
+	router, calls := setupIdempotentRouter(http.StatusCreated)
+
+	postIdempotent(router, "", `{"amount":"1"}`)
+	postIdempotent(router, "", `{"amount":"1"}`)
+
+	assert.Equal(t, 2, *calls)
+}
@@ -0,0 +1,71 @@
+package tests
+
+import (
+	"crypto-exchange-go/internal/ledger"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLedgerTransferIsBalanced(t *testing.T) {
+	entry := &ledger.Entry{
+		ReferenceType: "DEPOSIT",
+		ReferenceID:   uuid.New().String(),
+		Lines: ledger.Transfer(
+			ledger.SystemAccount(ledger.AccountExternal),
+			ledger.WalletAccount(uuid.New()),
+			"BTC",
+			decimal.RequireFromString("0.015"),
+		),
+	}
+
+	assert.NoError(t, entry.Validate())
+	assert.Equal(t, ledger.Debit, entry.Lines[0].Side)
+	assert.Equal(t, ledger.Credit, entry.Lines[1].Side)
+}
+
+func TestLedgerRejectsUnbalancedEntry(t *testing.T) {
+	walletID := uuid.New()
+	entry := &ledger.Entry{
+		ReferenceType: "TRADE",
+		Lines: []ledger.Line{
+			{Account: ledger.SystemAccount(ledger.AccountTradeClearing), Currency: "USDT", Side: ledger.Debit, Amount: decimal.NewFromInt(100)},
+			{Account: ledger.WalletAccount(walletID), Currency: "USDT", Side: ledger.Credit, Amount: decimal.NewFromInt(99)},
+			{Account: ledger.SystemAccount(ledger.AccountFees), Currency: "BTC", Side: ledger.Credit, Amount: decimal.NewFromInt(1)},
+		},
+	}
+
+	err := entry.Validate()
+	assert.True(t, errors.Is(err, ledger.ErrUnbalanced))
+}
+
+func TestLedgerBalancesPerCurrency(t *testing.T) {
+	walletID := uuid.New()
+	entry := &ledger.Entry{
+		ReferenceType: "TRADE",
+		Lines: []ledger.Line{
+			{Account: ledger.SystemAccount(ledger.AccountTradeClearing), Currency: "USDT", Side: ledger.Debit, Amount: decimal.NewFromInt(100)},
+			{Account: ledger.WalletAccount(walletID), Currency: "USDT", Side: ledger.Credit, Amount: decimal.NewFromInt(99)},
+			{Account: ledger.SystemAccount(ledger.AccountFees), Currency: "USDT", Side: ledger.Credit, Amount: decimal.NewFromInt(1)},
+		},
+	}
+
+	assert.NoError(t, entry.Validate())
+}
+
+func TestLedgerRejectsNonPositiveAmounts(t *testing.T) {
+	entry := &ledger.Entry{
+		ReferenceType: "ADJUSTMENT",
+		Lines: ledger.Transfer(
+			ledger.SystemAccount(ledger.AccountExternal),
+			ledger.WalletAccount(uuid.New()),
+			"ETH",
+			decimal.Zero,
+		),
+	}
+
+	assert.Error(t, entry.Validate())
+}
@@ -0,0 +1,114 @@
+package tests
+
+import (
+	"context"
+	"crypto-exchange-go/internal/config"
+	"crypto-exchange-go/internal/database"
+	"crypto-exchange-go/internal/models"
+	"crypto-exchange-go/internal/services"
+	"crypto-exchange-go/pkg/logger"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrderAmendKeepsFills(t *testing.T) {
+	placed := time.Now().Add(-time.Minute)
+	order := &services.Order{
+		Amount:    decimal.NewFromInt(10),
+		Price:     decimal.NewFromInt(100),
+		Filled:    decimal.NewFromInt(4),
+		Remaining: decimal.NewFromInt(6),
+		CreatedAt: placed,
+	}
+
+	now := time.Now()
+	require.NoError(t, order.Amend(decimal.NewFromInt(100), decimal.NewFromInt(8), now))
+	assert.True(t, order.Remaining.Equal(decimal.NewFromInt(4)), "remaining %s", order.Remaining)
+	assert.Equal(t, placed, order.CreatedAt, "a smaller amount keeps time priority")
+
+	require.NoError(t, order.Amend(decimal.NewFromInt(101), decimal.NewFromInt(8), now))
+	assert.Equal(t, now, order.CreatedAt, "a new price loses time priority")
+
+	assert.Error(t, order.Amend(decimal.NewFromInt(101), decimal.NewFromInt(4), now), "amount must stay above the fills")
+	assert.True(t, order.Amount.Equal(decimal.NewFromInt(8)))
+}
+
+func TestEngineAmendNeedsRestingOrder(t *testing.T) {
+	engine := &services.MatchingEngine{}
+	_, err := engine.AmendOrder(uuid.New(), "BTC/USDT", decimal.NewFromInt(1), decimal.NewFromInt(1))
+	assert.ErrorIs(t, err, services.ErrOrderNotInBook)
+}
+
+// setupOrderServices needs ScyllaDB for the matching engine on top of what
+// setupBalanceServices needs, and creates a market of its own.
+func setupOrderServices(t *testing.T) (*services.OrderService, *services.WalletService, string) {
+	t.Helper()
+
+	db, walletService, _ := setupBalanceServices(t)
+
+	scyllaDB, err := database.NewScyllaDB(config.ScyllaDB{Hosts: []string{"127.0.0.1:9042"}, Keyspace: "trading_test"})
+	if err != nil {
+		t.Skipf("ScyllaDB not available: %v", err)
+	}
+	redisClient, err := database.NewRedis(config.Redis{Host: "localhost", Port: 6379, DB: 1})
+	require.NoError(t, err)
+
+	log := logger.New("error")
+	matchingEngine, err := services.NewMatchingEngine(scyllaDB, redisClient, log)
+	require.NoError(t, err)
+
+	metadata := models.MarketMetadata{}
+	metadata.Limits.Amount.Min = decimal.RequireFromString("0.0001")
+	metadata.Limits.Price.Min = decimal.RequireFromString("0.01")
+
+	currency := "T" + strings.ToUpper(uuid.New().String()[:8])
+	_, err = db.Exec(`INSERT INTO exchange_market (id, currency, pair, isTrending, isHot, metadata, status) VALUES (?, ?, 'USDT', 0, 0, ?, 1)`,
+		uuid.New(), currency, metadata)
+	require.NoError(t, err)
+
+	return services.NewOrderService(db, scyllaDB, redisClient, matchingEngine, log), walletService, currency
+}
+
+func placeBuyOrder(ctx context.Context, orderService *services.OrderService, userID uuid.UUID, currency string, amount, price int64) (*models.OrderResponse, error) {
+	orderPrice := decimal.NewFromInt(price)
+	return orderService.CreateOrder(ctx, userID, &models.CreateOrderRequest{
+		Currency: currency,
+		Pair:     "USDT",
+		Type:     models.OrderTypeLimit,
+		Side:     models.OrderSideBuy,
+		Amount:   decimal.NewFromInt(amount),
+		Price:    &orderPrice,
+	})
+}
+
+func TestCancelAllOrdersForSymbol(t *testing.T) {
+	orderService, walletService, currency := setupOrderServices(t)
+	_, _, other := setupOrderServices(t)
+	userID, _ := fundedWallet(t, walletService, decimal.NewFromInt(1000))
+	ctx := context.Background()
+
+	for _, market := range []string{currency, currency, other} {
+		_, err := placeBuyOrder(ctx, orderService, userID, market, 1, 10)
+		require.NoError(t, err)
+	}
+	assertWalletMatchesLedger(t, walletService, userID, "970", "30")
+
+	canceled, err := orderService.CancelAllOrders(ctx, userID, currency+"/USDT")
+	require.NoError(t, err)
+	assert.Len(t, canceled, 2)
+	for _, order := range canceled {
+		assert.Equal(t, models.OrderStatusCanceled, order.Status)
+	}
+	assertWalletMatchesLedger(t, walletService, userID, "990", "10")
+
+	open, err := orderService.GetOrders(ctx, userID, string(models.OrderStatusOpen), 10, 0)
+	require.NoError(t, err)
+	require.Len(t, open, 1)
+	assert.Equal(t, other+"/USDT", open[0].Symbol)
+}
@@ -0,0 +1,232 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto-exchange-go/internal/models"
+	"crypto-exchange-go/internal/payments"
+	"crypto-exchange-go/internal/services"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const stripeEvent = `{"id":"evt_1","type":"payment_intent.succeeded","data":{"object":{"id":"pi_1","amount":1050,"currency":"usd","status":"succeeded","metadata":{"reference":"dep_1"}}}}`
+
+func TestStripeWebhookSignature(t *testing.T) {
+	stripe, err := payments.NewStripe(payments.StripeOptions{WebhookSecret: "whsec_test"})
+	require.NoError(t, err)
+	body := []byte(stripeEvent)
+
+	header := http.Header{}
+	header.Set(payments.StripeSignatureHeader, payments.SignStripePayload("whsec_test", time.Now(), body))
+	event, err := stripe.VerifyWebhook(context.Background(), header, body)
+	require.NoError(t, err)
+	assert.Equal(t, "evt_1", event.ID)
+	require.NotNil(t, event.Payment)
+	assert.Equal(t, payments.PaymentSucceeded, event.Payment.Status)
+	assert.True(t, event.Payment.Amount.Equal(decimal.RequireFromString("10.50")))
+	assert.Equal(t, "USD", event.Payment.Currency)
+	assert.Equal(t, "dep_1", event.Payment.Reference)
+
+	tampered := []byte(`{"id":"evt_1","type":"payment_intent.succeeded","data":{"object":{"id":"pi_1","amount":999999,"currency":"usd","status":"succeeded"}}}`)
+	_, err = stripe.VerifyWebhook(context.Background(), header, tampered)
+	assert.ErrorIs(t, err, payments.ErrInvalidSignature)
+
+	header.Set(payments.StripeSignatureHeader, payments.SignStripePayload("whsec_test", time.Now().Add(-time.Hour), body))
+	_, err = stripe.VerifyWebhook(context.Background(), header, body)
+	assert.ErrorIs(t, err, payments.ErrInvalidSignature)
+}
+
+func TestStripeNeedsWebhookSecret(t *testing.T) {
+	_, err := payments.NewStripe(payments.StripeOptions{SecretKey: "sk_test"})
+	assert.ErrorIs(t, err, payments.ErrNoWebhookSecret)
+
+	// A zero Stripe must not accept webhooks signed with an empty secret.
+	body := []byte(stripeEvent)
+	header := http.Header{}
+	header.Set(payments.StripeSignatureHeader, payments.SignStripePayload("", time.Now(), body))
+	_, err = (&payments.Stripe{}).VerifyWebhook(context.Background(), header, body)
+	assert.ErrorIs(t, err, payments.ErrNoWebhookSecret)
+}
+
+func TestStripeMinorUnits(t *testing.T) {
+	assert.True(t, payments.StripeAmount(500, "JPY").Equal(decimal.NewFromInt(500)))
+	assert.True(t, payments.StripeAmount(1234, "KWD").Equal(decimal.RequireFromString("1.234")))
+
+	minor, err := payments.StripeMinorAmount(decimal.RequireFromString("10.5"), "usd")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1050), minor)
+
+	_, err = payments.StripeMinorAmount(decimal.RequireFromString("10.505"), "USD")
+	assert.Error(t, err)
+}
+
+func TestPayPalWebhookSignature(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "messageverificationcerts.paypal.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	paypal := payments.NewPayPal(payments.PayPalOptions{
+		WebhookID: "WH-1",
+		Certificates: func(ctx context.Context, certURL string) (*x509.Certificate, error) {
+			return cert, nil
+		},
+	})
+
+	body := []byte(`{"id":"WH-EVT-1","event_type":"PAYMENT.CAPTURE.COMPLETED","resource_type":"capture","resource":{"id":"CAP-1","status":"COMPLETED","custom_id":"dep_1","amount":{"currency_code":"EUR","value":"25.00"},"supplementary_data":{"related_ids":{"order_id":"ORDER-1"}}}}`)
+	message := payments.PayPalSignedMessage("tx-1", "2024-05-01T10:00:00Z", "WH-1", body)
+	digest := sha256.Sum256([]byte(message))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+
+	header := http.Header{}
+	header.Set(payments.PayPalTransmissionIDHeader, "tx-1")
+	header.Set(payments.PayPalTransmissionTimeHeader, "2024-05-01T10:00:00Z")
+	header.Set(payments.PayPalTransmissionSigHeader, base64.StdEncoding.EncodeToString(signature))
+	header.Set(payments.PayPalCertURLHeader, "https://api.paypal.com/v1/notifications/certs/CERT-1")
+	header.Set(payments.PayPalAuthAlgoHeader, "SHA256withRSA")
+
+	event, err := paypal.VerifyWebhook(context.Background(), header, body)
+	require.NoError(t, err)
+	require.NotNil(t, event.Payment)
+	assert.Equal(t, "ORDER-1", event.Payment.ID)
+	assert.Equal(t, payments.PaymentSucceeded, event.Payment.Status)
+	assert.True(t, event.Payment.Amount.Equal(decimal.NewFromInt(25)))
+
+	_, err = paypal.VerifyWebhook(context.Background(), header, append(body, ' '))
+	assert.ErrorIs(t, err, payments.ErrInvalidSignature)
+
+	header.Set(payments.PayPalCertURLHeader, "https://paypal.com.attacker.example/cert")
+	_, err = paypal.VerifyWebhook(context.Background(), header, body)
+	assert.ErrorIs(t, err, payments.ErrInvalidSignature)
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestPayPalCertificateIssuedToPayPal(t *testing.T) {
+	caKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	ca, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	body := []byte(`{"id":"WH-EVT-1","event_type":"PAYMENT.CAPTURE.COMPLETED","resource_type":"capture","resource":{"id":"CAP-1","status":"COMPLETED","amount":{"currency_code":"EUR","value":"25.00"}}}`)
+
+	// verify signs a webhook with a certificate the test root issued to name.
+	verify := func(name string) error {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(2),
+			Subject:      pkix.Name{CommonName: name},
+			DNSNames:     []string{name},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+		require.NoError(t, err)
+		certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+		paypal := payments.NewPayPal(payments.PayPalOptions{
+			WebhookID: "WH-1",
+			Roots:     roots,
+			HTTPClient: &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader(certPEM)), Request: req}, nil
+			})},
+		})
+
+		digest := sha256.Sum256([]byte(payments.PayPalSignedMessage("tx-1", "2024-05-01T10:00:00Z", "WH-1", body)))
+		signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		require.NoError(t, err)
+
+		header := http.Header{}
+		header.Set(payments.PayPalTransmissionIDHeader, "tx-1")
+		header.Set(payments.PayPalTransmissionTimeHeader, "2024-05-01T10:00:00Z")
+		header.Set(payments.PayPalTransmissionSigHeader, base64.StdEncoding.EncodeToString(signature))
+		header.Set(payments.PayPalCertURLHeader, "https://api.paypal.com/v1/notifications/certs/CERT-1")
+		header.Set(payments.PayPalAuthAlgoHeader, "SHA256withRSA")
+
+		_, err = paypal.VerifyWebhook(context.Background(), header, body)
+		return err
+	}
+
+	assert.NoError(t, verify("messageverificationcerts.paypal.com"))
+	assert.Error(t, verify("attacker.example"), "a trusted certificate for another name")
+}
+
+func TestFakeProviderWebhook(t *testing.T) {
+	fake := payments.NewFakeProvider("fake", "secret")
+	payment, err := fake.CreatePayment(context.Background(), decimal.NewFromInt(100), "usd", "dep_1")
+	require.NoError(t, err)
+
+	header, body, err := fake.Settle(payment.ID, payments.PaymentSucceeded)
+	require.NoError(t, err)
+
+	event, err := fake.VerifyWebhook(context.Background(), header, body)
+	require.NoError(t, err)
+	assert.Equal(t, payment.ID, event.Payment.ID)
+	assert.Equal(t, payments.PaymentSucceeded, event.Payment.Status)
+
+	_, err = payments.NewFakeProvider("fake", "other").VerifyWebhook(context.Background(), header, body)
+	assert.ErrorIs(t, err, payments.ErrInvalidSignature)
+}
+
+func TestMatchPaymentCrossChecksDeposit(t *testing.T) {
+	deposit := &models.Deposit{ID: uuid.New(), Currency: "USD", Amount: decimal.RequireFromString("100.00")}
+	payment := &payments.Payment{Reference: deposit.ID.String(), Currency: "usd", Amount: decimal.NewFromInt(100)}
+	assert.NoError(t, services.MatchPayment(deposit, payment))
+
+	short := *payment
+	short.Amount = decimal.RequireFromString("99.99")
+	assert.ErrorIs(t, services.MatchPayment(deposit, &short), services.ErrPaymentMismatch)
+
+	otherCurrency := *payment
+	otherCurrency.Currency = "EUR"
+	assert.ErrorIs(t, services.MatchPayment(deposit, &otherCurrency), services.ErrPaymentMismatch)
+
+	otherDeposit := *payment
+	otherDeposit.Reference = uuid.NewString()
+	assert.ErrorIs(t, services.MatchPayment(deposit, &otherDeposit), services.ErrPaymentMismatch)
+}
@@ -0,0 +1,74 @@
+package tests
+
+import (
+	"context"
+	"crypto-exchange-go/internal/handlers/admin"
+	"crypto-exchange-go/internal/middleware"
+	"crypto-exchange-go/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+type memoryPermissionStore map[uuid.UUID][]string
+
+func (s memoryPermissionStore) HasPermission(ctx context.Context, userID uuid.UUID, permission string) (bool, error) {
+	for _, granted := range s[userID] {
+		if granted == permission {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func TestRequirePermission(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	adminID, customer := uuid.New(), uuid.New()
+	store := memoryPermissionStore{adminID: {"Access Wallet Management"}}
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		if id, err := uuid.Parse(c.GetHeader("X-User")); err == nil {
+			c.Set("user", &models.User{ID: id})
+		}
+	})
+	router.POST("/snapshot", middleware.RequirePermission(store, "Access Wallet Management"), func(c *gin.Context) {
+		user, ok := middleware.GetAdminFromContext(c)
+		assert.True(t, ok)
+		assert.Equal(t, adminID, user.ID)
+		c.Status(http.StatusCreated)
+	})
+
+	send := func(user string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/snapshot", nil)
+		req.Header.Set("X-User", user)
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, send(""))
+	assert.Equal(t, http.StatusForbidden, send(customer.String()))
+	assert.Equal(t, http.StatusCreated, send(adminID.String()))
+}
+
+func TestWithdrawalReviewNeedsPermissionGuard(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler := admin.NewWithdrawalHandler(nil, logrus.New())
+
+	// A signed in user on a route that was registered without the guard.
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", &models.User{ID: uuid.New()})
+	})
+	router.POST("/withdrawal/:id/approve", handler.Approve)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/withdrawal/"+uuid.New().String()+"/approve", nil))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
@@ -0,0 +1,119 @@
+package tests
+
+import (
+	"context"
+	"crypto-exchange-go/internal/config"
+	"crypto-exchange-go/internal/models"
+	"crypto-exchange-go/internal/services"
+	"crypto-exchange-go/pkg/logger"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWalletReconciliationBalanced(t *testing.T) {
+	r := &services.WalletReconciliation{
+		Wallet: models.Wallet{
+			ID:      uuid.New(),
+			UserID:  uuid.New(),
+			Balance: decimal.RequireFromString("75.5"),
+			InOrder: decimal.RequireFromString("24.5"),
+		},
+		LedgerAvailable:  decimal.RequireFromString("75.5"),
+		LedgerLocked:     decimal.RequireFromString("24.5"),
+		JournalAvailable: decimal.RequireFromString("75.5"),
+		ExpectedLocked:   decimal.RequireFromString("24.5"),
+	}
+
+	assert.Empty(t, r.Discrepancies())
+}
+
+func TestWalletReconciliationReportsEachMismatch(t *testing.T) {
+	r := &services.WalletReconciliation{
+		Wallet: models.Wallet{
+			ID:       uuid.New(),
+			UserID:   uuid.New(),
+			Currency: "USDT",
+			Type:     models.WalletTypeSpot,
+			Balance:  decimal.NewFromInt(100),
+			InOrder:  decimal.NewFromInt(10),
+		},
+		LedgerAvailable:  decimal.NewFromInt(100),
+		LedgerLocked:     decimal.NewFromInt(10),
+		JournalAvailable: decimal.NewFromInt(90),
+		ExpectedLocked:   decimal.NewFromInt(4),
+	}
+
+	discrepancies := r.Discrepancies()
+	require.Len(t, discrepancies, 2)
+
+	assert.Equal(t, models.ReconciliationTransactions, discrepancies[0].Check)
+	assert.True(t, discrepancies[0].Difference.Equal(decimal.NewFromInt(10)))
+	assert.Equal(t, r.Wallet.ID, *discrepancies[0].WalletID)
+
+	assert.Equal(t, models.ReconciliationHolds, discrepancies[1].Check)
+	assert.Equal(t, "inOrder", discrepancies[1].Field)
+	assert.True(t, discrepancies[1].Difference.Equal(decimal.NewFromInt(6)))
+}
+
+func TestNextDailyRun(t *testing.T) {
+	before := time.Date(2024, 3, 10, 1, 30, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2024, 3, 10, 2, 0, 0, 0, time.UTC), services.NextDailyRun(before, 2))
+
+	after := time.Date(2024, 3, 10, 2, 0, 1, 0, time.UTC)
+	assert.Equal(t, time.Date(2024, 3, 11, 2, 0, 0, 0, time.UTC), services.NextDailyRun(after, 2))
+}
+
+func TestGetWalletsListsFrozenWallets(t *testing.T) {
+	db, walletService, _ := setupBalanceServices(t)
+	userID, walletID := fundedWallet(t, walletService, decimal.NewFromInt(25))
+	ctx := context.Background()
+
+	_, err := walletService.CreateWallet(ctx, userID, "BTC", models.WalletTypeSpot)
+	require.NoError(t, err)
+	_, err = db.Exec(`UPDATE wallet SET frozen = TRUE WHERE id = ?`, walletID)
+	require.NoError(t, err)
+
+	wallets, err := walletService.GetWallets(ctx, userID, models.WalletTypeSpot)
+	require.NoError(t, err)
+	require.Len(t, wallets, 2)
+
+	assert.Equal(t, "BTC", wallets[0].Currency)
+	assert.False(t, wallets[0].Frozen)
+	assert.Equal(t, "USDT", wallets[1].Currency)
+	assert.True(t, wallets[1].Frozen)
+	assert.True(t, wallets[1].Balance.Equal(decimal.NewFromInt(25)))
+}
+
+func TestReconciliationFreezesHoldWithoutEscrow(t *testing.T) {
+	db, walletService, _ := setupBalanceServices(t)
+	userID, walletID := fundedWallet(t, walletService, decimal.NewFromInt(25))
+	healthyUser, healthyWallet := fundedWallet(t, walletService, decimal.NewFromInt(25))
+	ctx := context.Background()
+
+	// A P2P hold with no escrow row behind it.
+	require.NoError(t, walletService.Hold(ctx, walletID, decimal.NewFromInt(5), models.BalanceReasonP2pTrade, uuid.New().String()))
+
+	log := logger.New("error")
+	reconciliation := services.NewReconciliationService(db, services.NewNotificationService(db, log),
+		config.Reconciliation{FreezeWallets: true}, log)
+	report, err := reconciliation.Run(ctx)
+	require.NoError(t, err)
+
+	var holds []*models.Discrepancy
+	for _, discrepancy := range report.Discrepancies {
+		if discrepancy.UserID != nil && (*discrepancy.UserID == userID || *discrepancy.UserID == healthyUser) {
+			holds = append(holds, discrepancy)
+		}
+	}
+	require.Len(t, holds, 1)
+	assert.Equal(t, models.ReconciliationHolds, holds[0].Check)
+	assert.True(t, holds[0].Difference.Equal(decimal.NewFromInt(5)))
+
+	assert.Contains(t, report.FrozenWallets, walletID)
+	assert.NotContains(t, report.FrozenWallets, healthyWallet)
+}
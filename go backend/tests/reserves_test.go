@@ -0,0 +1,72 @@
+package tests
+
+import (
+	"crypto-exchange-go/internal/reserves"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func reserveLeaves(n int) []reserves.Leaf {
+	leaves := make([]reserves.Leaf, n)
+	for i := range leaves {
+		leaves[i] = reserves.Leaf{
+			UserID: fmt.Sprintf("user-%d", i),
+			Salt:   fmt.Sprintf("salt-%d", i),
+			Balances: reserves.Balances{
+				"BTC":  decimal.NewFromFloat(0.5).Mul(decimal.NewFromInt(int64(i + 1))),
+				"USDT": decimal.NewFromInt(int64(100 * (i + 1))),
+			},
+		}
+	}
+	return leaves
+}
+
+func TestReserveTreeTotalsAndProofs(t *testing.T) {
+	for _, n := range []int{1, 2, 5, 8} {
+		t.Run(fmt.Sprintf("%d leaves", n), func(t *testing.T) {
+			tree, err := reserves.Build(reserveLeaves(n))
+			require.NoError(t, err)
+
+			root := tree.Root()
+			expectedUSDT := decimal.NewFromInt(int64(100 * n * (n + 1) / 2))
+			assert.True(t, root.Sums["USDT"].Equal(expectedUSDT))
+
+			for i := 0; i < n; i++ {
+				proof, err := tree.Proof(i)
+				require.NoError(t, err)
+
+				// Proofs travel as JSON to the offline verifier.
+				data, err := json.Marshal(proof)
+				require.NoError(t, err)
+				decoded := &reserves.Proof{}
+				require.NoError(t, json.Unmarshal(data, decoded))
+
+				assert.NoError(t, reserves.Verify(decoded, root.Hash, root.Sums))
+			}
+		})
+	}
+}
+
+func TestReserveProofRejectsTampering(t *testing.T) {
+	tree, err := reserves.Build(reserveLeaves(5))
+	require.NoError(t, err)
+	root := tree.Root()
+
+	proof, err := tree.Proof(2)
+	require.NoError(t, err)
+	proof.Balances["USDT"] = proof.Balances["USDT"].Add(decimal.NewFromInt(1))
+	assert.ErrorIs(t, reserves.Verify(proof, root.Hash, root.Sums), reserves.ErrInvalidProof)
+
+	proof, err = tree.Proof(2)
+	require.NoError(t, err)
+	proof.Path[0].Sums = reserves.Balances{"USDT": decimal.NewFromInt(-300)}
+	assert.ErrorIs(t, reserves.Verify(proof, root.Hash, root.Sums), reserves.ErrNegativeBalance)
+
+	_, err = reserves.Build([]reserves.Leaf{{UserID: "u", Salt: "s", Balances: reserves.Balances{"BTC": decimal.NewFromInt(-1)}}})
+	assert.ErrorIs(t, err, reserves.ErrNegativeBalance)
+}
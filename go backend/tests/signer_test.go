@@ -0,0 +1,159 @@
+package tests
+
+import (
+	"context"
+	"crypto-exchange-go/internal/hdwallet"
+	"crypto-exchange-go/internal/signer"
+	"crypto-exchange-go/internal/utxo"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The private key 1, whose public key is the generator and whose P2WPKH
+// address is masterAddress.
+var keyOne = append(make([]byte, 31), 1)
+
+func TestSignIsDeterministic(t *testing.T) {
+	vectors := map[string]string{
+		"Satoshi Nakamoto": "3045022100934b1ea10a4b3c1757e2b0c017d0b6143ce3c9a7e6a4a49860d7a6ab210ee3d802202442ce9d2b916064108014783e923ec36b49743e2ffa1c4496f01a512aafd9e5",
+		"All those moments will be lost in time, like tears in rain. Time to die...": "30450221008600dbd41e348fe5c9465ab92d23e3db8b98b873beecd930736488696438cb6b0220547fe64427496db33bf66019dacbf0039c04199abb0122918601db38a72cfc21",
+	}
+	for message, expected := range vectors {
+		digest := sha256.Sum256([]byte(message))
+		signature, err := signer.Sign(keyOne, digest[:])
+		require.NoError(t, err)
+		assert.Equal(t, expected, hex.EncodeToString(signature), message)
+	}
+}
+
+func TestKeystore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keystore.json")
+
+	keystore, err := signer.OpenKeystore(path, "correct horse")
+	require.NoError(t, err)
+	publicKey, err := keystore.Add("btc-master", keyOne)
+	require.NoError(t, err)
+	assert.Equal(t, "0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798", publicKey)
+
+	_, err = keystore.Add("btc-master", keyOne)
+	assert.ErrorIs(t, err, signer.ErrKeyExists)
+
+	_, err = signer.OpenKeystore(path, "battery staple")
+	assert.ErrorIs(t, err, signer.ErrWrongPassphrase)
+
+	reopened, err := signer.OpenKeystore(path, "correct horse")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"btc-master": publicKey}, reopened.PublicKeys())
+}
+
+func TestMnemonicAccount(t *testing.T) {
+	mnemonic := strings.Repeat("abandon ", 11) + "about"
+	eth, _ := hdwallet.ChainFor("ETH")
+
+	account, err := signer.MnemonicAccount(mnemonic, eth.CoinType(), 0)
+	require.NoError(t, err)
+	key, err := account.Key(0)
+	require.NoError(t, err)
+	public, err := hdwallet.PublicKeyFromPrivate(key)
+	require.NoError(t, err)
+	address, err := eth.Address(public)
+	require.NoError(t, err)
+	assert.Equal(t, "0x9858EfFD232B4033E47d90003D41EC34EcaEda94", address)
+
+	_, err = signer.MnemonicAccount("abandon about", eth.CoinType(), 0)
+	assert.ErrorIs(t, err, signer.ErrInvalidMnemonic)
+}
+
+func spendableTx(payout int64) *utxo.UnsignedTx {
+	return &utxo.UnsignedTx{
+		Chain: "BTC",
+		Inputs: []utxo.Coin{{
+			ID:     "coin",
+			TxID:   strings.Repeat("ab", 32),
+			Value:  200000,
+			Script: "0014751e76e8199196d454941c45d1b3a323f1433bd6",
+		}},
+		Outputs: []utxo.Output{
+			{Address: "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2", Value: payout},
+			{Address: masterAddress, Value: 200000 - payout - 2000},
+		},
+		Fee: 2000,
+	}
+}
+
+func newTestSigner(t *testing.T) *signer.SoftwareSigner {
+	keystore, err := signer.OpenKeystore(filepath.Join(t.TempDir(), "keystore.json"), "passphrase")
+	require.NoError(t, err)
+	_, err = keystore.Add("btc-master", keyOne)
+	require.NoError(t, err)
+
+	policy := signer.Policy{Chains: map[string]signer.ChainPolicy{
+		"BTC": {MaxAmount: 100000, DailyAmount: 150000, MaxFee: 5000},
+	}}
+	software, err := signer.NewSoftwareSigner(keystore, policy, logrus.New())
+	require.NoError(t, err)
+	return software
+}
+
+func TestSoftwareSignerPolicy(t *testing.T) {
+	ctx := context.Background()
+	software := newTestSigner(t)
+
+	signed, err := software.SignTransaction(ctx, &signer.Request{Reference: "batch-1", Tx: spendableTx(90000)})
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(signed, "020000000001"), "segwit transaction")
+	assert.Contains(t, signed, "210279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798", "witness carries the public key")
+
+	// Change to the signer's own key doesn't count, but the payout does.
+	_, err = software.SignTransaction(ctx, &signer.Request{Reference: "batch-2", Tx: spendableTx(120000)})
+	assert.ErrorIs(t, err, signer.ErrPolicy, "over the per transaction limit")
+	_, err = software.SignTransaction(ctx, &signer.Request{Reference: "batch-3", Tx: spendableTx(70000)})
+	assert.ErrorIs(t, err, signer.ErrPolicy, "over the daily limit")
+
+	expensive := spendableTx(10000)
+	expensive.Outputs[1].Value -= 10000
+	_, err = software.SignTransaction(ctx, &signer.Request{Reference: "batch-4", Tx: expensive})
+	assert.ErrorIs(t, err, signer.ErrPolicy, "fee too high")
+
+	litecoin := spendableTx(10000)
+	litecoin.Chain = "LTC"
+	litecoin.Outputs = []utxo.Output{{Address: "ltc1qw508d6qejxtdg4y5r3zarvary0c5xw7kgmn4n9", Value: 10000}}
+	_, err = software.SignTransaction(ctx, &signer.Request{Reference: "batch-5", Tx: litecoin})
+	assert.ErrorIs(t, err, signer.ErrPolicy, "chain not enabled")
+
+	stranger := spendableTx(10000)
+	stranger.Inputs[0].Script = "0014" + strings.Repeat("11", 20)
+	_, err = software.SignTransaction(ctx, &signer.Request{Reference: "batch-6", Tx: stranger})
+	assert.ErrorIs(t, err, signer.ErrUnknownKey)
+}
+
+func TestSignerOverHTTP(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := httptest.NewServer(signer.NewHandler(newTestSigner(t), "secret", logrus.New()))
+	defer server.Close()
+	ctx := context.Background()
+
+	_, err := signer.NewClient(server.URL, "wrong").PublicKeys(ctx)
+	assert.ErrorIs(t, err, signer.ErrUnauthorized)
+
+	client := signer.NewClient(server.URL, "secret")
+	keys, err := client.PublicKeys(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798", keys["btc-master"])
+
+	signed, err := client.SignTransaction(ctx, &signer.Request{Reference: "batch-1", Tx: spendableTx(90000)})
+	require.NoError(t, err)
+	assert.NotEmpty(t, signed)
+
+	_, err = client.SignTransaction(ctx, &signer.Request{Reference: "batch-2", Tx: spendableTx(120000)})
+	assert.ErrorIs(t, err, signer.ErrPolicy)
+}
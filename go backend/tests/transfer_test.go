@@ -0,0 +1,114 @@
+package tests
+
+import (
+	"context"
+	"crypto-exchange-go/internal/config"
+	"crypto-exchange-go/internal/models"
+	"crypto-exchange-go/internal/services"
+	"crypto-exchange-go/pkg/logger"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testTransferRules() services.TransferRules {
+	return services.NewTransferRules(config.Transfer{
+		FiatCurrencies:    []string{"USD", "EUR"},
+		FuturesCurrencies: []string{"USDT"},
+	})
+}
+
+func TestTransferRulesWalletCurrencies(t *testing.T) {
+	rules := testTransferRules()
+
+	assert.True(t, rules.Holds(models.WalletTypeFiat, "usd"))
+	assert.False(t, rules.Holds(models.WalletTypeFiat, "BTC"))
+	assert.True(t, rules.Holds(models.WalletTypeSpot, "BTC"))
+	assert.False(t, rules.Holds(models.WalletTypeSpot, "EUR"))
+	assert.True(t, rules.Holds(models.WalletTypeFutures, "USDT"))
+	assert.False(t, rules.Holds(models.WalletTypeFutures, "BTC"))
+	assert.False(t, rules.Holds(models.WalletType("ECO"), "BTC"))
+}
+
+func TestTransferRulesValidate(t *testing.T) {
+	rules := testTransferRules()
+
+	tests := []struct {
+		name    string
+		req     models.CreateTransferRequest
+		allowed bool
+	}{
+		{"spot to futures margin", models.CreateTransferRequest{FromType: models.WalletTypeSpot, ToType: models.WalletTypeFutures, Currency: "USDT", Amount: decimal.NewFromInt(10)}, true},
+		{"futures back to spot", models.CreateTransferRequest{FromType: models.WalletTypeFutures, ToType: models.WalletTypeSpot, Currency: "USDT", Amount: decimal.NewFromInt(10)}, true},
+		{"same wallet type", models.CreateTransferRequest{FromType: models.WalletTypeSpot, ToType: models.WalletTypeSpot, Currency: "USDT", Amount: decimal.NewFromInt(10)}, false},
+		{"non-margin currency to futures", models.CreateTransferRequest{FromType: models.WalletTypeSpot, ToType: models.WalletTypeFutures, Currency: "BTC", Amount: decimal.NewFromInt(1)}, false},
+		{"fiat currency to spot", models.CreateTransferRequest{FromType: models.WalletTypeFiat, ToType: models.WalletTypeSpot, Currency: "USD", Amount: decimal.NewFromInt(10)}, false},
+		{"zero amount", models.CreateTransferRequest{FromType: models.WalletTypeSpot, ToType: models.WalletTypeFutures, Currency: "USDT", Amount: decimal.Zero}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := rules.Validate(&tt.req)
+			if tt.allowed {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, services.ErrTransferNotAllowed)
+			}
+		})
+	}
+}
+
+func TestUserTransferRecipientIsMasked(t *testing.T) {
+	recipient := models.NewUserTransferRecipient(&models.User{
+		FirstName: "Alice",
+		LastName:  "Walker",
+		Email:     "alice@example.com",
+	})
+
+	assert.Equal(t, "Alice W.", recipient.Name)
+	assert.Equal(t, "a***@example.com", recipient.Email)
+}
+
+func TestUserTransferReplayMustMatch(t *testing.T) {
+	db, walletService, _ := setupBalanceServices(t)
+	senderID, _ := fundedWallet(t, walletService, decimal.NewFromInt(100))
+	ctx := context.Background()
+
+	recipients := make([]uuid.UUID, 2)
+	for i := range recipients {
+		recipients[i] = uuid.New()
+		_, err := db.Exec(`INSERT INTO user (id, email, firstName, lastName, status, emailVerified, createdAt, updatedAt)
+				VALUES (?, ?, 'Test', 'User', 'ACTIVE', TRUE, NOW(), NOW())`, recipients[i], recipients[i].String()+"@example.com")
+		require.NoError(t, err)
+	}
+
+	log := logger.New("error")
+	transferService := services.NewTransferService(db, walletService, services.NewUserService(db, log), services.NewNotificationService(db, log),
+		config.Transfer{UserDailyLimits: map[string]float64{"usdt": 1000}, UserOTPThresholds: map[string]float64{"usdt": 500}}, log)
+
+	send := func(recipient uuid.UUID, amount int64) (*models.UserTransferResponse, error) {
+		return transferService.SendToUser(ctx, senderID, &models.UserTransferRequest{
+			Recipient: recipient.String(),
+			Currency:  "USDT",
+			Amount:    decimal.NewFromInt(amount),
+		}, "transfer-1")
+	}
+
+	sent, err := send(recipients[0], 10)
+	require.NoError(t, err)
+
+	replayed, err := send(recipients[0], 10)
+	require.NoError(t, err)
+	assert.Equal(t, sent.ID, replayed.ID)
+	assert.Equal(t, recipients[0], replayed.Recipient.ID)
+
+	_, err = send(recipients[1], 10)
+	assert.ErrorIs(t, err, services.ErrTransferKeyReused)
+	_, err = send(recipients[0], 11)
+	assert.ErrorIs(t, err, services.ErrTransferKeyReused)
+
+	assertWalletMatchesLedger(t, walletService, senderID, "90", "0")
+}
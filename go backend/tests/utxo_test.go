@@ -0,0 +1,140 @@
+package tests
+
+import (
+	"context"
+	"crypto-exchange-go/internal/utxo"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const masterAddress = "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"
+
+func testCoin(n int, value int64) utxo.Coin {
+	return utxo.Coin{TxID: fmt.Sprintf("%064x", n), Index: uint32(n), Value: value}
+}
+
+func TestOutputScripts(t *testing.T) {
+	btc, ok := utxo.ChainByName("btc")
+	require.True(t, ok)
+
+	script, err := btc.Script(masterAddress)
+	require.NoError(t, err)
+	assert.Equal(t, "0014751e76e8199196d454941c45d1b3a323f1433bd6", hex.EncodeToString(script))
+
+	script, err = btc.Script("1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2")
+	require.NoError(t, err)
+	assert.Len(t, script, 25)
+	assert.True(t, strings.HasPrefix(hex.EncodeToString(script), "76a914"))
+
+	script, err = btc.Script("3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy")
+	require.NoError(t, err)
+	assert.Len(t, script, 23)
+	assert.True(t, strings.HasPrefix(hex.EncodeToString(script), "a914"))
+
+	_, err = btc.Script("LM2WMpR1Rp6j3Sa59cMXMs1SPzj9eXpGc1")
+	assert.Error(t, err, "a Litecoin address isn't a Bitcoin one")
+}
+
+func TestSelectCoins(t *testing.T) {
+	coins := []utxo.Coin{testCoin(1, 200000), testCoin(2, 70000), testCoin(3, 30068), testCoin(4, 20110)}
+
+	// At 1 sat/vB a one output transaction costs 42 plus 68 per input, so
+	// the two small coins pay 50000 exactly and need no change.
+	selection, err := utxo.SelectCoins(coins, 50000, 1, 1, 546)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []utxo.Coin{coins[2], coins[3]}, selection.Coins)
+	assert.Equal(t, int64(0), selection.Change)
+	assert.Equal(t, int64(178), selection.Fee)
+
+	// Nothing fits 60000 without change, so the largest coin pays and the
+	// rest comes back.
+	selection, err = utxo.SelectCoins(coins, 60000, 1, 1, 546)
+	require.NoError(t, err)
+	assert.Equal(t, []utxo.Coin{coins[0]}, selection.Coins)
+	assert.Equal(t, int64(11+31*2+68), selection.Fee)
+	assert.Equal(t, int64(200000-60000-141), selection.Change)
+
+	_, err = utxo.SelectCoins(coins, 320000, 1, 1, 546)
+	assert.ErrorIs(t, err, utxo.ErrInsufficientFunds)
+
+	// A coin worth less than spending it costs is never picked.
+	_, err = utxo.SelectCoins([]utxo.Coin{testCoin(5, 600)}, 100, 1, 10, 546)
+	assert.ErrorIs(t, err, utxo.ErrInsufficientFunds)
+}
+
+func TestBatcherReservesCoinsAndWithdrawals(t *testing.T) {
+	ctx := context.Background()
+	btc, _ := utxo.ChainByName("BTC")
+	ledger := utxo.NewSimulatedLedger(masterAddress)
+	batcher := utxo.NewBatcher(btc, ledger, utxo.BatcherOptions{FeeRate: 10}, logrus.New())
+
+	batch, err := batcher.Run(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, batch, "nothing to send")
+
+	ledger.AddCoin(testCoin(1, 100000))
+	ledger.AddCoin(testCoin(2, 60000))
+	ledger.AddPayment(utxo.Payment{WithdrawalID: "w1", Address: "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2", Value: 50000})
+	ledger.AddPayment(utxo.Payment{WithdrawalID: "w2", Address: "3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy", Value: 40000})
+	ledger.AddPayment(utxo.Payment{WithdrawalID: "w3", Address: "bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0", Value: 80000})
+	ledger.AddPayment(utxo.Payment{WithdrawalID: "dust", Address: "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2", Value: 100})
+
+	// All three don't fit in 160000, so the newest waits.
+	batch, err = batcher.Run(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, batch)
+	require.Len(t, batch.Payments, 2)
+	assert.Equal(t, "w1", batch.Payments[0].WithdrawalID)
+	assert.Equal(t, "w2", batch.Payments[1].WithdrawalID)
+	require.Len(t, batch.Tx.Inputs, 1)
+	assert.Equal(t, int64(100000), batch.Tx.Inputs[0].Value)
+
+	require.Len(t, batch.Tx.Outputs, 3)
+	change := batch.Tx.Outputs[2]
+	assert.Equal(t, masterAddress, change.Address)
+	assert.Equal(t, int64(100000-90000), change.Value+batch.Tx.Fee)
+	assert.Equal(t, int64((11+3*31+68)*10), batch.Tx.Fee)
+
+	raw, err := hex.DecodeString(batch.Raw)
+	require.NoError(t, err)
+	assert.Equal(t, "0200000001", hex.EncodeToString(raw[:5]), "version 2, one input")
+	assert.Contains(t, batch.Raw, "160014751e76e8199196d454941c45d1b3a323f1433bd6", "change pays the master wallet")
+
+	assert.ErrorIs(t, ledger.Reserve(ctx, batch), utxo.ErrAlreadyReserved)
+
+	// The waiting withdrawal can't be paid from the coin that's left...
+	_, err = batcher.Run(ctx)
+	assert.ErrorIs(t, err, utxo.ErrInsufficientFunds)
+
+	// ...until another one arrives.
+	ledger.AddCoin(testCoin(3, 50000))
+	batch, err = batcher.Run(ctx)
+	require.NoError(t, err)
+	require.Len(t, batch.Payments, 1)
+	assert.Equal(t, "w3", batch.Payments[0].WithdrawalID)
+	assert.Len(t, batch.Tx.Inputs, 2)
+
+	var spent int64
+	for _, b := range ledger.Batches() {
+		var in, out int64
+		for _, coin := range b.Tx.Inputs {
+			in += coin.Value
+		}
+		for _, output := range b.Tx.Outputs {
+			out += output.Value
+		}
+		assert.Equal(t, in, out+b.Tx.Fee, "batch %s balances", b.ID)
+		spent += in
+	}
+	assert.Equal(t, int64(210000), spent)
+
+	batch, err = batcher.Run(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, batch, "only the dust withdrawal is left and it is skipped")
+}
@@ -0,0 +1,58 @@
+package tests
+
+import (
+	"crypto-exchange-go/internal/models"
+	"crypto-exchange-go/internal/services"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPriceGraphRoutesThroughCrossPairs(t *testing.T) {
+	graph := services.NewPriceGraph(map[string]decimal.Decimal{
+		"BTC/USDT": decimal.NewFromInt(60000),
+		"ETH/BTC":  decimal.RequireFromString("0.05"),
+		"XRP/ETH":  decimal.RequireFromString("0.0002"),
+	})
+
+	rate, ok := graph.Rate("BTC", "USDT")
+	require.True(t, ok)
+	assert.True(t, rate.Equal(decimal.NewFromInt(60000)))
+
+	rate, ok = graph.Rate("XRP", "USDT")
+	require.True(t, ok)
+	assert.True(t, rate.Equal(decimal.RequireFromString("0.6")), "got %s", rate)
+
+	rate, ok = graph.Rate("USDT", "BTC")
+	require.True(t, ok)
+	assert.True(t, rate.Mul(decimal.NewFromInt(60000)).Round(8).Equal(decimal.NewFromInt(1)))
+
+	_, ok = graph.Rate("DOGE", "USDT")
+	assert.False(t, ok)
+}
+
+func TestPriceGraphPeggedCurrency(t *testing.T) {
+	graph := services.NewPriceGraph(nil)
+	graph.AddRate("USD", "USDT", decimal.NewFromInt(1))
+
+	rate, ok := graph.Rate("usd", "USDT")
+	require.True(t, ok)
+	assert.True(t, rate.Equal(decimal.NewFromInt(1)))
+}
+
+func TestFillPortfolioPnLExcludesNetFlows(t *testing.T) {
+	points := []*models.PortfolioPoint{
+		{Value: decimal.NewFromInt(1000)},
+		{Value: decimal.NewFromInt(1600), NetFlow: decimal.NewFromInt(500)},
+		{Value: decimal.NewFromInt(1500)},
+	}
+
+	services.FillPortfolioPnL(points)
+
+	assert.True(t, points[0].PnL.IsZero())
+	assert.True(t, points[1].PnL.Equal(decimal.NewFromInt(100)))
+	assert.True(t, points[2].PnL.Equal(decimal.NewFromInt(-100)))
+	assert.True(t, points[2].CumulativePnL.IsZero())
+}
@@ -0,0 +1,62 @@
+package tests
+
+import (
+	"context"
+	"crypto-exchange-go/internal/config"
+	"crypto-exchange-go/internal/database"
+	"crypto-exchange-go/internal/handlers"
+	"crypto-exchange-go/internal/services"
+	"crypto-exchange-go/pkg/logger"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// Needs Redis; skips when it isn't reachable.
+func TestGatewayRelaysOrderRequests(t *testing.T) {
+	redisClient, err := database.NewRedis(config.Redis{Host: "localhost", Port: 6379, DB: 1})
+	if err != nil {
+		t.Skipf("Redis not available: %v", err)
+	}
+
+	log := logger.New("error")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hub := handlers.NewWebSocketHub(config.WebSocket{}, log)
+	gateway := handlers.NewWebSocketGateway("test-"+uuid.New().String()[:8], hub, redisClient, services.NewPresenceService(redisClient, log), log)
+	go gateway.Run(ctx)
+
+	// Two API processes share the shards between them. Waiting for them to
+	// stop lets them give their leases back for the next run.
+	var workers sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			handlers.NewOrderRequestWorker(nil, redisClient, log).Run(ctx)
+		}()
+	}
+	defer func() {
+		cancel()
+		workers.Wait()
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	// Both requests fail validation in the worker, before any order is
+	// touched, and the errors come back to the gateway.
+	_, err = gateway.ExecuteOrder(ctx, uuid.New(), &handlers.WebSocketMessage{Type: "placeOrder"})
+	assert.EqualError(t, err, "data is required")
+
+	_, err = gateway.ExecuteOrder(ctx, uuid.New(), &handlers.WebSocketMessage{Type: "closePosition"})
+	assert.EqualError(t, err, "unknown message type: closePosition")
+
+	// Whichever worker holds a user's shard answers.
+	for i := 0; i < 8; i++ {
+		_, err = gateway.ExecuteOrder(ctx, uuid.New(), &handlers.WebSocketMessage{Type: "placeOrder"})
+		assert.EqualError(t, err, "data is required")
+	}
+}
@@ -0,0 +1,24 @@
+package tests
+
+import (
+	"crypto-exchange-go/internal/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithdrawalAddressUsable(t *testing.T) {
+	now := time.Now()
+	confirmed := now.Add(-time.Hour)
+
+	address := &models.WithdrawalAddress{UsableAt: now.Add(-time.Minute)}
+	assert.False(t, address.Usable(now), "not confirmed")
+
+	address.ConfirmedAt = &confirmed
+	assert.True(t, address.Usable(now))
+
+	address.UsableAt = now.Add(23 * time.Hour)
+	assert.False(t, address.Usable(now), "cooling period not over")
+	assert.True(t, address.Usable(address.UsableAt))
+}
@@ -0,0 +1,73 @@
+package tests
+
+import (
+	"context"
+	"crypto-exchange-go/internal/config"
+	"crypto-exchange-go/internal/services"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithdrawalFeeQuote(t *testing.T) {
+	cfg := config.Withdrawal{
+		Fees: map[string]config.WithdrawalFee{
+			"usdt":      {Flat: 1, MinAmount: 10},
+			"usdt:tron": {Flat: 0.5, MinAmount: 5},
+			"btc":       {Percent: 0.1, MinAmount: 0.001, Dynamic: true},
+		},
+	}
+	fees := services.NewWithdrawalFees(cfg, services.NewStaticFeeEstimator(map[string]float64{"btc": 0.0001}))
+	ctx := context.Background()
+
+	quote := func(currency, network, amount string) decimal.Decimal {
+		fee, err := fees.Quote(ctx, currency, network, decimal.RequireFromString(amount))
+		require.NoError(t, err)
+		return fee
+	}
+
+	assert.Equal(t, "1", quote("USDT", "ETH", "100").String())
+	assert.Equal(t, "0.5", quote("USDT", "TRON", "100").String(), "network specific fee")
+	assert.Equal(t, "0.0011", quote("BTC", "BTC", "1").String(), "percentage plus network fee")
+
+	_, err := fees.Quote(ctx, "USDT", "ETH", decimal.RequireFromString("9.99"))
+	assert.ErrorIs(t, err, services.ErrBelowWithdrawalMinimum)
+	_, err = fees.Quote(ctx, "USDT", "TRON", decimal.RequireFromString("5"))
+	assert.NoError(t, err)
+	_, err = fees.Quote(ctx, "DOGE", "DOGE", decimal.Zero)
+	assert.ErrorIs(t, err, services.ErrBelowWithdrawalMinimum)
+	_, err = fees.Quote(ctx, "DOGE", "DOGE", decimal.NewFromInt(100))
+	assert.ErrorIs(t, err, services.ErrWithdrawalFeeNotConfigured, "not in the schedule")
+
+	cfg.Fees["default"] = config.WithdrawalFee{Flat: 2, MinAmount: 20}
+	fees = services.NewWithdrawalFees(cfg, nil)
+	assert.Equal(t, "2", quote("DOGE", "DOGE", "100").String(), "default entry")
+	_, err = fees.Quote(ctx, "DOGE", "DOGE", decimal.NewFromInt(10))
+	assert.ErrorIs(t, err, services.ErrBelowWithdrawalMinimum)
+}
+
+func TestWithdrawalLimitTiers(t *testing.T) {
+	limits := services.NewWithdrawalLimits(config.Withdrawal{
+		LimitTiers: []config.WithdrawalLimitTier{
+			{KYCLevel: 2, Daily: 50000, Monthly: 500000},
+			{KYCLevel: 1, Daily: 5000, Monthly: 50000},
+		},
+	})
+
+	daily, monthly, limited := limits.For(0)
+	assert.True(t, limited)
+	assert.True(t, daily.IsZero(), "below every tier")
+	assert.True(t, monthly.IsZero())
+
+	daily, monthly, _ = limits.For(1)
+	assert.Equal(t, "5000", daily.String())
+	assert.Equal(t, "50000", monthly.String())
+
+	daily, _, _ = limits.For(3)
+	assert.Equal(t, "50000", daily.String())
+
+	_, _, limited = services.NewWithdrawalLimits(config.Withdrawal{}).For(0)
+	assert.False(t, limited)
+}
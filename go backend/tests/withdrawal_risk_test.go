@@ -0,0 +1,55 @@
+package tests
+
+import (
+	"crypto-exchange-go/internal/config"
+	"crypto-exchange-go/internal/services"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func withdrawalRules() services.WithdrawalRules {
+	return services.NewWithdrawalRules(config.Withdrawal{
+		AutoApproveLimits:   map[string]float64{"usdt": 1000},
+		AutoApproveKYCLevel: 2,
+		AutoApproveMaxRisk:  20,
+	})
+}
+
+func TestWithdrawalRiskScore(t *testing.T) {
+	rules := withdrawalRules()
+
+	score, factors := rules.Score(services.WithdrawalSignals{})
+	assert.Zero(t, score)
+	assert.Empty(t, factors)
+
+	score, factors = rules.Score(services.WithdrawalSignals{
+		NewDevice:            true,
+		RecentPasswordChange: true,
+		FirstToAddress:       true,
+	})
+	assert.Equal(t, 115, score)
+	assert.Equal(t, []string{
+		services.RiskNewDevice,
+		services.RiskRecentPasswordChange,
+		services.RiskFirstWithdrawalToAddress,
+	}, factors)
+}
+
+func TestWithdrawalAutoApproval(t *testing.T) {
+	rules := withdrawalRules()
+	trusted := services.WithdrawalSignals{Whitelisted: true, KYCLevel: 2}
+	small := decimal.RequireFromString("250")
+
+	assert.True(t, rules.AutoApprove("USDT", small, trusted, 0))
+	assert.True(t, rules.AutoApprove("usdt", decimal.RequireFromString("1000"), trusted, 0))
+
+	assert.False(t, rules.AutoApprove("USDT", decimal.RequireFromString("1000.01"), trusted, 0), "over the limit")
+	assert.False(t, rules.AutoApprove("BTC", decimal.RequireFromString("0.001"), trusted, 0), "no limit for the currency")
+	assert.False(t, rules.AutoApprove("USDT", small, services.WithdrawalSignals{KYCLevel: 2}, 0), "address not whitelisted")
+	assert.False(t, rules.AutoApprove("USDT", small, services.WithdrawalSignals{Whitelisted: true, KYCLevel: 1}, 0), "KYC level too low")
+
+	score, _ := rules.Score(services.WithdrawalSignals{NewDevice: true})
+	assert.False(t, rules.AutoApprove("USDT", small, trusted, score), "risky")
+}
@@ -0,0 +1,35 @@
+package tests
+
+import (
+	"crypto-exchange-go/internal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithdrawalTransitions(t *testing.T) {
+	allowed := [][2]string{
+		{models.WithdrawalStatusPending, models.WithdrawalStatusApproved},
+		{models.WithdrawalStatusPending, models.WithdrawalStatusRejected},
+		{models.WithdrawalStatusPending, models.WithdrawalStatusCanceled},
+		{models.WithdrawalStatusApproved, models.WithdrawalStatusBroadcast},
+		{models.WithdrawalStatusApproved, models.WithdrawalStatusRejected},
+		{models.WithdrawalStatusBroadcast, models.WithdrawalStatusConfirmed},
+		{models.WithdrawalStatusBroadcast, models.WithdrawalStatusFailed},
+	}
+	for _, move := range allowed {
+		assert.True(t, models.CanTransitionWithdrawal(move[0], move[1]), "%s -> %s", move[0], move[1])
+	}
+
+	refused := [][2]string{
+		{models.WithdrawalStatusApproved, models.WithdrawalStatusCanceled},
+		{models.WithdrawalStatusPending, models.WithdrawalStatusBroadcast},
+		{models.WithdrawalStatusBroadcast, models.WithdrawalStatusRejected},
+		{models.WithdrawalStatusConfirmed, models.WithdrawalStatusFailed},
+		{models.WithdrawalStatusCanceled, models.WithdrawalStatusApproved},
+		{models.WithdrawalStatusFailed, models.WithdrawalStatusBroadcast},
+	}
+	for _, move := range refused {
+		assert.False(t, models.CanTransitionWithdrawal(move[0], move[1]), "%s -> %s", move[0], move[1])
+	}
+}